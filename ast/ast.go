@@ -4,6 +4,8 @@ package ast
 
 import (
 	"encoding/json"
+	"maps"
+	"regexp"
 )
 
 // NodeType represents the type of a node in the AST
@@ -165,6 +167,15 @@ func (r *Rewrite) ToMap() map[string]any {
 type Token struct {
 	Wrap     Node      `json:"wrap"`
 	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// Shorthand marks a token that carried its term attributes directly
+	// instead of in a wrap. It is serialized back to that form as long as
+	// it wraps a single term.
+	Shorthand bool `json:"-"`
+
+	// Extra holds fields of the token not known to the parser, e.g.
+	// custom annotations, which are serialized back unchanged.
+	Extra map[string]any `json:"-"`
 }
 
 func (t *Token) Type() NodeType {
@@ -178,7 +189,9 @@ func (t *Token) Clone() Node {
 		clonedWrap = t.Wrap.Clone()
 	}
 	tc := &Token{
-		Wrap: clonedWrap,
+		Wrap:      clonedWrap,
+		Shorthand: t.Shorthand,
+		Extra:     maps.Clone(t.Extra),
 	}
 
 	if t.Rewrites != nil {
@@ -232,6 +245,22 @@ type Term struct {
 	Match    MatchType `json:"match"`
 	Value    string    `json:"value,omitempty"`
 	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// Regex marks a key given as regular expression, "type:regex" in
+	// KoralQuery. KeyRegexp holds the compiled key, anchored at both
+	// ends, for regex terms of mapping rules.
+	Regex     bool           `json:"-"`
+	KeyRegexp *regexp.Regexp `json:"-"`
+}
+
+// MatchesKey reports whether key satisfies the key of the term: a regex
+// term with a compiled key matches keys the expression matches, any
+// other term only its own key.
+func (t *Term) MatchesKey(key string) bool {
+	if t.Regex && t.KeyRegexp != nil {
+		return t.KeyRegexp.MatchString(key)
+	}
+	return t.Key == key
 }
 
 func (t *Term) Type() NodeType {
@@ -242,11 +271,13 @@ func (t *Term) Type() NodeType {
 func (t *Term) Clone() Node {
 
 	tc := &Term{
-		Foundry: t.Foundry,
-		Key:     t.Key,
-		Layer:   t.Layer,
-		Match:   t.Match,
-		Value:   t.Value,
+		Foundry:   t.Foundry,
+		Key:       t.Key,
+		Layer:     t.Layer,
+		Match:     t.Match,
+		Value:     t.Value,
+		Regex:     t.Regex,
+		KeyRegexp: t.KeyRegexp,
 	}
 
 	if t.Rewrites != nil {
@@ -339,6 +370,40 @@ func ApplyFoundryAndLayerOverrides(node Node, foundry, layer string) {
 	}
 }
 
+// RenameFoundriesAndLayers renames the foundries and layers of all terms
+// by their current value. Renamed values are not renamed again, so the
+// maps may swap names.
+func RenameFoundriesAndLayers(node Node, foundries, layers map[string]string) {
+	if node == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Term:
+		if foundry, ok := foundries[n.Foundry]; ok {
+			n.Foundry = foundry
+		}
+		if layer, ok := layers[n.Layer]; ok {
+			n.Layer = layer
+		}
+	case *TermGroup:
+		for _, op := range n.Operands {
+			RenameFoundriesAndLayers(op, foundries, layers)
+		}
+	case *Token:
+		if n.Wrap != nil {
+			RenameFoundriesAndLayers(n.Wrap, foundries, layers)
+		}
+	case *CatchallNode:
+		if n.Wrap != nil {
+			RenameFoundriesAndLayers(n.Wrap, foundries, layers)
+		}
+		for _, op := range n.Operands {
+			RenameFoundriesAndLayers(op, foundries, layers)
+		}
+	}
+}
+
 // ApplyFoundryAndLayerOverridesWithPrecedence applies foundry and layer overrides while respecting precedence:
 // 1. Mapping rule foundry/layer (highest priority - don't override if already set)
 // 2. Passed overwrite foundry/layer (from MappingOptions)
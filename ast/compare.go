@@ -21,7 +21,8 @@ func NodesEqual(a, b Node) bool {
 				n1.Key == n2.Key &&
 				n1.Layer == n2.Layer &&
 				n1.Match == n2.Match &&
-				n1.Value == n2.Value
+				n1.Value == n2.Value &&
+				n1.Regex == n2.Regex
 		}
 	case *TermGroup:
 		if n2, ok := b.(*TermGroup); ok {
@@ -0,0 +1,191 @@
+// Package client provides a client for the HTTP API of the Koral-Mapper
+// service.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Errors matched by the errors returned for failed requests
+var (
+	ErrBadRequest = errors.New("bad request")
+	ErrNotFound   = errors.New("not found")
+	ErrServer     = errors.New("server error")
+)
+
+// Error is returned for requests the service answers with an error
+// status. It matches ErrBadRequest for HTTP 400, ErrNotFound for
+// HTTP 404 and ErrServer for HTTP 5xx with errors.Is.
+type Error struct {
+	StatusCode int    // HTTP status code of the response
+	Message    string // error message reported by the service
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("koral-mapper: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("koral-mapper: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Is reports whether the error belongs to the class of target.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// Options holds the parameters of a single mapping list transformation.
+// Empty fields leave the defaults of the mapping list unchanged.
+type Options struct {
+	Dir      string // "atob" or "btoa"
+	FoundryA string
+	FoundryB string
+	LayerA   string
+	LayerB   string
+	Rewrites *bool // overrides the rewrites setting of the service, if set
+}
+
+// Encode returns the options as a URL query string.
+func (o Options) Encode() string {
+	params := url.Values{}
+	if o.Dir != "" {
+		params.Add("dir", o.Dir)
+	}
+	if o.FoundryA != "" {
+		params.Add("foundryA", o.FoundryA)
+	}
+	if o.FoundryB != "" {
+		params.Add("foundryB", o.FoundryB)
+	}
+	if o.LayerA != "" {
+		params.Add("layerA", o.LayerA)
+	}
+	if o.LayerB != "" {
+		params.Add("layerB", o.LayerB)
+	}
+	if o.Rewrites != nil {
+		params.Add("rewrites", strconv.FormatBool(*o.Rewrites))
+	}
+	return params.Encode()
+}
+
+// Client calls the endpoints of a Koral-Mapper service.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+// (default: http.DefaultClient).
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New creates a client for the service at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    baseURL,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Query transforms a KoralQuery request with the mapping list mapID.
+func (c *Client) Query(mapID string, opts Options, koral any) (any, error) {
+	return c.post(opts.Encode(), koral, url.PathEscape(mapID), "query")
+}
+
+// Response transforms a KoralQuery response with the mapping list mapID.
+func (c *Client) Response(mapID string, opts Options, koral any) (any, error) {
+	return c.post(opts.Encode(), koral, url.PathEscape(mapID), "response")
+}
+
+// Cascade transforms a KoralQuery request with the cascade of mapping
+// lists given by cfg, in the format of the "/query/:cfg" endpoint.
+func (c *Client) Cascade(cfg string, koral any) (any, error) {
+	return c.post("", koral, "query", escapeCfg(cfg))
+}
+
+// CascadeResponse transforms a KoralQuery response with the cascade of
+// mapping lists given by cfg.
+func (c *Client) CascadeResponse(cfg string, koral any) (any, error) {
+	return c.post("", koral, "response", escapeCfg(cfg))
+}
+
+// escapeCfg escapes a cfg path segment, keeping the entry separators
+// readable as the Kalamar plugin does.
+func escapeCfg(cfg string) string {
+	return strings.ReplaceAll(url.PathEscape(cfg), "%3B", ";")
+}
+
+// post sends koral as JSON to the endpoint given by the escaped path
+// segments and decodes the JSON result.
+func (c *Client) post(query string, koral any, segments ...string) (any, error) {
+	endpoint, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	escaped := path.Join(append([]string{endpoint.EscapedPath(), "/"}, segments...)...)
+	endpoint, err = endpoint.Parse(escaped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request path: %w", err)
+	}
+	endpoint.RawQuery = query
+
+	body, err := json.Marshal(koral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	resp, err := c.httpClient.Post(endpoint.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, &errBody) == nil {
+			apiErr.Message = errBody.Error
+		}
+		return nil, apiErr
+	}
+
+	var result any
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsEncode(t *testing.T) {
+	rewrites := false
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{name: "empty", opts: Options{}, expected: ""},
+		{name: "direction only", opts: Options{Dir: "atob"}, expected: "dir=atob"},
+		{
+			name:     "all fields",
+			opts:     Options{Dir: "btoa", FoundryA: "opennlp", FoundryB: "upos", LayerA: "p", LayerB: "pos", Rewrites: &rewrites},
+			expected: "dir=btoa&foundryA=opennlp&foundryB=upos&layerA=p&layerB=pos&rewrites=false",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.opts.Encode())
+		})
+	}
+}
+
+func TestRequests(t *testing.T) {
+	var gotPath, gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotQuery = r.URL.RawQuery
+		var body any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	c := New(server.URL + "/mapper")
+	input := map[string]any{"@type": "koral:token"}
+
+	result, err := c.Query("my list", Options{Dir: "atob"}, input)
+	require.NoError(t, err)
+	assert.Equal(t, input, result)
+	assert.Equal(t, "/mapper/my%20list/query", gotPath)
+	assert.Equal(t, "dir=atob", gotQuery)
+
+	_, err = c.Response("stts", Options{}, input)
+	require.NoError(t, err)
+	assert.Equal(t, "/mapper/stts/response", gotPath)
+	assert.Empty(t, gotQuery)
+
+	_, err = c.Cascade("a:atob;b:btoa", input)
+	require.NoError(t, err)
+	assert.Equal(t, "/mapper/query/a:atob;b:btoa", gotPath)
+
+	_, err = c.CascadeResponse("a:atob", input)
+	require.NoError(t, err)
+	assert.Equal(t, "/mapper/response/a:atob", gotPath)
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		expected error
+		message  string
+	}{
+		{name: "bad request", status: http.StatusBadRequest, body: `{"error": "invalid direction"}`, expected: ErrBadRequest, message: "invalid direction"},
+		{name: "not found", status: http.StatusNotFound, body: `{"error": "mapping list not found"}`, expected: ErrNotFound, message: "mapping list not found"},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"error": "failed"}`, expected: ErrServer, message: "failed"},
+		{name: "unavailable", status: http.StatusServiceUnavailable, body: `{"error": "request timed out"}`, expected: ErrServer, message: "request timed out"},
+		{name: "non-JSON body", status: http.StatusBadGateway, body: `upstream down`, expected: ErrServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := New(server.URL).Query("test", Options{}, map[string]any{})
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.expected)
+
+			var apiErr *Error
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+			assert.Equal(t, tt.message, apiErr.Message)
+		})
+	}
+}
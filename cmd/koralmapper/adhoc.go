@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/gofiber/fiber/v3"
+)
+
+// adhocListID is the ID of the temporary mapping list of ad-hoc rules.
+const adhocListID = "adhoc"
+
+// handleAdhocQuery applies a single rule given in the "rule" query
+// parameter, without a configured mapping list. The rule is parsed into
+// a temporary one-rule list per request; "type=corpus" selects a corpus
+// rule.
+func handleAdhocQuery(yamlConfig *config.MappingConfig, metrics *transformMetrics) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		defer func() {
+			metrics.record("adhoc-query", nil, c.Response().StatusCode(), time.Since(start))
+		}()
+
+		rule := c.Query("rule", "")
+		if rule == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "missing rule parameter",
+			})
+		}
+		if len(rule) > limits.maxParamBytes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("rule too long (max %d bytes)", limits.maxParamBytes),
+			})
+		}
+
+		listType := c.Query("type", "")
+		if listType != "" && listType != "annotation" && listType != "corpus" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid type, must be 'annotation' or 'corpus'",
+			})
+		}
+
+		params, err := extractRequestParams(c, limits)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		params.MapID = adhocListID
+		params.Dir = effectiveDirection(params.Dir, nil)
+
+		jsonData, direction, err := parseRequestBody(c, params.Dir, yamlConfig)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		m, err := mapper.NewMapper([]config.MappingList{{
+			ID:       adhocListID,
+			Type:     listType,
+			Mappings: []config.MappingRule{config.MappingRule(rule)},
+		}}, mapperOptions(yamlConfig)...)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("invalid rule: %v", err),
+			})
+		}
+
+		addRewrites := yamlConfig.Rewrites
+		if params.Rewrites != nil {
+			addRewrites = *params.Rewrites
+		}
+
+		ctx, cancel := transformContext(c, yamlConfig)
+		defer cancel()
+
+		trace := requestTrace(c)
+		result, err := m.ApplyQueryMappingsContext(ctx, adhocListID, mapper.MappingOptions{
+			Direction:   direction,
+			FoundryA:    params.FoundryA,
+			FoundryB:    params.FoundryB,
+			LayerA:      params.LayerA,
+			LayerB:      params.LayerB,
+			AddRewrites: addRewrites,
+			Trace:       trace,
+		}, jsonData)
+		if err != nil {
+			requestLogger(c).Error().Err(err).
+				Str("rule", rule).
+				Str("direction", params.Dir).
+				Msg("Failed to apply ad-hoc rule")
+
+			return transformError(c, err)
+		}
+
+		reportTrace(c, trace)
+		return writeQueryResult(c, yamlConfig, result)
+	}
+}
@@ -34,7 +34,9 @@ type CascadeEntry struct {
 // or 6 fields (explicit values, empty means use default).
 // Corpus entries have either 2 fields (all field overrides use defaults)
 // or 4 fields (explicit values, empty means use default).
-func ParseCfgParam(raw string, lists []config.MappingList) ([]CascadeEntry, error) {
+// Mixed entries take either form. Entries of the passthrough ID, unless
+// a list has the same ID, have 2 fields and apply no rules.
+func ParseCfgParam(raw string, lists []config.MappingList, passthroughID string) ([]CascadeEntry, error) {
 	if raw == "" {
 		return nil, nil
 	}
@@ -62,17 +64,33 @@ func ParseCfgParam(raw string, lists []config.MappingList) ([]CascadeEntry, erro
 		}
 
 		list, ok := listsByID[id]
+		if !ok && id == passthroughID && passthroughID != "" {
+			if n != 2 {
+				return nil, fmt.Errorf("invalid passthrough entry %q: expected 2 colon-separated fields, got %d", part, n)
+			}
+			result = append(result, CascadeEntry{ID: id, Direction: dir})
+			continue
+		}
 		if !ok {
 			return nil, fmt.Errorf("unknown mapping ID %q", id)
 		}
-		isCorpus := list.IsCorpus()
-
-		if isCorpus {
+		// Mixed lists take the overrides of both kinds of lists
+		hasFields := list.IsCorpus() || list.IsMixed()
+		hasFoundries := !list.IsCorpus()
+
+		switch {
+		case list.IsMixed():
+			if n != 2 && n != 4 && n != 6 {
+				return nil, fmt.Errorf("invalid mixed entry %q: expected 2, 4 or 6 colon-separated fields, got %d", part, n)
+			}
+		case hasFields:
 			if n != 2 && n != 4 {
 				return nil, fmt.Errorf("invalid corpus entry %q: expected 2 or 4 colon-separated fields, got %d", part, n)
 			}
-		} else if n != 2 && n != 6 {
-			return nil, fmt.Errorf("invalid annotation entry %q: expected 2 or 6 colon-separated fields, got %d", part, n)
+		default:
+			if n != 2 && n != 6 {
+				return nil, fmt.Errorf("invalid annotation entry %q: expected 2 or 6 colon-separated fields, got %d", part, n)
+			}
 		}
 
 		ce := CascadeEntry{
@@ -80,7 +98,7 @@ func ParseCfgParam(raw string, lists []config.MappingList) ([]CascadeEntry, erro
 			Direction: dir,
 		}
 
-		if isCorpus {
+		if hasFields {
 			if n == 4 {
 				ce.FieldA = fields[2]
 				ce.FieldB = fields[3]
@@ -91,7 +109,8 @@ func ParseCfgParam(raw string, lists []config.MappingList) ([]CascadeEntry, erro
 			if ce.FieldB == "" {
 				ce.FieldB = list.FieldB
 			}
-		} else {
+		}
+		if hasFoundries {
 			if n == 6 {
 				ce.FoundryA = fields[2]
 				ce.LayerA = fields[3]
@@ -119,6 +138,23 @@ func ParseCfgParam(raw string, lists []config.MappingList) ([]CascadeEntry, erro
 	return result, nil
 }
 
+// resolveCascadeCfg returns the cfg string of a composite request. When a
+// pipeline name is given, the steps of the named pipeline from the
+// configuration are used; it cannot be combined with an explicit cfg.
+func resolveCascadeCfg(cfgRaw, pipelineName string, yamlConfig *config.MappingConfig) (string, error) {
+	if pipelineName == "" {
+		return cfgRaw, nil
+	}
+	if cfgRaw != "" {
+		return "", fmt.Errorf("cfg and pipeline cannot be combined")
+	}
+	pipeline := yamlConfig.FindPipeline(pipelineName)
+	if pipeline == nil {
+		return "", fmt.Errorf("unknown pipeline %q", pipelineName)
+	}
+	return pipeline.CfgString(), nil
+}
+
 // BuildCfgParam serialises a slice of CascadeEntry back to the compact
 // cfg string format. Entries with all override fields empty use the
 // short 2-field format (id:dir). Entries with any non-empty
@@ -16,13 +16,13 @@ func FuzzParseCfgParam(f *testing.F) {
 	f.Add("stts-upos:atob::::")
 
 	f.Fuzz(func(t *testing.T, raw string) {
-		parsed, err := ParseCfgParam(raw, cfgTestLists)
+		parsed, err := ParseCfgParam(raw, cfgTestLists, "passthrough")
 		if err != nil {
 			return
 		}
 
 		rebuilt := BuildCfgParam(parsed)
-		reparsed, err := ParseCfgParam(rebuilt, cfgTestLists)
+		reparsed, err := ParseCfgParam(rebuilt, cfgTestLists, "passthrough")
 		if err != nil {
 			t.Fatalf("reparse failed for rebuilt cfg %q from raw %q: %v", rebuilt, raw, err)
 		}
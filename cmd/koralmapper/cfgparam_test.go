@@ -32,6 +32,17 @@ var cfgTestLists = []tmconfig.MappingList{
 		FieldB:   "textClass",
 		Mappings: []tmconfig.MappingRule{"textClass=science <> textClass=akademisch"},
 	},
+	{
+		ID:       "mixed-map",
+		Type:     "mixed",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		FieldA:   "textClass",
+		FieldB:   "genre",
+		Mappings: []tmconfig.MappingRule{"[DET] <> [PRON]", "novel <> fiction"},
+	},
 }
 
 func TestParseCfgParam(t *testing.T) {
@@ -133,16 +144,67 @@ func TestParseCfgParam(t *testing.T) {
 				{ID: "corpus-map", Direction: "btoa", FieldA: "genre", FieldB: "topic"},
 			},
 		},
+		{
+			name: "Corpus mapping 4-field entry with partial override",
+			raw:  "corpus-map:atob::topic",
+			expected: []CascadeEntry{
+				{ID: "corpus-map", Direction: "atob", FieldA: "wikiCat", FieldB: "topic"},
+			},
+		},
+		{
+			name:    "Corpus mapping 6-field entry is invalid",
+			raw:     "corpus-map:atob:opennlp:p:upos:p",
+			wantErr: "invalid corpus entry",
+		},
 		{
 			name:    "Annotation mapping 4-field entry is invalid",
 			raw:     "stts-upos:atob:foo:bar",
 			wantErr: "invalid annotation entry",
 		},
+		{
+			name: "Mixed mapping 2-field entry uses all defaults",
+			raw:  "mixed-map:atob",
+			expected: []CascadeEntry{
+				{ID: "mixed-map", Direction: "atob", FoundryA: "opennlp", LayerA: "p", FoundryB: "upos", LayerB: "p", FieldA: "textClass", FieldB: "genre"},
+			},
+		},
+		{
+			name: "Mixed mapping 4-field entry overrides fields",
+			raw:  "mixed-map:atob:wikiCat:",
+			expected: []CascadeEntry{
+				{ID: "mixed-map", Direction: "atob", FoundryA: "opennlp", LayerA: "p", FoundryB: "upos", LayerB: "p", FieldA: "wikiCat", FieldB: "genre"},
+			},
+		},
+		{
+			name: "Mixed mapping 6-field entry overrides foundries and layers",
+			raw:  "mixed-map:btoa:stts:p::",
+			expected: []CascadeEntry{
+				{ID: "mixed-map", Direction: "btoa", FoundryA: "stts", LayerA: "p", FoundryB: "upos", LayerB: "p", FieldA: "textClass", FieldB: "genre"},
+			},
+		},
+		{
+			name:    "Mixed mapping 3-field entry is invalid",
+			raw:     "mixed-map:atob:x",
+			wantErr: "invalid mixed entry",
+		},
 		{
 			name:    "Invalid direction",
 			raw:     "stts-upos:invalid",
 			wantErr: "invalid direction",
 		},
+		{
+			name: "Passthrough entry",
+			raw:  "stts-upos:atob;passthrough:atob",
+			expected: []CascadeEntry{
+				{ID: "stts-upos", Direction: "atob", FoundryA: "opennlp", LayerA: "p", FoundryB: "upos", LayerB: "p"},
+				{ID: "passthrough", Direction: "atob"},
+			},
+		},
+		{
+			name:    "Passthrough entry with overrides is invalid",
+			raw:     "passthrough:atob:opennlp:p:upos:p",
+			wantErr: "invalid passthrough entry",
+		},
 		{
 			name: "Three entries with mixed types",
 			raw:  "stts-upos:atob;corpus-map:atob;other-mapper:btoa",
@@ -156,7 +218,7 @@ func TestParseCfgParam(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ParseCfgParam(tt.raw, cfgTestLists)
+			result, err := ParseCfgParam(tt.raw, cfgTestLists, "passthrough")
 			if tt.wantErr != "" {
 				require.Error(t, err)
 				assert.Contains(t, err.Error(), tt.wantErr)
@@ -240,7 +302,7 @@ func TestBuildCfgParam(t *testing.T) {
 
 func TestBuildAndParseCfgParamRoundTrip(t *testing.T) {
 	original := "stts-upos:atob:opennlp:p:upos:p;corpus-map:btoa:wikiCat:textClass"
-	entries, err := ParseCfgParam(original, cfgTestLists)
+	entries, err := ParseCfgParam(original, cfgTestLists, "passthrough")
 	require.NoError(t, err)
 
 	rebuilt := BuildCfgParam(entries)
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+// configMapping describes a mapping list for GET /config.json.
+type configMapping struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Description string `json:"desc,omitempty"`
+	FoundryA    string `json:"foundryA,omitempty"`
+	LayerA      string `json:"layerA,omitempty"`
+	FoundryB    string `json:"foundryB,omitempty"`
+	LayerB      string `json:"layerB,omitempty"`
+	FieldA      string `json:"fieldA,omitempty"`
+	FieldB      string `json:"fieldB,omitempty"`
+}
+
+// configJSON is the data of the configuration page as JSON.
+type configJSON struct {
+	Title              string          `json:"title"`
+	Version            string          `json:"version"`
+	Description        string          `json:"description"`
+	Server             string          `json:"server"`
+	SDK                string          `json:"sdk"`
+	ServiceURL         string          `json:"serviceURL"`
+	CookieName         string          `json:"cookieName"`
+	AnnotationMappings []configMapping `json:"annotationMappings"`
+	CorpusMappings     []configMapping `json:"corpusMappings"`
+}
+
+// handleConfigJSON returns the data of the configuration page (GET /)
+// as JSON, for front-ends rendering the page themselves.
+func handleConfigJSON(yamlConfig *config.MappingConfig) fiber.Handler {
+	data := buildConfigPageData(yamlConfig)
+	result := configJSON{
+		Title:              data.Title,
+		Version:            data.Version,
+		Description:        data.Description,
+		Server:             data.Server,
+		SDK:                data.SDK,
+		ServiceURL:         data.ServiceURL,
+		CookieName:         data.CookieName,
+		AnnotationMappings: toConfigMappings(data.AnnotationMappings),
+		CorpusMappings:     toConfigMappings(data.CorpusMappings),
+	}
+
+	return func(c fiber.Ctx) error {
+		return c.JSON(result)
+	}
+}
+
+// toConfigMappings converts the mapping lists of the configuration page,
+// returning an empty slice rather than nil for no lists.
+func toConfigMappings(lists []config.MappingList) []configMapping {
+	mappings := make([]configMapping, 0, len(lists))
+	for _, list := range lists {
+		mappings = append(mappings, configMapping{
+			ID:          list.ID,
+			Type:        list.Type,
+			Description: list.Description,
+			FoundryA:    list.FoundryA,
+			LayerA:      list.LayerA,
+			FoundryB:    list.FoundryB,
+			LayerB:      list.LayerB,
+			FieldA:      list.FieldA,
+			FieldB:      list.FieldB,
+		})
+	}
+	return mappings
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/gofiber/fiber/v3"
+)
+
+// Debug headers reporting the rules applied by a transformation
+const (
+	headerApplied      = "X-Koral-Mapper-Applied"
+	headerAppliedCount = "X-Koral-Mapper-Applied-Count"
+)
+
+// headerMatched is set to "false" on responses to requests with
+// "requireMatch=true" to which no rule applied.
+const headerMatched = "X-Koral-Mapper-Matched"
+
+// headerSkipped lists the mapping lists of the cascade steps skipped
+// because they failed, on requests with "continueOnError=true".
+const headerSkipped = "X-Koral-Mapper-Skipped"
+
+// reportSkippedSteps logs the failed steps of a cascade skipped with
+// "continueOnError=true" and lists them in headerSkipped. It returns
+// nil for such errors and any other error unchanged.
+func reportSkippedSteps(c fiber.Ctx, err error) error {
+	var skipped *mapper.SkippedStepsError
+	if !errors.As(err, &skipped) {
+		return err
+	}
+	ids := make([]string, len(skipped.Steps))
+	for i, step := range skipped.Steps {
+		requestLogger(c).Warn().Err(step.Err).
+			Int("step", step.Step).
+			Str("mapID", step.MappingID).
+			Msg("Skipped failed cascade step")
+		ids[i] = step.MappingID
+	}
+	c.Set(headerSkipped, strings.Join(ids, ", "))
+	return nil
+}
+
+// requestTrace returns a trace collecting the applied rules if the
+// request asks for debug headers with "debugHeaders=true" or requires a
+// match with "requireMatch=true", or nil otherwise.
+func requestTrace(c fiber.Ctx) *mapper.Trace {
+	if c.Query("debugHeaders", "") != "true" && c.Query("requireMatch", "") != "true" {
+		return nil
+	}
+	return &mapper.Trace{}
+}
+
+// reportTrace reports the rules collected by trace as the request asks
+// for, without changing the body. With "requireMatch=true", a response
+// to which no rule applied gets HTTP 422 and headerMatched "false".
+func reportTrace(c fiber.Ctx, trace *mapper.Trace) {
+	if trace == nil {
+		return
+	}
+	if c.Query("debugHeaders", "") == "true" {
+		setDebugHeaders(c, trace.Applied())
+	}
+	if c.Query("requireMatch", "") == "true" && len(trace.Applied()) == 0 {
+		c.Status(fiber.StatusUnprocessableEntity)
+		c.Set(headerMatched, "false")
+	}
+}
+
+// setDebugHeaders reports the applied rules in the response headers. The
+// applied header lists the rules in the order they were applied as
+// "list:index", followed by the rule ID in parentheses for rules that
+// have one.
+func setDebugHeaders(c fiber.Ctx, applied []mapper.AppliedRule) {
+	entries := make([]string, len(applied))
+	for i, rule := range applied {
+		entries[i] = rule.List + ":" + strconv.Itoa(rule.Index)
+		if rule.ID != "" {
+			entries[i] += " (" + rule.ID + ")"
+		}
+	}
+	c.Set(headerAppliedCount, strconv.Itoa(len(applied)))
+	if len(entries) > 0 {
+		c.Set(headerApplied, strings.Join(entries, ", "))
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/KorAP/Koral-Mapper/ast"
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/parser"
+)
+
+// diffRule is a rule of a mapping list compared by runDiff.
+type diffRule struct {
+	Label  string
+	ID     string
+	Text   string
+	Parsed any // *parser.MappingResult or *parser.CorpusMappingResult
+}
+
+// runDiff loads two configurations and writes the mapping lists and
+// rules added, removed and changed from the old to the new one to w.
+// Rules are compared by their parsed form, with the default foundries
+// and layers of their list applied, so reformatted rules are equal.
+// Rules are paired by ID if they have one and otherwise by position.
+func runDiff(w io.Writer, oldFile, newFile string, opts config.LoadOptions) error {
+	oldConfig, err := loadDiffSource(oldFile, opts)
+	if err != nil {
+		return err
+	}
+	newConfig, err := loadDiffSource(newFile, opts)
+	if err != nil {
+		return err
+	}
+
+	oldLists := make(map[string]*config.MappingList, len(oldConfig.Lists))
+	for i := range oldConfig.Lists {
+		oldLists[oldConfig.Lists[i].ID] = &oldConfig.Lists[i]
+	}
+	newLists := make(map[string]*config.MappingList, len(newConfig.Lists))
+	for i := range newConfig.Lists {
+		newLists[newConfig.Lists[i].ID] = &newConfig.Lists[i]
+	}
+
+	added, removed, changed := 0, 0, 0
+	for i := range oldConfig.Lists {
+		oldList := &oldConfig.Lists[i]
+		if _, ok := newLists[oldList.ID]; !ok {
+			removed++
+			fmt.Fprintf(w, "- list %s (%d rules)\n", oldList.ID, len(oldList.Mappings))
+		}
+	}
+	for i := range newConfig.Lists {
+		newList := &newConfig.Lists[i]
+		oldList, ok := oldLists[newList.ID]
+		if !ok {
+			added++
+			fmt.Fprintf(w, "+ list %s (%d rules)\n", newList.ID, len(newList.Mappings))
+			continue
+		}
+
+		lines, err := diffList(oldList, newList)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		changed++
+		fmt.Fprintf(w, "~ list %s\n", newList.ID)
+		for _, line := range lines {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+
+	fmt.Fprintf(w, "%d lists added, %d removed, %d changed\n", added, removed, changed)
+	return nil
+}
+
+// loadDiffSource loads a file compared by runDiff, either as a main
+// configuration file or, if it holds no lists, as a mapping file.
+func loadDiffSource(file string, opts config.LoadOptions) (*config.MappingConfig, error) {
+	loaded, err := config.LoadFromSourcesWithOptions(file, nil, opts)
+	if err == nil && len(loaded.Lists) > 0 {
+		return loaded, nil
+	}
+	loaded, mappingErr := config.LoadFromSourcesWithOptions("", []string{file}, opts)
+	if mappingErr != nil {
+		if err == nil {
+			err = mappingErr
+		}
+		return nil, fmt.Errorf("failed to load configuration '%s': %w", file, err)
+	}
+	return loaded, nil
+}
+
+// diffList returns the changed settings and the added, removed and
+// changed rules of a mapping list as lines of the summary.
+func diffList(oldList, newList *config.MappingList) ([]string, error) {
+	lines := diffSettings(oldList, newList)
+
+	oldRules, err := diffRules(oldList)
+	if err != nil {
+		return nil, err
+	}
+	newRules, err := diffRules(newList)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rules with an ID are paired by their ID
+	oldByID := make(map[string]diffRule)
+	for _, rule := range oldRules {
+		if rule.ID != "" {
+			oldByID[rule.ID] = rule
+		}
+	}
+	newIDs := make(map[string]bool)
+	for _, rule := range newRules {
+		if rule.ID == "" {
+			continue
+		}
+		newIDs[rule.ID] = true
+		oldRule, ok := oldByID[rule.ID]
+		if !ok {
+			lines = append(lines, fmt.Sprintf("+ %s: %s", rule.Label, rule.Text))
+		} else if !rulesEqual(oldRule.Parsed, rule.Parsed) {
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", rule.Label, oldRule.Text, rule.Text))
+		}
+	}
+	for _, rule := range oldRules {
+		if rule.ID != "" && !newIDs[rule.ID] {
+			lines = append(lines, fmt.Sprintf("- %s: %s", rule.Label, rule.Text))
+		}
+	}
+
+	// Rules without an ID are unchanged if an equal rule remains. Of the
+	// others, a removed and an added rule at the same position count as
+	// a changed rule.
+	oldRest := withoutEqual(withoutIDs(oldRules), withoutIDs(newRules))
+	newRest := withoutEqual(withoutIDs(newRules), withoutIDs(oldRules))
+	for _, oldRule := range oldRest {
+		if slices.ContainsFunc(newRest, func(r diffRule) bool { return r.Label == oldRule.Label }) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s", oldRule.Label, oldRule.Text))
+	}
+	for _, newRule := range newRest {
+		i := slices.IndexFunc(oldRest, func(r diffRule) bool { return r.Label == newRule.Label })
+		if i >= 0 {
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", newRule.Label, oldRest[i].Text, newRule.Text))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("+ %s: %s", newRule.Label, newRule.Text))
+	}
+
+	return lines, nil
+}
+
+// diffSettings returns a line per changed setting of the list header.
+// Settings are named by their YAML keys.
+func diffSettings(oldList, newList *config.MappingList) []string {
+	var lines []string
+	oldValue := reflect.ValueOf(*oldList)
+	newValue := reflect.ValueOf(*newList)
+	listType := oldValue.Type()
+	for i := range listType.NumField() {
+		name, _, _ := strings.Cut(listType.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || name == "mappings" {
+			continue
+		}
+		before, after := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", name, formatSetting(before), formatSetting(after)))
+	}
+	return lines
+}
+
+// formatSetting formats a setting of a list header, with unset
+// settings printed as "(unset)".
+func formatSetting(value any) string {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "(unset)"
+		}
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		return "(unset)"
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// diffRules parses the rules of a list for comparison.
+func diffRules(list *config.MappingList) ([]diffRule, error) {
+	rules := make([]diffRule, len(list.Mappings))
+	for i, rule := range list.Mappings {
+		rules[i] = diffRule{
+			Label: list.RuleLabel(i),
+			ID:    list.RuleMetaAt(i).ID,
+			Text:  string(rule),
+		}
+	}
+
+	if list.IsCorpus() || list.IsMixed() {
+		parsed, err := list.ParseCorpusMappings()
+		if err != nil {
+			return nil, err
+		}
+		for i := range parsed {
+			if list.IsCorpusRuleAt(i) {
+				rules[i].Parsed = parsed[i]
+			}
+		}
+	}
+	if !list.IsCorpus() {
+		parsed, err := list.ParseMappings()
+		if err != nil {
+			return nil, err
+		}
+		for i := range parsed {
+			if !list.IsCorpusRuleAt(i) {
+				rules[i].Parsed = parsed[i]
+			}
+		}
+	}
+	return rules, nil
+}
+
+// rulesEqual reports whether two parsed rules are equal. Annotation
+// rules are compared with ast.NodesEqual.
+func rulesEqual(a, b any) bool {
+	ruleA, okA := a.(*parser.MappingResult)
+	ruleB, okB := b.(*parser.MappingResult)
+	if okA && okB {
+		return ruleA.Direction == ruleB.Direction &&
+			ast.NodesEqual(ruleA.Upper, ruleB.Upper) &&
+			ast.NodesEqual(ruleA.Lower, ruleB.Lower)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// withoutIDs returns the rules without an ID.
+func withoutIDs(rules []diffRule) []diffRule {
+	return slices.DeleteFunc(slices.Clone(rules), func(r diffRule) bool { return r.ID != "" })
+}
+
+// withoutEqual returns the rules that have no equal rule in others.
+// Every rule of others is paired with one rule at most.
+func withoutEqual(rules, others []diffRule) []diffRule {
+	used := make([]bool, len(others))
+	var rest []diffRule
+	for _, rule := range rules {
+		found := false
+		for i, other := range others {
+			if !used[i] && rulesEqual(rule.Parsed, other.Parsed) {
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			rest = append(rest, rule)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/KorAP/Koral-Mapper/ast"
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/parser"
+	"github.com/gofiber/fiber/v3"
+)
+
+// dumpedList is a mapping list as printed by the dump-rules command and returned
+// by GET /:map/rules.
+type dumpedList struct {
+	ID    string       `json:"id"`
+	Type  string       `json:"type"`
+	Rules []dumpedRule `json:"rules"`
+}
+
+// dumpedRule is a rule with the parsed sides of the rule. Annotation
+// sides are serialized as KoralQuery, corpus sides as parsed field and
+// group nodes. AtoB and BtoA name the sides used as pattern and
+// replacement in each direction; they are omitted for a direction the
+// rule does not apply in.
+type dumpedRule struct {
+	ID       string          `json:"id,omitempty"`
+	Comment  string          `json:"comment,omitempty"`
+	Rule     string          `json:"rule"`
+	Upper    json.RawMessage `json:"upper"`
+	Lower    json.RawMessage `json:"lower"`
+	AtoB     *dumpedSides    `json:"atob,omitempty"`
+	BtoA     *dumpedSides    `json:"btoa,omitempty"`
+	Example  any             `json:"example,omitempty"`
+	Expected any             `json:"expected,omitempty"`
+}
+
+// dumpedSides names the side of a rule ("upper" or "lower") matched as
+// pattern and the side emitted as replacement.
+type dumpedSides struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// newDumpedRule returns the rule at index i of the list with its
+// parsed sides.
+func newDumpedRule(list *config.MappingList, i int, direction parser.RuleDirection, upper, lower json.RawMessage) dumpedRule {
+	meta := list.RuleMetaAt(i)
+	rule := dumpedRule{
+		ID:       meta.ID,
+		Comment:  meta.Comment,
+		Rule:     string(list.Mappings[i]),
+		Upper:    upper,
+		Lower:    lower,
+		Example:  meta.Example,
+		Expected: meta.Expected,
+	}
+	if direction.Allows(true) {
+		rule.AtoB = &dumpedSides{Pattern: "upper", Replacement: "lower"}
+	}
+	if direction.Allows(false) {
+		rule.BtoA = &dumpedSides{Pattern: "lower", Replacement: "upper"}
+	}
+	return rule
+}
+
+// runDumpRules loads the configuration and prints the parsed rules of
+// every mapping list as JSON.
+func runDumpRules(w io.Writer, configFile string, mappingFiles []string, opts config.LoadOptions) error {
+	yamlConfig, err := config.LoadFromSourcesWithOptions(configFile, mappingFiles, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	lists := make([]dumpedList, 0, len(yamlConfig.Lists))
+	for i := range yamlConfig.Lists {
+		dumped, err := dumpList(&yamlConfig.Lists[i])
+		if err != nil {
+			return err
+		}
+		lists = append(lists, dumped)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(lists); err != nil {
+		return fmt.Errorf("failed to serialize rules: %w", err)
+	}
+	return nil
+}
+
+// dumpList parses the rules of a mapping list. Mixed lists hold both
+// annotation and corpus rules, each dumped in the form of its kind.
+func dumpList(list *config.MappingList) (dumpedList, error) {
+	dumped := dumpedList{ID: list.ID, Type: "annotation", Rules: []dumpedRule{}}
+	if list.IsCorpus() {
+		dumped.Type = "corpus"
+	} else if list.IsMixed() {
+		dumped.Type = "mixed"
+	}
+
+	var corpusRules []*parser.CorpusMappingResult
+	if list.IsCorpus() || list.IsMixed() {
+		rules, err := list.ParseCorpusMappings()
+		if err != nil {
+			return dumpedList{}, fmt.Errorf("failed to parse corpus mappings for list %s: %w", list.ID, err)
+		}
+		corpusRules = rules
+	}
+	var annotationRules []*parser.MappingResult
+	if !list.IsCorpus() {
+		rules, err := list.ParseMappings()
+		if err != nil {
+			return dumpedList{}, fmt.Errorf("failed to parse mappings for list %s: %w", list.ID, err)
+		}
+		annotationRules = rules
+	}
+
+	for i := range list.Mappings {
+		if list.IsCorpusRuleAt(i) {
+			rule := corpusRules[i]
+			upper, err := json.Marshal(rule.Upper)
+			if err != nil {
+				return dumpedList{}, err
+			}
+			lower, err := json.Marshal(rule.Lower)
+			if err != nil {
+				return dumpedList{}, err
+			}
+			dumped.Rules = append(dumped.Rules, newDumpedRule(list, i, rule.Direction, upper, lower))
+			continue
+		}
+
+		rule := annotationRules[i]
+		upper, err := serializeRuleSide(rule.Upper)
+		if err != nil {
+			return dumpedList{}, err
+		}
+		lower, err := serializeRuleSide(rule.Lower)
+		if err != nil {
+			return dumpedList{}, err
+		}
+		dumped.Rules = append(dumped.Rules, newDumpedRule(list, i, rule.Direction, upper, lower))
+	}
+	return dumped, nil
+}
+
+// handleMapRules returns the parsed rules of a mapping list as JSON, in
+// the format of the dump-rules command, with the sides used in each direction.
+func handleMapRules(yamlConfig *config.MappingConfig) fiber.Handler {
+	resolver := newListResolver(yamlConfig.Lists)
+	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
+	for i := range yamlConfig.Lists {
+		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
+	}
+
+	return func(c fiber.Ctx) error {
+		mapID, _ := url.PathUnescape(c.Params("map"))
+
+		list, ok := listsByID[resolver.resolveAlias(mapID)]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "mapping list with ID " + mapID + " not found",
+			})
+		}
+
+		dumped, err := dumpList(list)
+		if err != nil {
+			requestLogger(c).Error().Err(err).Str("mapID", list.ID).Msg("Failed to dump rules")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "internal error",
+			})
+		}
+		return c.JSON(dumped)
+	}
+}
+
+// serializeRuleSide serializes one side of an annotation rule.
+func serializeRuleSide(node ast.Node) (json.RawMessage, error) {
+	data, err := parser.SerializeToJSONCompact(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize rule: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"maps"
+	"mime"
+	"slices"
+	"strings"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+// koralQueryContext is the JSON-LD context of KoralQuery envelopes.
+const koralQueryContext = "http://korap.ids-mannheim.de/ns/KoralQuery/v0.3/context.jsonld"
+
+// mimeApplicationLDJSON is the media type requesting the JSON-LD envelope.
+const mimeApplicationLDJSON = "application/ld+json"
+
+// corpusNodeTypes are the node types that belong below "corpus" rather
+// than "query" when a bare result is wrapped.
+var corpusNodeTypes = []string{"koral:doc", "koral:docGroup", "koral:docGroupRef", "koral:field", "koral:fieldGroup"}
+
+// wantsEnvelope reports whether a query result is requested as a full
+// KoralQuery envelope, either with "envelope=true" or by accepting
+// application/ld+json.
+func wantsEnvelope(c fiber.Ctx) bool {
+	if c.Query("envelope", "") == "true" {
+		return true
+	}
+	for part := range strings.SplitSeq(c.Get(fiber.HeaderAccept), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == mimeApplicationLDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// writeQueryResult sends a query transformation result like writeResult,
+// wrapped in a KoralQuery envelope if the client asks for one.
+func writeQueryResult(c fiber.Ctx, yamlConfig *config.MappingConfig, result any) error {
+	if wantsEnvelope(c) {
+		result = envelope(yamlConfig, result)
+	}
+	return writeResult(c, result)
+}
+
+// envelope wraps a bare query or corpus node in a KoralQuery envelope
+// with the standard @context. Corpus nodes are placed under "corpus",
+// all others under the first configured query key ("query" by default).
+// Results that already are envelopes only get the @context if missing.
+func envelope(yamlConfig *config.MappingConfig, result any) any {
+	queryKeys := yamlConfig.QueryKeys
+	if len(queryKeys) == 0 {
+		queryKeys = []string{"query"}
+	}
+
+	if node, ok := result.(map[string]any); ok {
+		isEnvelope := false
+		for _, key := range append(slices.Clone(queryKeys), "corpus", "collection") {
+			if _, exists := node[key]; exists {
+				isEnvelope = true
+				break
+			}
+		}
+		if isEnvelope {
+			if _, exists := node["@context"]; exists {
+				return node
+			}
+			wrapped := maps.Clone(node)
+			wrapped["@context"] = koralQueryContext
+			return wrapped
+		}
+
+		if nodeType, _ := node["@type"].(string); slices.Contains(corpusNodeTypes, nodeType) {
+			return map[string]any{
+				"@context": koralQueryContext,
+				"corpus":   node,
+			}
+		}
+	}
+
+	return map[string]any{
+		"@context":   koralQueryContext,
+		queryKeys[0]: result,
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/KorAP/Koral-Mapper/parser"
+)
+
+// runTestExamples loads the configuration and applies every rule with an
+// example to the example on its own, printing PASS or FAIL per rule. A
+// rule passes if its result equals the expected result or, without one,
+// if the rule matched the example. It fails if any example fails.
+func runTestExamples(w io.Writer, configFile string, mappingFiles []string, opts config.LoadOptions) error {
+	yamlConfig, err := config.LoadFromSourcesWithOptions(configFile, mappingFiles, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	total, failed := 0, 0
+	for _, list := range yamlConfig.Lists {
+		for i := range list.Mappings {
+			meta := list.RuleMetaAt(i)
+			if meta.Example == nil {
+				continue
+			}
+			total++
+
+			if err := testExample(yamlConfig, list, i); err != nil {
+				failed++
+				fmt.Fprintf(w, "FAIL %s %s: %v\n", list.ID, list.RuleLabel(i), err)
+				continue
+			}
+			fmt.Fprintf(w, "PASS %s %s\n", list.ID, list.RuleLabel(i))
+		}
+	}
+
+	fmt.Fprintf(w, "%d examples, %d failed\n", total, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d examples failed", failed, total)
+	}
+	return nil
+}
+
+// testExample applies the rule at index i of the list to its example,
+// with the other settings of the list. The rule is applied from A to B,
+// unless it is restricted to the other direction.
+func testExample(yamlConfig *config.MappingConfig, list config.MappingList, i int) error {
+	meta := list.RuleMetaAt(i)
+
+	single := list
+	single.Aliases = nil
+	single.Mappings = list.Mappings[i : i+1]
+	single.RuleMeta = []config.RuleMeta{meta}
+
+	m, err := mapper.NewMapper([]config.MappingList{single}, mapperOptions(yamlConfig)...)
+	if err != nil {
+		return err
+	}
+
+	example, err := normalizeJSON(meta.Example)
+	if err != nil {
+		return fmt.Errorf("invalid example: %w", err)
+	}
+
+	var ruleDirection parser.RuleDirection
+	if single.IsCorpusRuleAt(0) {
+		rules, err := single.ParseCorpusMappings()
+		if err != nil {
+			return err
+		}
+		ruleDirection = rules[0].Direction
+	} else {
+		rules, err := single.ParseMappings()
+		if err != nil {
+			return err
+		}
+		ruleDirection = rules[0].Direction
+	}
+	direction := mapper.AtoB
+	if !ruleDirection.Allows(bool(mapper.AtoB)) {
+		direction = mapper.BtoA
+	}
+
+	trace := &mapper.Trace{}
+	result, err := m.ApplyQueryMappings(list.ID, mapper.MappingOptions{
+		Direction:   direction,
+		AddRewrites: single.EffectiveRewrites(yamlConfig.Rewrites),
+		Trace:       trace,
+	}, example)
+	if err != nil {
+		return err
+	}
+
+	if meta.Expected == nil {
+		if len(trace.Applied()) == 0 {
+			return fmt.Errorf("rule does not match the example")
+		}
+		return nil
+	}
+
+	expected, err := normalizeJSON(meta.Expected)
+	if err != nil {
+		return fmt.Errorf("invalid expected result: %w", err)
+	}
+	if !reflect.DeepEqual(expected, result) {
+		got, _ := json.Marshal(result)
+		want, _ := json.Marshal(expected)
+		return fmt.Errorf("result differs\n  expected: %s\n  got:      %s", want, got)
+	}
+	return nil
+}
+
+// normalizeJSON converts a value decoded from YAML to its form decoded
+// from JSON, e.g. integers to float64, so it compares equal to results.
+func normalizeJSON(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized any
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
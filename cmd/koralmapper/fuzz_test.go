@@ -85,7 +85,7 @@ func FuzzTransformEndpoint(f *testing.F) {
 	f.Fuzz(func(t *testing.T, mapID, dir, foundryA, foundryB, layerA, layerB string, body []byte) {
 
 		// Validate input first
-		if err := validateInput(mapID, dir, foundryA, foundryB, layerA, layerB, body); err != nil {
+		if err := validateInput(defaultInputLimits, mapID, dir, foundryA, foundryB, layerA, layerB, body); err != nil {
 			// Skip this test case as it's invalid
 			t.Skip(err)
 		}
@@ -203,7 +203,7 @@ func FuzzResponseTransformEndpoint(f *testing.F) {
 	f.Fuzz(func(t *testing.T, mapID, dir, foundryA, foundryB, layerA, layerB string, body []byte) {
 
 		// Validate input first
-		if err := validateInput(mapID, dir, foundryA, foundryB, layerA, layerB, body); err != nil {
+		if err := validateInput(defaultInputLimits, mapID, dir, foundryA, foundryB, layerA, layerB, body); err != nil {
 			// Skip this test case as it's invalid
 			t.Skip(err)
 		}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+// mapInfo describes a single mapping list for GET /:map/info.
+type mapInfo struct {
+	ID          string   `json:"id"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"desc,omitempty"`
+	Type        string   `json:"type"`
+	FoundryA    string   `json:"foundryA,omitempty"`
+	LayerA      string   `json:"layerA,omitempty"`
+	FoundryB    string   `json:"foundryB,omitempty"`
+	LayerB      string   `json:"layerB,omitempty"`
+	FieldA      string   `json:"fieldA,omitempty"`
+	FieldB      string   `json:"fieldB,omitempty"`
+	Rules       int      `json:"rules"`
+	QueryURL    string   `json:"queryURL"`
+	ResponseURL string   `json:"responseURL"`
+}
+
+// handleMapInfo returns the metadata of a mapping list as JSON, including
+// the service URLs the single-mapping plugin page registers. The URLs take
+// the same query parameters as the page.
+func handleMapInfo(yamlConfig *config.MappingConfig) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+	resolver := newListResolver(yamlConfig.Lists)
+	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
+	for i := range yamlConfig.Lists {
+		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
+	}
+
+	return func(c fiber.Ctx) error {
+		mapID, _ := url.PathUnescape(c.Params("map"))
+
+		list, ok := listsByID[resolver.resolveAlias(mapID)]
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "mapping list with ID " + mapID + " not found",
+			})
+		}
+
+		queryParams := QueryParams{
+			Dir:      c.Query("dir", "atob"),
+			FoundryA: c.Query("foundryA", ""),
+			FoundryB: c.Query("foundryB", ""),
+			LayerA:   c.Query("layerA", ""),
+			LayerB:   c.Query("layerB", ""),
+		}
+		if err := validateInput(limits, mapID, queryParams.Dir, queryParams.FoundryA, queryParams.FoundryB, queryParams.LayerA, queryParams.LayerB, []byte{}); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if queryParams.Dir != "atob" && queryParams.Dir != "btoa" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid direction, must be 'atob' or 'btoa'",
+			})
+		}
+
+		queryURL, responseURL, err := buildMapServiceURLs(yamlConfig.ServiceURL, mapID, queryParams)
+		if err != nil {
+			requestLogger(c).Warn().Err(err).Msg("Failed to build service URLs")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "internal error",
+			})
+		}
+
+		listType := list.Type
+		if listType == "" {
+			listType = "annotation"
+		}
+
+		return c.JSON(mapInfo{
+			ID:          list.ID,
+			Aliases:     list.Aliases,
+			Description: list.Description,
+			Type:        listType,
+			FoundryA:    list.FoundryA,
+			LayerA:      list.LayerA,
+			FoundryB:    list.FoundryB,
+			LayerB:      list.LayerB,
+			FieldA:      list.FieldA,
+			FieldB:      list.FieldB,
+			Rules:       len(list.Mappings),
+			QueryURL:    queryURL,
+			ResponseURL: responseURL,
+		})
+	}
+}
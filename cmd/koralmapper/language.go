@@ -0,0 +1,144 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+// listResolver resolves aliases and the logical names of language-specific
+// mapping lists to list IDs. Explicit list IDs always take precedence.
+type listResolver struct {
+	ids      map[string]bool
+	aliases  map[string]string                // list ID by alias
+	variants map[string][]*config.MappingList // by logical name, in config order
+}
+
+func newListResolver(lists []config.MappingList) *listResolver {
+	r := &listResolver{
+		ids:      make(map[string]bool, len(lists)),
+		aliases:  make(map[string]string),
+		variants: make(map[string][]*config.MappingList),
+	}
+	for i := range lists {
+		r.ids[lists[i].ID] = true
+		for _, alias := range lists[i].Aliases {
+			r.aliases[alias] = lists[i].ID
+		}
+		if lists[i].Name != "" {
+			r.variants[lists[i].Name] = append(r.variants[lists[i].Name], &lists[i])
+		}
+	}
+	return r
+}
+
+// resolve returns the ID of the list to use for id. Aliases resolve to the
+// ID of their list; IDs that are neither an alias nor a logical name are
+// returned unchanged. For a logical name, the variant
+// matching the first of the preferred languages is chosen, where "de-AT"
+// also matches a variant for "de". Without a match, the variant without a
+// language is used, or else the first variant.
+func (r *listResolver) resolve(id string, langs []string) string {
+	if listID := r.resolveAlias(id); r.ids[listID] {
+		return listID
+	}
+	variants, ok := r.variants[id]
+	if !ok {
+		return id
+	}
+
+	for _, lang := range langs {
+		primary, _, _ := strings.Cut(lang, "-")
+		for _, list := range variants {
+			if list.Language != "" && (strings.EqualFold(list.Language, lang) || strings.EqualFold(list.Language, primary)) {
+				return list.ID
+			}
+		}
+	}
+
+	for _, list := range variants {
+		if list.Language == "" {
+			return list.ID
+		}
+	}
+	return variants[0].ID
+}
+
+// resolveAlias returns the ID of the list with the alias id, or id itself
+// if it is no alias.
+func (r *listResolver) resolveAlias(id string) string {
+	if listID, ok := r.aliases[id]; ok {
+		return listID
+	}
+	return id
+}
+
+// resolveCfg resolves the list IDs of all entries of a cfg parameter.
+func (r *listResolver) resolveCfg(cfgRaw string, langs []string) string {
+	if (len(r.variants) == 0 && len(r.aliases) == 0) || cfgRaw == "" {
+		return cfgRaw
+	}
+	parts := strings.Split(cfgRaw, ";")
+	for i, part := range parts {
+		id, rest, found := strings.Cut(part, ":")
+		if !found {
+			continue
+		}
+		parts[i] = r.resolve(id, langs) + ":" + rest
+	}
+	return strings.Join(parts, ";")
+}
+
+// requestLanguages returns the languages preferred by the request: the
+// lang query parameter, followed by the Accept-Language header entries
+// ordered by quality.
+func requestLanguages(c fiber.Ctx) []string {
+	var langs []string
+	if lang := c.Query("lang", ""); lang != "" {
+		langs = append(langs, lang)
+	}
+	return append(langs, parseAcceptLanguage(c.Get(fiber.HeaderAcceptLanguage))...)
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language
+// header ordered by descending quality. The wildcard and tags with a
+// quality of 0 are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weightedTag struct {
+		tag     string
+		quality float64
+	}
+
+	var tags []weightedTag
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(v, 64); err == nil {
+				quality = q
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		tags = append(tags, weightedTag{tag, quality})
+	}
+
+	slices.SortStableFunc(tags, func(a, b weightedTag) int {
+		return cmp.Compare(b.quality, a.quality)
+	})
+
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+// inputLimits bounds the size of request parameters and bodies.
+type inputLimits struct {
+	maxParamBytes int
+	maxBodyBytes  int
+}
+
+// defaultInputLimits apply where the configuration sets no limits.
+var defaultInputLimits = inputLimits{
+	maxParamBytes: maxParamLength,
+	maxBodyBytes:  maxInputLength,
+}
+
+// newInputLimits returns the limits set via the "maxParamBytes" and
+// "maxBodyBytes" YAML keys, using the defaults for unset values.
+func newInputLimits(yamlConfig *config.MappingConfig) inputLimits {
+	limits := defaultInputLimits
+	if yamlConfig.MaxParamBytes > 0 {
+		limits.maxParamBytes = yamlConfig.MaxParamBytes
+	}
+	if yamlConfig.MaxBodyBytes > 0 {
+		limits.maxBodyBytes = yamlConfig.MaxBodyBytes
+	}
+	return limits
+}
+
+// fiberConfig returns the server configuration. Request bodies are
+// streamed, so POST /:map/query/stream can read batches of any size.
+// The body limit is enforced by limitRequestBody in the mapping handlers,
+// so it changes on reload; BodyLimit only sets how much of a body is
+// buffered right away.
+func fiberConfig(yamlConfig *config.MappingConfig) fiber.Config {
+	return fiber.Config{
+		BodyLimit:         maxInputLength,
+		StreamRequestBody: true,
+		ReadBufferSize:    64 * 1024, // 64KB - increase header size limit
+		WriteBufferSize:   64 * 1024, // 64KB - increase response buffer size,
+		ReadTimeout:       time.Duration(yamlConfig.ReadTimeout) * time.Second,
+		WriteTimeout:      time.Duration(yamlConfig.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(yamlConfig.IdleTimeout) * time.Second,
+		ErrorHandler: func(c fiber.Ctx, err error) error {
+			if errors.Is(err, fiber.ErrRequestEntityTooLarge) {
+				return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+					"error": "request body too large",
+				})
+			}
+			return fiber.DefaultErrorHandler(c, err)
+		},
+	}
+}
+
+// limitRequestBody reads streamed request bodies up to the body limit,
+// so handlers find them complete in c.Body(). Larger bodies are rejected
+// with 413 Request Entity Too Large, reporting the limit.
+func limitRequestBody(limits inputLimits) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		req := c.Request()
+		if !req.IsBodyStream() {
+			return c.Next()
+		}
+
+		// The rest of the body is not read, so the connection cannot
+		// carry further requests
+		tooLarge := func() error {
+			c.Response().SetConnectionClose()
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": fmt.Sprintf("request body too large (max %d bytes)", limits.maxBodyBytes),
+			})
+		}
+		if req.Header.ContentLength() > limits.maxBodyBytes {
+			return tooLarge()
+		}
+		body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(limits.maxBodyBytes)+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > limits.maxBodyBytes {
+			return tooLarge()
+		}
+		req.SetBody(body)
+		return c.Next()
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"embed"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"net/url"
 	"os"
@@ -16,12 +17,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/KorAP/Koral-Mapper/client"
 	"github.com/KorAP/Koral-Mapper/config"
 	"github.com/KorAP/Koral-Mapper/mapper"
 	"github.com/alecthomas/kong"
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
 	"github.com/gofiber/fiber/v3/middleware/limiter"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -29,16 +32,46 @@ import (
 //go:embed static/*
 var staticFS embed.FS
 
+// Default input limits, see inputLimits
 const (
 	maxInputLength = 1024 * 1024 // 1MB
 	maxParamLength = 1024        // 1KB
 )
 
 type appConfig struct {
-	Port     *int     `kong:"short='p',help='Port to listen on'"`
-	Config   string   `kong:"short='c',help='YAML configuration file containing mapping directives and global settings'"`
-	Mappings []string `kong:"short='m',help='Individual YAML mapping files to load (supports glob patterns like dir/*.yaml)'"`
-	LogLevel *string  `kong:"short='l',help='Log level (debug, info, warn, error)'"`
+	Port      *int     `kong:"short='p',help='Port to listen on'"`
+	Config    string   `kong:"short='c',help='YAML configuration file containing mapping directives and global settings (- reads standard input)'"`
+	Mappings  []string `kong:"short='m',help='Individual YAML mapping files to load (supports glob patterns like dir/*.yaml, directories, and dir/** for recursive loading; - reads standard input)'"`
+	LogLevel  *string  `kong:"short='l',help='Log level (debug, info, warn, error)'"`
+	LogFormat *string  `kong:"name='log-format',help='Log format (console, json)'"`
+	Profile   string   `kong:"name='profile',help='Name of the profile in the configuration file to apply (e.g. dev, stage, prod)'"`
+	Strict    bool     `kong:"name='strict',help='Reject unknown keys in the configuration and mapping files instead of ignoring them'"`
+
+	ValidateOnly bool `kong:"name='validate-only',help='Load and validate the configuration, print a summary and exit without starting the server'"`
+
+	Serve struct{} `kong:"cmd,default='1',help='Start the server (default)'"`
+	Diff  diffCmd  `kong:"cmd,help='Load two configuration or mapping files, print the mapping lists and rules added, removed and changed from OLD to NEW and exit without starting the server'"`
+
+	DumpRules    struct{} `kong:"cmd,name='dump-rules',help='Load the configuration, print the parsed rules of all mapping lists as JSON and exit without starting the server'"`
+	TestExamples struct{} `kong:"cmd,name='test-examples',help='Load the configuration, apply every rule with an example to it, report PASS or FAIL per rule and exit without starting the server'"`
+
+	// command is the selected command, e.g. "serve" or "diff <old> <new>"
+	command string
+}
+
+// diffCommand is the command selected by "koralmapper diff OLD NEW".
+const diffCommand = "diff <old> <new>"
+
+// dumpRulesCommand is the command selected by "koralmapper dump-rules".
+const dumpRulesCommand = "dump-rules"
+
+// testExamplesCommand is the command selected by "koralmapper test-examples".
+const testExamplesCommand = "test-examples"
+
+// diffCmd holds the arguments of the diff command.
+type diffCmd struct {
+	Old string `kong:"arg,name='old',help='Old configuration or mapping file'"`
+	New string `kong:"arg,name='new',help='New configuration or mapping file'"`
 }
 
 type BasePageData struct {
@@ -103,6 +136,12 @@ type ConfigPageData struct {
 	MappingSections    []MappingSectionData
 }
 
+// loadOptions returns the options for loading the configuration given
+// on the command line.
+func (cfg *appConfig) loadOptions() config.LoadOptions {
+	return config.LoadOptions{Profile: cfg.Profile, Strict: cfg.Strict}
+}
+
 func parseConfig() *appConfig {
 	cfg := &appConfig{}
 
@@ -117,10 +156,11 @@ func parseConfig() *appConfig {
 		fmt.Fprintln(os.Stderr, ctx.Error)
 		os.Exit(1)
 	}
+	cfg.command = ctx.Command()
 	return cfg
 }
 
-func setupLogger(level string) {
+func setupLogger(level, format string) {
 	// Parse log level
 	lvl, err := zerolog.ParseLevel(strings.ToLower(level))
 	if err != nil {
@@ -130,7 +170,21 @@ func setupLogger(level string) {
 
 	// Configure zerolog
 	zerolog.SetGlobalLevel(lvl)
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	log.Logger = log.Output(logWriter(format, os.Stderr))
+}
+
+// logWriter returns the writer for the given log format: plain zerolog
+// JSON lines for "json", human-readable console output otherwise.
+func logWriter(format string, out io.Writer) io.Writer {
+	switch strings.ToLower(format) {
+	case "json":
+		return out
+	case "", "console":
+		return zerolog.ConsoleWriter{Out: out}
+	default:
+		log.Error().Str("format", format).Msg("Invalid log format, defaulting to console")
+		return zerolog.ConsoleWriter{Out: out}
+	}
 }
 
 // setupFiberLogger configures fiber's logger middleware to integrate with zerolog
@@ -164,6 +218,10 @@ func setupFiberLogger() fiber.Handler {
 			logEvent = log.Error()
 		}
 
+		if id := requestid.FromContext(c); id != "" {
+			logEvent = logEvent.Str("request_id", id)
+		}
+
 		// Log the request
 		logEvent.
 			Int("status", status).
@@ -179,7 +237,7 @@ func setupFiberLogger() fiber.Handler {
 }
 
 // extractRequestParams extracts and validates common request parameters
-func extractRequestParams(c fiber.Ctx) (*requestParams, error) {
+func extractRequestParams(c fiber.Ctx, limits inputLimits) (*requestParams, error) {
 	mapID, err := url.PathUnescape(c.Params("map"))
 	if err != nil {
 		return nil, fmt.Errorf("mapID contains invalid characters")
@@ -187,7 +245,7 @@ func extractRequestParams(c fiber.Ctx) (*requestParams, error) {
 
 	params := &requestParams{
 		MapID:    mapID,
-		Dir:      c.Query("dir", "atob"),
+		Dir:      c.Query("dir", ""),
 		FoundryA: c.Query("foundryA", ""),
 		FoundryB: c.Query("foundryB", ""),
 		LayerA:   c.Query("layerA", ""),
@@ -199,24 +257,41 @@ func extractRequestParams(c fiber.Ctx) (*requestParams, error) {
 		params.Rewrites = &v
 	}
 
-	// Validate input parameters
-	if err := validateInput(params.MapID, params.Dir, params.FoundryA, params.FoundryB, params.LayerA, params.LayerB, c.Body()); err != nil {
+	// Validate input parameters. Bodies still streamed at this point
+	// belong to POST /:map/query/stream, which limits each line instead.
+	var body []byte
+	if !c.Request().IsBodyStream() {
+		body = c.Body()
+	}
+	if err := validateInput(limits, params.MapID, params.Dir, params.FoundryA, params.FoundryB, params.LayerA, params.LayerB, body); err != nil {
 		return nil, err
 	}
 
-	// Validate direction
-	if params.Dir != "atob" && params.Dir != "btoa" {
+	// Validate direction; an empty direction is resolved per mapping list
+	if params.Dir != "" && params.Dir != "atob" && params.Dir != "btoa" {
 		return nil, fmt.Errorf("invalid direction, must be 'atob' or 'btoa'")
 	}
 
 	return params, nil
 }
 
-// parseRequestBody parses JSON request body and direction
-func parseRequestBody(c fiber.Ctx, dir string) (any, mapper.Direction, error) {
-	var jsonData any
-	if err := c.Bind().Body(&jsonData); err != nil {
-		return nil, mapper.BtoA, fmt.Errorf("invalid JSON in request body")
+// effectiveDirection returns dir, or the default direction of the mapping
+// list if the request does not specify one.
+func effectiveDirection(dir string, list *config.MappingList) string {
+	if dir != "" {
+		return dir
+	}
+	if list != nil {
+		return list.EffectiveDirection()
+	}
+	return "atob"
+}
+
+// parseRequestBody parses JSON request body and direction.
+func parseRequestBody(c fiber.Ctx, dir string, yamlConfig *config.MappingConfig) (any, mapper.Direction, error) {
+	jsonData, err := bindRequestBody(c, yamlConfig)
+	if err != nil {
+		return nil, mapper.BtoA, err
 	}
 
 	direction, err := mapper.ParseDirection(dir)
@@ -227,6 +302,23 @@ func parseRequestBody(c fiber.Ctx, dir string) (any, mapper.Direction, error) {
 	return jsonData, direction, nil
 }
 
+// bindRequestBody parses the JSON request body. Empty bodies are rejected
+// before parsing, and the body is checked against the KoralQuery schema if
+// "validateSchema" is enabled.
+func bindRequestBody(c fiber.Ctx, yamlConfig *config.MappingConfig) (any, error) {
+	if len(bytes.TrimSpace(c.Body())) == 0 {
+		return nil, fmt.Errorf("empty request body")
+	}
+	var jsonData any
+	if err := c.Bind().Body(&jsonData); err != nil {
+		return nil, fmt.Errorf("invalid JSON in request body")
+	}
+	if err := validateRequestBody(yamlConfig, jsonData); err != nil {
+		return nil, err
+	}
+	return jsonData, nil
+}
+
 func main() {
 	// Confine config file loading to the current working directory tree
 	// (path traversal prevention). Can be overridden via the "basePath"
@@ -241,6 +333,15 @@ func main() {
 	// Parse command line flags
 	cfg := parseConfig()
 
+	// Compare two configurations without starting the server
+	if cfg.command == diffCommand {
+		if err := runDiff(os.Stdout, cfg.Diff.Old, cfg.Diff.New, cfg.loadOptions()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Validate command line arguments
 	if cfg.Config == "" && len(cfg.Mappings) == 0 {
 		log.Fatal().Msg("At least one configuration source must be provided: use -c for main config file or -m for mapping files")
@@ -252,8 +353,35 @@ func main() {
 		log.Fatal().Err(err).Msg("Failed to expand glob patterns in mapping files")
 	}
 
+	// Validate the configuration without starting the server
+	if cfg.ValidateOnly {
+		if err := runValidation(os.Stdout, cfg.Config, expandedMappings, cfg.loadOptions()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Print the parsed rules without starting the server
+	if cfg.command == dumpRulesCommand {
+		if err := runDumpRules(os.Stdout, cfg.Config, expandedMappings, cfg.loadOptions()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Test the rule examples without starting the server
+	if cfg.command == testExamplesCommand {
+		if err := runTestExamples(os.Stdout, cfg.Config, expandedMappings, cfg.loadOptions()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	// Load configuration from multiple sources
-	yamlConfig, err := config.LoadFromSources(cfg.Config, expandedMappings)
+	yamlConfig, err := config.LoadFromSourcesWithOptions(cfg.Config, expandedMappings, cfg.loadOptions())
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
@@ -265,6 +393,7 @@ func main() {
 
 	finalPort := yamlConfig.Port
 	finalLogLevel := yamlConfig.LogLevel
+	finalLogFormat := yamlConfig.LogFormat
 
 	// Use command line values if provided (they override config file)
 	if cfg.Port != nil {
@@ -273,28 +402,29 @@ func main() {
 	if cfg.LogLevel != nil {
 		finalLogLevel = *cfg.LogLevel
 	}
+	if cfg.LogFormat != nil {
+		finalLogFormat = *cfg.LogFormat
+	}
 
-	// Set up logging with the final log level
-	setupLogger(finalLogLevel)
+	// Set up logging with the final log level and format
+	setupLogger(finalLogLevel, finalLogFormat)
 
 	// Create a new mapper instance
-	m, err := mapper.NewMapper(yamlConfig.Lists)
+	m, err := mapper.NewMapper(yamlConfig.Lists, mapperOptions(yamlConfig)...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create mapper")
 	}
 
 	// Create fiber app
-	app := fiber.New(fiber.Config{
-		BodyLimit:       maxInputLength,
-		ReadBufferSize:  64 * 1024, // 64KB - increase header size limit
-		WriteBufferSize: 64 * 1024, // 64KB - increase response buffer size,
-	})
+	app := fiber.New(fiberConfig(yamlConfig))
 
 	// Add zerolog-integrated logger middleware
 	app.Use(setupFiberLogger())
 
-	// Set up routes
-	setupRoutes(app, m, yamlConfig)
+	// Set up routes; reloading uses the same sources as the startup
+	setupRoutesWithReload(app, m, yamlConfig, func() (*config.MappingConfig, error) {
+		return config.LoadFromSourcesWithOptions(cfg.Config, expandedMappings, cfg.loadOptions())
+	})
 
 	// Start server
 	go func() {
@@ -319,17 +449,73 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
-	// Graceful shutdown
-	log.Info().Msg("Shutting down server")
-	if err := app.Shutdown(); err != nil {
+	// Graceful shutdown, draining in-flight requests up to the timeout
+	log.Info().Int("timeout", yamlConfig.ShutdownTimeout).Msg("Shutting down server")
+	closed, err := shutdownServer(app, time.Duration(yamlConfig.ShutdownTimeout)*time.Second)
+	if err != nil {
 		log.Error().Err(err).Msg("Error during shutdown")
 	}
+	if closed > 0 {
+		log.Warn().Int32("connections", closed).Msg("Forcibly closed connections after shutdown timeout")
+	}
+}
+
+// mapperOptions returns the mapper options set in the configuration.
+func mapperOptions(yamlConfig *config.MappingConfig) []mapper.Option {
+	return []mapper.Option{
+		mapper.WithEditorName(yamlConfig.EditorName),
+		mapper.WithQueryKeys(yamlConfig.QueryKeys...),
+		mapper.WithFieldPaths(yamlConfig.FieldPaths...),
+		mapper.WithReferenceKeys(yamlConfig.ReferenceKeys...),
+		mapper.WithPassthroughID(yamlConfig.PassthroughID),
+		mapper.WithSnippetAttr(yamlConfig.SnippetAttr),
+	}
+}
+
+// runValidation loads the configuration and parses all mapping rules
+// without starting the server. A summary of the loaded lists is written
+// to w. An error is returned if loading or parsing fails.
+func runValidation(w io.Writer, configFile string, mappingFiles []string, opts config.LoadOptions) error {
+	yamlConfig, err := config.LoadFromSourcesWithOptions(configFile, mappingFiles, opts)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	if _, err := mapper.NewMapper(yamlConfig.Lists); err != nil {
+		return fmt.Errorf("failed to create mapper: %w", err)
+	}
+
+	fmt.Fprintf(w, "Configuration valid lists=%d\n", len(yamlConfig.Lists))
+	for _, list := range yamlConfig.Lists {
+		listType := list.Type
+		if listType == "" {
+			listType = "annotation"
+		}
+		fmt.Fprintf(w, "Loaded mapping desc=%s id=%s type=%s rules=%d\n",
+			formatConsoleField(list.Description),
+			list.ID,
+			listType,
+			len(list.Mappings),
+		)
+	}
+	return nil
 }
 
 func setupRoutes(app *fiber.App, m *mapper.Mapper, yamlConfig *config.MappingConfig) {
+	setupRoutesWithReload(app, m, yamlConfig, nil)
+}
+
+// setupRoutesWithReload registers all routes. If a loader is given and a
+// reload token is configured, POST /reload replaces the mapping lists
+// with a freshly loaded configuration.
+func setupRoutesWithReload(app *fiber.App, m *mapper.Mapper, yamlConfig *config.MappingConfig, load configLoader) {
 	configTmpl := template.Must(template.ParseFS(staticFS, "static/config.html"))
 	pluginTmpl := template.Must(template.ParseFS(staticFS, "static/plugin.html"))
 
+	// Request IDs for tracing requests across services, echoed in the
+	// X-Request-ID response header and included in request log lines
+	app.Use(requestIDMiddleware())
+
 	// Security headers middleware to mitigate MIME-sniffing and referrer
 	// information leaks (OWASP Secure Headers). X-Frame-Options is
 	// intentionally omitted because the service is designed to be embedded
@@ -349,7 +535,9 @@ func setupRoutes(app *fiber.App, m *mapper.Mapper, yamlConfig *config.MappingCon
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: yamlConfig.AllowOrigins,
 		AllowMethods: []string{"GET", "POST"},
-		AllowHeaders: []string{"Content-Type"},
+		AllowHeaders: []string{"Content-Type", fiber.HeaderXRequestID},
+		// Debug headers are readable by plugin frames
+		ExposeHeaders: []string{headerApplied, headerAppliedCount, headerMatched, fiber.HeaderXRequestID},
 	}))
 
 	// Rate limiting middleware to prevent resource exhaustion from
@@ -366,27 +554,112 @@ func setupRoutes(app *fiber.App, m *mapper.Mapper, yamlConfig *config.MappingCon
 		LimiterMiddleware: limiter.SlidingWindow{},
 	}))
 
+	// All routes live below the "routePrefix" setting, e.g. behind a
+	// reverse proxy forwarding /plugin/koralmapper/ unchanged
+	var routes fiber.Router = app
+	if yamlConfig.RoutePrefix != "" {
+		routes = app.Group(yamlConfig.RoutePrefix)
+	}
+
 	// Health check endpoint
-	app.Get("/health", func(c fiber.Ctx) error {
+	routes.Get("/health", func(c fiber.Ctx) error {
 		return c.SendString("OK")
 	})
 
-	// Static file serving from embedded FS
-	app.Get("/static/*", handleStaticFile())
+	// Build information for deployment tooling
+	routes.Get("/version", handleVersion)
+
+	// Static file serving from embedded FS, only needed by the plugin pages
+	if !yamlConfig.DisablePluginUI {
+		routes.Get("/static/*", handleStaticFile())
+	}
+
+	// Prometheus metrics endpoint, only exposed when enabled via the
+	// "metrics" YAML key or the KORAL_MAPPER_METRICS environment variable
+	var metrics *transformMetrics
+	if yamlConfig.Metrics {
+		metrics = newTransformMetrics()
+		routes.Get("/metrics", metrics.handler())
+	}
+
+	// Handlers depending on the mapping lists are swapped as a whole
+	// on reload
+	buildHandlers := func(m *mapper.Mapper, yamlConfig *config.MappingConfig) *mappingHandlers {
+		rates := newListRateLimits(yamlConfig.Lists)
+		return &mappingHandlers{
+			compositeQuery:    handleCompositeQueryTransform(m, yamlConfig, metrics, rates),
+			compositeResponse: handleCompositeResponseTransform(m, yamlConfig, metrics, rates),
+			query:             handleTransform(m, yamlConfig, metrics, rates),
+			response:          handleResponseTransform(m, yamlConfig, metrics, rates),
+			plugin:            handleKalamarPlugin(yamlConfig, configTmpl, pluginTmpl),
+			info:              handleMapInfo(yamlConfig),
+			rules:             handleMapRules(yamlConfig),
+			adhocQuery:        handleAdhocQuery(yamlConfig, metrics),
+			ruleTest:          handleRuleTest(yamlConfig, metrics),
+			queryStream:       handleQueryStream(m, yamlConfig, metrics, rates),
+			stats:             handleStats(m),
+			configJSON:        handleConfigJSON(yamlConfig),
+			bodyLimit:         limitRequestBody(newInputLimits(yamlConfig)),
+		}
+	}
+	live := &liveHandlers{}
+	live.current.Store(buildHandlers(m, yamlConfig))
+
+	// Bodies of all routes but the stream are read up to the body limit
+	// of the live configuration
+	bodyLimit := live.route(func(h *mappingHandlers) fiber.Handler { return h.bodyLimit })
+
+	// Reload endpoint, only exposed when a reload token is configured via
+	// the "reloadToken" YAML key or the KORAL_MAPPER_RELOAD_TOKEN
+	// environment variable
+	if load != nil && yamlConfig.ReloadToken != "" {
+		routes.Post("/reload", bodyLimit, handleReload(yamlConfig.ReloadToken, load, live, buildHandlers))
+	}
+
+	// Rule application counts, exposed together with the metrics
+	if yamlConfig.Metrics {
+		routes.Get("/stats", live.route(func(h *mappingHandlers) fiber.Handler { return h.stats }))
+	}
+
+	// Ad-hoc rule endpoint, registered before the cfg path it shadows
+	routes.Post("/query/adhoc", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.adhocQuery }))
+
+	// Rule test endpoint with the rule and input in the body
+	routes.Post("/test", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.ruleTest }))
 
 	// Composite cascade transformation endpoints (cfg in path)
-	app.Post("/query/:cfg", handleCompositeQueryTransform(m, yamlConfig))
-	app.Post("/response/:cfg", handleCompositeResponseTransform(m, yamlConfig))
+	routes.Post("/query/:cfg", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.compositeQuery }))
+	routes.Post("/response/:cfg", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.compositeResponse }))
+
+	// Named pipeline endpoints (?pipeline=name)
+	routes.Post("/query", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.compositeQuery }))
+	routes.Post("/response", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.compositeResponse }))
 
 	// Transformation endpoint
-	app.Post("/:map/query", handleTransform(m, yamlConfig))
+	routes.Post("/:map/query", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.query }))
+
+	// Streaming transformation of newline-delimited JSON
+	routes.Post("/:map/query/stream", live.route(func(h *mappingHandlers) fiber.Handler { return h.queryStream }))
 
 	// Response transformation endpoint
-	app.Post("/:map/response", handleResponseTransform(m, yamlConfig))
+	routes.Post("/:map/response", bodyLimit, live.route(func(h *mappingHandlers) fiber.Handler { return h.response }))
 
-	// Kalamar plugin endpoint
-	app.Get("/", handleKalamarPlugin(yamlConfig, configTmpl, pluginTmpl))
-	app.Get("/:map", handleKalamarPlugin(yamlConfig, configTmpl, pluginTmpl))
+	// Mapping list metadata endpoint
+	routes.Get("/:map/info", live.route(func(h *mappingHandlers) fiber.Handler { return h.info }))
+
+	// Parsed rules of a mapping list
+	routes.Get("/:map/rules", live.route(func(h *mappingHandlers) fiber.Handler { return h.rules }))
+
+	// Configuration page data, registered before the map path it shadows
+	routes.Get("/config.json", live.route(func(h *mappingHandlers) fiber.Handler { return h.configJSON }))
+
+	// Kalamar plugin endpoint, not exposed in API-only deployments
+	// disabling it via the "disablePluginUI" YAML key or the
+	// KORAL_MAPPER_DISABLE_PLUGIN_UI environment variable
+	if !yamlConfig.DisablePluginUI {
+		routes.Get("/", live.route(func(h *mappingHandlers) fiber.Handler { return h.plugin }))
+		routes.Get("/:map", live.route(func(h *mappingHandlers) fiber.Handler { return h.plugin }))
+	}
 }
 
 func handleStaticFile() fiber.Handler {
@@ -408,6 +681,25 @@ func handleStaticFile() fiber.Handler {
 	}
 }
 
+// handleStats returns the number of applications of each rule of the
+// mapper as JSON, by list ID and rule index.
+func handleStats(m *mapper.Mapper) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(m.Stats())
+	}
+}
+
+// handleVersion returns the build information of the server as JSON.
+func handleVersion(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"version":     config.Version,
+		"hash":        config.Buildhash,
+		"date":        config.Buildtime,
+		"title":       config.Title,
+		"description": config.Description,
+	})
+}
+
 func buildBasePageData(yamlConfig *config.MappingConfig) BasePageData {
 	return BasePageData{
 		Title:       config.Title,
@@ -466,28 +758,49 @@ func buildConfigPageData(yamlConfig *config.MappingConfig) ConfigPageData {
 	return data
 }
 
-func handleCompositeQueryTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig) fiber.Handler {
+func handleCompositeQueryTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig, metrics *transformMetrics, rates *listRateLimits) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+	resolver := newListResolver(yamlConfig.Lists)
 	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
 	for i := range yamlConfig.Lists {
 		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
 	}
 
 	return func(c fiber.Ctx) error {
+		start := time.Now()
+		var orderedIDs []string
+		defer func() {
+			metrics.record("composite-query", orderedIDs, c.Response().StatusCode(), time.Since(start))
+		}()
+
 		cfgRaw := c.Params("cfg")
-		if len(cfgRaw) > maxParamLength {
+		if len(cfgRaw) > limits.maxParamBytes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("cfg too long (max %d bytes)", limits.maxParamBytes),
+			})
+		}
+		pipelineName := c.Query("pipeline", "")
+		if len(pipelineName) > limits.maxParamBytes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("pipeline too long (max %d bytes)", limits.maxParamBytes),
+			})
+		}
+		cfgRaw, err := resolveCascadeCfg(cfgRaw, pipelineName, yamlConfig)
+		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("cfg too long (max %d bytes)", maxParamLength),
+				"error": err.Error(),
 			})
 		}
+		cfgRaw = resolver.resolveCfg(cfgRaw, requestLanguages(c))
 
-		var jsonData any
-		if err := c.Bind().Body(&jsonData); err != nil {
+		jsonData, err := bindRequestBody(c, yamlConfig)
+		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "invalid JSON in request body",
+				"error": err.Error(),
 			})
 		}
 
-		entries, err := ParseCfgParam(cfgRaw, yamlConfig.Lists)
+		entries, err := ParseCfgParam(cfgRaw, yamlConfig.Lists, yamlConfig.PassthroughID)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
@@ -495,7 +808,7 @@ func handleCompositeQueryTransform(m *mapper.Mapper, yamlConfig *config.MappingC
 		}
 
 		if len(entries) == 0 {
-			return c.JSON(jsonData)
+			return writeQueryResult(c, yamlConfig, jsonData)
 		}
 
 		rewrites := c.Query("rewrites", "")
@@ -504,8 +817,10 @@ func handleCompositeQueryTransform(m *mapper.Mapper, yamlConfig *config.MappingC
 			v := rewrites == "true"
 			rewritesOverride = &v
 		}
+		continueOnError := c.Query("continueOnError", "") == "true"
 
-		orderedIDs := make([]string, 0, len(entries))
+		trace := requestTrace(c)
+		orderedIDs = make([]string, 0, len(entries))
 		opts := make([]mapper.MappingOptions, 0, len(entries))
 		for _, entry := range entries {
 			dir := mapper.AtoB
@@ -523,51 +838,80 @@ func handleCompositeQueryTransform(m *mapper.Mapper, yamlConfig *config.MappingC
 
 			orderedIDs = append(orderedIDs, entry.ID)
 			opts = append(opts, mapper.MappingOptions{
-				Direction:   dir,
-				FoundryA:    entry.FoundryA,
-				LayerA:      entry.LayerA,
-				FoundryB:    entry.FoundryB,
-				LayerB:      entry.LayerB,
-				FieldA:      entry.FieldA,
-				FieldB:      entry.FieldB,
-				AddRewrites: addRewrites,
+				Direction:       dir,
+				FoundryA:        entry.FoundryA,
+				LayerA:          entry.LayerA,
+				FoundryB:        entry.FoundryB,
+				LayerB:          entry.LayerB,
+				FieldA:          entry.FieldA,
+				FieldB:          entry.FieldB,
+				AddRewrites:     addRewrites,
+				ContinueOnError: continueOnError,
+				Trace:           trace,
 			})
 		}
 
-		result, err := m.CascadeQueryMappings(orderedIDs, opts, jsonData)
-		if err != nil {
-			log.Error().Err(err).Str("cfg", cfgRaw).Msg("Failed to apply composite query mappings")
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+		if id, ok := rates.allow(orderedIDs...); !ok {
+			return rateLimitExceeded(c, id)
+		}
+
+		ctx, cancel := transformContext(c, yamlConfig)
+		defer cancel()
+
+		result, err := m.CascadeQueryMappingsContext(ctx, orderedIDs, opts, jsonData)
+		if err = reportSkippedSteps(c, err); err != nil {
+			requestLogger(c).Error().Err(err).Str("cfg", cfgRaw).Msg("Failed to apply composite query mappings")
+			return transformError(c, err)
 		}
 
-		return c.JSON(result)
+		reportTrace(c, trace)
+		return writeQueryResult(c, yamlConfig, result)
 	}
 }
 
-func handleCompositeResponseTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig) fiber.Handler {
+func handleCompositeResponseTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig, metrics *transformMetrics, rates *listRateLimits) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+	resolver := newListResolver(yamlConfig.Lists)
 	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
 	for i := range yamlConfig.Lists {
 		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
 	}
 
 	return func(c fiber.Ctx) error {
+		start := time.Now()
+		var orderedIDs []string
+		defer func() {
+			metrics.record("composite-response", orderedIDs, c.Response().StatusCode(), time.Since(start))
+		}()
+
 		cfgRaw := c.Params("cfg")
-		if len(cfgRaw) > maxParamLength {
+		if len(cfgRaw) > limits.maxParamBytes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("cfg too long (max %d bytes)", limits.maxParamBytes),
+			})
+		}
+		pipelineName := c.Query("pipeline", "")
+		if len(pipelineName) > limits.maxParamBytes {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("pipeline too long (max %d bytes)", limits.maxParamBytes),
+			})
+		}
+		cfgRaw, err := resolveCascadeCfg(cfgRaw, pipelineName, yamlConfig)
+		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("cfg too long (max %d bytes)", maxParamLength),
+				"error": err.Error(),
 			})
 		}
+		cfgRaw = resolver.resolveCfg(cfgRaw, requestLanguages(c))
 
-		var jsonData any
-		if err := c.Bind().Body(&jsonData); err != nil {
+		jsonData, err := bindRequestBody(c, yamlConfig)
+		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "invalid JSON in request body",
+				"error": err.Error(),
 			})
 		}
 
-		entries, err := ParseCfgParam(cfgRaw, yamlConfig.Lists)
+		entries, err := ParseCfgParam(cfgRaw, yamlConfig.Lists, yamlConfig.PassthroughID)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
@@ -575,7 +919,7 @@ func handleCompositeResponseTransform(m *mapper.Mapper, yamlConfig *config.Mappi
 		}
 
 		if len(entries) == 0 {
-			return c.JSON(jsonData)
+			return writeResult(c, jsonData)
 		}
 
 		rewrites := c.Query("rewrites", "")
@@ -584,8 +928,10 @@ func handleCompositeResponseTransform(m *mapper.Mapper, yamlConfig *config.Mappi
 			v := rewrites == "true"
 			rewritesOverride = &v
 		}
+		continueOnError := c.Query("continueOnError", "") == "true"
 
-		orderedIDs := make([]string, 0, len(entries))
+		trace := requestTrace(c)
+		orderedIDs = make([]string, 0, len(entries))
 		opts := make([]mapper.MappingOptions, 0, len(entries))
 		for _, entry := range entries {
 			dir := mapper.AtoB
@@ -603,46 +949,72 @@ func handleCompositeResponseTransform(m *mapper.Mapper, yamlConfig *config.Mappi
 
 			orderedIDs = append(orderedIDs, entry.ID)
 			opts = append(opts, mapper.MappingOptions{
-				Direction:   dir,
-				FoundryA:    entry.FoundryA,
-				LayerA:      entry.LayerA,
-				FoundryB:    entry.FoundryB,
-				LayerB:      entry.LayerB,
-				FieldA:      entry.FieldA,
-				FieldB:      entry.FieldB,
-				AddRewrites: addRewrites,
+				Direction:       dir,
+				FoundryA:        entry.FoundryA,
+				LayerA:          entry.LayerA,
+				FoundryB:        entry.FoundryB,
+				LayerB:          entry.LayerB,
+				FieldA:          entry.FieldA,
+				FieldB:          entry.FieldB,
+				AddRewrites:     addRewrites,
+				ContinueOnError: continueOnError,
+				Trace:           trace,
 			})
 		}
 
-		result, err := m.CascadeResponseMappings(orderedIDs, opts, jsonData)
-		if err != nil {
-			log.Error().Err(err).Str("cfg", cfgRaw).Msg("Failed to apply composite response mappings")
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+		if id, ok := rates.allow(orderedIDs...); !ok {
+			return rateLimitExceeded(c, id)
+		}
+
+		ctx, cancel := transformContext(c, yamlConfig)
+		defer cancel()
+
+		result, err := m.CascadeResponseMappingsContext(ctx, orderedIDs, opts, jsonData)
+		if err = reportSkippedSteps(c, err); err != nil {
+			requestLogger(c).Error().Err(err).Str("cfg", cfgRaw).Msg("Failed to apply composite response mappings")
+			return transformError(c, err)
 		}
 
-		return c.JSON(result)
+		reportTrace(c, trace)
+		return writeResult(c, result)
 	}
 }
 
-func handleTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig) fiber.Handler {
+func handleTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig, metrics *transformMetrics, rates *listRateLimits) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+	resolver := newListResolver(yamlConfig.Lists)
 	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
 	for i := range yamlConfig.Lists {
 		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
 	}
 
 	return func(c fiber.Ctx) error {
+		start := time.Now()
+		defer func() {
+			// Only known list IDs are used as labels to bound cardinality
+			var mapIDs []string
+			if id := resolver.resolve(c.Params("map"), requestLanguages(c)); listsByID[id] != nil {
+				mapIDs = []string{id}
+			}
+			metrics.record("query", mapIDs, c.Response().StatusCode(), time.Since(start))
+		}()
+
 		// Extract and validate parameters
-		params, err := extractRequestParams(c)
+		params, err := extractRequestParams(c, limits)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
+		params.MapID = resolver.resolve(params.MapID, requestLanguages(c))
+		params.Dir = effectiveDirection(params.Dir, listsByID[params.MapID])
+
+		if _, ok := rates.allow(params.MapID); !ok {
+			return rateLimitExceeded(c, params.MapID)
+		}
 
 		// Parse request body
-		jsonData, direction, err := parseRequestBody(c, params.Dir)
+		jsonData, direction, err := parseRequestBody(c, params.Dir, yamlConfig)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
@@ -659,47 +1031,69 @@ func handleTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig) fiber.H
 		}
 
 		// Apply mappings
-		result, err := m.ApplyQueryMappings(params.MapID, mapper.MappingOptions{
+		ctx, cancel := transformContext(c, yamlConfig)
+		defer cancel()
+
+		trace := requestTrace(c)
+		result, err := m.ApplyQueryMappingsContext(ctx, params.MapID, mapper.MappingOptions{
 			Direction:   direction,
 			FoundryA:    params.FoundryA,
 			FoundryB:    params.FoundryB,
 			LayerA:      params.LayerA,
 			LayerB:      params.LayerB,
 			AddRewrites: addRewrites,
+			Trace:       trace,
 		}, jsonData)
 
 		if err != nil {
-			log.Error().Err(err).
+			requestLogger(c).Error().Err(err).
 				Str("mapID", params.MapID).
 				Str("direction", params.Dir).
 				Msg("Failed to apply mappings")
 
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+			return transformError(c, err)
 		}
 
-		return c.JSON(result)
+		reportTrace(c, trace)
+		return writeQueryResult(c, yamlConfig, result)
 	}
 }
 
-func handleResponseTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig) fiber.Handler {
+func handleResponseTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig, metrics *transformMetrics, rates *listRateLimits) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+	resolver := newListResolver(yamlConfig.Lists)
 	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
 	for i := range yamlConfig.Lists {
 		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
 	}
 
 	return func(c fiber.Ctx) error {
+		start := time.Now()
+		defer func() {
+			// Only known list IDs are used as labels to bound cardinality
+			var mapIDs []string
+			if id := resolver.resolve(c.Params("map"), requestLanguages(c)); listsByID[id] != nil {
+				mapIDs = []string{id}
+			}
+			metrics.record("response", mapIDs, c.Response().StatusCode(), time.Since(start))
+		}()
+
 		// Extract and validate parameters
-		params, err := extractRequestParams(c)
+		params, err := extractRequestParams(c, limits)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
+		params.MapID = resolver.resolve(params.MapID, requestLanguages(c))
+		params.Dir = effectiveDirection(params.Dir, listsByID[params.MapID])
+
+		if _, ok := rates.allow(params.MapID); !ok {
+			return rateLimitExceeded(c, params.MapID)
+		}
 
 		// Parse request body
-		jsonData, direction, err := parseRequestBody(c, params.Dir)
+		jsonData, direction, err := parseRequestBody(c, params.Dir, yamlConfig)
 		if err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
@@ -716,32 +1110,36 @@ func handleResponseTransform(m *mapper.Mapper, yamlConfig *config.MappingConfig)
 		}
 
 		// Apply response mappings
-		result, err := m.ApplyResponseMappings(params.MapID, mapper.MappingOptions{
+		ctx, cancel := transformContext(c, yamlConfig)
+		defer cancel()
+
+		trace := requestTrace(c)
+		result, err := m.ApplyResponseMappingsContext(ctx, params.MapID, mapper.MappingOptions{
 			Direction:   direction,
 			FoundryA:    params.FoundryA,
 			FoundryB:    params.FoundryB,
 			LayerA:      params.LayerA,
 			LayerB:      params.LayerB,
 			AddRewrites: addRewrites,
+			Trace:       trace,
 		}, jsonData)
 
 		if err != nil {
-			log.Error().Err(err).
+			requestLogger(c).Error().Err(err).
 				Str("mapID", params.MapID).
 				Str("direction", params.Dir).
 				Msg("Failed to apply response mappings")
 
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": err.Error(),
-			})
+			return transformError(c, err)
 		}
 
-		return c.JSON(result)
+		reportTrace(c, trace)
+		return writeResult(c, result)
 	}
 }
 
 // validateInput checks if the input parameters are valid
-func validateInput(mapID, dir, foundryA, foundryB, layerA, layerB string, body []byte) error {
+func validateInput(limits inputLimits, mapID, dir, foundryA, foundryB, layerA, layerB string, body []byte) error {
 	// Define parameter checks
 	params := []struct {
 		name  string
@@ -757,22 +1155,23 @@ func validateInput(mapID, dir, foundryA, foundryB, layerA, layerB string, body [
 
 	for _, param := range params {
 		// Check input lengths and invalid characters in one combined condition
-		if len(param.value) > maxParamLength {
-			return fmt.Errorf("%s too long (max %d bytes)", param.name, maxParamLength)
+		if len(param.value) > limits.maxParamBytes {
+			return fmt.Errorf("%s too long (max %d bytes)", param.name, limits.maxParamBytes)
 		}
 		if strings.ContainsAny(param.value, "<>{}[]\\") {
 			return fmt.Errorf("%s contains invalid characters", param.name)
 		}
 	}
 
-	if len(body) > maxInputLength {
-		return fmt.Errorf("request body too large (max %d bytes)", maxInputLength)
+	if len(body) > limits.maxBodyBytes {
+		return fmt.Errorf("request body too large (max %d bytes)", limits.maxBodyBytes)
 	}
 
 	return nil
 }
 
 func handleKalamarPlugin(yamlConfig *config.MappingConfig, configTmpl *template.Template, pluginTmpl *template.Template) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
 	return func(c fiber.Ctx) error {
 		mapID, _ := url.PathUnescape(c.Params("map"))
 
@@ -781,7 +1180,7 @@ func handleKalamarPlugin(yamlConfig *config.MappingConfig, configTmpl *template.
 			data := buildConfigPageData(yamlConfig)
 			var buf bytes.Buffer
 			if err := configTmpl.Execute(&buf, data); err != nil {
-				log.Error().Err(err).Msg("Failed to execute config template")
+				requestLogger(c).Error().Err(err).Msg("Failed to execute config template")
 				return c.Status(fiber.StatusInternalServerError).SendString("internal error")
 			}
 			c.Set("Content-Type", "text/html")
@@ -797,7 +1196,7 @@ func handleKalamarPlugin(yamlConfig *config.MappingConfig, configTmpl *template.
 		layerB := c.Query("layerB", "")
 
 		// Validate input parameters and direction in one step
-		if err := validateInput(mapID, dir, foundryA, foundryB, layerA, layerB, []byte{}); err != nil {
+		if err := validateInput(limits, mapID, dir, foundryA, foundryB, layerA, layerB, []byte{}); err != nil {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": err.Error(),
 			})
@@ -817,20 +1216,9 @@ func handleKalamarPlugin(yamlConfig *config.MappingConfig, configTmpl *template.
 			LayerB:   layerB,
 		}
 
-		queryURL, err := buildMapServiceURL(yamlConfig.ServiceURL, mapID, "query", queryParams)
-		if err != nil {
-			log.Warn().Err(err).Msg("Failed to build query service URL")
-			return c.Status(fiber.StatusInternalServerError).SendString("internal error")
-		}
-		reversed := queryParams
-		if queryParams.Dir == "btoa" {
-			reversed.Dir = "atob"
-		} else {
-			reversed.Dir = "btoa"
-		}
-		responseURL, err := buildMapServiceURL(yamlConfig.ServiceURL, mapID, "response", reversed)
+		queryURL, responseURL, err := buildMapServiceURLs(yamlConfig.ServiceURL, mapID, queryParams)
 		if err != nil {
-			log.Warn().Err(err).Msg("Failed to build response service URL")
+			requestLogger(c).Warn().Err(err).Msg("Failed to build service URLs")
 			return c.Status(fiber.StatusInternalServerError).SendString("internal error")
 		}
 
@@ -844,7 +1232,7 @@ func handleKalamarPlugin(yamlConfig *config.MappingConfig, configTmpl *template.
 
 		var buf bytes.Buffer
 		if err := pluginTmpl.Execute(&buf, data); err != nil {
-			log.Error().Err(err).Msg("Failed to execute plugin template")
+			requestLogger(c).Error().Err(err).Msg("Failed to execute plugin template")
 			return c.Status(fiber.StatusInternalServerError).SendString("internal error")
 		}
 		c.Set("Content-Type", "text/html")
@@ -852,6 +1240,26 @@ func handleKalamarPlugin(yamlConfig *config.MappingConfig, configTmpl *template.
 	}
 }
 
+// buildMapServiceURLs returns the query and response service URLs of a
+// mapping list. The response URL maps in the reverse direction.
+func buildMapServiceURLs(serviceURL, mapID string, params QueryParams) (string, string, error) {
+	queryURL, err := buildMapServiceURL(serviceURL, mapID, "query", params)
+	if err != nil {
+		return "", "", err
+	}
+	reversed := params
+	if params.Dir == "btoa" {
+		reversed.Dir = "atob"
+	} else {
+		reversed.Dir = "btoa"
+	}
+	responseURL, err := buildMapServiceURL(serviceURL, mapID, "response", reversed)
+	if err != nil {
+		return "", "", err
+	}
+	return queryURL, responseURL, nil
+}
+
 func buildMapServiceURL(serviceURL, mapID, endpoint string, params QueryParams) (string, error) {
 	service, err := url.Parse(serviceURL)
 	if err != nil {
@@ -871,31 +1279,47 @@ func formatConsoleField(value string) string {
 
 // buildQueryParams builds a query string from the provided parameters
 func buildQueryParams(dir, foundryA, foundryB, layerA, layerB string) string {
-	params := url.Values{}
-	if dir != "" {
-		params.Add("dir", dir)
-	}
-	if foundryA != "" {
-		params.Add("foundryA", foundryA)
-	}
-	if foundryB != "" {
-		params.Add("foundryB", foundryB)
-	}
-	if layerA != "" {
-		params.Add("layerA", layerA)
-	}
-	if layerB != "" {
-		params.Add("layerB", layerB)
-	}
-	return params.Encode()
+	return client.Options{
+		Dir:      dir,
+		FoundryA: foundryA,
+		FoundryB: foundryB,
+		LayerA:   layerA,
+		LayerB:   layerB,
+	}.Encode()
 }
 
 // expandGlobs expands glob patterns in the slice of file paths
-// Returns the expanded list of files or an error if glob expansion fails
+// Returns the expanded list of files or an error if glob expansion fails.
+// A directory path expands to the YAML files directly inside it; a
+// directory path followed by "/**" expands to all YAML files below it.
 func expandGlobs(patterns []string) ([]string, error) {
 	var expanded []string
 
 	for _, pattern := range patterns {
+		// URLs are fetched and standard input is read as given
+		if config.IsRemoteSource(pattern) || pattern == config.StdinSource {
+			expanded = append(expanded, pattern)
+			continue
+		}
+
+		if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+			files, err := findMappingFiles(dir, true)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, files...)
+			continue
+		}
+
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			files, err := findMappingFiles(pattern, false)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, files...)
+			continue
+		}
+
 		// Use filepath.Glob which works cross-platform
 		matches, err := filepath.Glob(pattern)
 		if err != nil {
@@ -913,3 +1337,43 @@ func expandGlobs(patterns []string) ([]string, error) {
 
 	return expanded, nil
 }
+
+// findMappingFiles returns the *.yaml and *.yml files in dir, gzipped or
+// not, in lexical order. When recursive is true, subdirectories are
+// searched as well.
+func findMappingFiles(dir string, recursive bool) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isMappingFile(d.Name()) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping directory '%s': %w", dir, err)
+	}
+
+	if len(files) == 0 {
+		log.Warn().Str("dir", dir).Msg("Mapping directory contains no YAML files")
+	}
+
+	return files, nil
+}
+
+// isMappingFile reports whether a file name has a YAML extension,
+// optionally followed by ".gz" for gzipped files.
+func isMappingFile(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".gz")
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
@@ -1,22 +1,36 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/KorAP/Koral-Mapper/client"
 	tmconfig "github.com/KorAP/Koral-Mapper/config"
 	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/alecthomas/kong"
 	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -273,7 +287,7 @@ lists:
 			mapID:         "nonexistent",
 			direction:     "atob",
 			input:         `{"@type": "koral:token"}`,
-			expectedCode:  http.StatusInternalServerError,
+			expectedCode:  http.StatusNotFound,
 			expectedError: "mapping list with ID nonexistent not found",
 		},
 		{
@@ -452,7 +466,7 @@ lists:
 			mapID:         "nonexistent",
 			direction:     "atob",
 			input:         `{"snippet": "<span>test</span>"}`,
-			expectedCode:  http.StatusInternalServerError,
+			expectedCode:  http.StatusNotFound,
 			expectedError: "mapping list with ID nonexistent not found",
 		},
 		{
@@ -965,6 +979,104 @@ mappings:
 	}
 }
 
+func TestExpandGlobsDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"mapper1.yaml":         "id: dir-mapper-1\nmappings:\n  - \"[A] <> [B]\"\n",
+		"mapper2.yml":          "id: dir-mapper-2\nmappings:\n  - \"[C] <> [D]\"\n",
+		"notes.txt":            "not a yaml file",
+		"sub/mapper3.yaml":     "id: dir-mapper-3\nmappings:\n  - \"[E] <> [F]\"\n",
+		"sub/deep/mapper4.yml": "id: dir-mapper-4\nmappings:\n  - \"[G] <> [H]\"\n",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+	}{
+		{
+			name:     "Directory without trailing slash",
+			patterns: []string{tempDir},
+			expected: []string{filepath.Join(tempDir, "mapper1.yaml"), filepath.Join(tempDir, "mapper2.yml")},
+		},
+		{
+			name:     "Directory with trailing slash",
+			patterns: []string{tempDir + "/"},
+			expected: []string{filepath.Join(tempDir, "mapper1.yaml"), filepath.Join(tempDir, "mapper2.yml")},
+		},
+		{
+			name:     "Recursive directory",
+			patterns: []string{tempDir + "/**"},
+			expected: []string{
+				filepath.Join(tempDir, "mapper1.yaml"),
+				filepath.Join(tempDir, "mapper2.yml"),
+				filepath.Join(tempDir, "sub", "deep", "mapper4.yml"),
+				filepath.Join(tempDir, "sub", "mapper3.yaml"),
+			},
+		},
+		{
+			name:     "Directory mixed with literal file",
+			patterns: []string{filepath.Join(tempDir, "sub"), filepath.Join(tempDir, "mapper1.yaml")},
+			expected: []string{filepath.Join(tempDir, "sub", "mapper3.yaml"), filepath.Join(tempDir, "mapper1.yaml")},
+		},
+		{
+			name:     "URL is kept as given",
+			patterns: []string{"https://example.org/mappings/*.yaml", tempDir},
+			expected: []string{"https://example.org/mappings/*.yaml", filepath.Join(tempDir, "mapper1.yaml"), filepath.Join(tempDir, "mapper2.yml")},
+		},
+		{
+			name:     "Standard input is kept as given",
+			patterns: []string{"-"},
+			expected: []string{"-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandGlobs(tt.patterns)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	t.Run("Recursive expansion of missing directory fails", func(t *testing.T) {
+		_, err := expandGlobs([]string{filepath.Join(tempDir, "missing") + "/**"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Gzipped files are included", func(t *testing.T) {
+		gzipDir := t.TempDir()
+		for _, name := range []string{"a.yaml.gz", "b.YML.gz", "c.txt.gz", "d.yaml"} {
+			require.NoError(t, os.WriteFile(filepath.Join(gzipDir, name), nil, 0644))
+		}
+		result, err := expandGlobs([]string{gzipDir})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(gzipDir, "a.yaml.gz"),
+			filepath.Join(gzipDir, "b.YML.gz"),
+			filepath.Join(gzipDir, "d.yaml"),
+		}, result)
+
+		result, err = expandGlobs([]string{filepath.Join(gzipDir, "*.yaml.gz")})
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(gzipDir, "a.yaml.gz")}, result)
+	})
+
+	t.Run("Directory files load as mapping lists", func(t *testing.T) {
+		expanded, err := expandGlobs([]string{tempDir + "/**"})
+		require.NoError(t, err)
+		cfg, err := tmconfig.LoadFromSources("", expanded)
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 4)
+	})
+}
+
 func TestGlobMappingFileLoading(t *testing.T) {
 	// Create a temporary directory for test files
 	tempDir, err := os.MkdirTemp("", "glob_mapping_test_*")
@@ -1739,6 +1851,190 @@ lists:
 	}
 }
 
+func TestNamedPipelineEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+pipelines:
+  - name: full-pos
+    steps:
+      - step1:atob
+      - step2:atob
+lists:
+  - id: step1
+    foundryA: opennlp
+    layerA: p
+    foundryB: stts
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+  - id: step2
+    foundryA: stts
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[DET] <> [PRON]"
+`)
+	require.Len(t, cfg.Pipelines, 1)
+
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	input := `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+	}`
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expected     any
+	}{
+		{
+			name:         "named pipeline cascades its steps",
+			url:          "/query?pipeline=full-pos",
+			expectedCode: http.StatusOK,
+			expected: map[string]any{
+				"@type": "koral:token",
+				"wrap": map[string]any{
+					"@type":   "koral:term",
+					"foundry": "upos",
+					"key":     "PRON",
+					"layer":   "p",
+					"match":   "match:eq",
+				},
+			},
+		},
+		{
+			name:         "ad-hoc cfg still works",
+			url:          "/query/step1:atob",
+			expectedCode: http.StatusOK,
+			expected: map[string]any{
+				"@type": "koral:token",
+				"wrap": map[string]any{
+					"@type":   "koral:term",
+					"foundry": "stts",
+					"key":     "DET",
+					"layer":   "p",
+					"match":   "match:eq",
+				},
+			},
+		},
+		{
+			name:         "unknown pipeline returns bad request",
+			url:          "/query?pipeline=missing",
+			expectedCode: http.StatusBadRequest,
+			expected: map[string]any{
+				"error": `unknown pipeline "missing"`,
+			},
+		},
+		{
+			name:         "pipeline cannot be combined with cfg",
+			url:          "/query/step1:atob?pipeline=full-pos",
+			expectedCode: http.StatusBadRequest,
+			expected: map[string]any{
+				"error": "cfg and pipeline cannot be combined",
+			},
+		},
+		{
+			name:         "unknown pipeline on response endpoint",
+			url:          "/response?pipeline=missing",
+			expectedCode: http.StatusBadRequest,
+			expected: map[string]any{
+				"error": `unknown pipeline "missing"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(input))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			var actual any
+			err = json.Unmarshal(body, &actual)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestCompositeCorpusFieldOverrides(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: corpus-step
+    type: corpus
+    mappings:
+      - "textClass=science <> textClass=akademisch"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expected     map[string]any
+	}{
+		{
+			name:         "fields of the 4-field form override the rule keys",
+			url:          "/query/corpus-step:atob:wikiCat:topic",
+			expectedCode: http.StatusOK,
+			expected: map[string]any{
+				"@type": "koral:doc", "key": "topic", "value": "akademisch", "match": "match:eq",
+			},
+		},
+		{
+			name:         "2-field form keeps the rule keys",
+			url:          "/query/corpus-step:atob",
+			expectedCode: http.StatusOK,
+			expected: map[string]any{
+				"@type": "koral:doc", "key": "wikiCat", "value": "science", "match": "match:eq",
+			},
+		},
+		{
+			name:         "annotation form is rejected for corpus lists",
+			url:          "/query/corpus-step:atob:opennlp:p:upos:p",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(`{
+				"corpus": {"@type": "koral:doc", "key": "wikiCat", "value": "science", "match": "match:eq"}
+			}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expected == nil {
+				return
+			}
+			var actual map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&actual))
+			assert.Equal(t, tt.expected, actual["corpus"])
+		})
+	}
+}
+
 func TestCompositeResponseEndpoint(t *testing.T) {
 	cfg := loadConfigFromYAML(t, `
 lists:
@@ -2294,6 +2590,84 @@ func TestBuildConfigPageData(t *testing.T) {
 	assert.Equal(t, "First corpus", data.CorpusMappings[0].Description)
 }
 
+func TestConfigJSONEndpoint(t *testing.T) {
+	lists := []tmconfig.MappingList{
+		{
+			ID:          "anno-mapper",
+			Description: "Annotation mapping",
+			FoundryA:    "opennlp",
+			LayerA:      "p",
+			FoundryB:    "upos",
+			LayerB:      "p",
+			Mappings:    []tmconfig.MappingRule{"[A] <> [B]"},
+		},
+		{
+			ID:          "corpus-mapper",
+			Type:        "corpus",
+			Description: "Corpus mapping",
+			FieldA:      "wikiCat",
+			FieldB:      "textClass",
+			Mappings:    []tmconfig.MappingRule{"textClass=science <> textClass=akademisch"},
+		},
+	}
+	m, err := mapper.NewMapper(lists)
+	require.NoError(t, err)
+
+	mockConfig := &tmconfig.MappingConfig{
+		SDK:        "https://example.com/sdk.js",
+		Server:     "https://example.com/",
+		ServiceURL: "https://example.com/plugin/koralmapper",
+		Lists:      lists,
+	}
+
+	app := fiber.New()
+	setupRoutes(app, m, mockConfig)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/config.json", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/json")
+
+	var data map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+
+	assert.Equal(t, "https://example.com/", data["server"])
+	assert.Equal(t, "https://example.com/sdk.js", data["sdk"])
+	assert.Equal(t, "https://example.com/plugin/koralmapper", data["serviceURL"])
+
+	annotations, ok := data["annotationMappings"].([]any)
+	require.True(t, ok)
+	require.Len(t, annotations, 1)
+	anno := annotations[0].(map[string]any)
+	assert.Equal(t, "anno-mapper", anno["id"])
+	assert.Equal(t, "annotation", anno["type"])
+	assert.Equal(t, "Annotation mapping", anno["desc"])
+	assert.Equal(t, "opennlp", anno["foundryA"])
+	assert.Equal(t, "upos", anno["foundryB"])
+
+	corpora, ok := data["corpusMappings"].([]any)
+	require.True(t, ok)
+	require.Len(t, corpora, 1)
+	corpus := corpora[0].(map[string]any)
+	assert.Equal(t, "corpus-mapper", corpus["id"])
+	assert.Equal(t, "corpus", corpus["type"])
+	assert.Equal(t, "wikiCat", corpus["fieldA"])
+	assert.Equal(t, "textClass", corpus["fieldB"])
+
+	// Without lists of a type, the group is an empty array
+	app = fiber.New()
+	setupRoutes(app, m, &tmconfig.MappingConfig{Lists: lists[:1]})
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/config.json", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	data = nil
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&data))
+	assert.Equal(t, []any{}, data["corpusMappings"])
+}
+
 func TestConfigPageDefaultsAsPlaceholdersOnly(t *testing.T) {
 	lists := []tmconfig.MappingList{
 		{
@@ -3318,3 +3692,2606 @@ lists:
 	assert.False(t, hasRewrites,
 		"mapper-overrides-off should NOT have rewrites (per-list false overrides global true)")
 }
+
+func TestRunValidation(t *testing.T) {
+	writeTemp := func(t *testing.T, content string) string {
+		t.Helper()
+		f, err := os.CreateTemp("", "koralmapper-validate-*.yaml")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = os.Remove(f.Name()) })
+		_, err = f.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		return f.Name()
+	}
+
+	t.Run("Valid configuration", func(t *testing.T) {
+		configPath := writeTemp(t, `
+lists:
+  - id: ann-mapper
+    desc: Annotation mapper
+    mappings:
+      - "[A] <> [B]"
+      - "[C] <> [D]"
+  - id: corpus-mapper
+    type: corpus
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+		var out bytes.Buffer
+		require.NoError(t, runValidation(&out, configPath, nil, tmconfig.LoadOptions{}))
+		assert.Equal(t,
+			"Configuration valid lists=2\n"+
+				"Loaded mapping desc=\"Annotation mapper\" id=ann-mapper type=annotation rules=2\n"+
+				"Loaded mapping desc= id=corpus-mapper type=corpus rules=1\n",
+			out.String())
+	})
+
+	t.Run("Unparsable rule", func(t *testing.T) {
+		configPath := writeTemp(t, `
+lists:
+  - id: broken-mapper
+    mappings:
+      - "[A] <> "
+`)
+		var out bytes.Buffer
+		err := runValidation(&out, configPath, nil, tmconfig.LoadOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create mapper")
+		assert.Contains(t, err.Error(), "broken-mapper")
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("Missing configuration file", func(t *testing.T) {
+		var out bytes.Buffer
+		err := runValidation(&out, filepath.Join(os.TempDir(), "koralmapper-does-not-exist.yaml"), nil, tmconfig.LoadOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to load configuration")
+	})
+}
+
+func TestMapRulesEndpoint(t *testing.T) {
+	cfg, err := tmconfig.LoadFromSources("", []string{"../../mappings/stts-upos.yaml"})
+	require.NoError(t, err)
+	cfg.Lists = append(cfg.Lists, tmconfig.MappingList{
+		ID:       "one-way",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []tmconfig.MappingRule{"[PIDAT] >> [DET]"},
+	})
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	get := func(path string) (int, dumpedList) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var list dumpedList
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+		}
+		return resp.StatusCode, list
+	}
+
+	status, list := get("/stts-upos/rules")
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "stts-upos", list.ID)
+	assert.Equal(t, "annotation", list.Type)
+	assert.Len(t, list.Rules, len(cfg.Lists[0].Mappings))
+
+	idx := slices.IndexFunc(list.Rules, func(r dumpedRule) bool {
+		return strings.HasPrefix(r.Rule, "[PIDAT] <>")
+	})
+	require.GreaterOrEqual(t, idx, 0)
+	rule := list.Rules[idx]
+	assert.Equal(t, &dumpedSides{Pattern: "upper", Replacement: "lower"}, rule.AtoB)
+	assert.Equal(t, &dumpedSides{Pattern: "lower", Replacement: "upper"}, rule.BtoA)
+
+	var upper, lower map[string]any
+	require.NoError(t, json.Unmarshal(rule.Upper, &upper))
+	require.NoError(t, json.Unmarshal(rule.Lower, &lower))
+	assert.Equal(t, map[string]any{
+		"@type":   "koral:term",
+		"foundry": "opennlp",
+		"key":     "PIDAT",
+		"layer":   "p",
+		"match":   "match:eq",
+	}, upper["wrap"])
+	lowerWrap := lower["wrap"].(map[string]any)
+	assert.Equal(t, "koral:termGroup", lowerWrap["@type"])
+	assert.Equal(t, "relation:and", lowerWrap["relation"])
+	assert.Len(t, lowerWrap["operands"], 3)
+
+	// A one-way rule has no sides for the other direction
+	status, list = get("/one-way/rules")
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, list.Rules, 1)
+	assert.NotNil(t, list.Rules[0].AtoB)
+	assert.Nil(t, list.Rules[0].BtoA)
+
+	status, _ = get("/unknown/rules")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestRunDumpRules(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, runDumpRules(&out, "", []string{"../../mappings/stts-upos.yaml"}, tmconfig.LoadOptions{}))
+
+	var lists []dumpedList
+	require.NoError(t, json.Unmarshal(out.Bytes(), &lists))
+	require.Len(t, lists, 1)
+	assert.Equal(t, "stts-upos", lists[0].ID)
+	assert.Equal(t, "annotation", lists[0].Type)
+
+	idx := slices.IndexFunc(lists[0].Rules, func(r dumpedRule) bool {
+		return strings.HasPrefix(r.Rule, "[PIDAT] <>")
+	})
+	require.GreaterOrEqual(t, idx, 0)
+
+	var upper, lower map[string]any
+	require.NoError(t, json.Unmarshal(lists[0].Rules[idx].Upper, &upper))
+	require.NoError(t, json.Unmarshal(lists[0].Rules[idx].Lower, &lower))
+
+	assert.Equal(t, map[string]any{
+		"@type": "koral:token",
+		"wrap": map[string]any{
+			"@type":   "koral:term",
+			"foundry": "opennlp",
+			"key":     "PIDAT",
+			"layer":   "p",
+			"match":   "match:eq",
+		},
+	}, upper)
+
+	term := func(key, layer string) map[string]any {
+		return map[string]any{
+			"@type":   "koral:term",
+			"foundry": "upos",
+			"key":     key,
+			"layer":   layer,
+			"match":   "match:eq",
+		}
+	}
+	assert.Equal(t, map[string]any{
+		"@type": "koral:token",
+		"wrap": map[string]any{
+			"@type":    "koral:termGroup",
+			"relation": "relation:and",
+			"operands": []any{
+				term("DET", "p"),
+				term("Pdt", "AdjType"),
+				map[string]any{
+					"@type":    "koral:termGroup",
+					"relation": "relation:or",
+					"operands": []any{
+						term("Ind", "PronType"),
+						term("Neg", "PronType"),
+						term("Tot", "PronType"),
+					},
+				},
+			},
+		},
+	}, lower)
+}
+
+func TestDumpRulesCommandArgs(t *testing.T) {
+	cfg, err := parseArgs(t, "dump-rules", "-m", "../../mappings/stts-upos.yaml", "--strict")
+	require.NoError(t, err)
+	assert.Equal(t, dumpRulesCommand, cfg.command)
+	assert.Equal(t, []string{"../../mappings/stts-upos.yaml"}, cfg.Mappings)
+	assert.True(t, cfg.Strict)
+
+	_, err = parseArgs(t, "dump-rules", "extra")
+	assert.Error(t, err)
+}
+
+func TestTestExamplesCommandArgs(t *testing.T) {
+	cfg, err := parseArgs(t, "test-examples", "-m", "mappings/*.yaml", "--profile", "dev")
+	require.NoError(t, err)
+	assert.Equal(t, testExamplesCommand, cfg.command)
+	assert.Equal(t, []string{"mappings/*.yaml"}, cfg.Mappings)
+	assert.Equal(t, "dev", cfg.Profile)
+
+	_, err = parseArgs(t, "--test-examples", "-m", "mappings/*.yaml")
+	assert.Error(t, err)
+}
+
+func TestRunTestExamples(t *testing.T) {
+	writeMapping := func(t *testing.T, content string) string {
+		mapFile, err := os.CreateTemp("", "koralmapper-examples-*.yaml")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.Remove(mapFile.Name()) })
+		_, err = mapFile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, mapFile.Close())
+		return mapFile.Name()
+	}
+
+	passing := writeMapping(t, `
+id: examples
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - "[ADJA] <> [ADJ]"
+  - rule: "[PIDAT] <> [DET]"
+    id: pidat
+    example: {"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PIDAT", "match": "match:eq"}}
+    expected: {"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "layer": "p", "key": "DET", "match": "match:eq"}}
+  - rule: "[PPER] <> [PRON]"
+    example:
+      "@type": koral:token
+      wrap: {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PPER", "match": "match:eq"}
+  - rule: "[NN] << [NOUN]"
+    example: {"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "layer": "p", "key": "NOUN", "match": "match:eq"}}
+`)
+
+	var out bytes.Buffer
+	require.NoError(t, runTestExamples(&out, "", []string{passing}, tmconfig.LoadOptions{}))
+	assert.Equal(t, "PASS examples rule 1 (pidat)\nPASS examples rule 2\nPASS examples rule 3\n3 examples, 0 failed\n", out.String())
+
+	failing := writeMapping(t, `
+id: examples
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - rule: "[PIDAT] <> [DET]"
+    example: {"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PIDAT", "match": "match:eq"}}
+    expected: {"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "layer": "p", "key": "PRON", "match": "match:eq"}}
+  - rule: "[PPER] <> [PRON]"
+    example: {"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PIS", "match": "match:eq"}}
+`)
+
+	out.Reset()
+	err := runTestExamples(&out, "", []string{failing}, tmconfig.LoadOptions{})
+	require.Error(t, err)
+	assert.Equal(t, "2 of 2 examples failed", err.Error())
+	assert.Contains(t, out.String(), "FAIL examples rule 0: result differs\n")
+	assert.Contains(t, out.String(), `"key":"DET"`)
+	assert.Contains(t, out.String(), "FAIL examples rule 1: rule does not match the example\n")
+	assert.True(t, strings.HasSuffix(out.String(), "2 examples, 2 failed\n"))
+}
+
+// parseArgs parses command line arguments like parseConfig does.
+func parseArgs(t *testing.T, args ...string) (*appConfig, error) {
+	cfg := &appConfig{}
+	parser, err := kong.New(cfg)
+	require.NoError(t, err)
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	cfg.command = ctx.Command()
+	return cfg, nil
+}
+
+func TestDiffCommandArgs(t *testing.T) {
+	// Paths may contain commas
+	cfg, err := parseArgs(t, "diff", "old,v1.yaml", "new.yaml", "--strict")
+	require.NoError(t, err)
+	assert.Equal(t, diffCommand, cfg.command)
+	assert.Equal(t, "old,v1.yaml", cfg.Diff.Old)
+	assert.Equal(t, "new.yaml", cfg.Diff.New)
+	assert.True(t, cfg.Strict)
+
+	_, err = parseArgs(t, "diff", "old.yaml")
+	assert.Error(t, err)
+
+	// Without a command, the server is started
+	cfg, err = parseArgs(t, "-c", "config.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "serve", cfg.command)
+	assert.Equal(t, "config.yaml", cfg.Config)
+}
+
+func TestRunDiff(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		file, err := os.CreateTemp("", "koralmapper-diff-*.yaml")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.Remove(file.Name()) })
+		_, err = file.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		return file.Name()
+	}
+
+	oldFile := writeConfig(t, `
+lists:
+  - id: stts-upos
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+      - "[PIDAT] <> [DET]"
+      - rule: "[NN] <> [NOUN]"
+        id: noun
+  - id: legacy
+    mappings:
+      - "[a/b=X] <> [c/d=Y]"
+`)
+	newFile := writeConfig(t, `
+lists:
+  - id: stts-upos
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[opennlp/p=ADJA] <> [upos/p=ADJ]"
+      - "[PIDAT] <> [PRON]"
+      - rule: "[NN] <> [NOUN]"
+        id: noun
+  - id: genres
+    type: corpus
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+
+	t.Run("Changed rule", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, runDiff(&out, oldFile, newFile, tmconfig.LoadOptions{}))
+		assert.Equal(t, "- list legacy (1 rules)\n"+
+			"~ list stts-upos\n"+
+			"    ~ rule 1: [PIDAT] <> [DET] -> [PIDAT] <> [PRON]\n"+
+			"+ list genres (1 rules)\n"+
+			"1 lists added, 1 removed, 1 changed\n", out.String())
+	})
+
+	t.Run("Identical configurations", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, runDiff(&out, oldFile, oldFile, tmconfig.LoadOptions{}))
+		assert.Equal(t, "0 lists added, 0 removed, 0 changed\n", out.String())
+	})
+
+	t.Run("Settings and rules by ID", func(t *testing.T) {
+		oldMapping := writeConfig(t, `
+id: nouns
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - rule: "[NN] <> [NOUN]"
+    id: noun
+  - rule: "[NE] <> [PROPN]"
+    id: name
+`)
+		newMapping := writeConfig(t, `
+id: nouns
+desc: Nouns
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - rule: "[NN] <> [NOUN & X]"
+    id: noun
+  - "[FM] <> [X]"
+`)
+		var out bytes.Buffer
+		require.NoError(t, runDiff(&out, oldMapping, newMapping, tmconfig.LoadOptions{}))
+		assert.Equal(t, "~ list nouns\n"+
+			"    ~ desc: (unset) -> Nouns\n"+
+			"    ~ rule 0 (noun): [NN] <> [NOUN] -> [NN] <> [NOUN & X]\n"+
+			"    - rule 1 (name): [NE] <> [PROPN]\n"+
+			"    + rule 1: [FM] <> [X]\n"+
+			"0 lists added, 0 removed, 1 changed\n", out.String())
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		err := runDiff(io.Discard, oldFile, "does-not-exist.yaml", tmconfig.LoadOptions{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does-not-exist.yaml")
+	})
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	mappingYAML := `
+id: metrics-mapper
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - "[PIDAT] <> [DET]"
+`
+	input := `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}}`
+
+	t.Run("disabled by default", func(t *testing.T) {
+		cfg := loadConfigFromYAML(t, "", mappingYAML)
+		m, err := mapper.NewMapper(cfg.Lists)
+		require.NoError(t, err)
+		app := fiber.New()
+		setupRoutes(app, m, cfg)
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.NotContains(t, string(body), "koralmapper_transform_requests_total")
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := loadConfigFromYAML(t, "metrics: true\n", mappingYAML)
+		m, err := mapper.NewMapper(cfg.Lists)
+		require.NoError(t, err)
+		app := fiber.New()
+		setupRoutes(app, m, cfg)
+
+		for _, target := range []string{"/metrics-mapper/query?dir=atob", "/query/metrics-mapper:atob", "/metrics-mapper/query?dir=sideways"} {
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(input))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		metrics := string(body)
+		assert.Contains(t, metrics, `koralmapper_transform_requests_total{endpoint="query",map="metrics-mapper"} 2`)
+		assert.Contains(t, metrics, `koralmapper_transform_requests_total{endpoint="composite-query",map="metrics-mapper"} 1`)
+		assert.Contains(t, metrics, `koralmapper_transform_errors_total{endpoint="query",status="400"} 1`)
+		assert.Contains(t, metrics, "koralmapper_transform_duration_seconds_bucket")
+	})
+}
+
+func TestDisabledMappingList(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: active-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+  - id: disabled-mapper
+    enabled: false
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`)
+	require.Len(t, cfg.Lists, 1)
+
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	input := `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/disabled-mapper/query?dir=atob", bytes.NewBufferString(input))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var result map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "mapping list with ID disabled-mapper not found", result["error"])
+
+	// Disabled lists are not accepted in composite cfg strings either
+	req = httptest.NewRequest(http.MethodPost, "/query/disabled-mapper:atob", bytes.NewBufferString(input))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The config page only lists enabled mappings
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `data-id="active-mapper"`)
+	assert.NotContains(t, string(body), "disabled-mapper")
+}
+
+func TestTransformXMLContentNegotiation(t *testing.T) {
+	cfg := loadConfigFromYAML(t, "", `
+id: xml-mapper
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - "[PIDAT] <> [DET]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	input := `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}}`
+
+	t.Run("XML when requested", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/xml-mapper/query?dir=atob", bytes.NewBufferString(input))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/xml")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/xml; charset=utf-8", resp.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+			`<koral><type>koral:token</type><wrap><type>koral:term</type><foundry>upos</foundry>`+
+			`<key>DET</key><layer>p</layer><match>match:eq</match></wrap></koral>`, string(body))
+	})
+
+	t.Run("JSON by default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/xml-mapper/query?dir=atob", bytes.NewBufferString(input))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("Content-Type"), "application/json")
+	})
+
+	t.Run("XML encoding of arrays and escaping", func(t *testing.T) {
+		data, err := encodeResultXML(map[string]any{
+			"operands": []any{"a<b", 1.0, nil},
+			"9key":     true,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+			`<koral><_9key>true</_9key><operands><item>a&lt;b</item><item>1</item><item></item></operands></koral>`, string(data))
+	})
+}
+
+func TestTransformErrorStatus(t *testing.T) {
+	m, err := mapper.NewMapper(nil)
+	require.NoError(t, err)
+	_, notFoundErr := m.ApplyQueryMappings("x", mapper.MappingOptions{}, map[string]any{})
+	_, invalidErr := mapper.ParseDirection("sideways")
+
+	app := fiber.New()
+	app.Get("/:kind", func(c fiber.Ctx) error {
+		switch c.Params("kind") {
+		case "not-found":
+			return transformError(c, fmt.Errorf("cascade step 0 (mapping %q): %w", "x", notFoundErr))
+		case "invalid":
+			return transformError(c, invalidErr)
+		case "canceled":
+			return transformError(c, fmt.Errorf("cascade step 0: %w", context.Canceled))
+		case "timeout":
+			return transformError(c, context.DeadlineExceeded)
+		default:
+			return transformError(c, errors.New("broken rule"))
+		}
+	})
+
+	tests := []struct {
+		kind       string
+		wantStatus int
+		wantError  string
+	}{
+		{"canceled", http.StatusServiceUnavailable, "request canceled"},
+		{"timeout", http.StatusServiceUnavailable, "request timed out"},
+		{"not-found", http.StatusNotFound, `cascade step 0 (mapping "x"): mapping list with ID x not found`},
+		{"invalid", http.StatusBadRequest, "invalid direction: sideways"},
+		{"other", http.StatusInternalServerError, "broken rule"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/"+tt.kind, nil))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			var result map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			assert.Equal(t, tt.wantError, result["error"])
+		})
+	}
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	oldLogger := log.Logger
+	oldLevel := zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = oldLogger
+		zerolog.SetGlobalLevel(oldLevel)
+	}()
+
+	var buf bytes.Buffer
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	log.Logger = zerolog.New(logWriter("json", &buf)).With().Timestamp().Logger()
+
+	app := fiber.New()
+	app.Use(setupFiberLogger())
+	app.Get("/ok", func(c fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/bad", func(c fiber.Ctx) error {
+		return c.Status(fiber.StatusBadRequest).SendString("bad")
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ok", nil))
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/bad", nil))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), "not a JSON line: %s", line)
+		assert.Equal(t, "HTTP request", entry["message"])
+		assert.Equal(t, http.MethodGet, entry["method"])
+		assert.Contains(t, entry, "latency")
+		assert.Contains(t, entry, "ip")
+		assert.Contains(t, entry, "time")
+	}
+
+	var first, second map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, "/ok", first["path"])
+	assert.Equal(t, float64(http.StatusOK), first["status"])
+	assert.Equal(t, "info", first["level"])
+	assert.Equal(t, "/bad", second["path"])
+	assert.Equal(t, float64(http.StatusBadRequest), second["status"])
+	assert.Equal(t, "warn", second["level"])
+
+	// The console format is not JSON
+	buf.Reset()
+	log.Logger = zerolog.New(logWriter("console", &buf))
+	log.Info().Msg("hello")
+	assert.False(t, json.Valid(bytes.TrimSpace(buf.Bytes())))
+	assert.Contains(t, buf.String(), "hello")
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	writeConfig := func(content string) {
+		require.NoError(t, os.WriteFile(configPath, []byte(content), 0o644))
+	}
+	writeConfig(`
+reloadToken: s3cret
+lists:
+  - id: first
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`)
+
+	cfg, err := tmconfig.LoadFromSources(configPath, nil)
+	require.NoError(t, err)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New()
+	setupRoutesWithReload(app, m, cfg, func() (*tmconfig.MappingConfig, error) {
+		return tmconfig.LoadFromSources(configPath, nil)
+	})
+
+	reload := func(auth string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/reload", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+	queryStatus := func(mapID string) int {
+		req := httptest.NewRequest(http.MethodPost, "/"+mapID+"/query?dir=atob",
+			strings.NewReader(`{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("bad token", func(t *testing.T) {
+		status, result := reload("Bearer wrong")
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.Equal(t, "invalid or missing reload token", result["error"])
+
+		status, _ = reload("")
+		assert.Equal(t, http.StatusUnauthorized, status)
+	})
+
+	t.Run("successful reload", func(t *testing.T) {
+		writeConfig(`
+reloadToken: s3cret
+lists:
+  - id: second
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    desc: Reloaded
+    mappings:
+      - "[PIDAT] <> [DET]"
+      - "[ADJA] <> [ADJ]"
+`)
+		status, result := reload("Bearer s3cret")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, []any{map[string]any{
+			"id":    "second",
+			"desc":  "Reloaded",
+			"type":  "annotation",
+			"rules": float64(2),
+		}}, result["lists"])
+
+		assert.Equal(t, http.StatusOK, queryStatus("second"))
+		assert.NotEqual(t, http.StatusOK, queryStatus("first"))
+	})
+
+	t.Run("failed validation keeps old config", func(t *testing.T) {
+		writeConfig(`
+reloadToken: s3cret
+lists:
+  - id: broken
+    mappings:
+      - "[PIDAT <> [DET]"
+`)
+		status, result := reload("Bearer s3cret")
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.NotEmpty(t, result["error"])
+
+		assert.Equal(t, http.StatusOK, queryStatus("second"))
+	})
+}
+
+func TestReloadBodyLimit(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	writeConfig := func(maxBodyBytes int) {
+		require.NoError(t, os.WriteFile(configPath, []byte(fmt.Sprintf(`
+reloadToken: s3cret
+maxBodyBytes: %d
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`, maxBodyBytes)), 0o644))
+	}
+	writeConfig(256)
+
+	load := func() (*tmconfig.MappingConfig, error) {
+		return tmconfig.LoadFromSources(configPath, nil)
+	}
+	cfg, err := load()
+	require.NoError(t, err)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New(fiberConfig(cfg))
+	setupRoutesWithReload(app, m, cfg, load)
+
+	query := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"PIDAT","layer":"p","match":"match:eq"}}`
+	body := query + strings.Repeat(" ", 512-len(query))
+	post := func() (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/test-mapper/query?dir=atob", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+	reload := func() {
+		req := httptest.NewRequest(http.MethodPost, "/reload", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	status, result := post()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "request body too large (max 256 bytes)", result["error"])
+
+	writeConfig(1024)
+	reload()
+	status, _ = post()
+	assert.Equal(t, http.StatusOK, status)
+
+	writeConfig(128)
+	reload()
+	status, result = post()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "request body too large (max 128 bytes)", result["error"])
+}
+
+func TestReloadEndpointDisabledWithoutToken(t *testing.T) {
+	cfg := loadConfigFromYAML(t, "", `
+id: test-mapper
+mappings:
+  - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New()
+	setupRoutesWithReload(app, m, cfg, func() (*tmconfig.MappingConfig, error) {
+		return cfg, nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/reload", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestQueryReferencePassthrough(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	for _, input := range []string{
+		`{"query":{"@type":"koral:queryRef","ref":"https://korap.ids-mannheim.de/@ndiewald/MyQuery"}}`,
+		`{"@type":"koral:queryRef","ref":"https://korap.ids-mannheim.de/@ndiewald/MyQuery"}`,
+		`{"query":{"@type":"koral:reference","operation":"operation:focus","classRef":[1],"operands":[{"@type":"koral:queryRef","ref":"MyQuery"}]}}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/test-mapper/query?dir=atob&rewrites=true", bytes.NewBufferString(input))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, input)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.JSONEq(t, input, string(body))
+	}
+}
+
+func TestMapInfoEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+serviceURL: https://korap.example.org/plugin/koralmapper
+lists:
+  - id: test-mapper
+    desc: STTS to UPOS
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+      - "[PPER] <> [PRON]"
+  - id: corpus-mapper
+    type: corpus
+    fieldA: wikiCat
+    fieldB: textClass
+    mappings:
+      - "Entertainment <> kultur"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	t.Run("known annotation list", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/test-mapper/info?dir=btoa&foundryB=custom", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Equal(t, "test-mapper", result["id"])
+		assert.Equal(t, "STTS to UPOS", result["desc"])
+		assert.Equal(t, "annotation", result["type"])
+		assert.Equal(t, "opennlp", result["foundryA"])
+		assert.Equal(t, "upos", result["foundryB"])
+		assert.Equal(t, float64(2), result["rules"])
+		assert.Equal(t, "https://korap.example.org/plugin/koralmapper/test-mapper/query?dir=btoa&foundryB=custom", result["queryURL"])
+		assert.Equal(t, "https://korap.example.org/plugin/koralmapper/test-mapper/response?dir=atob&foundryB=custom", result["responseURL"])
+	})
+
+	t.Run("known corpus list", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/corpus-mapper/info", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Equal(t, "corpus", result["type"])
+		assert.Equal(t, "wikiCat", result["fieldA"])
+		assert.Equal(t, "textClass", result["fieldB"])
+		assert.Nil(t, result["foundryA"])
+		assert.Equal(t, float64(1), result["rules"])
+	})
+
+	t.Run("unknown list", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/nonexistent/info", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Equal(t, "mapping list with ID nonexistent not found", result["error"])
+	})
+}
+
+func TestConfigurableInputLimits(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+maxBodyBytes: 256
+maxParamBytes: 16
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New(fiberConfig(cfg))
+	setupRoutes(app, m, cfg)
+
+	post := func(path, body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+
+	query := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"PIDAT","layer":"p","match":"match:eq"}}`
+
+	t.Run("body within limit", func(t *testing.T) {
+		status, _ := post("/test-mapper/query?dir=atob", query)
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("body just over limit", func(t *testing.T) {
+		body := query + strings.Repeat(" ", 257-len(query))
+		require.Len(t, body, 257)
+
+		status, result := post("/test-mapper/query?dir=atob", body)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		assert.Equal(t, "request body too large (max 256 bytes)", result["error"])
+
+		err = validateInput(newInputLimits(cfg), "test-mapper", "atob", "", "", "", "", []byte(body))
+		assert.EqualError(t, err, "request body too large (max 256 bytes)")
+	})
+
+	t.Run("oversized body error", func(t *testing.T) {
+		errApp := fiber.New(fiberConfig(cfg))
+		errApp.Get("/", func(c fiber.Ctx) error {
+			return fiber.ErrRequestEntityTooLarge
+		})
+		resp, err := errApp.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		assert.Equal(t, "request body too large", result["error"])
+	})
+
+	t.Run("parameter over limit", func(t *testing.T) {
+		status, result := post("/test-mapper/query?dir=atob&foundryA="+strings.Repeat("a", 17), query)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "foundryA too long (max 16 bytes)", result["error"])
+	})
+}
+
+func TestLanguageListSelection(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: de-pos
+    name: pos
+    language: de
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+  - id: en-pos
+    name: pos
+    language: en
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [PRON]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	query := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"PIDAT","layer":"p","match":"match:eq"}}`
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptLanguage string
+		expectedKey    string
+	}{
+		{"lang parameter de", "/pos/query?dir=atob&lang=de", "", "DET"},
+		{"lang parameter en", "/pos/query?dir=atob&lang=en", "", "PRON"},
+		{"accept-language header", "/pos/query?dir=atob", "fr;q=0.9, en-GB, de;q=0.8", "PRON"},
+		{"lang parameter before header", "/pos/query?dir=atob&lang=de", "en", "DET"},
+		{"fallback to first variant", "/pos/query?dir=atob&lang=fr", "", "DET"},
+		{"explicit ID", "/en-pos/query?dir=atob&lang=de", "", "PRON"},
+		{"composite cfg", "/query/pos:atob?lang=en", "", "PRON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(query))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var result map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			wrap := result["wrap"].(map[string]any)
+			assert.Equal(t, tt.expectedKey, wrap["key"])
+		})
+	}
+}
+
+func TestRuleTestEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+maxParamBytes: 16
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	query := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"PIDAT","layer":"p","match":"match:eq"}}`
+
+	post := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/test", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+
+	t.Run("matching rule", func(t *testing.T) {
+		// Rules in the body are not limited by maxParamBytes
+		status, result := post(`{"rule":"[opennlp/p=PIDAT] <> [upos/p=DET]","direction":"atob","input":` + query + `}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, true, result["matched"])
+		assert.NotContains(t, result, "error")
+		wrap := result["result"].(map[string]any)["wrap"].(map[string]any)
+		assert.Equal(t, "upos", wrap["foundry"])
+		assert.Equal(t, "DET", wrap["key"])
+	})
+
+	t.Run("expected result", func(t *testing.T) {
+		status, result := post(`{"rule":"[opennlp/p=PIDAT] <> [upos/p=DET]","input":` + query + `,"expected":` + query + `}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, true, result["matched"])
+		assert.Equal(t, false, result["passed"])
+
+		expected := strings.Replace(strings.Replace(query, "PIDAT", "DET", 1), "opennlp", "upos", 1)
+		_, result = post(`{"rule":"[opennlp/p=PIDAT] <> [upos/p=DET]","input":` + query + `,"expected":` + expected + `}`)
+		assert.Equal(t, true, result["passed"])
+	})
+
+	t.Run("non-matching rule", func(t *testing.T) {
+		status, result := post(`{"rule":"[opennlp/p=PIDAT] <> [upos/p=DET]","direction":"btoa","input":` + query + `}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, false, result["matched"])
+		wrap := result["result"].(map[string]any)["wrap"].(map[string]any)
+		assert.Equal(t, "PIDAT", wrap["key"])
+	})
+
+	t.Run("corpus rule", func(t *testing.T) {
+		status, result := post(`{"rule":"textClass=novel <> genre=fiction","type":"corpus","input":{"corpus":{"@type":"koral:doc","key":"textClass","value":"novel","match":"match:eq"}}}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, true, result["matched"])
+		assert.Equal(t, "genre", result["result"].(map[string]any)["corpus"].(map[string]any)["key"])
+	})
+
+	t.Run("malformed rule", func(t *testing.T) {
+		status, result := post(`{"rule":"[opennlp/p=PIDAT <> [DET]","input":` + query + `}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, false, result["matched"])
+		assert.Contains(t, result["error"], "invalid rule:")
+		assert.NotContains(t, result, "result")
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		status, result := post(`{"rule":"[PIDAT] <> [DET]","input":{"@type":"koral:token","wrap":{"@type":"koral:term"}}}`)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, false, result["matched"])
+		assert.NotEmpty(t, result["error"])
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for body, message := range map[string]string{
+			``:                      "empty request body",
+			`not json`:              "invalid JSON in request body",
+			`{"input":{}}`:          "missing rule",
+			`{"rule":"[A] <> [B]"}`: "missing input",
+			`{"rule":"[A] <> [B]","type":"x","input":{}}`:       "invalid type, must be 'annotation' or 'corpus'",
+			`{"rule":"[A] <> [B]","direction":"up","input":{}}`: "invalid direction",
+		} {
+			status, result := post(body)
+			assert.Equal(t, http.StatusBadRequest, status, body)
+			assert.Contains(t, result["error"], message, body)
+		}
+	})
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"en-GB", "fr", "de"}, parseAcceptLanguage("fr;q=0.9, en-GB, *;q=0.5, de;q=0.8, es;q=0"))
+	assert.Empty(t, parseAcceptLanguage(""))
+}
+
+func TestAdhocQueryEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+maxParamBytes: 64
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	query := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"PIDAT","layer":"p","match":"match:eq"}}`
+
+	post := func(params url.Values, body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/query/adhoc?"+params.Encode(), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+
+	t.Run("valid rule", func(t *testing.T) {
+		status, result := post(url.Values{
+			"rule": {"[opennlp/p=PIDAT] <> [upos/p=DET]"},
+			"dir":  {"atob"},
+		}, query)
+		require.Equal(t, http.StatusOK, status)
+		wrap := result["wrap"].(map[string]any)
+		assert.Equal(t, "upos", wrap["foundry"])
+		assert.Equal(t, "DET", wrap["key"])
+	})
+
+	t.Run("valid corpus rule", func(t *testing.T) {
+		status, result := post(url.Values{
+			"rule": {"textClass=novel <> genre=fiction"},
+			"type": {"corpus"},
+		}, `{"corpus":{"@type":"koral:doc","key":"textClass","value":"novel","match":"match:eq"}}`)
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "genre", result["corpus"].(map[string]any)["key"])
+	})
+
+	t.Run("invalid rule", func(t *testing.T) {
+		status, result := post(url.Values{"rule": {"[opennlp/p=PIDAT <> [DET]"}}, query)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Contains(t, result["error"], "invalid rule:")
+		assert.Contains(t, result["error"], "parse")
+	})
+
+	t.Run("missing rule", func(t *testing.T) {
+		status, result := post(url.Values{}, query)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "missing rule parameter", result["error"])
+	})
+
+	t.Run("rule too long", func(t *testing.T) {
+		status, result := post(url.Values{"rule": {"[" + strings.Repeat("A", 64) + "] <> [B]"}}, query)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "rule too long (max 64 bytes)", result["error"])
+	})
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/version", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/json")
+
+	var info map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, map[string]string{
+		"version":     tmconfig.Version,
+		"hash":        tmconfig.Buildhash,
+		"date":        tmconfig.Buildtime,
+		"title":       tmconfig.Title,
+		"description": tmconfig.Description,
+	}, info)
+}
+
+func TestDefaultDirection(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: corpus-map
+    type: corpus
+    defaultDirection: btoa
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	post := func(url, body string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	// Without a dir parameter, the list's default direction is used
+	result := post("/corpus-map/response", `{"fields": [{"@type": "koral:field", "key": "genre", "value": "fiction", "type": "type:string"}]}`)
+	fields := result["fields"].([]any)
+	require.Len(t, fields, 2)
+	assert.Equal(t, "textClass", fields[1].(map[string]any)["key"])
+	assert.Equal(t, "novel", fields[1].(map[string]any)["value"])
+
+	result = post("/corpus-map/query", `{"corpus": {"@type": "koral:doc", "key": "genre", "value": "fiction", "match": "match:eq"}}`)
+	assert.Equal(t, "textClass", result["corpus"].(map[string]any)["key"])
+
+	// An explicit dir parameter takes precedence
+	result = post("/corpus-map/query?dir=atob", `{"corpus": {"@type": "koral:doc", "key": "textClass", "value": "novel", "match": "match:eq"}}`)
+	assert.Equal(t, "genre", result["corpus"].(map[string]any)["key"])
+}
+
+func TestQueryStreamEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	token := func(foundry, key string) string {
+		return `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"` + foundry + `","key":"` + key + `","layer":"p","match":"match:eq"}}`
+	}
+	body := strings.Join([]string{
+		token("opennlp", "PIDAT"),
+		`{"@type": "koral:token", "wrap": `,
+		"",
+		token("opennlp", "NN"),
+		token("opennlp", "PIDAT"),
+	}, "\n") + "\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/test-mapper/query/stream?dir=atob", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, lines, 4)
+
+	assert.JSONEq(t, token("upos", "DET"), lines[0])
+	assert.JSONEq(t, `{"error": "invalid JSON", "line": 2}`, lines[1])
+	assert.JSONEq(t, token("opennlp", "NN"), lines[2])
+	assert.JSONEq(t, token("upos", "DET"), lines[3])
+
+	// Unknown lists fail before streaming
+	req = httptest.NewRequest(http.MethodPost, "/unknown/query/stream", strings.NewReader(body))
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestQueryStreamBodyLargerThanLimit(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+maxBodyBytes: 256
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New(fiberConfig(cfg))
+	setupRoutes(app, m, cfg)
+
+	token := func(foundry, key string) string {
+		return `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"` + foundry + `","key":"` + key + `","layer":"p","match":"match:eq"}}`
+	}
+	body := strings.Repeat(token("opennlp", "PIDAT")+"\n", 100)
+	require.Greater(t, len(body), 256)
+
+	req := httptest.NewRequest(http.MethodPost, "/test-mapper/query/stream?dir=atob", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, lines, 100)
+	for _, line := range lines {
+		assert.JSONEq(t, token("upos", "DET"), line)
+	}
+
+	// The body limit applies to each line
+	req = httptest.NewRequest(http.MethodPost, "/test-mapper/query/stream?dir=atob",
+		strings.NewReader(token("opennlp", "PIDAT")+"\n"+strings.Repeat(" ", 300)+token("opennlp", "PIDAT")+"\n"))
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	lines = nil
+	scanner = bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, token("upos", "DET"), lines[0])
+	assert.JSONEq(t, `{"error": "bufio.Scanner: token too long", "line": 2}`, lines[1])
+
+	// Other routes still reject the body
+	req = httptest.NewRequest(http.MethodPost, "/test-mapper/query?dir=atob", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+metrics: true
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	query := `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "A", "layer": "p", "match": "match:eq"}}`
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/test-mapper/query", strings.NewReader(query))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/stats", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var stats map[string]map[string]uint64
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Equal(t, map[string]map[string]uint64{"test-mapper": {"0": 2}}, stats)
+}
+
+func TestShutdownServerTimeout(t *testing.T) {
+	app := fiber.New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	app.Get("/slow", func(c fiber.Ctx) error {
+		close(started)
+		<-release
+		return c.SendString("done")
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	}()
+
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow handler was not called")
+	}
+
+	start := time.Now()
+	closed, err := shutdownServer(app, 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Equal(t, int32(1), closed)
+}
+
+func TestShutdownServerDrained(t *testing.T) {
+	app := fiber.New()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	}()
+	require.Eventually(t, func() bool { return app.Server() != nil }, 5*time.Second, 10*time.Millisecond)
+
+	closed, err := shutdownServer(app, time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, closed)
+}
+
+func TestDebugHeaders(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[A] <> [B]"
+      - rule: "[B] <> [C]"
+        id: b-to-c
+  - id: corpus-mapper
+    type: corpus
+    mappings:
+      - "textClass=a <> genre=a"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	token := func(key string) string {
+		return `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "` + key + `", "layer": "p", "match": "match:eq"}}`
+	}
+
+	tests := []struct {
+		name          string
+		url           string
+		body          string
+		expectedCount string
+		expected      string
+	}{
+		{
+			name:          "matching rule",
+			url:           "/test-mapper/query?dir=atob&debugHeaders=true",
+			body:          token("A"),
+			expectedCount: "1",
+			expected:      "test-mapper:0",
+		},
+		{
+			name:          "rule with ID",
+			url:           "/test-mapper/query?dir=atob&debugHeaders=true",
+			body:          token("B"),
+			expectedCount: "1",
+			expected:      "test-mapper:1 (b-to-c)",
+		},
+		{
+			name:          "no matching rule",
+			url:           "/test-mapper/query?dir=atob&debugHeaders=true",
+			body:          token("X"),
+			expectedCount: "0",
+		},
+		{
+			name: "headers are off by default",
+			url:  "/test-mapper/query?dir=atob",
+			body: token("A"),
+		},
+		{
+			name:          "cascade lists rules in order",
+			url:           "/query/corpus-mapper:atob;test-mapper:atob?debugHeaders=true",
+			body:          `{"query": ` + token("A") + `, "corpus": {"@type": "koral:doc", "key": "textClass", "value": "a", "match": "match:eq"}}`,
+			expectedCount: "2",
+			expected:      "corpus-mapper:0, test-mapper:0",
+		},
+		{
+			name:          "response snippet",
+			url:           "/test-mapper/response?dir=atob&debugHeaders=true",
+			body:          `{"snippet": "<span title=\"opennlp/p:A\">a</span>"}`,
+			expectedCount: "1",
+			expected:      "test-mapper:0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.expectedCount, resp.Header.Get("X-Koral-Mapper-Applied-Count"))
+			assert.Equal(t, tt.expected, resp.Header.Get("X-Koral-Mapper-Applied"))
+		})
+	}
+}
+
+func TestRequireMatch(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	token := func(key string) string {
+		return `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"` + key + `","layer":"p","match":"match:eq"}}`
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+		expectedBody   string
+		matched        string
+	}{
+		{
+			name:           "matched",
+			url:            "/test-mapper/query?dir=atob&requireMatch=true",
+			body:           token("A"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"upos","key":"B","layer":"p","match":"match:eq"}}`,
+		},
+		{
+			name:           "unmatched",
+			url:            "/test-mapper/query?dir=atob&requireMatch=true",
+			body:           token("X"),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   token("X"),
+			matched:        "false",
+		},
+		{
+			name:           "unmatched without requireMatch",
+			url:            "/test-mapper/query?dir=atob",
+			body:           token("X"),
+			expectedStatus: http.StatusOK,
+			expectedBody:   token("X"),
+		},
+		{
+			name:           "unmatched cascade",
+			url:            "/query/test-mapper:btoa?requireMatch=true",
+			body:           token("X"),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   token("X"),
+			matched:        "false",
+		},
+		{
+			name:           "unmatched response",
+			url:            "/test-mapper/response?dir=atob&requireMatch=true",
+			body:           `{"snippet":"<span title=\"opennlp/p:X\">x</span>"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"snippet":"<span title=\"opennlp/p:X\">x</span>"}`,
+			matched:        "false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			assert.Equal(t, tt.matched, resp.Header.Get("X-Koral-Mapper-Matched"))
+			assert.Empty(t, resp.Header.Get("X-Koral-Mapper-Applied-Count"))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expectedBody, string(body))
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[A] <> [B]"
+  - id: second-mapper
+    foundryA: upos
+    layerA: p
+    foundryB: stts
+    layerB: p
+    mappings:
+      - "[B] <> [C]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+	server := httptest.NewServer(adaptor.FiberApp(app))
+	defer server.Close()
+
+	c := client.New(server.URL)
+
+	token := func(foundry, key string) map[string]any {
+		return map[string]any{
+			"@type": "koral:token",
+			"wrap": map[string]any{
+				"@type":   "koral:term",
+				"foundry": foundry,
+				"key":     key,
+				"layer":   "p",
+				"match":   "match:eq",
+			},
+		}
+	}
+	keyOf := func(t *testing.T, result any) string {
+		doc, ok := result.(map[string]any)
+		require.True(t, ok)
+		wrap, ok := doc["wrap"].(map[string]any)
+		require.True(t, ok)
+		return wrap["foundry"].(string) + "/" + wrap["key"].(string)
+	}
+
+	t.Run("query", func(t *testing.T) {
+		result, err := c.Query("test-mapper", client.Options{Dir: "atob"}, token("opennlp", "A"))
+		require.NoError(t, err)
+		assert.Equal(t, "upos/B", keyOf(t, result))
+	})
+
+	t.Run("query with foundry override", func(t *testing.T) {
+		result, err := c.Query("test-mapper", client.Options{Dir: "atob", FoundryB: "custom"}, token("opennlp", "A"))
+		require.NoError(t, err)
+		assert.Equal(t, "custom/B", keyOf(t, result))
+	})
+
+	t.Run("response", func(t *testing.T) {
+		result, err := c.Response("test-mapper", client.Options{Dir: "atob"}, map[string]any{
+			"snippet": `<span title="opennlp/p:A">Der</span>`,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, result.(map[string]any)["snippet"], "upos/p:B")
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		result, err := c.Cascade("test-mapper:atob;second-mapper:atob", token("opennlp", "A"))
+		require.NoError(t, err)
+		assert.Equal(t, "stts/C", keyOf(t, result))
+	})
+
+	t.Run("unknown mapping list", func(t *testing.T) {
+		_, err := c.Query("missing", client.Options{Dir: "atob"}, token("opennlp", "A"))
+		require.Error(t, err)
+		assert.ErrorIs(t, err, client.ErrNotFound)
+		var apiErr *client.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Contains(t, apiErr.Message, "missing")
+	})
+
+	t.Run("invalid direction", func(t *testing.T) {
+		_, err := c.Query("test-mapper", client.Options{Dir: "sideways"}, token("opennlp", "A"))
+		assert.ErrorIs(t, err, client.ErrBadRequest)
+	})
+
+	t.Run("invalid cascade", func(t *testing.T) {
+		_, err := c.Cascade("test-mapper:sideways", token("opennlp", "A"))
+		assert.ErrorIs(t, err, client.ErrBadRequest)
+	})
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+readTimeout: 1
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New(fiberConfig(cfg))
+	setupRoutes(app, m, cfg)
+	assert.Equal(t, time.Second, app.Config().ReadTimeout)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true})
+	}()
+	defer func() { _ = app.Shutdown() }()
+
+	// A client announcing a body it never sends is disconnected
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("POST /test-mapper/query HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: 100\r\n\r\n{"))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err, "connection should be closed by the server before the deadline")
+	assert.Less(t, time.Since(start), 4*time.Second)
+}
+
+func TestPassthroughEndpoint(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+passthroughID: noop
+pipelines:
+  - name: ab
+    steps:
+      - noop:atob
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists, mapperOptions(cfg)...)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{
+			name: "query",
+			url:  "/noop/query?dir=atob",
+			body: `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"A","layer":"p","match":"match:eq"}}`,
+		},
+		{
+			name: "stream",
+			url:  "/noop/query/stream",
+			body: `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"A","layer":"p","match":"match:eq"}}` + "\n",
+		},
+		{
+			name: "cascade",
+			url:  "/query/noop:atob",
+			body: `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"A","layer":"p","match":"match:eq"}}`,
+		},
+		{
+			name: "pipeline",
+			url:  "/query?pipeline=ab",
+			body: `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"A","layer":"p","match":"match:eq"}}`,
+		},
+		{
+			name: "response",
+			url:  "/noop/response",
+			body: `{"snippet":"<span title=\"opennlp/p:A\">Der</span>"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	oldLogger := log.Logger
+	oldLevel := zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = oldLogger
+		zerolog.SetGlobalLevel(oldLevel)
+	}()
+
+	var buf bytes.Buffer
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	log.Logger = zerolog.New(logWriter("json", &buf))
+
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(setupFiberLogger())
+	setupRoutes(app, m, cfg)
+
+	uuidPattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	logEntries := func(t *testing.T) []map[string]any {
+		var entries []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &entry), "not a JSON line: %s", line)
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	t.Run("incoming ID is echoed and logged", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("X-Request-ID", "trace-123")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, "trace-123", resp.Header.Get("X-Request-ID"))
+		entries := logEntries(t)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "trace-123", entries[0]["request_id"])
+	})
+
+	t.Run("missing ID is generated", func(t *testing.T) {
+		buf.Reset()
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		id := resp.Header.Get("X-Request-ID")
+		assert.Regexp(t, uuidPattern, id)
+		entries := logEntries(t)
+		require.Len(t, entries, 1)
+		assert.Equal(t, id, entries[0]["request_id"])
+
+		resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/health", nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.NotEqual(t, id, resp.Header.Get("X-Request-ID"))
+	})
+
+	t.Run("handler log lines carry the ID", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodPost, "/missing/query?dir=atob", bytes.NewBufferString(`{"@type": "koral:token"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", "trace-456")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		entries := logEntries(t)
+		require.Len(t, entries, 2)
+		for _, entry := range entries {
+			assert.Equal(t, "trace-456", entry["request_id"], "log line without request ID: %v", entry)
+		}
+	})
+}
+
+func TestListRateLimits(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: limited
+    requestsPerSecond: 0.5
+    burst: 2
+    mappings:
+      - "[A] <> [B]"
+  - id: unlimited
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	post := func(t *testing.T, url string) int {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(`{"@type":"koral:token","wrap":{"@type":"koral:term","key":"A","match":"match:eq"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests {
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, "rate limit exceeded for mapping list limited", body["error"])
+		}
+		return resp.StatusCode
+	}
+
+	// The burst is allowed, further requests are rejected for both
+	// directions and cascades including the list
+	assert.Equal(t, http.StatusOK, post(t, "/limited/query"))
+	assert.Equal(t, http.StatusOK, post(t, "/limited/response"))
+	assert.Equal(t, http.StatusTooManyRequests, post(t, "/limited/query"))
+	assert.Equal(t, http.StatusTooManyRequests, post(t, "/limited/response"))
+	assert.Equal(t, http.StatusTooManyRequests, post(t, "/query/unlimited:atob;limited:atob"))
+
+	for range 5 {
+		assert.Equal(t, http.StatusOK, post(t, "/unlimited/query"))
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rates := newListRateLimits([]tmconfig.MappingList{{ID: "limited", RequestsPerSecond: 2}})
+	rates.now = func() time.Time { return now }
+
+	// Without a burst setting, the rate rounded up is allowed at once
+	_, ok := rates.allow("limited")
+	assert.True(t, ok)
+	_, ok = rates.allow("limited")
+	assert.True(t, ok)
+	id, ok := rates.allow("limited")
+	assert.False(t, ok)
+	assert.Equal(t, "limited", id)
+
+	// Tokens refill at the rate, up to the burst
+	now = now.Add(500 * time.Millisecond)
+	_, ok = rates.allow("limited")
+	assert.True(t, ok)
+	_, ok = rates.allow("limited")
+	assert.False(t, ok)
+
+	now = now.Add(time.Minute)
+	for range 2 {
+		_, ok = rates.allow("limited")
+		assert.True(t, ok)
+	}
+	_, ok = rates.allow("limited")
+	assert.False(t, ok)
+
+	// Unknown and unlimited lists are always allowed
+	_, ok = rates.allow("other")
+	assert.True(t, ok)
+}
+
+func TestListAliasEndpoints(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: stts-upos
+    aliases: [opennlp-upos]
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	post := func(t *testing.T, url string) string {
+		req := httptest.NewRequest(http.MethodPost, url, bytes.NewBufferString(`{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"ADJA","layer":"p","match":"match:eq"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		return string(body)
+	}
+
+	expected := post(t, "/stts-upos/query?dir=atob")
+	assert.Contains(t, expected, `"key":"ADJ"`)
+	assert.Equal(t, expected, post(t, "/opennlp-upos/query?dir=atob"))
+	assert.Equal(t, expected, post(t, "/query/opennlp-upos:atob"))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/opennlp-upos/info", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var info map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, "stts-upos", info["id"])
+	assert.Equal(t, []any{"opennlp-upos"}, info["aliases"])
+}
+
+func TestDisablePluginUI(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+disablePluginUI: true
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	for _, path := range []string{"/", "/test-mapper", "/static/style.css"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+
+	for _, path := range []string{"/health", "/test-mapper/info", "/config.json"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/test-mapper/query?dir=atob", bytes.NewBufferString(`{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"ADJA","layer":"p","match":"match:eq"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"key":"ADJ"`)
+}
+
+func TestValidateSchema(t *testing.T) {
+	const lists = `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+  - id: corpus-mapper
+    type: corpus
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`
+	post := func(app *fiber.App, path, body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp.StatusCode, result
+	}
+
+	// A term without a key in a term group
+	invalid := `{"query":{"@type":"koral:token","wrap":{"@type":"koral:termGroup","relation":"relation:and","operands":[{"@type":"koral:term","foundry":"opennlp","layer":"p"}]}}}`
+
+	cfg := loadConfigFromYAML(t, "validateSchema: true\n"+lists)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	status, result := post(app, "/test-mapper/query?dir=atob", invalid)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, `request body does not match the KoralQuery schema: query.wrap.operands[0]: missing required property "key"`, result["error"])
+
+	status, result = post(app, "/test-mapper/query?dir=atob", `{"@type":"koral:token","wrap":{"@type":"koral:term","key":"ADJA","match":"eq"}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, result["error"], `wrap.match: value eq is not one of [match:eq match:ne]`)
+
+	status, result = post(app, "/corpus-mapper/query?dir=atob", `{"corpus":{"@type":"koral:docGroup","operation":"operation:and","operands":[]}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, result["error"], "corpus.operands: expected at least 1 items, got 0")
+
+	status, result = post(app, "/query?cfg=test-mapper:atob", `{"query":{"@type":"koral:token","wrap":"ADJA"}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, result["error"], "query.wrap: expected object, got string")
+
+	// Valid bodies pass, including unknown node types and the short form
+	status, result = post(app, "/test-mapper/query?dir=atob", `{"query":{"@type":"koral:group","operation":"operation:sequence","operands":[{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","layer":"p","key":"ADJA"}},{"@type":"koral:reference","classRef":[1]}]}}`)
+	assert.Equal(t, http.StatusOK, status, result)
+	status, result = post(app, "/corpus-mapper/query?dir=atob", `{"corpus":"textClass=novel"}`)
+	assert.Equal(t, http.StatusOK, status, result)
+
+	// Without the setting, the mapper reports the invalid query itself
+	cfg = loadConfigFromYAML(t, lists)
+	m, err = mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app = fiber.New()
+	setupRoutes(app, m, cfg)
+
+	status, result = post(app, "/test-mapper/query?dir=atob", invalid)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.NotContains(t, result["error"], "KoralQuery schema")
+}
+
+func TestEmptyRequestBody(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	for _, path := range []string{
+		"/test-mapper/query?dir=atob",
+		"/test-mapper/response?dir=atob",
+		"/query?cfg=test-mapper:atob",
+		"/response?cfg=test-mapper:atob",
+	} {
+		for _, body := range []string{"", " \n"} {
+			req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+
+			var result map[string]any
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+			assert.Equal(t, "empty request body", result["error"], path)
+		}
+	}
+
+	// Malformed bodies are still reported as invalid JSON
+	req := httptest.NewRequest(http.MethodPost, "/test-mapper/query?dir=atob", bytes.NewBufferString("{"))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var result map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "invalid JSON in request body", result["error"])
+}
+
+func TestRoutePrefix(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+routePrefix: /plugin/koralmapper
+serviceURL: https://example.org
+metrics: true
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	get := func(path string) (int, string) {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	for _, path := range []string{"", "/", "/health", "/version", "/static/style.css", "/metrics", "/stats", "/config.json", "/test-mapper", "/test-mapper/info", "/test-mapper/rules"} {
+		status, _ := get("/plugin/koralmapper" + path)
+		assert.Equal(t, http.StatusOK, status, path)
+	}
+
+	// Nothing is served outside the prefix
+	for _, path := range []string{"/", "/health", "/static/style.css", "/test-mapper/info"} {
+		status, _ := get(path)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/plugin/koralmapper/test-mapper/query?dir=atob", bytes.NewBufferString(`{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"ADJA","layer":"p","match":"match:eq"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Generated service URLs carry the prefix
+	status, body := get("/plugin/koralmapper/test-mapper/info")
+	require.Equal(t, http.StatusOK, status)
+	var info map[string]any
+	require.NoError(t, json.Unmarshal([]byte(body), &info))
+	assert.True(t, strings.HasPrefix(info["queryURL"].(string), "https://example.org/plugin/koralmapper/test-mapper/query?"), info["queryURL"])
+
+	_, body = get("/plugin/koralmapper/")
+	assert.Contains(t, body, `<base href="https://example.org/plugin/koralmapper"`)
+}
+
+func TestQueryEnvelope(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[ADJA] <> [ADJ]"
+  - id: corpus-mapper
+    type: corpus
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	post := func(path, accept, body string) map[string]any {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return result
+	}
+
+	token := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"ADJA","layer":"p","match":"match:eq"}}`
+	mapped := map[string]any{
+		"@type": "koral:token",
+		"wrap": map[string]any{
+			"@type":   "koral:term",
+			"foundry": "upos",
+			"key":     "ADJ",
+			"layer":   "p",
+			"match":   "match:eq",
+		},
+	}
+
+	t.Run("Bare token without envelope", func(t *testing.T) {
+		assert.Equal(t, mapped, post("/test-mapper/query?dir=atob", "", token))
+	})
+
+	t.Run("Bare token is wrapped under query", func(t *testing.T) {
+		assert.Equal(t, map[string]any{
+			"@context": koralQueryContext,
+			"query":    mapped,
+		}, post("/test-mapper/query?dir=atob&envelope=true", "", token))
+	})
+
+	t.Run("Accept application/ld+json requests the envelope", func(t *testing.T) {
+		result := post("/test-mapper/query?dir=atob", "application/ld+json", token)
+		assert.Equal(t, koralQueryContext, result["@context"])
+		assert.Equal(t, mapped, result["query"])
+	})
+
+	t.Run("Existing envelope keeps its fields", func(t *testing.T) {
+		result := post("/test-mapper/query?dir=atob&envelope=true", "", `{"meta":{"count":25},"query":`+token+`}`)
+		assert.Equal(t, map[string]any{
+			"@context": koralQueryContext,
+			"meta":     map[string]any{"count": float64(25)},
+			"query":    mapped,
+		}, result)
+	})
+
+	t.Run("Existing context is kept", func(t *testing.T) {
+		result := post("/test-mapper/query?dir=atob&envelope=true", "", `{"@context":"http://example.org/context.jsonld","query":`+token+`}`)
+		assert.Equal(t, "http://example.org/context.jsonld", result["@context"])
+	})
+
+	t.Run("Corpus result keeps its corpus section", func(t *testing.T) {
+		result := post("/corpus-mapper/query?dir=atob&envelope=true", "", `{"corpus":{"@type":"koral:doc","key":"textClass","value":"novel","match":"match:eq"}}`)
+		assert.Equal(t, koralQueryContext, result["@context"])
+		corpus := result["corpus"].(map[string]any)
+		assert.Equal(t, "genre", corpus["key"])
+		assert.Equal(t, "fiction", corpus["value"])
+	})
+
+	t.Run("Bare corpus node is wrapped under corpus", func(t *testing.T) {
+		result := post("/query/corpus-mapper:atob?envelope=true", "", `{"@type":"koral:doc","key":"textClass","value":"novel","match":"match:eq"}`)
+		assert.Equal(t, koralQueryContext, result["@context"])
+		assert.Equal(t, "koral:doc", result["corpus"].(map[string]any)["@type"])
+		assert.NotContains(t, result, "query")
+	})
+
+	t.Run("Composite query", func(t *testing.T) {
+		assert.Equal(t, map[string]any{
+			"@context": koralQueryContext,
+			"query":    mapped,
+		}, post("/query/test-mapper:atob?envelope=true", "", token))
+	})
+}
+
+func TestCompositeContinueOnError(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: step1
+    foundryA: opennlp
+    layerA: p
+    foundryB: stts
+    layerB: p
+    mappings:
+      - "[PIDAT] <> [DET]"
+  - id: step2
+    foundryA: stts
+    layerA: p
+    foundryB: ud
+    layerB: p
+    mappings:
+      - "[DET] <> [X]"
+  - id: step3
+    foundryA: stts
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[DET] <> [PRON]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	// The foundry and layer overrides of step2 are identical and fail
+	cascade := "step1:atob;step2:atob:stts:p:stts:p;step3:atob"
+	body := `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"PIDAT","layer":"p","match":"match:eq"}}`
+	post := func(query string) (*http.Response, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/query/"+cascade+query, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var result map[string]any
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		return resp, result
+	}
+
+	t.Run("Abort", func(t *testing.T) {
+		resp, result := post("")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, result["error"], `cascade step 1 (mapping "step2")`)
+		assert.Empty(t, resp.Header.Get(headerSkipped))
+	})
+
+	t.Run("Continue", func(t *testing.T) {
+		resp, result := post("?continueOnError=true")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "step2", resp.Header.Get(headerSkipped))
+		assert.Equal(t, map[string]any{
+			"@type":   "koral:term",
+			"foundry": "upos",
+			"key":     "PRON",
+			"layer":   "p",
+			"match":   "match:eq",
+		}, result["wrap"])
+	})
+
+	t.Run("Response cascade", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/response/"+cascade+"?continueOnError=true",
+			bytes.NewBufferString(`{"snippet":"<span title=\"opennlp/p:PIDAT\">Der</span>"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "step2", resp.Header.Get(headerSkipped))
+	})
+}
+
+func TestPassthroughStreamAndCascade(t *testing.T) {
+	cfg := loadConfigFromYAML(t, `
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    layerA: p
+    foundryB: upos
+    layerB: p
+    mappings:
+      - "[A] <> [B]"
+`)
+	m, err := mapper.NewMapper(cfg.Lists, mapperOptions(cfg)...)
+	require.NoError(t, err)
+
+	app := fiber.New()
+	setupRoutes(app, m, cfg)
+
+	post := func(url, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	token := func(key string) string {
+		return `{"@type":"koral:token","wrap":{"@type":"koral:term","foundry":"opennlp","key":"` + key + `","layer":"p","match":"match:eq"}}`
+	}
+
+	// Each line is returned unchanged, invalid lines still yield errors
+	status, body := post("/passthrough/query/stream?dir=btoa", token("A")+"\n{\n"+token("B")+"\n")
+	require.Equal(t, http.StatusOK, status)
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, token("A"), lines[0])
+	assert.JSONEq(t, `{"error":"invalid JSON","line":2}`, lines[1])
+	assert.JSONEq(t, token("B"), lines[2])
+
+	// Other unknown IDs are still rejected
+	status, body = post("/unknown/query/stream", token("A")+"\n")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.JSONEq(t, `{"error":"mapping list with ID unknown not found"}`, body)
+
+	// The passthrough step of a cascade leaves the result of the others
+	status, body = post("/query/passthrough:atob;test-mapper:atob", token("A"))
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"key":"B"`)
+
+	status, body = post("/query/passthrough:atob:opennlp:p:upos:p", token("A"))
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "invalid passthrough entry")
+}
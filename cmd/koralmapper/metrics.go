@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// transformMetrics holds the Prometheus collectors for the transformation
+// endpoints. A nil *transformMetrics is valid and records nothing, so
+// handlers can be instrumented unconditionally while metrics are disabled.
+type transformMetrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+// newTransformMetrics creates the collectors on a dedicated registry, so
+// multiple app instances (e.g. in tests) do not conflict.
+func newTransformMetrics() *transformMetrics {
+	tm := &transformMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "koralmapper_transform_requests_total",
+			Help: "Number of transformation requests per endpoint and mapping list.",
+		}, []string{"endpoint", "map"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "koralmapper_transform_errors_total",
+			Help: "Number of failed transformation requests per endpoint and HTTP status.",
+		}, []string{"endpoint", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "koralmapper_transform_duration_seconds",
+			Help:    "Latency of transformation requests per endpoint.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+	}
+	tm.registry.MustRegister(tm.requests, tm.errors, tm.latency)
+	return tm
+}
+
+// handler serves the collected metrics in the Prometheus text format.
+func (tm *transformMetrics) handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(tm.registry, promhttp.HandlerOpts{}))
+}
+
+// record counts a finished request for each of the given mapping lists
+// and observes its latency. Responses with a status of 400 or above are
+// counted as errors.
+func (tm *transformMetrics) record(endpoint string, mapIDs []string, status int, elapsed time.Duration) {
+	if tm == nil {
+		return
+	}
+	if len(mapIDs) == 0 {
+		mapIDs = []string{""}
+	}
+	for _, id := range mapIDs {
+		// Fiber strings reference pooled request buffers; the registry
+		// keeps label values, so they must be copied
+		tm.requests.WithLabelValues(endpoint, strings.Clone(id)).Inc()
+	}
+	if status >= fiber.StatusBadRequest {
+		tm.errors.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+	}
+	tm.latency.WithLabelValues(endpoint).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/gofiber/fiber/v3"
+)
+
+// listRateLimits enforces the "requestsPerSecond" and "burst" settings of
+// the mapping lists with a token bucket per list ID. Lists without a rate
+// are unlimited.
+type listRateLimits struct {
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate tokens per
+// second. Each request takes one token.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newListRateLimits creates a full bucket for each mapping list with a
+// rate.
+func newListRateLimits(lists []config.MappingList) *listRateLimits {
+	l := &listRateLimits{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+	for _, list := range lists {
+		if list.RequestsPerSecond <= 0 {
+			continue
+		}
+		burst := float64(list.Burst)
+		if burst == 0 {
+			burst = math.Ceil(list.RequestsPerSecond)
+		}
+		l.buckets[list.ID] = &tokenBucket{
+			rate:   list.RequestsPerSecond,
+			burst:  burst,
+			tokens: burst,
+		}
+	}
+	return l
+}
+
+// allow takes a token for each of the mapping lists and returns the ID of
+// the first list that exceeds its limit. Tokens taken from the lists
+// before it are not returned.
+func (l *listRateLimits) allow(ids ...string) (string, bool) {
+	now := l.now()
+	for _, id := range ids {
+		if b := l.buckets[id]; b != nil && !b.take(now) {
+			return id, false
+		}
+	}
+	return "", true
+}
+
+// take refills the bucket for the time passed since the last request and
+// takes a token, if one is left.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimitExceeded answers a request to a mapping list over its rate
+// limit with HTTP 429.
+func rateLimitExceeded(c fiber.Ctx, mapID string) error {
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": "rate limit exceeded for mapping list " + mapID,
+	})
+}
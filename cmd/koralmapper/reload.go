@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/subtle"
+	"strings"
+	"sync/atomic"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/gofiber/fiber/v3"
+)
+
+// configLoader loads the configuration from the sources the server was
+// started with.
+type configLoader func() (*config.MappingConfig, error)
+
+// mappingHandlers holds the handlers that depend on the loaded mapping
+// lists, so they can be replaced as a whole when the configuration is
+// reloaded.
+type mappingHandlers struct {
+	compositeQuery    fiber.Handler
+	compositeResponse fiber.Handler
+	query             fiber.Handler
+	response          fiber.Handler
+	plugin            fiber.Handler
+	info              fiber.Handler
+	rules             fiber.Handler
+	adhocQuery        fiber.Handler
+	ruleTest          fiber.Handler
+	queryStream       fiber.Handler
+	stats             fiber.Handler
+	configJSON        fiber.Handler
+	bodyLimit         fiber.Handler
+}
+
+// liveHandlers gives access to the currently served mapping handlers.
+type liveHandlers struct {
+	current atomic.Pointer[mappingHandlers]
+}
+
+// route returns a handler delegating to the selected handler of the
+// mapping handlers that are live at the time of the request.
+func (l *liveHandlers) route(pick func(*mappingHandlers) fiber.Handler) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return pick(l.current.Load())(c)
+	}
+}
+
+// handleReload reloads the configuration, creates a new mapper and swaps
+// the live mapping handlers. Requests must carry the reload token as a
+// bearer token. If loading or validation fails, the previous
+// configuration stays live.
+func handleReload(token string, load configLoader, live *liveHandlers, build func(*mapper.Mapper, *config.MappingConfig) *mappingHandlers) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !validBearerToken(c.Get(fiber.HeaderAuthorization), token) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid or missing reload token",
+			})
+		}
+
+		yamlConfig, err := load()
+		if err != nil {
+			requestLogger(c).Error().Err(err).Msg("Failed to reload configuration")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		m, err := mapper.NewMapper(yamlConfig.Lists, mapperOptions(yamlConfig)...)
+		if err != nil {
+			requestLogger(c).Error().Err(err).Msg("Failed to create mapper on reload")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		live.current.Store(build(m, yamlConfig))
+		requestLogger(c).Info().Int("lists", len(yamlConfig.Lists)).Msg("Reloaded configuration")
+
+		lists := make([]fiber.Map, 0, len(yamlConfig.Lists))
+		for _, list := range yamlConfig.Lists {
+			listType := list.Type
+			if listType == "" {
+				listType = "annotation"
+			}
+			lists = append(lists, fiber.Map{
+				"id":    list.ID,
+				"desc":  list.Description,
+				"type":  listType,
+				"rules": len(list.Mappings),
+			})
+		}
+		return c.JSON(fiber.Map{"lists": lists})
+	}
+}
+
+// validBearerToken reports whether the Authorization header carries the
+// expected token, comparing in constant time.
+func validBearerToken(header, token string) bool {
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
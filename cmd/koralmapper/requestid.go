@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/requestid"
+	"github.com/gofiber/utils/v2"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// requestIDMiddleware takes the request ID from the X-Request-ID header,
+// or generates a UUID if the header is missing or invalid, stores it in
+// the request locals and echoes it in the response header.
+func requestIDMiddleware() fiber.Handler {
+	return requestid.New(requestid.Config{
+		Generator: utils.UUIDv4,
+	})
+}
+
+// requestLogger returns the global logger tagged with the ID of the
+// request, for log lines belonging to a request.
+func requestLogger(c fiber.Ctx) *zerolog.Logger {
+	logger := log.With().Str("request_id", requestid.FromContext(c)).Logger()
+	return &logger
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/gofiber/fiber/v3"
+)
+
+// ruleTestRequest is the body of a rule test: a single rule, the
+// direction to apply it in and the KoralQuery input to apply it to.
+type ruleTestRequest struct {
+	Rule      string          `json:"rule"`
+	Type      string          `json:"type,omitempty"`      // "annotation" (default) or "corpus"
+	Direction string          `json:"direction,omitempty"` // "atob" (default) or "btoa"
+	Rewrites  *bool           `json:"rewrites,omitempty"`
+	Input     json.RawMessage `json:"input"`
+	Expected  json.RawMessage `json:"expected,omitempty"` // result the input should be transformed to
+}
+
+// ruleTestResult reports the outcome of a rule test. Result is the
+// transformed input, Matched whether the rule applied at all and Passed,
+// if an expected result was given, whether the result equals it.
+type ruleTestResult struct {
+	Result  any    `json:"result,omitempty"`
+	Matched bool   `json:"matched"`
+	Passed  *bool  `json:"passed,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleRuleTest applies a single rule given in the request body to the
+// input of the body, like handleAdhocQuery but without the length limit
+// of query parameters. Errors are reported in the "error" field of the
+// result, next to "matched".
+func handleRuleTest(yamlConfig *config.MappingConfig, metrics *transformMetrics) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		defer func() {
+			metrics.record("rule-test", nil, c.Response().StatusCode(), time.Since(start))
+		}()
+
+		fail := func(status int, err error) error {
+			return c.Status(status).JSON(ruleTestResult{Error: err.Error()})
+		}
+
+		if len(bytes.TrimSpace(c.Body())) == 0 {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("empty request body"))
+		}
+		var req ruleTestRequest
+		if err := json.Unmarshal(c.Body(), &req); err != nil {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("invalid JSON in request body"))
+		}
+		if req.Rule == "" {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("missing rule"))
+		}
+		if req.Type != "" && req.Type != "annotation" && req.Type != "corpus" {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("invalid type, must be 'annotation' or 'corpus'"))
+		}
+		if len(req.Input) == 0 {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("missing input"))
+		}
+
+		var input any
+		if err := json.Unmarshal(req.Input, &input); err != nil {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("invalid JSON in input"))
+		}
+		if err := validateRequestBody(yamlConfig, input); err != nil {
+			return fail(fiber.StatusBadRequest, err)
+		}
+		var expected any
+		if len(req.Expected) > 0 {
+			if err := json.Unmarshal(req.Expected, &expected); err != nil {
+				return fail(fiber.StatusBadRequest, fmt.Errorf("invalid JSON in expected"))
+			}
+		}
+
+		direction, err := mapper.ParseDirection(effectiveDirection(req.Direction, nil))
+		if err != nil {
+			return fail(fiber.StatusBadRequest, err)
+		}
+
+		m, err := mapper.NewMapper([]config.MappingList{{
+			ID:       adhocListID,
+			Type:     req.Type,
+			Mappings: []config.MappingRule{config.MappingRule(req.Rule)},
+		}}, mapperOptions(yamlConfig)...)
+		if err != nil {
+			return fail(fiber.StatusBadRequest, fmt.Errorf("invalid rule: %w", err))
+		}
+
+		addRewrites := yamlConfig.Rewrites
+		if req.Rewrites != nil {
+			addRewrites = *req.Rewrites
+		}
+
+		ctx, cancel := transformContext(c, yamlConfig)
+		defer cancel()
+
+		trace := &mapper.Trace{}
+		result, err := m.ApplyQueryMappingsContext(ctx, adhocListID, mapper.MappingOptions{
+			Direction:   direction,
+			AddRewrites: addRewrites,
+			Trace:       trace,
+		}, input)
+		if err != nil {
+			requestLogger(c).Error().Err(err).
+				Str("rule", req.Rule).
+				Str("direction", direction.String()).
+				Msg("Failed to test rule")
+
+			status, message := transformErrorStatus(err)
+			return c.Status(status).JSON(ruleTestResult{Error: message})
+		}
+
+		testResult := ruleTestResult{
+			Result:  result,
+			Matched: len(trace.Applied()) > 0,
+		}
+		if expected != nil {
+			passed := reflect.DeepEqual(expected, result)
+			testResult.Passed = &passed
+		}
+		return c.JSON(testResult)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/KorAP/Koral-Mapper/config"
+)
+
+// koralSchemaJSON is a minimal KoralQuery schema, checking the structure
+// of the nodes the mapper reads. It is applied to request bodies if the
+// "validateSchema" setting is enabled.
+//
+//go:embed koral.schema.json
+var koralSchemaJSON []byte
+
+// koralSchema is the parsed koralSchemaJSON.
+var koralSchema = mustParseSchema(koralSchemaJSON)
+
+// jsonSchema holds the subset of JSON Schema used by koralSchemaJSON:
+// type, enum, required, properties, items, minItems, pattern, allOf,
+// if/then and local references into $defs.
+type jsonSchema struct {
+	Ref        string                 `json:"$ref"`
+	Defs       map[string]*jsonSchema `json:"$defs"`
+	Type       schemaTypes            `json:"type"`
+	Enum       []any                  `json:"enum"`
+	Required   []string               `json:"required"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	MinItems   int                    `json:"minItems"`
+	Pattern    string                 `json:"pattern"`
+	AllOf      []*jsonSchema          `json:"allOf"`
+	If         *jsonSchema            `json:"if"`
+	Then       *jsonSchema            `json:"then"`
+
+	pattern *regexp.Regexp
+	root    *jsonSchema
+}
+
+// schemaTypes is the "type" keyword, given as a single type or a list.
+type schemaTypes []string
+
+// UnmarshalJSON accepts both a string and a list of strings.
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// mustParseSchema parses an embedded schema, compiling its patterns and
+// linking every subschema to the root for resolving references.
+func mustParseSchema(data []byte) *jsonSchema {
+	var root jsonSchema
+	if err := json.Unmarshal(data, &root); err != nil {
+		panic(fmt.Sprintf("invalid embedded schema: %v", err))
+	}
+	var link func(s *jsonSchema)
+	link = func(s *jsonSchema) {
+		if s == nil {
+			return
+		}
+		s.root = &root
+		if s.Pattern != "" {
+			s.pattern = regexp.MustCompile(s.Pattern)
+		}
+		for _, sub := range s.Defs {
+			link(sub)
+		}
+		for _, sub := range s.Properties {
+			link(sub)
+		}
+		for _, sub := range s.AllOf {
+			link(sub)
+		}
+		link(s.Items)
+		link(s.If)
+		link(s.Then)
+	}
+	link(&root)
+	return &root
+}
+
+// validateRequestBody checks a decoded request body against koralSchema,
+// if the "validateSchema" setting is enabled.
+func validateRequestBody(yamlConfig *config.MappingConfig, jsonData any) error {
+	if !yamlConfig.ValidateSchema {
+		return nil
+	}
+	if err := koralSchema.validate(jsonData, ""); err != nil {
+		return fmt.Errorf("request body does not match the KoralQuery schema: %w", err)
+	}
+	return nil
+}
+
+// validate checks value against the schema and returns the first
+// violation found, prefixed with the path of the offending value.
+func (s *jsonSchema) validate(value any, path string) error {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		def := s.root.Defs[name]
+		if !ok || def == nil {
+			return fmt.Errorf("unresolvable schema reference %q", s.Ref)
+		}
+		return def.validate(value, path)
+	}
+
+	if len(s.Type) > 0 && !slices.Contains(s.Type, jsonType(value)) {
+		return violation(path, "expected %s, got %s", strings.Join(s.Type, " or "), jsonType(value))
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(v any) bool { return reflect.DeepEqual(v, value) }) {
+		return violation(path, "value %v is not one of %v", value, s.Enum)
+	}
+	if s.pattern != nil {
+		if str, ok := value.(string); ok && !s.pattern.MatchString(str) {
+			return violation(path, "value %q does not match %q", str, s.Pattern)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				return violation(path, "missing required property %q", key)
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(s.Properties)) {
+			if child, ok := v[key]; ok {
+				if err := s.Properties[key].validate(child, joinPath(path, key)); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if len(v) < s.MinItems {
+			return violation(path, "expected at least %d items, got %d", s.MinItems, len(v))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		if err := sub.validate(value, path); err != nil {
+			return err
+		}
+	}
+	if s.If != nil && s.Then != nil && s.If.validate(value, path) == nil {
+		return s.Then.validate(value, path)
+	}
+	return nil
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value.
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// joinPath appends a property key to the path of a value.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// violation reports a schema violation at path.
+func violation(path, format string, args ...any) error {
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/gofiber/fiber/v3"
+)
+
+// handleQueryStream transforms newline-delimited JSON objects with a
+// single mapping list. The body is read line by line, and each line is
+// transformed and written as soon as it is processed, so only one line
+// and its result are held in memory at a time. A line
+// that cannot be transformed yields an {"error": ..., "line": N} object
+// instead of aborting the stream.
+func handleQueryStream(m *mapper.Mapper, yamlConfig *config.MappingConfig, metrics *transformMetrics, rates *listRateLimits) fiber.Handler {
+	limits := newInputLimits(yamlConfig)
+	resolver := newListResolver(yamlConfig.Lists)
+	listsByID := make(map[string]*config.MappingList, len(yamlConfig.Lists))
+	for i := range yamlConfig.Lists {
+		listsByID[yamlConfig.Lists[i].ID] = &yamlConfig.Lists[i]
+	}
+
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		defer func() {
+			// Only known list IDs are used as labels to bound cardinality
+			var mapIDs []string
+			if id := resolver.resolve(c.Params("map"), requestLanguages(c)); listsByID[id] != nil {
+				mapIDs = []string{id}
+			}
+			metrics.record("query-stream", mapIDs, c.Response().StatusCode(), time.Since(start))
+		}()
+
+		params, err := extractRequestParams(c, limits)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		params.MapID = resolver.resolve(params.MapID, requestLanguages(c))
+
+		// The passthrough ID needs no list, unless one has the same ID
+		list, ok := listsByID[params.MapID]
+		if !ok && (params.MapID != yamlConfig.PassthroughID || params.MapID == "") {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "mapping list with ID " + params.MapID + " not found",
+			})
+		}
+		params.Dir = effectiveDirection(params.Dir, list)
+
+		if _, ok := rates.allow(params.MapID); !ok {
+			return rateLimitExceeded(c, params.MapID)
+		}
+
+		direction, err := mapper.ParseDirection(params.Dir)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		addRewrites := yamlConfig.Rewrites
+		if list != nil {
+			addRewrites = list.EffectiveRewrites(yamlConfig.Rewrites)
+		}
+		if params.Rewrites != nil {
+			addRewrites = *params.Rewrites
+		}
+
+		opts := mapper.MappingOptions{
+			Direction:   direction,
+			FoundryA:    params.FoundryA,
+			FoundryB:    params.FoundryB,
+			LayerA:      params.LayerA,
+			LayerB:      params.LayerB,
+			AddRewrites: addRewrites,
+		}
+
+		// The body is read while the response is written, after the
+		// handler returned. Servers without streamed request bodies
+		// have buffered it already, which may be reused by then.
+		var body io.Reader
+		if c.Request().IsBodyStream() {
+			body = c.Request().BodyStream()
+			// The stream may end before the body is read completely,
+			// e.g. at an overlong line, leaving the connection unusable
+			c.Response().SetConnectionClose()
+		} else {
+			body = bytes.NewReader(bytes.Clone(c.Body()))
+		}
+		mapID := params.MapID
+		logger := requestLogger(c)
+
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		return c.SendStreamWriter(func(w *bufio.Writer) {
+			// The body limit applies to each line
+			scanner := bufio.NewScanner(body)
+			scanner.Buffer(make([]byte, 0, min(64*1024, limits.maxBodyBytes)), limits.maxBodyBytes)
+			enc := json.NewEncoder(w)
+
+			line := 0
+			for scanner.Scan() {
+				line++
+				raw := bytes.TrimSpace(scanner.Bytes())
+				if len(raw) == 0 {
+					continue
+				}
+
+				result, err := transformStreamLine(m, yamlConfig, mapID, opts, raw)
+				if err != nil {
+					logger.Debug().Err(err).Str("mapID", mapID).Int("line", line).Msg("Failed to transform stream line")
+					result = fiber.Map{"error": err.Error(), "line": line}
+				}
+
+				// Stop once the client is gone
+				if err := enc.Encode(result); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+
+			if err := scanner.Err(); err != nil {
+				_ = enc.Encode(fiber.Map{"error": err.Error(), "line": line + 1})
+			}
+		})
+	}
+}
+
+// transformStreamLine transforms a single line of a stream. The request
+// timeout applies to each line separately.
+func transformStreamLine(m *mapper.Mapper, yamlConfig *config.MappingConfig, mapID string, opts mapper.MappingOptions, raw []byte) (any, error) {
+	var jsonData any
+	if err := json.Unmarshal(raw, &jsonData); err != nil {
+		return nil, fmt.Errorf("invalid JSON")
+	}
+	if err := validateRequestBody(yamlConfig, jsonData); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withRequestTimeout(context.Background(), yamlConfig)
+	defer cancel()
+
+	return m.ApplyQueryMappingsContext(ctx, mapID, opts, jsonData)
+}
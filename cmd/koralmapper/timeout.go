@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/KorAP/Koral-Mapper/mapper"
+	"github.com/gofiber/fiber/v3"
+)
+
+// transformContext returns the context a transformation request runs
+// under. With a configured request timeout it is canceled once the
+// timeout elapses.
+func transformContext(c fiber.Ctx, yamlConfig *config.MappingConfig) (context.Context, context.CancelFunc) {
+	return withRequestTimeout(c.Context(), yamlConfig)
+}
+
+// withRequestTimeout derives a context that is canceled once the
+// configured request timeout elapses, if any.
+func withRequestTimeout(ctx context.Context, yamlConfig *config.MappingConfig) (context.Context, context.CancelFunc) {
+	if yamlConfig.RequestTimeout > 0 {
+		return context.WithTimeout(ctx, time.Duration(yamlConfig.RequestTimeout)*time.Second)
+	}
+	return context.WithCancel(ctx)
+}
+
+// shutdownServer stops accepting connections and waits up to timeout
+// for in-flight requests to finish. It returns the number of connections
+// still open when the timeout elapsed; they are closed when the process
+// exits.
+func shutdownServer(app *fiber.App, timeout time.Duration) (int32, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.ShutdownWithContext(ctx)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return 0, err
+	case <-timer.C:
+		// Connections are counted while the shutdown is still waiting
+		// for them
+		open := app.Server().GetOpenConnectionsCount()
+		cancel()
+		if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+			return open, err
+		}
+		return open, nil
+	}
+}
+
+// transformError writes the response for a failed transformation with
+// the status and message of transformErrorStatus.
+func transformError(c fiber.Ctx, err error) error {
+	status, message := transformErrorStatus(err)
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// transformErrorStatus returns the status and message reported for a
+// failed transformation. Unknown mapping lists are reported as 404 Not
+// Found, invalid input as 400 Bad Request, canceled and timed out
+// requests as 503 Service Unavailable, and any other error as 500
+// Internal Server Error.
+func transformErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, mapper.ErrMappingNotFound):
+		return fiber.StatusNotFound, err.Error()
+	case errors.Is(err, mapper.ErrInvalidInput):
+		return fiber.StatusBadRequest, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return fiber.StatusServiceUnavailable, "request timed out"
+	case errors.Is(err, context.Canceled):
+		return fiber.StatusServiceUnavailable, "request canceled"
+	}
+	return fiber.StatusInternalServerError, err.Error()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// xmlRootElement is the name of the root element of XML results.
+const xmlRootElement = "koral"
+
+// writeResult sends a transformation result in the format preferred by
+// the Accept header. JSON is the default; XML is only used when the
+// client prefers application/xml or text/xml.
+func writeResult(c fiber.Ctx, result any) error {
+	switch c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMEApplicationXML, fiber.MIMETextXML) {
+	case fiber.MIMEApplicationXML, fiber.MIMETextXML:
+		data, err := encodeResultXML(result)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationXMLCharsetUTF8)
+		return c.Send(data)
+	default:
+		return c.JSON(result)
+	}
+}
+
+// encodeResultXML encodes a JSON-like result tree as XML with one element
+// per field. Object keys are emitted in sorted order, array items become
+// <item> elements and scalars become character data.
+func encodeResultXML(result any) ([]byte, error) {
+	// Normalize to generic JSON values so typed results encode the same way
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	var generic any
+	if err := json.Unmarshal(jsonBytes, &generic); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	if err := encodeXMLValue(enc, xmlRootElement, generic); err != nil {
+		return nil, fmt.Errorf("failed to encode XML: %w", err)
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to encode XML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeXMLValue writes value as an element with the given name.
+func encodeXMLValue(enc *xml.Encoder, name string, value any) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if err := encodeXMLValue(enc, xmlElementName(key), v[key]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err := encodeXMLValue(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	case nil:
+		// Empty element
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlElementName turns a JSON key into a valid XML element name. The
+// JSON-LD "@" prefix (as in "@type") is dropped and any other character
+// not allowed in a name is replaced by an underscore.
+func xmlElementName(key string) string {
+	key = strings.TrimPrefix(key, "@")
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || r == '.' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "" || !((name[0] >= 'a' && name[0] <= 'z') || (name[0] >= 'A' && name[0] <= 'Z') || name[0] == '_') {
+		name = "_" + name
+	}
+	return name
+}
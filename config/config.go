@@ -1,10 +1,15 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -22,25 +27,134 @@ const (
 	defaultCookieName = "km-config"
 	defaultPort       = 5725
 	defaultLogLevel     = "warn"
+	defaultLogFormat    = "console"
 	defaultRateLimit    = 100
+	defaultEditorName = "Koral-Mapper"
+	defaultPassthroughID = "passthrough"
 )
 
+// Default input limits of the server
+const (
+	defaultMaxBodyBytes  = 1024 * 1024 // 1MB
+	defaultMaxParamBytes = 1024        // 1KB
+)
+
+// defaultShutdownTimeout is the time in seconds in-flight requests may
+// take to finish on shutdown
+const defaultShutdownTimeout = 30
+
 // MappingRule represents a single mapping rule in the configuration
 type MappingRule string
 
 // MappingList represents a list of mapping rules with metadata
 type MappingList struct {
-	ID          string        `yaml:"id"`
-	Type        string        `yaml:"type,omitempty"` // "annotation" (default) or "corpus"
-	Description string        `yaml:"desc,omitempty"`
-	FoundryA    string        `yaml:"foundryA,omitempty"`
-	LayerA      string        `yaml:"layerA,omitempty"`
-	FoundryB    string        `yaml:"foundryB,omitempty"`
-	LayerB      string        `yaml:"layerB,omitempty"`
-	FieldA      string        `yaml:"fieldA,omitempty"`
-	FieldB      string        `yaml:"fieldB,omitempty"`
-	Rewrites    *bool         `yaml:"rewrites,omitempty"`
-	Mappings    []MappingRule `yaml:"mappings"`
+	ID                string            `yaml:"id"`
+	Type              string            `yaml:"type,omitempty"` // "annotation" (default), "corpus" or "mixed"
+	Description       string            `yaml:"desc,omitempty"`
+	Aliases           []string          `yaml:"aliases,omitempty"`  // further IDs the list answers to, e.g. former IDs
+	Name              string            `yaml:"name,omitempty"`     // logical name shared by language variants
+	Language          string            `yaml:"language,omitempty"` // language of the variant, e.g. "de"
+	FoundryA          string            `yaml:"foundryA,omitempty"`
+	LayerA            string            `yaml:"layerA,omitempty"`
+	FoundryB          string            `yaml:"foundryB,omitempty"`
+	LayerB            string            `yaml:"layerB,omitempty"`
+	FieldA            string            `yaml:"fieldA,omitempty"`
+	FieldB            string            `yaml:"fieldB,omitempty"`
+	Rewrites          *bool             `yaml:"rewrites,omitempty"`
+	DefaultDirection  string            `yaml:"defaultDirection,omitempty"`  // "atob" (default) or "btoa", used without a dir parameter
+	NotInIndexClass   *string           `yaml:"notInIndexClass,omitempty"`   // nil means "notinindex", "" omits the class
+	Enabled           *bool             `yaml:"enabled,omitempty"`           // nil means enabled
+	FoundryRenames    map[string]string `yaml:"foundryRenames,omitempty"`    // foundries renamed in the result, after all rules
+	LayerRenames      map[string]string `yaml:"layerRenames,omitempty"`      // layers renamed in the result, after all rules
+	AllowedFoundries  []string          `yaml:"allowedFoundries,omitempty"`  // foundries the rules may use, none means any
+	AllowedLayers     []string          `yaml:"allowedLayers,omitempty"`     // layers the rules may use, none means any
+	RequestsPerSecond float64           `yaml:"requestsPerSecond,omitempty"` // rate limit of the list, 0 means unlimited
+	Burst             int               `yaml:"burst,omitempty"`             // requests allowed at once, 0 means the rate rounded up
+	Mappings          []MappingRule     `yaml:"mappings"`
+	RuleMeta          []RuleMeta        `yaml:"-"` // settings of rules in object form, indexed like Mappings
+}
+
+// RuleMeta holds the optional settings of a mapping rule written in
+// object form, e.g. {rule: "[A] <> [B]", scope: "key"}.
+type RuleMeta struct {
+	ID        string   `yaml:"id,omitempty"`        // identifies the rule in messages, unique per list
+	Comment   string   `yaml:"comment,omitempty"`   // documentation of the rule
+	Operation string   `yaml:"operation,omitempty"` // operation of emitted rewrites, e.g. "operation:override"
+	Scope     string   `yaml:"scope,omitempty"`     // scope of emitted rewrites, e.g. "key" or "value"
+	Tags      []string `yaml:"tags,omitempty"`      // tags for selecting a subset of rules
+	Example   any      `yaml:"example,omitempty"`   // KoralQuery request the rule is tested with
+	Expected  any      `yaml:"expected,omitempty"`  // result of applying the rule to the example
+}
+
+// ruleObject is the object form of a mapping rule.
+type ruleObject struct {
+	Rule     string `yaml:"rule"`
+	RuleMeta `yaml:",inline"`
+}
+
+// UnmarshalYAML accepts each mapping rule either as a plain string or
+// as an object with a "rule" field and optional settings. Settings of
+// object rules are kept in RuleMeta.
+func (list *MappingList) UnmarshalYAML(value *yaml.Node) error {
+	var meta []RuleMeta
+	value = resolveMergeKeys(value)
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content)-1; i += 2 {
+			rulesNode := resolveAlias(value.Content[i+1])
+			if value.Content[i].Value != "mappings" || rulesNode.Kind != yaml.SequenceNode {
+				continue
+			}
+			// Work on a copy so the object form is not lost from the node
+			rules := *rulesNode
+			rules.Content = slices.Clone(rules.Content)
+			for j, item := range rules.Content {
+				item = resolveAlias(item)
+				if item.Kind != yaml.MappingNode {
+					continue
+				}
+				var obj ruleObject
+				if err := item.Decode(&obj); err != nil {
+					return err
+				}
+				if meta == nil {
+					meta = make([]RuleMeta, len(rules.Content))
+				}
+				meta[j] = obj.RuleMeta
+				rules.Content[j] = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: obj.Rule, Line: item.Line, Column: item.Column}
+			}
+			content := slices.Clone(value.Content)
+			content[i+1] = &rules
+			copied := *value
+			copied.Content = content
+			value = &copied
+		}
+	}
+	type plain MappingList
+	var p plain
+	if err := value.Decode(&p); err != nil {
+		return err
+	}
+	*list = MappingList(p)
+	list.RuleMeta = meta
+	return nil
+}
+
+// RuleMetaAt returns the settings of the rule at index i, or the zero
+// RuleMeta if the rule has none.
+func (list *MappingList) RuleMetaAt(i int) RuleMeta {
+	if i < len(list.RuleMeta) {
+		return list.RuleMeta[i]
+	}
+	return RuleMeta{}
+}
+
+// RuleLabel names the rule at index i in messages: "rule 3", or
+// "rule 3 (r1)" for a rule with the ID "r1".
+func (list *MappingList) RuleLabel(i int) string {
+	if id := list.RuleMetaAt(i).ID; id != "" {
+		return fmt.Sprintf("rule %d (%s)", i, id)
+	}
+	return fmt.Sprintf("rule %d", i)
 }
 
 // IsCorpus returns true if the mapping list type is "corpus".
@@ -48,6 +162,28 @@ func (list *MappingList) IsCorpus() bool {
 	return list.Type == "corpus"
 }
 
+// IsMixed returns true if the mapping list type is "mixed", holding
+// both annotation and corpus rules.
+func (list *MappingList) IsMixed() bool {
+	return list.Type == "mixed"
+}
+
+// IsCorpusRuleAt reports whether the rule at index i is a corpus rule:
+// all rules of corpus lists and, in mixed lists, the rules not starting
+// with a bracketed token like "[DET]".
+func (list *MappingList) IsCorpusRuleAt(i int) bool {
+	if list.IsMixed() {
+		return !strings.HasPrefix(strings.TrimSpace(string(list.Mappings[i])), "[")
+	}
+	return list.IsCorpus()
+}
+
+// IsEnabled returns false only if the list is explicitly disabled
+// with "enabled: false".
+func (list *MappingList) IsEnabled() bool {
+	return list.Enabled == nil || *list.Enabled
+}
+
 // EffectiveRewrites returns the resolved rewrites setting for this list.
 // If the list has an explicit per-list override, it is used; otherwise the
 // global default is returned.
@@ -58,9 +194,20 @@ func (list *MappingList) EffectiveRewrites(globalDefault bool) bool {
 	return globalDefault
 }
 
+// EffectiveDirection returns the direction used for requests to this list
+// without a dir parameter: the configured default direction, or "atob".
+func (list *MappingList) EffectiveDirection() string {
+	if list.DefaultDirection != "" {
+		return list.DefaultDirection
+	}
+	return "atob"
+}
+
 // ParseCorpusMappings parses all mapping rules as corpus rules.
 // Bare values (without key=) are always allowed and receive the default
 // field name from the mapping list header (FieldA/FieldB) when set.
+// In mixed lists, only the corpus rules are parsed; the results of
+// annotation rules are nil, so results are indexed like the rules.
 func (list *MappingList) ParseCorpusMappings() ([]*parser.CorpusMappingResult, error) {
 	corpusParser := parser.NewCorpusParser()
 	corpusParser.AllowBareValues = true
@@ -70,9 +217,12 @@ func (list *MappingList) ParseCorpusMappings() ([]*parser.CorpusMappingResult, e
 		if rule == "" {
 			return nil, fmt.Errorf("empty corpus mapping rule at index %d in list '%s'", i, list.ID)
 		}
+		if list.IsMixed() && !list.IsCorpusRuleAt(i) {
+			continue
+		}
 		result, err := corpusParser.ParseMapping(string(rule))
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse corpus mapping rule %d in list '%s': %w", i, list.ID, err)
+			return nil, fmt.Errorf("failed to parse corpus mapping %s in list '%s': %w", list.RuleLabel(i), list.ID, err)
 		}
 
 		if list.FieldA != "" {
@@ -103,18 +253,87 @@ func applyDefaultCorpusKey(node parser.CorpusNode, defaultKey string) {
 
 // MappingConfig represents the root configuration containing multiple mapping lists
 type MappingConfig struct {
-	SDK          string        `yaml:"sdk,omitempty"`
-	Stylesheet   string        `yaml:"stylesheet,omitempty"`
-	Server       string        `yaml:"server,omitempty"`
-	ServiceURL   string        `yaml:"serviceURL,omitempty"`
-	CookieName   string        `yaml:"cookieName,omitempty"`
-	BasePath     string        `yaml:"basePath,omitempty"`     // restricts config file loading to this directory tree
-	AllowOrigins []string      `yaml:"allowOrigins,omitempty"`
-	Port         int           `yaml:"port,omitempty"`
-	LogLevel     string        `yaml:"loglevel,omitempty"`
-	RateLimit    int           `yaml:"rateLimit,omitempty"` // max requests per minute per IP (0 = use default 100)
-	Rewrites     bool          `yaml:"rewrites,omitempty"`  // global default for koral:rewrite annotations
-	Lists        []MappingList `yaml:"lists,omitempty"`
+	SDK             string             `yaml:"sdk,omitempty"`
+	Stylesheet      string             `yaml:"stylesheet,omitempty"`
+	Server          string             `yaml:"server,omitempty"`
+	ServiceURL      string             `yaml:"serviceURL,omitempty"`
+	CookieName      string             `yaml:"cookieName,omitempty"`
+	BasePath        string             `yaml:"basePath,omitempty"`    // restricts config file loading to this directory tree
+	RoutePrefix     string             `yaml:"routePrefix,omitempty"` // path prefix of all routes, e.g. "/plugin/koralmapper"
+	AllowOrigins    []string           `yaml:"allowOrigins,omitempty"`
+	Port            int                `yaml:"port,omitempty"`
+	LogLevel        string             `yaml:"loglevel,omitempty"`
+	LogFormat       string             `yaml:"logformat,omitempty"`       // "console" (default) or "json"
+	RateLimit       int                `yaml:"rateLimit,omitempty"`       // max requests per minute per IP (0 = use default 100)
+	Rewrites        bool               `yaml:"rewrites,omitempty"`        // global default for koral:rewrite annotations
+	Metrics         bool               `yaml:"metrics,omitempty"`         // expose Prometheus metrics at /metrics
+	DisablePluginUI bool               `yaml:"disablePluginUI,omitempty"` // do not serve the Kalamar plugin pages
+	ValidateSchema  bool               `yaml:"validateSchema,omitempty"`  // validate request bodies against the KoralQuery schema
+	RequestTimeout  int                `yaml:"requestTimeout,omitempty"`  // seconds per transformation (0 = no timeout)
+	ShutdownTimeout int                `yaml:"shutdownTimeout,omitempty"` // seconds to drain in-flight requests on shutdown (0 = use default 30)
+	ReadTimeout     int                `yaml:"readTimeout,omitempty"`     // seconds to read a request, including the body (0 = no timeout)
+	WriteTimeout    int                `yaml:"writeTimeout,omitempty"`    // seconds to write a response (0 = no timeout)
+	IdleTimeout     int                `yaml:"idleTimeout,omitempty"`     // seconds to keep idle connections open (0 = use ReadTimeout)
+	ReloadToken     string             `yaml:"reloadToken,omitempty"`     // bearer token enabling POST /reload
+	EditorName      string             `yaml:"editorName,omitempty"`      // editor of emitted koral:rewrite annotations
+	QueryKeys       []string           `yaml:"queryKeys,omitempty"`       // wrapper keys of annotation queries (default "query")
+	FieldPaths      []string           `yaml:"fieldPaths,omitempty"`      // dot-separated paths of response fields arrays (default "fields", "document.fields")
+	ReferenceKeys   []string           `yaml:"referenceKeys,omitempty"`   // response keys whose annotation references are mapped, e.g. "matchInfo"
+	PassthroughID   string             `yaml:"passthroughID,omitempty"`   // mapping ID returning the input unchanged (default "passthrough")
+	SnippetAttr     string             `yaml:"snippetAttr,omitempty"`     // span attribute holding snippet annotations (default "title")
+	MaxBodyBytes    int                `yaml:"maxBodyBytes,omitempty"`    // max request body size (0 = use default 1MB)
+	MaxParamBytes   int                `yaml:"maxParamBytes,omitempty"`   // max size of a single request parameter (0 = use default 1KB)
+	Pipelines       []Pipeline         `yaml:"pipelines,omitempty"`
+	Profiles        map[string]Profile `yaml:"profiles,omitempty"` // environment-specific overrides, selected with --profile
+	Lists           []MappingList      `yaml:"lists,omitempty"`
+}
+
+// Profile holds environment-specific settings, e.g. for dev, stage and
+// prod, that override the base configuration when selected.
+type Profile struct {
+	SDK        string `yaml:"sdk,omitempty"`
+	Server     string `yaml:"server,omitempty"`
+	ServiceURL string `yaml:"serviceURL,omitempty"`
+	Port       int    `yaml:"port,omitempty"`
+}
+
+// applyProfile overrides the settings set in the profile.
+func (m *MappingConfig) applyProfile(p Profile) {
+	if p.SDK != "" {
+		m.SDK = p.SDK
+	}
+	if p.Server != "" {
+		m.Server = p.Server
+	}
+	if p.ServiceURL != "" {
+		m.ServiceURL = p.ServiceURL
+	}
+	if p.Port != 0 {
+		m.Port = p.Port
+	}
+}
+
+// Pipeline is a named cascade of mapping lists. Each step uses the
+// entry format of the cfg parameter, e.g. "stts-upos:atob".
+type Pipeline struct {
+	Name  string   `yaml:"name"`
+	Steps []string `yaml:"steps"`
+}
+
+// CfgString returns the steps joined into a cfg parameter string.
+func (p *Pipeline) CfgString() string {
+	return strings.Join(p.Steps, ";")
+}
+
+// FindPipeline returns the pipeline with the given name, or nil if
+// no such pipeline is configured.
+func (m *MappingConfig) FindPipeline(name string) *Pipeline {
+	for i := range m.Pipelines {
+		if m.Pipelines[i].Name == name {
+			return &m.Pipelines[i]
+		}
+	}
+	return nil
 }
 
 // UnmarshalYAML rejects the deprecated comma-separated string format for
@@ -192,24 +411,91 @@ func sanitizeFilePath(path string) (string, error) {
 	return absPath, nil
 }
 
+// decodeMappingLists decodes a mapping file with one mapping list per YAML
+// document. Documents are separated by "---"; empty documents are skipped.
+func decodeMappingLists(data []byte) ([]MappingList, error) {
+	var lists []MappingList
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		var list MappingList
+		if err := doc.Decode(&list); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		lists = append(lists, list)
+	}
+	return lists, nil
+}
+
 // LoadFromSources loads configuration from multiple sources and merges them:
 // - A main configuration file (optional) containing global settings and lists
 // - Individual mapping files (optional) containing single mapping lists each
-// At least one source must be provided
+// At least one source must be provided. Sources may be local paths,
+// HTTP(S) URLs or "-" for standard input, given at most once.
 func LoadFromSources(configFile string, mappingFiles []string) (*MappingConfig, error) {
+	return LoadFromSourcesWithProfile(configFile, mappingFiles, "")
+}
+
+// LoadFromSourcesWithProfile works like LoadFromSources and merges the
+// settings of the named profile of the main configuration file over the
+// base configuration. Environment variables still take precedence. An
+// empty profile name selects no profile.
+func LoadFromSourcesWithProfile(configFile string, mappingFiles []string, profile string) (*MappingConfig, error) {
+	return LoadFromSourcesWithOptions(configFile, mappingFiles, LoadOptions{Profile: profile})
+}
+
+// LoadOptions control how LoadFromSourcesWithOptions loads the
+// configuration.
+type LoadOptions struct {
+	// Profile names the profile of the main configuration file to merge
+	// over the base configuration. Empty selects no profile.
+	Profile string
+
+	// Strict rejects keys that are not configuration settings, such as
+	// misspelled ones, instead of ignoring them. Unknown keys in mapping
+	// files are errors as well, where lenient loading skips only files
+	// that cannot be parsed.
+	Strict bool
+
+	// Stdin is read for the source given as StdinSource ("-"). Nil
+	// reads os.Stdin.
+	Stdin io.Reader
+}
+
+// LoadFromSourcesWithOptions works like LoadFromSources with the given
+// options applied.
+func LoadFromSourcesWithOptions(configFile string, mappingFiles []string, opts LoadOptions) (*MappingConfig, error) {
 	var allLists []MappingList
 	var globalConfig MappingConfig
 
+	if err := checkStdinSources(configFile, mappingFiles); err != nil {
+		return nil, err
+	}
+	stdin := opts.Stdin
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+
 	// Track seen IDs across all sources to detect duplicates
 	seenIDs := make(map[string]bool)
 
 	// Load main configuration file if provided
 	if configFile != "" {
-		safePath, err := sanitizeFilePath(configFile)
+		safePath, err := sanitizeSource(configFile)
 		if err != nil {
 			return nil, err
 		}
-		data, err := os.ReadFile(safePath) // #nosec G304 -- path sanitized above
+		data, err := readSource(safePath, stdin)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read config file '%s': %w", configFile, err)
 		}
@@ -218,6 +504,12 @@ func LoadFromSources(configFile string, mappingFiles []string) (*MappingConfig,
 			return nil, fmt.Errorf("EOF: config file '%s' is empty", configFile)
 		}
 
+		if opts.Strict {
+			if err := checkConfigFileKeys(data); err != nil {
+				return nil, fmt.Errorf("failed to parse config file '%s': %w", configFile, err)
+			}
+		}
+
 		// Try to unmarshal as new format first (object with optional sdk/server and lists)
 		if err := yaml.Unmarshal(data, &globalConfig); err == nil {
 			// Successfully parsed as new format - accept it regardless of whether it has lists
@@ -251,11 +543,11 @@ func LoadFromSources(configFile string, mappingFiles []string) (*MappingConfig,
 
 	// Load individual mapping files
 	for _, file := range mappingFiles {
-		safePath, err := sanitizeFilePath(file)
+		safePath, err := sanitizeSource(file)
 		if err != nil {
 			return nil, err
 		}
-		data, err := os.ReadFile(safePath) // #nosec G304 -- path sanitized above
+		data, err := readSource(safePath, stdin)
 		if err != nil {
 			log.Error().Err(err).Str("file", file).Msg("Failed to read mapping file")
 			continue
@@ -266,18 +558,26 @@ func LoadFromSources(configFile string, mappingFiles []string) (*MappingConfig,
 			continue
 		}
 
-		var list MappingList
-		if err := yaml.Unmarshal(data, &list); err != nil {
+		if opts.Strict {
+			if err := checkMappingFileKeys(data); err != nil {
+				return nil, fmt.Errorf("failed to parse mapping file '%s': %w", file, err)
+			}
+		}
+
+		lists, err := decodeMappingLists(data)
+		if err != nil {
 			log.Error().Err(err).Str("file", file).Msg("Failed to parse YAML mapping file")
 			continue
 		}
 
-		if seenIDs[list.ID] {
-			log.Error().Err(err).Str("file", file).Str("list-id", list.ID).Msg("Duplicate mapping list ID found")
-			continue
+		for _, list := range lists {
+			if seenIDs[list.ID] {
+				log.Error().Str("file", file).Str("list-id", list.ID).Msg("Duplicate mapping list ID found")
+				continue
+			}
+			seenIDs[list.ID] = true
+			allLists = append(allLists, list)
 		}
-		seenIDs[list.ID] = true
-		allLists = append(allLists, list)
 	}
 
 	// Ensure we have at least some configuration
@@ -285,24 +585,74 @@ func LoadFromSources(configFile string, mappingFiles []string) (*MappingConfig,
 		return nil, fmt.Errorf("no mapping lists found: provide either a config file (-c) with lists or mapping files (-m)")
 	}
 
+	// Drop disabled lists, so they are neither validated nor served
+	enabledLists := allLists[:0]
+	for _, list := range allLists {
+		if !list.IsEnabled() {
+			log.Info().Str("list-id", list.ID).Msg("Skipping disabled mapping list")
+			continue
+		}
+		enabledLists = append(enabledLists, list)
+	}
+	allLists = enabledLists
+	if len(allLists) == 0 {
+		return nil, fmt.Errorf("no enabled mapping lists found: all mapping lists are disabled")
+	}
+
 	// Validate all mapping lists (skip duplicate ID check since we already did it)
 	if err := validateMappingLists(allLists); err != nil {
 		return nil, err
 	}
 
+	if err := validateLanguageVariants(allLists); err != nil {
+		return nil, err
+	}
+
+	if err := validateAliases(allLists); err != nil {
+		return nil, err
+	}
+
+	if opts.Profile != "" {
+		p, ok := globalConfig.Profiles[opts.Profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile '%s' in config file", opts.Profile)
+		}
+		globalConfig.applyProfile(p)
+	}
+
 	// Create final configuration
 	result := &MappingConfig{
-		SDK:          globalConfig.SDK,
-		Stylesheet:   globalConfig.Stylesheet,
-		Server:       globalConfig.Server,
-		ServiceURL:   globalConfig.ServiceURL,
-		BasePath:     globalConfig.BasePath,
-		AllowOrigins: globalConfig.AllowOrigins,
-		Port:         globalConfig.Port,
-		LogLevel:     globalConfig.LogLevel,
-		RateLimit:    globalConfig.RateLimit,
-		Rewrites:     globalConfig.Rewrites,
-		Lists:        allLists,
+		SDK:             globalConfig.SDK,
+		Stylesheet:      globalConfig.Stylesheet,
+		Server:          globalConfig.Server,
+		ServiceURL:      globalConfig.ServiceURL,
+		BasePath:        globalConfig.BasePath,
+		RoutePrefix:     globalConfig.RoutePrefix,
+		AllowOrigins:    globalConfig.AllowOrigins,
+		Port:            globalConfig.Port,
+		LogLevel:        globalConfig.LogLevel,
+		LogFormat:       globalConfig.LogFormat,
+		RateLimit:       globalConfig.RateLimit,
+		Rewrites:        globalConfig.Rewrites,
+		Metrics:         globalConfig.Metrics,
+		DisablePluginUI: globalConfig.DisablePluginUI,
+		ValidateSchema:  globalConfig.ValidateSchema,
+		RequestTimeout:  globalConfig.RequestTimeout,
+		ShutdownTimeout: globalConfig.ShutdownTimeout,
+		ReadTimeout:     globalConfig.ReadTimeout,
+		WriteTimeout:    globalConfig.WriteTimeout,
+		IdleTimeout:     globalConfig.IdleTimeout,
+		ReloadToken:     globalConfig.ReloadToken,
+		EditorName:      globalConfig.EditorName,
+		QueryKeys:       globalConfig.QueryKeys,
+		FieldPaths:      globalConfig.FieldPaths,
+		ReferenceKeys:   globalConfig.ReferenceKeys,
+		PassthroughID:   globalConfig.PassthroughID,
+		SnippetAttr:     globalConfig.SnippetAttr,
+		MaxBodyBytes:    globalConfig.MaxBodyBytes,
+		MaxParamBytes:   globalConfig.MaxParamBytes,
+		Pipelines:       globalConfig.Pipelines,
+		Lists:           allLists,
 	}
 
 	// Apply environment variable overrides (ENV > config file)
@@ -311,18 +661,114 @@ func LoadFromSources(configFile string, mappingFiles []string) (*MappingConfig,
 	// Apply defaults if not specified
 	ApplyDefaults(result)
 
+	if err := validateServerTimeouts(result); err != nil {
+		return nil, err
+	}
+
+	if err := validatePipelines(result.Pipelines, result.Lists, result.PassthroughID); err != nil {
+		return nil, err
+	}
+
+	if err := validateFieldPaths(result.FieldPaths); err != nil {
+		return nil, err
+	}
+
+	if result.SnippetAttr != "" && !attributeNamePattern.MatchString(result.SnippetAttr) {
+		return nil, fmt.Errorf("invalid snippetAttr '%s': not an XML attribute name", result.SnippetAttr)
+	}
+
+	prefix, err := normalizeRoutePrefix(result.RoutePrefix)
+	if err != nil {
+		return nil, err
+	}
+	result.RoutePrefix = prefix
+	result.ServiceURL = serviceURLWithPrefix(result.ServiceURL, prefix)
+
 	return result, nil
 }
 
+// routePrefixPattern matches the path segments accepted as routePrefix,
+// without route parameters or wildcards.
+var routePrefixPattern = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)+$`)
+
+// normalizeRoutePrefix returns the route prefix with a leading and
+// without a trailing slash, or "" for no prefix.
+func normalizeRoutePrefix(prefix string) (string, error) {
+	normalized := strings.TrimRight(prefix, "/")
+	if normalized == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(normalized, "/") {
+		normalized = "/" + normalized
+	}
+	if !routePrefixPattern.MatchString(normalized) {
+		return "", fmt.Errorf("invalid routePrefix '%s': must be a path like /plugin/koralmapper", prefix)
+	}
+	return normalized, nil
+}
+
+// serviceURLWithPrefix appends the route prefix to the path of the
+// service URL, unless the path already ends with it.
+func serviceURLWithPrefix(serviceURL, prefix string) string {
+	if prefix == "" {
+		return serviceURL
+	}
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return serviceURL
+	}
+	path := strings.TrimRight(u.Path, "/")
+	// The prefix starts with a slash, so it only matches whole segments
+	if strings.HasSuffix(path, prefix) {
+		return serviceURL
+	}
+	u.Path = path + prefix
+	return u.String()
+}
+
+// attributeNamePattern matches the XML attribute names accepted as
+// snippetAttr.
+var attributeNamePattern = regexp.MustCompile(`^[A-Za-z_][-A-Za-z0-9_.]*$`)
+
+// validateFieldPaths checks that the field paths have no empty keys.
+func validateFieldPaths(paths []string) error {
+	for _, path := range paths {
+		if slices.Contains(strings.Split(path, "."), "") {
+			return fmt.Errorf("invalid fieldPaths entry '%s': keys must not be empty", path)
+		}
+	}
+	return nil
+}
+
+// validateServerTimeouts checks that the server timeouts are not negative.
+func validateServerTimeouts(config *MappingConfig) error {
+	for _, timeout := range []struct {
+		name  string
+		value int
+	}{
+		{"readTimeout", config.ReadTimeout},
+		{"writeTimeout", config.WriteTimeout},
+		{"idleTimeout", config.IdleTimeout},
+	} {
+		if timeout.value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", timeout.name, timeout.value)
+		}
+	}
+	return nil
+}
+
 // ApplyDefaults sets default values for configuration fields if they are empty
 func ApplyDefaults(config *MappingConfig) {
 	defaults := map[*string]string{
-		&config.SDK:        defaultSDK,
-		&config.Stylesheet: defaultStylesheet,
-		&config.Server:     defaultServer,
-		&config.ServiceURL: defaultServiceURL,
-		&config.CookieName: defaultCookieName,
-		&config.LogLevel:   defaultLogLevel,
+		&config.SDK:           defaultSDK,
+		&config.Stylesheet:    defaultStylesheet,
+		&config.Server:        defaultServer,
+		&config.ServiceURL:    defaultServiceURL,
+		&config.CookieName:    defaultCookieName,
+		&config.LogLevel:      defaultLogLevel,
+		&config.LogFormat:     defaultLogFormat,
+		&config.EditorName:    defaultEditorName,
+		&config.PassthroughID: defaultPassthroughID,
 	}
 
 	for field, defaultValue := range defaults {
@@ -344,6 +790,15 @@ func ApplyDefaults(config *MappingConfig) {
 	if config.RateLimit == 0 {
 		config.RateLimit = defaultRateLimit
 	}
+	if config.MaxBodyBytes == 0 {
+		config.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if config.MaxParamBytes == 0 {
+		config.MaxParamBytes = defaultMaxParamBytes
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
 }
 
 // normalizeOrigins strips path components from origin URLs, returning only
@@ -371,13 +826,19 @@ func normalizeOrigins(origins []string) []string {
 // Non-empty environment values override any previously loaded config values.
 func ApplyEnvOverrides(config *MappingConfig) {
 	envMappings := map[string]*string{
-		"KORAL_MAPPER_SERVER":      &config.Server,
-		"KORAL_MAPPER_SDK":         &config.SDK,
-		"KORAL_MAPPER_STYLESHEET":  &config.Stylesheet,
-		"KORAL_MAPPER_SERVICE_URL": &config.ServiceURL,
-		"KORAL_MAPPER_COOKIE_NAME": &config.CookieName,
-		"KORAL_MAPPER_LOG_LEVEL":   &config.LogLevel,
-		"KORAL_MAPPER_BASE_PATH":   &config.BasePath,
+		"KORAL_MAPPER_SERVER":         &config.Server,
+		"KORAL_MAPPER_SDK":            &config.SDK,
+		"KORAL_MAPPER_STYLESHEET":     &config.Stylesheet,
+		"KORAL_MAPPER_SERVICE_URL":    &config.ServiceURL,
+		"KORAL_MAPPER_COOKIE_NAME":    &config.CookieName,
+		"KORAL_MAPPER_LOG_LEVEL":      &config.LogLevel,
+		"KORAL_MAPPER_LOG_FORMAT":     &config.LogFormat,
+		"KORAL_MAPPER_RELOAD_TOKEN":   &config.ReloadToken,
+		"KORAL_MAPPER_EDITOR_NAME":    &config.EditorName,
+		"KORAL_MAPPER_BASE_PATH":      &config.BasePath,
+		"KORAL_MAPPER_PASSTHROUGH_ID": &config.PassthroughID,
+		"KORAL_MAPPER_SNIPPET_ATTR":   &config.SnippetAttr,
+		"KORAL_MAPPER_ROUTE_PREFIX":   &config.RoutePrefix,
 	}
 
 	for envKey, field := range envMappings {
@@ -402,9 +863,57 @@ func ApplyEnvOverrides(config *MappingConfig) {
 		}
 	}
 
+	if val := os.Getenv("KORAL_MAPPER_MAX_BODY_BYTES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.MaxBodyBytes = n
+		}
+	}
+
+	if val := os.Getenv("KORAL_MAPPER_MAX_PARAM_BYTES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.MaxParamBytes = n
+		}
+	}
+
 	if val := os.Getenv("KORAL_MAPPER_REWRITES"); val != "" {
 		config.Rewrites = val == "true"
 	}
+
+	if val := os.Getenv("KORAL_MAPPER_METRICS"); val != "" {
+		config.Metrics = val == "true"
+	}
+
+	if val := os.Getenv("KORAL_MAPPER_DISABLE_PLUGIN_UI"); val != "" {
+		config.DisablePluginUI = val == "true"
+	}
+
+	if val := os.Getenv("KORAL_MAPPER_VALIDATE_SCHEMA"); val != "" {
+		config.ValidateSchema = val == "true"
+	}
+
+	if val := os.Getenv("KORAL_MAPPER_REQUEST_TIMEOUT"); val != "" {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			config.RequestTimeout = timeout
+		}
+	}
+
+	if val := os.Getenv("KORAL_MAPPER_SHUTDOWN_TIMEOUT"); val != "" {
+		if timeout, err := strconv.Atoi(val); err == nil {
+			config.ShutdownTimeout = timeout
+		}
+	}
+
+	for envKey, target := range map[string]*int{
+		"KORAL_MAPPER_READ_TIMEOUT":  &config.ReadTimeout,
+		"KORAL_MAPPER_WRITE_TIMEOUT": &config.WriteTimeout,
+		"KORAL_MAPPER_IDLE_TIMEOUT":  &config.IdleTimeout,
+	} {
+		if val := os.Getenv(envKey); val != "" {
+			if timeout, err := strconv.Atoi(val); err == nil {
+				*target = timeout
+			}
+		}
+	}
 }
 
 // validateMappingLists validates a slice of mapping lists (without duplicate ID checking)
@@ -418,17 +927,68 @@ func validateMappingLists(lists []MappingList) error {
 			return fmt.Errorf("mapping list '%s' has no mapping rules", list.ID)
 		}
 
+		if list.DefaultDirection != "" && list.DefaultDirection != "atob" && list.DefaultDirection != "btoa" {
+			return fmt.Errorf("mapping list '%s' has invalid defaultDirection '%s', must be 'atob' or 'btoa'", list.ID, list.DefaultDirection)
+		}
+
+		if list.RequestsPerSecond < 0 {
+			return fmt.Errorf("mapping list '%s' requestsPerSecond must not be negative, got %g", list.ID, list.RequestsPerSecond)
+		}
+		if list.Burst < 0 {
+			return fmt.Errorf("mapping list '%s' burst must not be negative, got %d", list.ID, list.Burst)
+		}
+
+		if err := validateRenames(list, "foundryRenames", list.FoundryRenames); err != nil {
+			return err
+		}
+		if err := validateRenames(list, "layerRenames", list.LayerRenames); err != nil {
+			return err
+		}
+		if list.IsCorpus() && (len(list.AllowedFoundries) > 0 || len(list.AllowedLayers) > 0) {
+			return fmt.Errorf("mapping list '%s' is a corpus list, allowedFoundries and allowedLayers only apply to annotation lists", list.ID)
+		}
+
 		// Validate each mapping rule
+		ruleIDs := make(map[string]bool)
 		for j, rule := range list.Mappings {
 			if rule == "" {
 				return fmt.Errorf("mapping list '%s' rule at index %d is empty", list.ID, j)
 			}
+			meta := list.RuleMetaAt(j)
+			if meta.Expected != nil && meta.Example == nil {
+				return fmt.Errorf("mapping list '%s' %s has an expected result but no example", list.ID, list.RuleLabel(j))
+			}
+			if id := meta.ID; id != "" {
+				if ruleIDs[id] {
+					return fmt.Errorf("mapping list '%s' has duplicate rule id '%s'", list.ID, id)
+				}
+				ruleIDs[id] = true
+			}
 		}
 	}
 	return nil
 }
 
-// ParseMappings parses all mapping rules in a list and returns a slice of parsed rules
+// validateRenames checks the foundry or layer renames of a mapping list,
+// which only apply to annotation lists and need non-empty names.
+func validateRenames(list MappingList, field string, renames map[string]string) error {
+	if len(renames) == 0 {
+		return nil
+	}
+	if list.IsCorpus() {
+		return fmt.Errorf("mapping list '%s' is a corpus list, %s only apply to annotation lists", list.ID, field)
+	}
+	for from, to := range renames {
+		if from == "" || to == "" {
+			return fmt.Errorf("mapping list '%s' has an empty name in %s", list.ID, field)
+		}
+	}
+	return nil
+}
+
+// ParseMappings parses all mapping rules in a list and returns a slice of parsed rules.
+// In mixed lists, only the annotation rules are parsed; the results of
+// corpus rules are nil, so results are indexed like the rules.
 func (list *MappingList) ParseMappings() ([]*parser.MappingResult, error) {
 	// Create a grammar parser with the list's default foundries and layers
 	grammarParser, err := parser.NewGrammarParser("", "")
@@ -442,11 +1002,14 @@ func (list *MappingList) ParseMappings() ([]*parser.MappingResult, error) {
 		if rule == "" {
 			return nil, fmt.Errorf("empty mapping rule at index %d in list '%s'", i, list.ID)
 		}
+		if list.IsMixed() && list.IsCorpusRuleAt(i) {
+			continue
+		}
 
 		// Parse the mapping rule
 		result, err := grammarParser.ParseMapping(string(rule))
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse mapping rule %d in list '%s': %w", i, list.ID, err)
+			return nil, fmt.Errorf("failed to parse mapping %s in list '%s': %w", list.RuleLabel(i), list.ID, err)
 		}
 
 		// Apply default foundries and layers if not specified in the rule
@@ -479,3 +1042,89 @@ func applyDefaultFoundryAndLayer(node ast.Node, defaultFoundry, defaultLayer str
 		}
 	}
 }
+
+// validateLanguageVariants checks that lists sharing a logical name
+// differ in their language.
+func validateLanguageVariants(lists []MappingList) error {
+	seen := make(map[[2]string]string, len(lists))
+	for _, list := range lists {
+		if list.Name == "" {
+			continue
+		}
+		key := [2]string{list.Name, strings.ToLower(list.Language)}
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("mapping lists '%s' and '%s' share name '%s' and language '%s'", other, list.ID, list.Name, list.Language)
+		}
+		seen[key] = list.ID
+	}
+	return nil
+}
+
+// validateAliases checks that aliases are not empty and collide neither
+// with list IDs nor with other aliases.
+func validateAliases(lists []MappingList) error {
+	owners := make(map[string]string, len(lists))
+	for _, list := range lists {
+		owners[list.ID] = list.ID
+	}
+	for _, list := range lists {
+		for _, alias := range list.Aliases {
+			if alias == "" {
+				return fmt.Errorf("mapping list '%s' has an empty alias", list.ID)
+			}
+			if owner, ok := owners[alias]; ok {
+				if owner == alias {
+					return fmt.Errorf("alias '%s' of mapping list '%s' collides with a mapping list ID", alias, list.ID)
+				}
+				return fmt.Errorf("alias '%s' of mapping list '%s' is already an alias of mapping list '%s'", alias, list.ID, owner)
+			}
+			owners[alias] = list.ID
+		}
+	}
+	return nil
+}
+
+// validatePipelines checks that pipeline names are present and unique and
+// that every step references a loaded mapping list or the passthrough ID
+// with a valid direction.
+func validatePipelines(pipelines []Pipeline, lists []MappingList, passthroughID string) error {
+	listIDs := make(map[string]bool, len(lists))
+	// The passthrough ID is an identity step
+	if passthroughID != "" {
+		listIDs[passthroughID] = true
+	}
+	for _, list := range lists {
+		listIDs[list.ID] = true
+		for _, alias := range list.Aliases {
+			listIDs[alias] = true
+		}
+	}
+
+	seenNames := make(map[string]bool, len(pipelines))
+	for i, pipeline := range pipelines {
+		if pipeline.Name == "" {
+			return fmt.Errorf("pipeline at index %d is missing a name", i)
+		}
+		if seenNames[pipeline.Name] {
+			return fmt.Errorf("duplicate pipeline name found: %s", pipeline.Name)
+		}
+		seenNames[pipeline.Name] = true
+
+		if len(pipeline.Steps) == 0 {
+			return fmt.Errorf("pipeline '%s' has no steps", pipeline.Name)
+		}
+		for j, step := range pipeline.Steps {
+			fields := strings.Split(step, ":")
+			if len(fields) < 2 {
+				return fmt.Errorf("pipeline '%s' step %d %q: expected id:dir", pipeline.Name, j, step)
+			}
+			if !listIDs[fields[0]] {
+				return fmt.Errorf("pipeline '%s' step %d references unknown mapping list '%s'", pipeline.Name, j, fields[0])
+			}
+			if fields[1] != "atob" && fields[1] != "btoa" {
+				return fmt.Errorf("pipeline '%s' step %d has invalid direction %q", pipeline.Name, j, fields[1])
+			}
+		}
+	}
+	return nil
+}
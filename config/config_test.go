@@ -2,8 +2,12 @@ package config
 
 import (
 	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/KorAP/Koral-Mapper/ast"
@@ -930,6 +934,56 @@ func TestParseCorpusMappings(t *testing.T) {
 	require.NotNil(t, results[1].Lower)
 }
 
+func TestParseMixedMappings(t *testing.T) {
+	list := &MappingList{
+		ID:       "test-mixed",
+		Type:     "mixed",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		FieldB:   "genre",
+		Mappings: []MappingRule{
+			"[DET] <> [PRON]",
+			"textClass=novel <> fiction",
+			" (textClass=novel & pubDate=2020:geq#date) <> genre=recent",
+			"[opennlp/p=ADJA] >> [ADJ]",
+		},
+	}
+	assert.True(t, list.IsMixed())
+	assert.False(t, list.IsCorpus())
+
+	isCorpus := make([]bool, len(list.Mappings))
+	for i := range list.Mappings {
+		isCorpus[i] = list.IsCorpusRuleAt(i)
+	}
+	assert.Equal(t, []bool{false, true, true, false}, isCorpus)
+
+	annotationRules, err := list.ParseMappings()
+	require.NoError(t, err)
+	require.Len(t, annotationRules, 4)
+	require.NotNil(t, annotationRules[0])
+	assert.Nil(t, annotationRules[1])
+	assert.Nil(t, annotationRules[2])
+	require.NotNil(t, annotationRules[3])
+	assert.Equal(t, "upos", annotationRules[0].Lower.Wrap.(*ast.Term).Foundry)
+
+	corpusRules, err := list.ParseCorpusMappings()
+	require.NoError(t, err)
+	require.Len(t, corpusRules, 4)
+	assert.Nil(t, corpusRules[0])
+	require.NotNil(t, corpusRules[1])
+	require.NotNil(t, corpusRules[2])
+	assert.Nil(t, corpusRules[3])
+	assert.Equal(t, "genre", corpusRules[1].Lower.(*parser.CorpusField).Key)
+
+	// Rules of the other kind are routed by their form, not by the type
+	annotationList := &MappingList{ID: "a", Mappings: []MappingRule{"textClass=novel <> genre=fiction"}}
+	assert.False(t, annotationList.IsCorpusRuleAt(0))
+	corpusList := &MappingList{ID: "c", Type: "corpus", Mappings: []MappingRule{"[DET] <> [PRON]"}}
+	assert.True(t, corpusList.IsCorpusRuleAt(0))
+}
+
 func TestParseCorpusMappingsErrors(t *testing.T) {
 	list := &MappingList{
 		ID:       "test-corpus",
@@ -1339,45 +1393,15 @@ lists:
 		"KORAL_MAPPER_REWRITES=false env var should override YAML rewrites=true")
 }
 
-func TestParseCorpusMappingsWithFieldAFieldB(t *testing.T) {
-	list := &MappingList{
-		ID:     "test-keyed",
-		Type:   "corpus",
-		FieldA: "wikiCat",
-		FieldB: "textClass",
-		Mappings: []MappingRule{
-			"Entertainment <> ((kultur & musik) | (kultur & film))",
-		},
-	}
-
-	results, err := list.ParseCorpusMappings()
-	require.NoError(t, err)
-	require.Len(t, results, 1)
-
-	upper := results[0].Upper.(*parser.CorpusField)
-	assert.Equal(t, "wikiCat", upper.Key)
-	assert.Equal(t, "Entertainment", upper.Value)
-
-	group := results[0].Lower.(*parser.CorpusGroup)
-	assert.Equal(t, "or", group.Operation)
-	require.Len(t, group.Operands, 2)
-
-	and1 := group.Operands[0].(*parser.CorpusGroup)
-	assert.Equal(t, "textClass", and1.Operands[0].(*parser.CorpusField).Key)
-	assert.Equal(t, "kultur", and1.Operands[0].(*parser.CorpusField).Value)
-	assert.Equal(t, "textClass", and1.Operands[1].(*parser.CorpusField).Key)
-	assert.Equal(t, "musik", and1.Operands[1].(*parser.CorpusField).Value)
-}
-
-func TestRateLimitConfigField(t *testing.T) {
+func TestMetricsConfig(t *testing.T) {
 	content := `
-rateLimit: 50
+metrics: true
 lists:
   - id: test-mapper
     mappings:
       - "[A] <> [B]"
 `
-	tmpfile, err := os.CreateTemp("", "config-ratelimit-*.yaml")
+	tmpfile, err := os.CreateTemp("", "config-metrics-*.yaml")
 	require.NoError(t, err)
 	defer os.Remove(tmpfile.Name())
 
@@ -1387,27 +1411,24 @@ lists:
 
 	cfg, err := LoadFromSources(tmpfile.Name(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, 50, cfg.RateLimit, "rateLimit should be loaded from YAML")
-}
+	assert.True(t, cfg.Metrics)
 
-func TestRateLimitDefaultApplied(t *testing.T) {
-	cfg := &MappingConfig{}
-	ApplyDefaults(cfg)
-	assert.Equal(t, defaultRateLimit, cfg.RateLimit,
-		"default rate limit should be applied when not specified")
+	t.Setenv("KORAL_MAPPER_METRICS", "false")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.Metrics,
+		"KORAL_MAPPER_METRICS=false env var should override YAML metrics=true")
 }
 
-func TestRateLimitEnvOverride(t *testing.T) {
-	t.Setenv("KORAL_MAPPER_RATE_LIMIT", "200")
-
+func TestDisablePluginUIConfig(t *testing.T) {
 	content := `
-rateLimit: 50
+disablePluginUI: true
 lists:
   - id: test-mapper
     mappings:
       - "[A] <> [B]"
 `
-	tmpfile, err := os.CreateTemp("", "config-ratelimit-env-*.yaml")
+	tmpfile, err := os.CreateTemp("", "config-plugin-ui-*.yaml")
 	require.NoError(t, err)
 	defer os.Remove(tmpfile.Name())
 
@@ -1417,48 +1438,24 @@ lists:
 
 	cfg, err := LoadFromSources(tmpfile.Name(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, 200, cfg.RateLimit,
-		"KORAL_MAPPER_RATE_LIMIT env var should override YAML value")
-}
-
-func TestAllowOriginsDefault(t *testing.T) {
-	cfg := &MappingConfig{}
-	ApplyDefaults(cfg)
-	// AllowOrigins should derive from the Server default (trailing slash stripped)
-	assert.Equal(t, []string{"https://korap.ids-mannheim.de"}, cfg.AllowOrigins,
-		"default AllowOrigins should derive from defaultServer")
-}
-
-func TestAllowOriginsDerivedFromCustomServer(t *testing.T) {
-	cfg := &MappingConfig{
-		Server: "https://custom.example.com/",
-	}
-	ApplyDefaults(cfg)
-	assert.Equal(t, []string{"https://custom.example.com"}, cfg.AllowOrigins,
-		"AllowOrigins should derive from the configured Server (trailing slash stripped)")
-}
+	assert.True(t, cfg.DisablePluginUI)
 
-func TestAllowOriginsExplicitNotOverriddenByServer(t *testing.T) {
-	cfg := &MappingConfig{
-		Server:       "https://custom.example.com/",
-		AllowOrigins: []string{"https://explicit-origin.example.com"},
-	}
-	ApplyDefaults(cfg)
-	assert.Equal(t, []string{"https://explicit-origin.example.com"}, cfg.AllowOrigins,
-		"explicit AllowOrigins should not be overridden by Server default")
+	t.Setenv("KORAL_MAPPER_DISABLE_PLUGIN_UI", "false")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.DisablePluginUI,
+		"KORAL_MAPPER_DISABLE_PLUGIN_UI=false env var should override YAML disablePluginUI=true")
 }
 
-func TestAllowOriginsFromYAML(t *testing.T) {
+func TestValidateSchemaConfig(t *testing.T) {
 	content := `
-allowOrigins:
-  - "https://custom.example.com"
-  - "https://other.example.com"
+validateSchema: true
 lists:
   - id: test-mapper
     mappings:
       - "[A] <> [B]"
 `
-	tmpfile, err := os.CreateTemp("", "config-cors-*.yaml")
+	tmpfile, err := os.CreateTemp("", "config-validate-schema-*.yaml")
 	require.NoError(t, err)
 	defer os.Remove(tmpfile.Name())
 
@@ -1468,19 +1465,23 @@ lists:
 
 	cfg, err := LoadFromSources(tmpfile.Name(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, []string{"https://custom.example.com", "https://other.example.com"},
-		cfg.AllowOrigins)
+	assert.True(t, cfg.ValidateSchema)
+
+	t.Setenv("KORAL_MAPPER_VALIDATE_SCHEMA", "false")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.False(t, cfg.ValidateSchema)
 }
 
-func TestAllowOriginsStringFormatRejected(t *testing.T) {
+func TestRequestTimeoutConfig(t *testing.T) {
 	content := `
-allowOrigins: "https://custom.example.com,https://other.example.com"
+requestTimeout: 5
 lists:
   - id: test-mapper
     mappings:
       - "[A] <> [B]"
 `
-	tmpfile, err := os.CreateTemp("", "config-cors-reject-*.yaml")
+	tmpfile, err := os.CreateTemp("", "config-timeout-*.yaml")
 	require.NoError(t, err)
 	defer os.Remove(tmpfile.Name())
 
@@ -1488,23 +1489,25 @@ lists:
 	require.NoError(t, err)
 	require.NoError(t, tmpfile.Close())
 
-	_, err = LoadFromSources(tmpfile.Name(), nil)
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "allowOrigins must be a YAML list")
-}
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.RequestTimeout)
 
-func TestAllowOriginsEnvOverride(t *testing.T) {
-	t.Setenv("KORAL_MAPPER_ALLOW_ORIGINS", "https://env-origin.example.com")
+	t.Setenv("KORAL_MAPPER_REQUEST_TIMEOUT", "10")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.RequestTimeout,
+		"KORAL_MAPPER_REQUEST_TIMEOUT env var should override YAML requestTimeout")
+}
 
+func TestShutdownTimeoutConfig(t *testing.T) {
 	content := `
-allowOrigins:
-  - "https://yaml-origin.example.com"
 lists:
   - id: test-mapper
     mappings:
       - "[A] <> [B]"
 `
-	tmpfile, err := os.CreateTemp("", "config-cors-env-*.yaml")
+	tmpfile, err := os.CreateTemp("", "config-shutdown-*.yaml")
 	require.NoError(t, err)
 	defer os.Remove(tmpfile.Name())
 
@@ -1514,216 +1517,1778 @@ lists:
 
 	cfg, err := LoadFromSources(tmpfile.Name(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, []string{"https://env-origin.example.com"}, cfg.AllowOrigins,
-		"KORAL_MAPPER_ALLOW_ORIGINS env var should override YAML value")
-}
+	assert.Equal(t, defaultShutdownTimeout, cfg.ShutdownTimeout)
 
-func TestAllowOriginsDerivedFromServerWithPath(t *testing.T) {
-	cfg := &MappingConfig{
-		Server: "https://korap.ids-mannheim.de/instance/test",
-	}
-	ApplyDefaults(cfg)
-	assert.Equal(t, []string{"https://korap.ids-mannheim.de"}, cfg.AllowOrigins,
-		"AllowOrigins should be pruned to host-level origin when Server contains a path")
+	t.Setenv("KORAL_MAPPER_SHUTDOWN_TIMEOUT", "5")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, cfg.ShutdownTimeout,
+		"KORAL_MAPPER_SHUTDOWN_TIMEOUT env var should override the default")
 }
 
-func TestAllowOriginsExplicitWithPathsPruned(t *testing.T) {
-	cfg := &MappingConfig{
-		AllowOrigins: []string{"https://korap.ids-mannheim.de/instance/test", "https://other.example.com/app"},
-	}
-	ApplyDefaults(cfg)
-	assert.Equal(t, []string{"https://korap.ids-mannheim.de", "https://other.example.com"}, cfg.AllowOrigins,
-		"explicit AllowOrigins entries should be pruned to host-level origins")
-}
+func TestMultiDocumentMappingFile(t *testing.T) {
+	content := `id: mapper-1
+mappings:
+  - "[A] <> [B]"
+---
+id: mapper-2
+type: corpus
+mappings:
+  - "textClass=novel <> genre=fiction"
+---
+id: mapper-3
+mappings:
+  - "[C] <> [D]"
+---
+`
+	tmpfile, err := os.CreateTemp("", "mapping-multi-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
 
-func TestAllowOriginsWithPort(t *testing.T) {
-	cfg := &MappingConfig{
-		Server: "https://korap.ids-mannheim.de:8080/instance/test",
-	}
-	ApplyDefaults(cfg)
-	assert.Equal(t, []string{"https://korap.ids-mannheim.de:8080"}, cfg.AllowOrigins,
-		"AllowOrigins should preserve port but strip path")
-}
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
 
-func TestSanitizeFilePathRejectsOutsideBase(t *testing.T) {
-	// Set base to a specific directory and verify paths outside are rejected
-	tmpDir, err := os.MkdirTemp("", "koral-base-*")
+	cfg, err := LoadFromSources("", []string{tmpfile.Name()})
 	require.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
+	require.Len(t, cfg.Lists, 3)
+	assert.Equal(t, "mapper-1", cfg.Lists[0].ID)
+	assert.Equal(t, "mapper-2", cfg.Lists[1].ID)
+	assert.True(t, cfg.Lists[1].IsCorpus())
+	assert.Equal(t, "mapper-3", cfg.Lists[2].ID)
 
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
-	AllowedBasePath = tmpDir
+	// Duplicate IDs are detected across documents and files
+	dupfile, err := os.CreateTemp("", "mapping-dup-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(dupfile.Name())
 
-	tests := []struct {
-		name    string
-		input   string
-		wantErr bool
-	}{
-		{
-			name:    "Path within base is accepted",
-			input:   filepath.Join(tmpDir, "config.yaml"),
-			wantErr: false,
-		},
-		{
-			name:    "Path outside base is rejected",
-			input:   "/etc/passwd",
-			wantErr: true,
-		},
-		{
-			name:    "Traversal escaping base and tmp is rejected",
-			input:   "/etc/passwd",
-			wantErr: true,
-		},
-		{
-			name:    "Empty path is rejected",
-			input:   "",
-			wantErr: true,
-		},
-		{
-			name:    "Subdirectory within base is accepted",
-			input:   filepath.Join(tmpDir, "sub", "dir", "file.yaml"),
-			wantErr: false,
-		},
-		{
-			name:    "Relative path within base is rejected when CWD differs",
-			input:   "config.yaml",
-			wantErr: true, // resolves against CWD, not base
-		},
-	}
+	_, err = dupfile.WriteString("id: mapper-4\nmappings:\n  - \"[E] <> [F]\"\n---\nid: mapper-2\nmappings:\n  - \"[G] <> [H]\"\n")
+	require.NoError(t, err)
+	require.NoError(t, dupfile.Close())
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result, err := sanitizeFilePath(tt.input)
-			if tt.wantErr {
-				require.Error(t, err)
-				return
-			}
-			require.NoError(t, err)
-			assert.True(t, filepath.IsAbs(result),
-				"sanitized path should be absolute, got: %s", result)
-			assert.NotContains(t, result, "..")
-		})
-	}
+	cfg, err = LoadFromSources("", []string{tmpfile.Name(), dupfile.Name()})
+	require.NoError(t, err)
+	require.Len(t, cfg.Lists, 4)
+	assert.Equal(t, "mapper-4", cfg.Lists[3].ID)
+	assert.True(t, cfg.Lists[1].IsCorpus(), "duplicate list must not replace the first one")
 }
 
-func TestSanitizeFilePathTraversalToPasswd(t *testing.T) {
-	// Verify /etc/passwd cannot be accessed via traversal
-	cwd, err := os.Getwd()
+func TestRuleObjectForm(t *testing.T) {
+	content := `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+      - rule: "[C] <> [D]"
+        operation: "operation:override"
+        scope: "key"
+`
+	tmpfile, err := os.CreateTemp("", "config-rules-*.yaml")
 	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
 
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
-	AllowedBasePath = cwd
-
-	_, err = sanitizeFilePath("../../../etc/passwd")
-	require.Error(t, err)
-	assert.Contains(t, err.Error(), "path traversal detected")
-}
-
-func TestSanitizeFilePathWithDockerRoot(t *testing.T) {
-	// In Docker the WORKDIR is "/" -- all absolute paths should be valid
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
-	AllowedBasePath = "/"
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
 
-	result, err := sanitizeFilePath("/mappings/stts-upos.yaml")
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, "/mappings/stts-upos.yaml", result)
+	require.Len(t, cfg.Lists, 1)
 
-	// Even deeply nested paths work when base is /
-	result, err = sanitizeFilePath("/etc/ssl/certs/ca-certificates.crt")
+	list := cfg.Lists[0]
+	assert.Equal(t, []MappingRule{"[A] <> [B]", "[C] <> [D]"}, list.Mappings)
+	assert.Equal(t, RuleMeta{}, list.RuleMetaAt(0))
+	assert.Equal(t, RuleMeta{Operation: "operation:override", Scope: "key"}, list.RuleMetaAt(1))
+	assert.Equal(t, RuleMeta{}, list.RuleMetaAt(2))
+
+	results, err := list.ParseMappings()
 	require.NoError(t, err)
-	assert.Equal(t, "/etc/ssl/certs/ca-certificates.crt", result)
+	assert.Len(t, results, 2)
 }
 
-func TestSanitizeFilePathPrefixFalsePositive(t *testing.T) {
-	// Ensure /home/user does not match /home/username
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
-	AllowedBasePath = "/home/user"
+func TestRuleIDsAndComments(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		t.Helper()
+		tmpfile, err := os.CreateTemp("", "config-rule-ids-*.yaml")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return tmpfile.Name()
+	}
+
+	cfg, err := LoadFromSources(writeConfig(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+      - rule: "[C] <> [D]"
+        id: r1
+        comment: "Maps C to D"
+      - rule: "[E] <> [F]"
+        comment: "No ID"
+      - "[G] <> [H]"
+`), nil)
+	require.NoError(t, err)
+
+	list := cfg.Lists[0]
+	assert.Equal(t, []MappingRule{"[A] <> [B]", "[C] <> [D]", "[E] <> [F]", "[G] <> [H]"}, list.Mappings)
+	assert.Equal(t, RuleMeta{}, list.RuleMetaAt(0))
+	assert.Equal(t, RuleMeta{ID: "r1", Comment: "Maps C to D"}, list.RuleMetaAt(1))
+	assert.Equal(t, RuleMeta{Comment: "No ID"}, list.RuleMetaAt(2))
+	assert.Equal(t, RuleMeta{}, list.RuleMetaAt(3))
+	assert.Equal(t, "rule 0", list.RuleLabel(0))
+	assert.Equal(t, "rule 1 (r1)", list.RuleLabel(1))
+
+	// Parse errors name the rule by its ID
+	cfg, err = LoadFromSources(writeConfig(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+      - rule: "[C] <> "
+        id: broken
+`), nil)
+	require.NoError(t, err)
+	_, err = cfg.Lists[0].ParseMappings()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse mapping rule 1 (broken) in list 'test-mapper'")
+
+	_, err = LoadFromSources(writeConfig(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - rule: "[A] <> [B]"
+        id: r1
+      - rule: "[C] <> [D]"
+        id: r1
+`), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapping list 'test-mapper' has duplicate rule id 'r1'")
+}
+
+func TestTaggedRules(t *testing.T) {
+	content := `
+lists:
+  - id: test-mapper
+    mappings:
+      - rule: "[NN] <> [NOUN]"
+        tags: [pos, noun]
+      - rule: "[VVFIN] <> [VERB]"
+        tags: [pos]
+      - "[Case:Nom] <> [Case=Nom]"
+`
+	tmpfile, err := os.CreateTemp("", "config-tags-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+
+	list := cfg.Lists[0]
+	require.Len(t, list.Mappings, 3)
+	assert.Equal(t, []string{"pos", "noun"}, list.RuleMetaAt(0).Tags)
+	assert.Equal(t, []string{"pos"}, list.RuleMetaAt(1).Tags)
+	assert.Empty(t, list.RuleMetaAt(2).Tags)
+}
+
+func TestEditorNameConfig(t *testing.T) {
+	content := `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-editor-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Koral-Mapper", cfg.EditorName)
+
+	t.Setenv("KORAL_MAPPER_EDITOR_NAME", "Koral-Mapper-2")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Koral-Mapper-2", cfg.EditorName)
+}
+
+func TestDisabledMappingLists(t *testing.T) {
+	t.Run("disabled lists are excluded", func(t *testing.T) {
+		content := `
+lists:
+  - id: enabled-mapper
+    mappings:
+      - "[A] <> [B]"
+  - id: explicit-mapper
+    enabled: true
+    mappings:
+      - "[A] <> [B]"
+  - id: disabled-mapper
+    enabled: false
+    mappings:
+      - "[A] <> [B]"
+`
+		tmpfile, err := os.CreateTemp("", "config-disabled-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+
+		cfg, err := LoadFromSources(tmpfile.Name(), nil)
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 2)
+		assert.Equal(t, "enabled-mapper", cfg.Lists[0].ID)
+		assert.Equal(t, "explicit-mapper", cfg.Lists[1].ID)
+	})
+
+	t.Run("disabled lists are not validated", func(t *testing.T) {
+		content := `
+lists:
+  - id: enabled-mapper
+    mappings:
+      - "[A] <> [B]"
+  - id: broken-mapper
+    enabled: false
+    mappings: []
+`
+		tmpfile, err := os.CreateTemp("", "config-disabled-broken-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+
+		cfg, err := LoadFromSources(tmpfile.Name(), nil)
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 1)
+	})
+
+	t.Run("all lists disabled", func(t *testing.T) {
+		content := `
+lists:
+  - id: disabled-mapper
+    enabled: false
+    mappings:
+      - "[A] <> [B]"
+`
+		tmpfile, err := os.CreateTemp("", "config-all-disabled-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+
+		_, err = LoadFromSources(tmpfile.Name(), nil)
+		assert.EqualError(t, err, "no enabled mapping lists found: all mapping lists are disabled")
+	})
+}
+
+func TestPipelineValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		pipelines string
+		wantErr   string
+	}{
+		{
+			name: "valid pipeline",
+			pipelines: `
+pipelines:
+  - name: full
+    steps: ["first:atob", "second:btoa"]
+`,
+		},
+		{
+			name: "unknown mapping list",
+			pipelines: `
+pipelines:
+  - name: full
+    steps: ["first:atob", "missing:atob"]
+`,
+			wantErr: "pipeline 'full' step 1 references unknown mapping list 'missing'",
+		},
+		{
+			name: "invalid direction",
+			pipelines: `
+pipelines:
+  - name: full
+    steps: ["first:sideways"]
+`,
+			wantErr: `pipeline 'full' step 0 has invalid direction "sideways"`,
+		},
+		{
+			name: "duplicate name",
+			pipelines: `
+pipelines:
+  - name: full
+    steps: ["first:atob"]
+  - name: full
+    steps: ["second:atob"]
+`,
+			wantErr: "duplicate pipeline name found: full",
+		},
+		{
+			name: "no steps",
+			pipelines: `
+pipelines:
+  - name: empty
+`,
+			wantErr: "pipeline 'empty' has no steps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := tt.pipelines + `
+lists:
+  - id: first
+    mappings:
+      - "[A] <> [B]"
+  - id: second
+    mappings:
+      - "[B] <> [C]"
+`
+			tmpfile, err := os.CreateTemp("", "config-pipelines-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpfile.Name())
+
+			_, err = tmpfile.WriteString(content)
+			require.NoError(t, err)
+			require.NoError(t, tmpfile.Close())
+
+			cfg, err := LoadFromSources(tmpfile.Name(), nil)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			pipeline := cfg.FindPipeline("full")
+			require.NotNil(t, pipeline)
+			assert.Equal(t, "first:atob;second:btoa", pipeline.CfgString())
+			assert.Nil(t, cfg.FindPipeline("missing"))
+		})
+	}
+}
+
+func TestPipelinePassthroughStep(t *testing.T) {
+	load := func(content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-pipelines-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+
+		_, err = tmpfile.WriteString(content + `
+lists:
+  - id: first
+    mappings:
+      - "[A] <> [B]"
+`)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(`
+pipelines:
+  - name: ab
+    steps: ["first:atob", "passthrough:atob"]
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "first:atob;passthrough:atob", cfg.FindPipeline("ab").CfgString())
+
+	cfg, err = load(`
+passthroughID: noop
+pipelines:
+  - name: ab
+    steps: ["noop:btoa"]
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "noop:btoa", cfg.FindPipeline("ab").CfgString())
+
+	_, err = load(`
+passthroughID: noop
+pipelines:
+  - name: ab
+    steps: ["passthrough:atob"]
+`)
+	assert.EqualError(t, err, "pipeline 'ab' step 0 references unknown mapping list 'passthrough'")
+}
+
+func TestParseCorpusMappingsWithFieldAFieldB(t *testing.T) {
+	list := &MappingList{
+		ID:     "test-keyed",
+		Type:   "corpus",
+		FieldA: "wikiCat",
+		FieldB: "textClass",
+		Mappings: []MappingRule{
+			"Entertainment <> ((kultur & musik) | (kultur & film))",
+		},
+	}
+
+	results, err := list.ParseCorpusMappings()
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	upper := results[0].Upper.(*parser.CorpusField)
+	assert.Equal(t, "wikiCat", upper.Key)
+	assert.Equal(t, "Entertainment", upper.Value)
+
+	group := results[0].Lower.(*parser.CorpusGroup)
+	assert.Equal(t, "or", group.Operation)
+	require.Len(t, group.Operands, 2)
+
+	and1 := group.Operands[0].(*parser.CorpusGroup)
+	assert.Equal(t, "textClass", and1.Operands[0].(*parser.CorpusField).Key)
+	assert.Equal(t, "kultur", and1.Operands[0].(*parser.CorpusField).Value)
+	assert.Equal(t, "textClass", and1.Operands[1].(*parser.CorpusField).Key)
+	assert.Equal(t, "musik", and1.Operands[1].(*parser.CorpusField).Value)
+}
+
+func TestRateLimitConfigField(t *testing.T) {
+	content := `
+rateLimit: 50
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-ratelimit-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.RateLimit, "rateLimit should be loaded from YAML")
+}
+
+func TestRateLimitDefaultApplied(t *testing.T) {
+	cfg := &MappingConfig{}
+	ApplyDefaults(cfg)
+	assert.Equal(t, defaultRateLimit, cfg.RateLimit,
+		"default rate limit should be applied when not specified")
+}
+
+func TestRateLimitEnvOverride(t *testing.T) {
+	t.Setenv("KORAL_MAPPER_RATE_LIMIT", "200")
+
+	content := `
+rateLimit: 50
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-ratelimit-env-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, cfg.RateLimit,
+		"KORAL_MAPPER_RATE_LIMIT env var should override YAML value")
+}
+
+func TestAllowOriginsDefault(t *testing.T) {
+	cfg := &MappingConfig{}
+	ApplyDefaults(cfg)
+	// AllowOrigins should derive from the Server default (trailing slash stripped)
+	assert.Equal(t, []string{"https://korap.ids-mannheim.de"}, cfg.AllowOrigins,
+		"default AllowOrigins should derive from defaultServer")
+}
+
+func TestAllowOriginsDerivedFromCustomServer(t *testing.T) {
+	cfg := &MappingConfig{
+		Server: "https://custom.example.com/",
+	}
+	ApplyDefaults(cfg)
+	assert.Equal(t, []string{"https://custom.example.com"}, cfg.AllowOrigins,
+		"AllowOrigins should derive from the configured Server (trailing slash stripped)")
+}
+
+func TestAllowOriginsExplicitNotOverriddenByServer(t *testing.T) {
+	cfg := &MappingConfig{
+		Server:       "https://custom.example.com/",
+		AllowOrigins: []string{"https://explicit-origin.example.com"},
+	}
+	ApplyDefaults(cfg)
+	assert.Equal(t, []string{"https://explicit-origin.example.com"}, cfg.AllowOrigins,
+		"explicit AllowOrigins should not be overridden by Server default")
+}
+
+func TestAllowOriginsFromYAML(t *testing.T) {
+	content := `
+allowOrigins:
+  - "https://custom.example.com"
+  - "https://other.example.com"
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-cors-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://custom.example.com", "https://other.example.com"},
+		cfg.AllowOrigins)
+}
+
+func TestAllowOriginsStringFormatRejected(t *testing.T) {
+	content := `
+allowOrigins: "https://custom.example.com,https://other.example.com"
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-cors-reject-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	_, err = LoadFromSources(tmpfile.Name(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "allowOrigins must be a YAML list")
+}
+
+func TestAllowOriginsEnvOverride(t *testing.T) {
+	t.Setenv("KORAL_MAPPER_ALLOW_ORIGINS", "https://env-origin.example.com")
+
+	content := `
+allowOrigins:
+  - "https://yaml-origin.example.com"
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-cors-env-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://env-origin.example.com"}, cfg.AllowOrigins,
+		"KORAL_MAPPER_ALLOW_ORIGINS env var should override YAML value")
+}
+
+func TestAllowOriginsDerivedFromServerWithPath(t *testing.T) {
+	cfg := &MappingConfig{
+		Server: "https://korap.ids-mannheim.de/instance/test",
+	}
+	ApplyDefaults(cfg)
+	assert.Equal(t, []string{"https://korap.ids-mannheim.de"}, cfg.AllowOrigins,
+		"AllowOrigins should be pruned to host-level origin when Server contains a path")
+}
+
+func TestAllowOriginsExplicitWithPathsPruned(t *testing.T) {
+	cfg := &MappingConfig{
+		AllowOrigins: []string{"https://korap.ids-mannheim.de/instance/test", "https://other.example.com/app"},
+	}
+	ApplyDefaults(cfg)
+	assert.Equal(t, []string{"https://korap.ids-mannheim.de", "https://other.example.com"}, cfg.AllowOrigins,
+		"explicit AllowOrigins entries should be pruned to host-level origins")
+}
+
+func TestAllowOriginsWithPort(t *testing.T) {
+	cfg := &MappingConfig{
+		Server: "https://korap.ids-mannheim.de:8080/instance/test",
+	}
+	ApplyDefaults(cfg)
+	assert.Equal(t, []string{"https://korap.ids-mannheim.de:8080"}, cfg.AllowOrigins,
+		"AllowOrigins should preserve port but strip path")
+}
+
+func TestSanitizeFilePathRejectsOutsideBase(t *testing.T) {
+	// Set base to a specific directory and verify paths outside are rejected
+	tmpDir, err := os.MkdirTemp("", "koral-base-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+	AllowedBasePath = tmpDir
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:    "Path within base is accepted",
+			input:   filepath.Join(tmpDir, "config.yaml"),
+			wantErr: false,
+		},
+		{
+			name:    "Path outside base is rejected",
+			input:   "/etc/passwd",
+			wantErr: true,
+		},
+		{
+			name:    "Traversal escaping base and tmp is rejected",
+			input:   "/etc/passwd",
+			wantErr: true,
+		},
+		{
+			name:    "Empty path is rejected",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "Subdirectory within base is accepted",
+			input:   filepath.Join(tmpDir, "sub", "dir", "file.yaml"),
+			wantErr: false,
+		},
+		{
+			name:    "Relative path within base is rejected when CWD differs",
+			input:   "config.yaml",
+			wantErr: true, // resolves against CWD, not base
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := sanitizeFilePath(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, filepath.IsAbs(result),
+				"sanitized path should be absolute, got: %s", result)
+			assert.NotContains(t, result, "..")
+		})
+	}
+}
+
+func TestSanitizeFilePathTraversalToPasswd(t *testing.T) {
+	// Verify /etc/passwd cannot be accessed via traversal
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+	AllowedBasePath = cwd
+
+	_, err = sanitizeFilePath("../../../etc/passwd")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "path traversal detected")
+}
+
+func TestSanitizeFilePathWithDockerRoot(t *testing.T) {
+	// In Docker the WORKDIR is "/" -- all absolute paths should be valid
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+	AllowedBasePath = "/"
+
+	result, err := sanitizeFilePath("/mappings/stts-upos.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "/mappings/stts-upos.yaml", result)
+
+	// Even deeply nested paths work when base is /
+	result, err = sanitizeFilePath("/etc/ssl/certs/ca-certificates.crt")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/ssl/certs/ca-certificates.crt", result)
+}
+
+func TestSanitizeFilePathPrefixFalsePositive(t *testing.T) {
+	// Ensure /home/user does not match /home/username
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+	AllowedBasePath = "/home/user"
 
 	_, err := sanitizeFilePath("/home/username/secret.yaml")
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "path traversal detected")
+	assert.Contains(t, err.Error(), "path traversal detected")
+}
+
+func TestLoadFromSourcesRejectsTraversal(t *testing.T) {
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	AllowedBasePath = cwd
+
+	// Config file traversal should be rejected
+	_, err = LoadFromSources("../../../etc/passwd", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "path traversal detected")
+
+	// Mapping file traversal should be rejected
+	_, err = LoadFromSources("", []string{"../../../etc/passwd"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "path traversal detected")
+}
+
+func TestValidPathsStillWork(t *testing.T) {
+	content := `
+id: test-mapper
+mappings:
+  - "[A] <> [B]"
+`
+	tmpDir, err := os.MkdirTemp("", "koral-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+	AllowedBasePath = tmpDir
+
+	subDir := filepath.Join(tmpDir, "subdir")
+	require.NoError(t, os.Mkdir(subDir, 0755))
+
+	tmpfile, err := os.CreateTemp(subDir, "mapping-*.yaml")
+	require.NoError(t, err)
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources("", []string{tmpfile.Name()})
+	require.NoError(t, err)
+	require.Len(t, cfg.Lists, 1)
+	assert.Equal(t, "test-mapper", cfg.Lists[0].ID)
+}
+
+func TestRelativePathWithTraversalWithinBase(t *testing.T) {
+	// Paths with ".." that still resolve within the base should work
+	content := `
+id: traversal-test-mapper
+mappings:
+  - "[A] <> [B]"
+`
+	tmpDir, err := os.MkdirTemp("", "koral-traversal-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	origBase := AllowedBasePath
+	defer func() { AllowedBasePath = origBase }()
+	AllowedBasePath = tmpDir
+
+	// Create file at tmpDir/config.yaml
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	// Reference via a traversal path: tmpDir/subdir/../config.yaml
+	// This resolves to tmpDir/config.yaml which is within the base
+	subDir := filepath.Join(tmpDir, "subdir")
+	require.NoError(t, os.Mkdir(subDir, 0755))
+	traversalPath := filepath.Join(subDir, "..", "config.yaml")
+
+	cfg, err := LoadFromSources("", []string{traversalPath})
+	require.NoError(t, err)
+	require.Len(t, cfg.Lists, 1)
+	assert.Equal(t, "traversal-test-mapper", cfg.Lists[0].ID)
+}
+
+func TestInputLimitsConfig(t *testing.T) {
+	content := `
+maxBodyBytes: 2048
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-limits-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2048, cfg.MaxBodyBytes)
+	assert.Equal(t, 1024, cfg.MaxParamBytes)
+
+	t.Setenv("KORAL_MAPPER_MAX_BODY_BYTES", "4096")
+	t.Setenv("KORAL_MAPPER_MAX_PARAM_BYTES", "64")
+	cfg, err = LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, cfg.MaxBodyBytes)
+	assert.Equal(t, 64, cfg.MaxParamBytes)
+}
+
+func TestLanguageVariantsConfig(t *testing.T) {
+	content := `
+lists:
+  - id: de-pos
+    name: pos
+    language: de
+    mappings:
+      - "[A] <> [B]"
+  - id: de-pos-2
+    name: pos
+    language: DE
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-language-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	_, err = LoadFromSources(tmpfile.Name(), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "share name 'pos'")
+}
+
+func TestDefaultDirectionConfig(t *testing.T) {
+	writeConfig := func(t *testing.T, direction string) string {
+		t.Helper()
+		tmpfile, err := os.CreateTemp("", "config-direction-*.yaml")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = os.Remove(tmpfile.Name()) })
+		_, err = tmpfile.WriteString(`
+lists:
+  - id: corpus-map
+    type: corpus
+    defaultDirection: ` + direction + `
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return tmpfile.Name()
+	}
+
+	cfg, err := LoadFromSources(writeConfig(t, "btoa"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "btoa", cfg.Lists[0].EffectiveDirection())
+
+	_, err = LoadFromSources(writeConfig(t, "up"), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid defaultDirection 'up'")
+
+	assert.Equal(t, "atob", (&MappingList{}).EffectiveDirection())
+}
+
+func TestConfigProfiles(t *testing.T) {
+	content := `
+server: "https://base.example.com/"
+sdk: "https://base.example.com/js/plugin.js"
+serviceURL: "https://base.example.com/plugin"
+port: 8080
+profiles:
+  dev:
+    server: "http://localhost:64543/"
+    sdk: "http://localhost:64543/js/plugin.js"
+    serviceURL: "http://localhost:5725"
+    port: 5725
+  stage:
+    server: "https://stage.example.com/"
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`
+	tmpfile, err := os.CreateTemp("", "config-profiles-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	_, err = tmpfile.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	cfg, err := LoadFromSources(tmpfile.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://base.example.com/", cfg.Server)
+	assert.Equal(t, 8080, cfg.Port)
+
+	cfg, err = LoadFromSourcesWithProfile(tmpfile.Name(), nil, "dev")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:64543/", cfg.Server)
+	assert.Equal(t, "http://localhost:64543/js/plugin.js", cfg.SDK)
+	assert.Equal(t, "http://localhost:5725", cfg.ServiceURL)
+	assert.Equal(t, 5725, cfg.Port)
+
+	// Settings not set in the profile are kept from the base config
+	cfg, err = LoadFromSourcesWithProfile(tmpfile.Name(), nil, "stage")
+	require.NoError(t, err)
+	assert.Equal(t, "https://stage.example.com/", cfg.Server)
+	assert.Equal(t, "https://base.example.com/js/plugin.js", cfg.SDK)
+	assert.Equal(t, "https://base.example.com/plugin", cfg.ServiceURL)
+	assert.Equal(t, 8080, cfg.Port)
+
+	_, err = LoadFromSourcesWithProfile(tmpfile.Name(), nil, "prod")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown profile 'prod'")
+}
+
+func TestStrictLoading(t *testing.T) {
+	writeTemp := func(t *testing.T, content string) string {
+		t.Helper()
+		tmpfile, err := os.CreateTemp("", "config-strict-*.yaml")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return tmpfile.Name()
+	}
+
+	tests := []struct {
+		name     string
+		config   string
+		mapping  string
+		strictOK bool
+		wantErr  string
+	}{
+		{
+			name: "Misspelled list field",
+			config: `
+lists:
+  - id: test-mapper
+    foundaryA: opennlp
+    mappings:
+      - "[A] <> [B]"
+`,
+			wantErr: "line 4: unknown field 'foundaryA'",
+		},
+		{
+			name: "Misspelled global field",
+			config: `
+rewrite: true
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`,
+			wantErr: "line 2: unknown field 'rewrite'",
+		},
+		{
+			name: "Misspelled field of a rule object",
+			config: `
+lists:
+  - id: test-mapper
+    mappings:
+      - rule: "[A] <> [B]"
+        tag: [x]
+`,
+			wantErr: "line 6: unknown field 'tag'",
+		},
+		{
+			name: "Misspelled pipeline field",
+			config: `
+pipelines:
+  - name: full
+    steps: ["test-mapper:atob"]
+    desc: all steps
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`,
+			wantErr: "line 5: unknown field 'desc'",
+		},
+		{
+			name: "Misspelled field in legacy list format",
+			config: `
+- id: test-mapper
+  layerb: p
+  mappings:
+    - "[A] <> [B]"
+`,
+			wantErr: "line 3: unknown field 'layerb'",
+		},
+		{
+			name: "Misspelled field in mapping file",
+			mapping: `
+id: test-mapper
+mappings:
+  - "[A] <> [B]"
+---
+id: other-mapper
+fieldC: genre
+mappings:
+  - "textClass=a <> genre=a"
+`,
+			wantErr: "document 2: line 7: unknown field 'fieldC'",
+		},
+		{
+			name: "Known fields only",
+			config: `
+rewrites: true
+profiles:
+  dev:
+    port: 5725
+pipelines:
+  - name: full
+    steps: ["test-mapper:atob"]
+lists:
+  - id: test-mapper
+    foundryA: opennlp
+    mappings:
+      - "[A] <> [B]"
+      - rule: "[C] <> [D]"
+        tags: [x]
+`,
+			strictOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configFile string
+			var mappingFiles []string
+			if tt.config != "" {
+				configFile = writeTemp(t, tt.config)
+			}
+			if tt.mapping != "" {
+				mappingFiles = []string{writeTemp(t, tt.mapping)}
+			}
+
+			// Lenient loading stays the default
+			_, err := LoadFromSources(configFile, mappingFiles)
+			require.NoError(t, err)
+
+			_, err = LoadFromSourcesWithOptions(configFile, mappingFiles, LoadOptions{Strict: true})
+			if tt.strictOK {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	// The bundled mapping files pass strict loading
+	_, err := LoadFromSourcesWithOptions("", []string{"../mappings/stts-upos.yaml", "../mappings/wiki-dereko.yaml"}, LoadOptions{Strict: true})
+	require.NoError(t, err)
+}
+
+func TestLoadFromURL(t *testing.T) {
+	files := map[string]string{
+		"/config.yaml": `
+port: 8080
+lists:
+  - id: main-mapper
+    mappings:
+      - "[A] <> [B]"
+`,
+		"/stts.yaml": `
+id: remote-mapper
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - "[ADJA] <> [ADJ]"
+`,
+		"/mappings.json": `{"id": "json-mapper", "mappings": ["[X] <> [Y]"]}`,
+		"/large.yaml":    "id: large-mapper\nmappings:\n" + strings.Repeat("  - \"[A] <> [B]\"\n", 100),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	t.Run("config and mapping files", func(t *testing.T) {
+		cfg, err := LoadFromSources(server.URL+"/config.yaml", []string{
+			server.URL + "/stts.yaml",
+			server.URL + "/mappings.json",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 8080, cfg.Port)
+		require.Len(t, cfg.Lists, 3)
+		assert.Equal(t, "main-mapper", cfg.Lists[0].ID)
+		assert.Equal(t, "remote-mapper", cfg.Lists[1].ID)
+		assert.Equal(t, "opennlp", cfg.Lists[1].FoundryA)
+		assert.Equal(t, "json-mapper", cfg.Lists[2].ID)
+	})
+
+	t.Run("URLs are not confined to the base path", func(t *testing.T) {
+		orig := AllowedBasePath
+		AllowedBasePath = t.TempDir()
+		defer func() { AllowedBasePath = orig }()
+
+		cfg, err := LoadFromSources("", []string{server.URL + "/stts.yaml"})
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 1)
+	})
+
+	t.Run("missing config file", func(t *testing.T) {
+		_, err := LoadFromSources(server.URL+"/missing.yaml", nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read config file")
+		assert.Contains(t, err.Error(), "404")
+	})
+
+	t.Run("missing mapping file is skipped", func(t *testing.T) {
+		cfg, err := LoadFromSources("", []string{
+			server.URL + "/missing.yaml",
+			server.URL + "/stts.yaml",
+		})
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 1)
+		assert.Equal(t, "remote-mapper", cfg.Lists[0].ID)
+	})
+
+	t.Run("size cap", func(t *testing.T) {
+		orig := maxRemoteFileBytes
+		maxRemoteFileBytes = 512
+		defer func() { maxRemoteFileBytes = orig }()
+
+		_, err := LoadFromSources(server.URL+"/large.yaml", nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds 512 bytes")
+	})
+}
+
+func TestLoadFromStdin(t *testing.T) {
+	mapping := `
+id: stdin-mapper
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
+mappings:
+  - "[ADJA] <> [ADJ]"
+`
+
+	t.Run("mapping file", func(t *testing.T) {
+		cfg, err := LoadFromSourcesWithOptions("", []string{StdinSource}, LoadOptions{
+			Stdin: strings.NewReader(mapping),
+		})
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 1)
+		assert.Equal(t, "stdin-mapper", cfg.Lists[0].ID)
+		assert.Equal(t, "opennlp", cfg.Lists[0].FoundryA)
+	})
+
+	t.Run("config file", func(t *testing.T) {
+		cfg, err := LoadFromSourcesWithOptions(StdinSource, nil, LoadOptions{
+			Stdin: strings.NewReader("port: 8080\nlists:\n  - id: main-mapper\n    mappings:\n      - \"[A] <> [B]\"\n"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 8080, cfg.Port)
+		require.Len(t, cfg.Lists, 1)
+		assert.Equal(t, "main-mapper", cfg.Lists[0].ID)
+	})
+
+	t.Run("stdin is not confined to the base path", func(t *testing.T) {
+		orig := AllowedBasePath
+		AllowedBasePath = t.TempDir()
+		defer func() { AllowedBasePath = orig }()
+
+		cfg, err := LoadFromSourcesWithOptions("", []string{StdinSource}, LoadOptions{
+			Stdin: strings.NewReader(mapping),
+		})
+		require.NoError(t, err)
+		require.Len(t, cfg.Lists, 1)
+	})
+
+	t.Run("empty config file", func(t *testing.T) {
+		_, err := LoadFromSourcesWithOptions(StdinSource, nil, LoadOptions{
+			Stdin: strings.NewReader(""),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "is empty")
+	})
+
+	t.Run("config and mapping file from stdin", func(t *testing.T) {
+		_, err := LoadFromSourcesWithOptions(StdinSource, []string{StdinSource}, LoadOptions{
+			Stdin: strings.NewReader(mapping),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can only be given as one source")
+	})
+
+	t.Run("mapping files from stdin twice", func(t *testing.T) {
+		_, err := LoadFromSourcesWithOptions("", []string{StdinSource, StdinSource}, LoadOptions{
+			Stdin: strings.NewReader(mapping),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "can only be given as one source")
+	})
+}
+
+func TestListRateLimitConfig(t *testing.T) {
+	load := func(t *testing.T, settings string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-rate-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(`
+lists:
+  - id: test-mapper
+` + settings + `
+    mappings:
+      - "[A] <> [B]"
+`)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(t, "    requestsPerSecond: 2.5\n    burst: 10")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, cfg.Lists[0].RequestsPerSecond)
+	assert.Equal(t, 10, cfg.Lists[0].Burst)
+
+	cfg, err = load(t, "")
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Lists[0].RequestsPerSecond)
+	assert.Zero(t, cfg.Lists[0].Burst)
+
+	_, err = load(t, "    requestsPerSecond: -1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requestsPerSecond must not be negative")
+
+	_, err = load(t, "    burst: -1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "burst must not be negative")
 }
 
-func TestLoadFromSourcesRejectsTraversal(t *testing.T) {
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
+func TestAliasesConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-aliases-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
 
-	cwd, err := os.Getwd()
+	cfg, err := load(t, `
+lists:
+  - id: stts-upos
+    aliases: [opennlp-upos, pos]
+    mappings:
+      - "[A] <> [B]"
+pipelines:
+  - name: legacy
+    steps: ["opennlp-upos:atob"]
+`)
 	require.NoError(t, err)
-	AllowedBasePath = cwd
+	assert.Equal(t, []string{"opennlp-upos", "pos"}, cfg.Lists[0].Aliases)
 
-	// Config file traversal should be rejected
-	_, err = LoadFromSources("../../../etc/passwd", nil)
+	_, err = load(t, `
+lists:
+  - id: a
+    aliases: [b]
+    mappings:
+      - "[A] <> [B]"
+  - id: b
+    mappings:
+      - "[A] <> [B]"
+`)
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "path traversal detected")
+	assert.Contains(t, err.Error(), "alias 'b' of mapping list 'a' collides with a mapping list ID")
 
-	// Mapping file traversal should be rejected
-	_, err = LoadFromSources("", []string{"../../../etc/passwd"})
+	_, err = load(t, `
+lists:
+  - id: a
+    aliases: [old]
+    mappings:
+      - "[A] <> [B]"
+  - id: b
+    aliases: [old]
+    mappings:
+      - "[A] <> [B]"
+`)
 	require.Error(t, err)
-	assert.Contains(t, err.Error(), "path traversal detected")
+	assert.Contains(t, err.Error(), "alias 'old' of mapping list 'b' is already an alias of mapping list 'a'")
+
+	_, err = load(t, `
+lists:
+  - id: a
+    aliases: [""]
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapping list 'a' has an empty alias")
 }
 
-func TestValidPathsStillWork(t *testing.T) {
-	content := `
-id: test-mapper
+func TestIsRemoteSource(t *testing.T) {
+	assert.True(t, IsRemoteSource("https://example.org/mappings.yaml"))
+	assert.True(t, IsRemoteSource("HTTP://example.org/mappings.yaml"))
+	assert.False(t, IsRemoteSource("mappings/stts-upos.yaml"))
+	assert.False(t, IsRemoteSource("/etc/https://x.yaml"))
+	assert.False(t, IsRemoteSource("ftp://example.org/mappings.yaml"))
+}
+
+func TestLoadGzippedFiles(t *testing.T) {
+	mapping := `
+id: gzip-mapper
+foundryA: opennlp
+layerA: p
+foundryB: upos
+layerB: p
 mappings:
-  - "[A] <> [B]"
+  - "[ADJA] <> [ADJ]"
+  - "[PIDAT] <> [DET & PRON]"
 `
-	tmpDir, err := os.MkdirTemp("", "koral-test-*")
+	gzipped := func(content string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	dir := t.TempDir()
+	plainFile := filepath.Join(dir, "mapping.yaml")
+	gzipFile := filepath.Join(dir, "mapping.yaml.gz")
+	require.NoError(t, os.WriteFile(plainFile, []byte(mapping), 0644))
+	require.NoError(t, os.WriteFile(gzipFile, gzipped(mapping), 0644))
+
+	plain, err := LoadFromSources("", []string{plainFile})
 	require.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
+	compressed, err := LoadFromSources("", []string{gzipFile})
+	require.NoError(t, err)
+	require.Len(t, compressed.Lists, 1)
+	assert.Equal(t, plain.Lists, compressed.Lists)
 
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
-	AllowedBasePath = tmpDir
+	t.Run("config file", func(t *testing.T) {
+		configFile := filepath.Join(dir, "config.yml.GZ")
+		require.NoError(t, os.WriteFile(configFile, gzipped("port: 8080\nlists:\n  - id: main-mapper\n    mappings:\n      - \"[A] <> [B]\"\n"), 0644))
+		cfg, err := LoadFromSources(configFile, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 8080, cfg.Port)
+		require.Len(t, cfg.Lists, 1)
+		assert.Equal(t, "main-mapper", cfg.Lists[0].ID)
+	})
 
-	subDir := filepath.Join(tmpDir, "subdir")
-	require.NoError(t, os.Mkdir(subDir, 0755))
+	t.Run("invalid gzip data", func(t *testing.T) {
+		configFile := filepath.Join(dir, "broken.yaml.gz")
+		require.NoError(t, os.WriteFile(configFile, []byte(mapping), 0644))
+		_, err := LoadFromSources(configFile, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to decompress")
+	})
 
-	tmpfile, err := os.CreateTemp(subDir, "mapping-*.yaml")
+	t.Run("remote file", func(t *testing.T) {
+		// The padding compresses well below the size limit set below
+		padded := gzipped(mapping + strings.Repeat("# padding\n", 100))
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(padded)
+		}))
+		defer server.Close()
+
+		cfg, err := LoadFromSources("", []string{server.URL + "/mapping.yaml.gz"})
+		require.NoError(t, err)
+		assert.Equal(t, plain.Lists, cfg.Lists)
+
+		orig := maxRemoteFileBytes
+		maxRemoteFileBytes = 512
+		defer func() { maxRemoteFileBytes = orig }()
+		_, err = LoadFromSources(server.URL+"/config.yaml.gz", nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "decompressed file exceeds 512 bytes")
+	})
+}
+
+func TestServerTimeoutsConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-timeouts-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(t, `
+readTimeout: 10
+writeTimeout: 20
+idleTimeout: 60
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
 	require.NoError(t, err)
+	assert.Equal(t, 10, cfg.ReadTimeout)
+	assert.Equal(t, 20, cfg.WriteTimeout)
+	assert.Equal(t, 60, cfg.IdleTimeout)
 
-	_, err = tmpfile.WriteString(content)
+	t.Setenv("KORAL_MAPPER_IDLE_TIMEOUT", "5")
+	cfg, err = load(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
 	require.NoError(t, err)
-	require.NoError(t, tmpfile.Close())
+	assert.Equal(t, 0, cfg.ReadTimeout)
+	assert.Equal(t, 5, cfg.IdleTimeout,
+		"KORAL_MAPPER_IDLE_TIMEOUT env var should override the config")
 
-	cfg, err := LoadFromSources("", []string{tmpfile.Name()})
+	_, err = load(t, `
+writeTimeout: -1
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	assert.EqualError(t, err, "writeTimeout must not be negative, got -1")
+}
+
+func TestAllowedFoundriesConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-allowed-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(t, `
+lists:
+  - id: allowed
+    allowedFoundries: [opennlp, upos]
+    allowedLayers: [p]
+    mappings:
+      - "[opennlp/p=A] <> [upos/p=B]"
+`)
 	require.NoError(t, err)
-	require.Len(t, cfg.Lists, 1)
-	assert.Equal(t, "test-mapper", cfg.Lists[0].ID)
+	assert.Equal(t, []string{"opennlp", "upos"}, cfg.Lists[0].AllowedFoundries)
+	assert.Equal(t, []string{"p"}, cfg.Lists[0].AllowedLayers)
+
+	_, err = load(t, `
+lists:
+  - id: corpus
+    type: corpus
+    allowedFoundries: [opennlp]
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapping list 'corpus' is a corpus list, allowedFoundries and allowedLayers only apply to annotation lists")
 }
 
-func TestRelativePathWithTraversalWithinBase(t *testing.T) {
-	// Paths with ".." that still resolve within the base should work
-	content := `
-id: traversal-test-mapper
+func TestRenamesConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-renames-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(t, `
+lists:
+  - id: rename
+    foundryRenames:
+      opennlp: opennlp2
+    layerRenames:
+      m: morph
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"opennlp": "opennlp2"}, cfg.Lists[0].FoundryRenames)
+	assert.Equal(t, map[string]string{"m": "morph"}, cfg.Lists[0].LayerRenames)
+
+	_, err = load(t, `
+lists:
+  - id: rename
+    foundryRenames:
+      opennlp: ""
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapping list 'rename' has an empty name in foundryRenames")
+
+	_, err = load(t, `
+lists:
+  - id: corpus
+    type: corpus
+    layerRenames:
+      m: morph
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "layerRenames only apply to annotation lists")
+}
+
+func TestYAMLAnchorsAndMergeKeys(t *testing.T) {
+	writeFile := func(t *testing.T, pattern, content string) string {
+		tmpfile, err := os.CreateTemp("", pattern)
+		require.NoError(t, err)
+		t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return tmpfile.Name()
+	}
+
+	configFile := writeFile(t, "config-anchors-*.yaml", `
+lists:
+  - id: first
+    <<: &opennlp
+      foundryA: opennlp
+      layerA: p
+    foundryB: upos
+    mappings: &rules
+      - "[PIDAT] <> [DET]"
+      - rule: "[PPER] <> [PRON]"
+        tags: [pron]
+  - id: second
+    <<: *opennlp
+    layerA: pos
+    mappings: *rules
+`)
+	mappingFile := writeFile(t, "mapping-anchors-*.yaml", `
+id: third
+<<: &tt
+  foundryA: tt
+  layerA: p
 mappings:
-  - "[A] <> [B]"
+  - "[NN] <> [NOUN]"
+---
+id: fourth
+<<: {foundryA: marmot, layerA: p}
+mappings:
+  - "[NN] <> [NOUN]"
+`)
+
+	for _, strict := range []bool{false, true} {
+		cfg, err := LoadFromSourcesWithOptions(configFile, []string{mappingFile}, LoadOptions{Strict: strict})
+		require.NoError(t, err, "strict: %v", strict)
+		require.Len(t, cfg.Lists, 4)
+
+		first, second, third, fourth := cfg.Lists[0], cfg.Lists[1], cfg.Lists[2], cfg.Lists[3]
+		assert.Equal(t, "opennlp", first.FoundryA)
+		assert.Equal(t, "p", first.LayerA)
+		assert.Equal(t, "upos", first.FoundryB)
+		assert.Equal(t, []string{"pron"}, first.RuleMetaAt(1).Tags)
+
+		// Keys of the list take precedence over merged ones
+		assert.Equal(t, "opennlp", second.FoundryA)
+		assert.Equal(t, "pos", second.LayerA)
+		assert.Equal(t, first.Mappings, second.Mappings)
+		assert.Equal(t, []string{"pron"}, second.RuleMetaAt(1).Tags)
+
+		assert.Equal(t, "tt", third.FoundryA)
+		assert.Equal(t, "marmot", fourth.FoundryA)
+	}
+
+	// Anchors are local to a YAML document and do not cross documents
+	// or files
+	crossFile := writeFile(t, "mapping-anchors-*.yaml", `
+id: fifth
+<<: *opennlp
+mappings:
+  - "[NN] <> [NOUN]"
+`)
+	_, err := LoadFromSourcesWithOptions(configFile, []string{crossFile}, LoadOptions{Strict: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown anchor 'opennlp'")
+}
+
+func TestRuleExamplesConfig(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "config-examples-*.yaml")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	_, err = tmpfile.WriteString(`
+lists:
+  - id: examples
+    mappings:
+      - rule: "[A] <> [B]"
+        example: {"@type": "koral:token"}
+        expected: {"@type": "koral:token"}
+      - rule: "[C] <> [D]"
+        expected: {"@type": "koral:token"}
+`)
+	require.NoError(t, err)
+	require.NoError(t, tmpfile.Close())
+
+	_, err = LoadFromSourcesWithOptions(tmpfile.Name(), nil, LoadOptions{Strict: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mapping list 'examples' rule 1 has an expected result but no example")
+}
+
+func TestFieldPathsConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-fieldpaths-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(t, `
+fieldPaths: [fields, result.metadata.fields]
+lists:
+  - id: corpus
+    type: corpus
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fields", "result.metadata.fields"}, cfg.FieldPaths)
+
+	_, err = load(t, `
+fieldPaths: [document..fields]
+lists:
+  - id: corpus
+    type: corpus
+    mappings:
+      - "textClass=novel <> genre=fiction"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid fieldPaths entry 'document..fields'")
+}
+
+func TestSnippetAttrConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-snippetattr-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+
+	cfg, err := load(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.SnippetAttr)
+
+	cfg, err = load(t, `
+snippetAttr: class
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "class", cfg.SnippetAttr)
+
+	t.Setenv("KORAL_MAPPER_SNIPPET_ATTR", "data-annotation")
+	cfg, err = load(t, `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "data-annotation", cfg.SnippetAttr)
+
+	t.Setenv("KORAL_MAPPER_SNIPPET_ATTR", "")
+	_, err = load(t, `
+snippetAttr: 'title" onclick'
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
+`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid snippetAttr")
+}
+
+func TestRoutePrefixConfig(t *testing.T) {
+	load := func(t *testing.T, content string) (*MappingConfig, error) {
+		tmpfile, err := os.CreateTemp("", "config-routeprefix-*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpfile.Name())
+		_, err = tmpfile.WriteString(content)
+		require.NoError(t, err)
+		require.NoError(t, tmpfile.Close())
+		return LoadFromSources(tmpfile.Name(), nil)
+	}
+	const lists = `
+lists:
+  - id: test-mapper
+    mappings:
+      - "[A] <> [B]"
 `
-	tmpDir, err := os.MkdirTemp("", "koral-traversal-*")
+
+	cfg, err := load(t, lists)
 	require.NoError(t, err)
-	defer os.RemoveAll(tmpDir)
+	assert.Empty(t, cfg.RoutePrefix)
+	assert.Equal(t, defaultServiceURL, cfg.ServiceURL)
 
-	origBase := AllowedBasePath
-	defer func() { AllowedBasePath = origBase }()
-	AllowedBasePath = tmpDir
+	// The default service URL already ends with the prefix
+	for _, prefix := range []string{"/plugin/koralmapper", "plugin/koralmapper/", "/koralmapper"} {
+		cfg, err = load(t, "routePrefix: "+prefix+lists)
+		require.NoError(t, err)
+		assert.Equal(t, "/"+strings.Trim(prefix, "/"), cfg.RoutePrefix)
+		assert.Equal(t, defaultServiceURL, cfg.ServiceURL)
+	}
 
-	// Create file at tmpDir/config.yaml
-	configPath := filepath.Join(tmpDir, "config.yaml")
-	require.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+	cfg, err = load(t, "routePrefix: /\n"+lists)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.RoutePrefix)
 
-	// Reference via a traversal path: tmpDir/subdir/../config.yaml
-	// This resolves to tmpDir/config.yaml which is within the base
-	subDir := filepath.Join(tmpDir, "subdir")
-	require.NoError(t, os.Mkdir(subDir, 0755))
-	traversalPath := filepath.Join(subDir, "..", "config.yaml")
+	// Other service URLs get the prefix appended
+	cfg, err = load(t, "routePrefix: /mapper\nserviceURL: https://example.org/\n"+lists)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org/mapper", cfg.ServiceURL)
 
-	cfg, err := LoadFromSources("", []string{traversalPath})
+	cfg, err = load(t, "routePrefix: /mapper\nserviceURL: https://example.org/koralmapper\n"+lists)
 	require.NoError(t, err)
-	require.Len(t, cfg.Lists, 1)
-	assert.Equal(t, "traversal-test-mapper", cfg.Lists[0].ID)
+	assert.Equal(t, "https://example.org/koralmapper/mapper", cfg.ServiceURL)
+
+	t.Setenv("KORAL_MAPPER_ROUTE_PREFIX", "/env/prefix")
+	cfg, err = load(t, "routePrefix: /mapper\n"+lists)
+	require.NoError(t, err)
+	assert.Equal(t, "/env/prefix", cfg.RoutePrefix)
+	t.Setenv("KORAL_MAPPER_ROUTE_PREFIX", "")
+
+	for _, prefix := range []string{"/:map", "/plugin/*", "/a b", "/a?b=c", "/a//b"} {
+		_, err = load(t, "routePrefix: '"+prefix+"'"+lists)
+		require.Error(t, err, prefix)
+		assert.Contains(t, err.Error(), "invalid routePrefix", prefix)
+	}
 }
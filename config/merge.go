@@ -0,0 +1,64 @@
+package config
+
+import "gopkg.in/yaml.v3"
+
+// resolveAlias returns the node an alias node refers to, or node itself.
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// resolveMergeKeys returns a copy of a mapping node with its merge keys
+// ("<<") replaced by the keys of the merged mappings, as yaml.v3 does
+// when decoding. Keys of the mapping take precedence over merged keys,
+// and earlier merged mappings over later ones. The custom UnmarshalYAML
+// methods and the strict key check inspect the node tree before
+// decoding and would otherwise miss merged keys.
+func resolveMergeKeys(node *yaml.Node) *yaml.Node {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return node
+	}
+
+	var merged []*yaml.Node
+	var content []*yaml.Node
+	seen := make(map[string]bool)
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge" {
+			value = resolveAlias(value)
+			if value.Kind == yaml.SequenceNode {
+				merged = append(merged, value.Content...)
+			} else {
+				merged = append(merged, value)
+			}
+			continue
+		}
+		seen[key.Value] = true
+		content = append(content, key, value)
+	}
+	if merged == nil {
+		return node
+	}
+
+	for _, source := range merged {
+		source = resolveMergeKeys(source)
+		if source.Kind != yaml.MappingNode {
+			return node // left to the decoder to report
+		}
+		for i := 0; i < len(source.Content)-1; i += 2 {
+			key := source.Content[i]
+			if seen[key.Value] {
+				continue
+			}
+			seen[key.Value] = true
+			content = append(content, key, source.Content[i+1])
+		}
+	}
+
+	copied := *node
+	copied.Content = content
+	return &copied
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// remoteFetchTimeout bounds fetching a configuration or mapping file
+// from an HTTP(S) URL, including reading the body.
+const remoteFetchTimeout = 30 * time.Second
+
+// maxRemoteFileBytes caps the size of a file fetched from an HTTP(S) URL.
+var maxRemoteFileBytes int64 = 10 << 20
+
+var remoteClient = &http.Client{Timeout: remoteFetchTimeout}
+
+// StdinSource is the source name for reading a configuration or mapping
+// file from standard input.
+const StdinSource = "-"
+
+// IsRemoteSource reports whether a configuration or mapping file source
+// is an HTTP(S) URL rather than a local path.
+func IsRemoteSource(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// sanitizeSource returns HTTP(S) URLs and StdinSource unchanged and
+// sanitizes local file paths with sanitizeFilePath. URLs are not
+// confined to AllowedBasePath.
+func sanitizeSource(source string) (string, error) {
+	if IsRemoteSource(source) || source == StdinSource {
+		return source, nil
+	}
+	return sanitizeFilePath(source)
+}
+
+// readSource reads a sanitized source, fetching HTTP(S) URLs with an
+// anonymous GET request and reading StdinSource from stdin. Sources with
+// a ".gz" suffix are decompressed.
+func readSource(source string, stdin io.Reader) ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case source == StdinSource:
+		return io.ReadAll(stdin)
+	case IsRemoteSource(source):
+		data, err = fetchRemoteFile(source)
+	default:
+		data, err = os.ReadFile(source) // #nosec G304 -- path sanitized by sanitizeSource
+	}
+	if err != nil || !isGzipSource(source) {
+		return data, err
+	}
+
+	limit := int64(-1)
+	if IsRemoteSource(source) {
+		limit = maxRemoteFileBytes
+	}
+	return gunzip(data, limit)
+}
+
+// isGzipSource reports whether a configuration or mapping file source
+// is gzip-compressed, judged by a ".gz" suffix.
+func isGzipSource(source string) bool {
+	return strings.HasSuffix(strings.ToLower(source), ".gz")
+}
+
+// gunzip decompresses gzip data. A non-negative limit caps the size of
+// the decompressed data.
+func gunzip(data []byte, limit int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	defer zr.Close()
+
+	var r io.Reader = zr
+	if limit >= 0 {
+		r = io.LimitReader(zr, limit+1)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if limit >= 0 && int64(len(decompressed)) > limit {
+		return nil, fmt.Errorf("decompressed file exceeds %d bytes", limit)
+	}
+	return decompressed, nil
+}
+
+// checkStdinSources fails if StdinSource is given more than once, as
+// standard input can only be read once.
+func checkStdinSources(configFile string, mappingFiles []string) error {
+	count := 0
+	if configFile == StdinSource {
+		count++
+	}
+	for _, file := range mappingFiles {
+		if file == StdinSource {
+			count++
+		}
+	}
+	if count > 1 {
+		return fmt.Errorf("standard input ('%s') can only be given as one source, got %d", StdinSource, count)
+	}
+	return nil
+}
+
+// fetchRemoteFile fetches the body of url, failing on non-200 responses
+// and on bodies larger than maxRemoteFileBytes.
+func fetchRemoteFile(url string) ([]byte, error) {
+	resp, err := remoteClient.Get(url) // #nosec G107 -- URL given by the operator
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxRemoteFileBytes {
+		return nil, fmt.Errorf("file exceeds %d bytes", maxRemoteFileBytes)
+	}
+	return data, nil
+}
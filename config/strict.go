@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkConfigFileKeys reports unknown keys in a main configuration file,
+// either in the object format or as a plain sequence of mapping lists.
+func checkConfigFileKeys(data []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.SequenceNode {
+		return checkKnownFields(&doc, reflect.TypeFor[[]MappingList]())
+	}
+	return checkKnownFields(&doc, reflect.TypeFor[MappingConfig]())
+}
+
+// checkMappingFileKeys reports unknown keys in any of the mapping lists
+// of a mapping file.
+func checkMappingFileKeys(data []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 1; ; i++ {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+		if err := checkKnownFields(&doc, reflect.TypeFor[MappingList]()); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+}
+
+// checkKnownFields reports the first key of node that does not name a
+// field of the Go type t, descending into nested mappings and sequences.
+// The custom UnmarshalYAML methods decode via yaml.Node, which does not
+// honor the decoder's KnownFields setting, so strict loading checks the
+// node tree against the struct tags instead.
+func checkKnownFields(node *yaml.Node, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	node = resolveMergeKeys(node)
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := checkKnownFields(child, t); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice {
+			return nil
+		}
+		for _, item := range node.Content {
+			if err := checkKnownFields(item, t.Elem()); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		// Mapping rules may be written as objects
+		if t == reflect.TypeFor[MappingRule]() {
+			t = reflect.TypeFor[ruleObject]()
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			for i := 1; i < len(node.Content); i += 2 {
+				if err := checkKnownFields(node.Content[i], t.Elem()); err != nil {
+					return err
+				}
+			}
+		case reflect.Struct:
+			fields := yamlFields(t)
+			for i := 0; i < len(node.Content)-1; i += 2 {
+				key := node.Content[i]
+				field, ok := fields[key.Value]
+				if !ok {
+					return fmt.Errorf("line %d: unknown field '%s'", key.Line, key.Value)
+				}
+				if err := checkKnownFields(node.Content[i+1], field); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// yamlFields returns the types of the fields of struct type t by their
+// YAML key, including the fields of inlined structs.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("yaml")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if opts == "inline" {
+			for key, typ := range yamlFields(field.Type) {
+				fields[key] = typ
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
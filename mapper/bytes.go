@@ -0,0 +1,43 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ApplyQueryMappingsBytes is like ApplyQueryMappings, but takes and
+// returns JSON-encoded data. The result is serialized with encoding/json
+// like the responses of the service.
+func (m *Mapper) ApplyQueryMappingsBytes(mappingID string, opts MappingOptions, input []byte) ([]byte, error) {
+	return applyBytes(input, func(jsonData any) (any, error) {
+		return m.ApplyQueryMappings(mappingID, opts, jsonData)
+	})
+}
+
+// ApplyResponseMappingsBytes is like ApplyResponseMappings, but takes and
+// returns JSON-encoded data.
+func (m *Mapper) ApplyResponseMappingsBytes(mappingID string, opts MappingOptions, input []byte) ([]byte, error) {
+	return applyBytes(input, func(jsonData any) (any, error) {
+		return m.ApplyResponseMappings(mappingID, opts, jsonData)
+	})
+}
+
+// applyBytes decodes input, transforms it with apply and encodes the
+// result.
+func applyBytes(input []byte, apply func(any) (any, error)) ([]byte, error) {
+	var jsonData any
+	if err := json.Unmarshal(input, &jsonData); err != nil {
+		return nil, withKind(ErrInvalidInput, fmt.Errorf("failed to parse JSON: %w", err))
+	}
+
+	result, err := apply(jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize result: %w", err)
+	}
+	return output, nil
+}
@@ -1,7 +1,9 @@
 package mapper
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/KorAP/Koral-Mapper/config"
@@ -190,6 +192,95 @@ func TestCascadeQueryUnknownID(t *testing.T) {
 	assert.Contains(t, err.Error(), "nonexistent")
 }
 
+func TestCascadeQueryFailingMiddleStep(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID: "ann-step1", FoundryA: "opennlp", LayerA: "p",
+			FoundryB: "stts", LayerB: "p",
+			Mappings: []config.MappingRule{`[PIDAT] <> [DET]`},
+		},
+		{
+			ID: "ann-failing", FoundryA: "stts", LayerA: "p",
+			FoundryB: "ud", LayerB: "p",
+			Mappings: []config.MappingRule{`[DET] <> [X]`},
+		},
+		{
+			ID: "ann-step3", FoundryA: "stts", LayerA: "p",
+			FoundryB: "upos", LayerB: "p",
+			Mappings: []config.MappingRule{`[DET] <> [PRON]`},
+		},
+	})
+	require.NoError(t, err)
+
+	input := `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+	}`
+	ids := []string{"ann-step1", "ann-failing", "ann-step3"}
+	// Identical source and target foundries and layers fail validation
+	failing := MappingOptions{Direction: AtoB, FoundryB: "stts", LayerB: "p"}
+
+	t.Run("Abort", func(t *testing.T) {
+		result, err := m.CascadeQueryMappings(ids,
+			[]MappingOptions{{Direction: AtoB}, failing, {Direction: AtoB}},
+			parseJSON(t, input),
+		)
+		require.Error(t, err)
+		assert.Nil(t, result)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+
+		var stepErr *StepError
+		require.ErrorAs(t, err, &stepErr)
+		assert.Equal(t, 1, stepErr.Step)
+		assert.Equal(t, "ann-failing", stepErr.MappingID)
+		assert.Contains(t, err.Error(), `cascade step 1 (mapping "ann-failing")`)
+	})
+
+	t.Run("Continue", func(t *testing.T) {
+		failing := failing
+		failing.ContinueOnError = true
+		result, err := m.CascadeQueryMappings(ids,
+			[]MappingOptions{{Direction: AtoB}, failing, {Direction: AtoB}},
+			parseJSON(t, input),
+		)
+
+		var skipped *SkippedStepsError
+		require.ErrorAs(t, err, &skipped)
+		require.Len(t, skipped.Steps, 1)
+		assert.Equal(t, 1, skipped.Steps[0].Step)
+		assert.Equal(t, "ann-failing", skipped.Steps[0].MappingID)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+
+		// The third step is applied to the result of the first one
+		assert.Equal(t, parseJSON(t, `{
+			"@type": "koral:token",
+			"wrap": {"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}
+		}`), result)
+	})
+
+	t.Run("Continue without failures", func(t *testing.T) {
+		opts := []MappingOptions{{Direction: AtoB, ContinueOnError: true}, {Direction: AtoB, ContinueOnError: true}}
+		result, err := m.CascadeQueryMappings([]string{"ann-step1", "ann-step3"}, opts, parseJSON(t, input))
+		require.NoError(t, err)
+		assert.Equal(t, "PRON", result.(map[string]any)["wrap"].(map[string]any)["key"])
+	})
+
+	t.Run("Canceled context aborts", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		failing := failing
+		failing.ContinueOnError = true
+		_, err := m.CascadeQueryMappingsContext(ctx, ids,
+			[]MappingOptions{{Direction: AtoB, ContinueOnError: true}, failing, {Direction: AtoB, ContinueOnError: true}},
+			parseJSON(t, input),
+		)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.Canceled)
+		var skipped *SkippedStepsError
+		assert.False(t, errors.As(err, &skipped))
+	})
+}
+
 // --- Response cascade tests ---
 
 func TestCascadeQueryRewritesPreservedAcrossSteps(t *testing.T) {
@@ -337,6 +428,92 @@ func TestCascadeQueryRewritesPreservedStructuralChange(t *testing.T) {
 	assert.Equal(t, "DET", original1["key"])
 }
 
+func TestCascadeQueryStripRewrites(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID: "ann-step1", FoundryA: "opennlp", LayerA: "p",
+			FoundryB: "stts", LayerB: "p",
+			Mappings: []config.MappingRule{`[PIDAT] <> [DET]`},
+		},
+		{
+			ID: "ann-step2", FoundryA: "stts", LayerA: "p",
+			FoundryB: "upos", LayerB: "p",
+			Mappings: []config.MappingRule{`[DET] <> [PRON & Number=Sing]`},
+		},
+		{
+			ID:       "corpus-mapper",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{`textClass=novel <> genre=fiction`},
+		},
+	})
+	require.NoError(t, err)
+
+	input := parseJSON(t, `{
+		"query": {
+			"@type": "koral:group",
+			"operation": "operation:sequence",
+			"operands": [
+				{
+					"@type": "koral:token",
+					"wrap": {
+						"@type": "koral:term",
+						"foundry": "opennlp",
+						"key": "PIDAT",
+						"layer": "p",
+						"match": "match:eq"
+					}
+				},
+				{
+					"@type": "koral:token",
+					"wrap": {
+						"@type": "koral:term",
+						"foundry": "opennlp",
+						"key": "NN",
+						"layer": "p",
+						"match": "match:eq",
+						"rewrites": [
+							{"@type": "koral:rewrite", "editor": "Kustvakt", "operation": "operation:injection"}
+						]
+					}
+				}
+			]
+		},
+		"corpus": {
+			"@type": "koral:doc",
+			"key": "textClass",
+			"value": "novel",
+			"match": "match:eq"
+		}
+	}`)
+
+	result, err := m.CascadeQueryMappings(
+		[]string{"ann-step1", "corpus-mapper", "ann-step2"},
+		[]MappingOptions{
+			{Direction: AtoB, AddRewrites: true},
+			{Direction: AtoB, AddRewrites: true},
+			{Direction: AtoB, AddRewrites: true, StripRewrites: true},
+		},
+		input,
+	)
+	require.NoError(t, err)
+
+	resultBytes, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.NotContains(t, string(resultBytes), RewriteEditor)
+	assert.Contains(t, string(resultBytes), "Kustvakt")
+
+	resultMap := result.(map[string]any)
+	query := resultMap["query"].(map[string]any)
+	first := query["operands"].([]any)[0].(map[string]any)
+	termGroup := first["wrap"].(map[string]any)
+	assert.Equal(t, "koral:termGroup", termGroup["@type"])
+	assert.NotContains(t, termGroup, "rewrites")
+	for _, op := range termGroup["operands"].([]any) {
+		assert.NotContains(t, op.(map[string]any), "rewrites")
+	}
+	assert.Equal(t, "genre", resultMap["corpus"].(map[string]any)["key"])
+}
+
 func TestCascadeResponseTwoCorpusMappings(t *testing.T) {
 	m, err := NewMapper([]config.MappingList{
 		{
@@ -481,3 +658,42 @@ func TestCascadeResponseUnknownID(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "nonexistent")
 }
+
+func TestCascadeResponseContinueOnError(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID: "corpus-step1", Type: "corpus",
+			Mappings: []config.MappingRule{`textClass=novel <> genre=fiction`},
+		},
+		{
+			ID: "corpus-step2", Type: "corpus",
+			Mappings: []config.MappingRule{`genre=fiction <> category=lit`},
+		},
+	})
+	require.NoError(t, err)
+
+	input := `{"fields": [{"@type": "koral:field", "key": "textClass", "value": "novel", "type": "type:string"}]}`
+	ids := []string{"corpus-step1", "nonexistent", "corpus-step2"}
+
+	_, err = m.CascadeResponseMappings(ids,
+		[]MappingOptions{{Direction: AtoB}, {Direction: AtoB}, {Direction: AtoB}},
+		parseJSON(t, input),
+	)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrMappingNotFound)
+
+	result, err := m.CascadeResponseMappings(ids,
+		[]MappingOptions{{Direction: AtoB}, {Direction: AtoB, ContinueOnError: true}, {Direction: AtoB}},
+		parseJSON(t, input),
+	)
+	var skipped *SkippedStepsError
+	require.ErrorAs(t, err, &skipped)
+	require.Len(t, skipped.Steps, 1)
+	assert.Equal(t, "nonexistent", skipped.Steps[0].MappingID)
+	assert.ErrorIs(t, err, ErrMappingNotFound)
+
+	fields := result.(map[string]any)["fields"].([]any)
+	require.Len(t, fields, 3)
+	assert.Equal(t, "genre", fields[1].(map[string]any)["key"])
+	assert.Equal(t, "category", fields[2].(map[string]any)["key"])
+}
@@ -1,17 +1,30 @@
 package mapper
 
 import (
+	"context"
+	"fmt"
 	"maps"
+	"reflect"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/KorAP/Koral-Mapper/ast"
 	"github.com/KorAP/Koral-Mapper/parser"
 )
 
-// applyCorpusQueryMappings processes corpus/collection section with corpus rules.
-// Rules are applied iteratively: each rule is applied to the entire tree,
-// and subsequent rules see the transformed result.
-func (m *Mapper) applyCorpusQueryMappings(mappingID string, opts MappingOptions, jsonData any) (any, error) {
+// corpusKeys are the keys of wrapper objects holding a virtual corpus.
+// "collection" is the legacy name of "corpus".
+var corpusKeys = []string{"corpus", "collection"}
+
+// applyCorpusQueryMappings processes the corpus and collection sections
+// with corpus rules. Both are transformed if present; other keys are
+// left untouched. A section given in the short form "key=value" is
+// transformed as the koral:doc it stands for and emitted as koral:doc or
+// koral:docGroup if a rule applies, as rewrites and groups have no short
+// form; otherwise the string is kept.
+func (m *Mapper) applyCorpusQueryMappings(ctx context.Context, mappingID string, opts MappingOptions, jsonData any) (any, error) {
 	rules := m.rulesWithFieldOverrides(m.parsedCorpusRules[mappingID], opts)
 
 	jsonMap, ok := jsonData.(map[string]any)
@@ -19,37 +32,182 @@ func (m *Mapper) applyCorpusQueryMappings(mappingID string, opts MappingOptions,
 		return jsonData, nil
 	}
 
-	corpusKey := ""
-	if _, exists := jsonMap["corpus"]; exists {
-		corpusKey = "corpus"
-	} else if _, exists := jsonMap["collection"]; exists {
-		corpusKey = "collection"
+	var result map[string]any
+	for _, corpusKey := range corpusKeys {
+		var corpusData map[string]any
+		shortForm := false
+		switch section := jsonMap[corpusKey].(type) {
+		case map[string]any:
+			corpusData = section
+		case string:
+			field, err := parser.ParseCorpusField(section)
+			if err != nil {
+				return nil, withKind(ErrInvalidInput, fmt.Errorf("invalid %s short form %q: %w", corpusKey, section, err))
+			}
+			corpusData = field.ToJSON()
+			shortForm = true
+		default:
+			continue
+		}
+		if maxDepth := effectiveMaxDepth(opts); exceedsDepth(corpusData, maxDepth) {
+			return nil, withKind(ErrInvalidInput, fmt.Errorf("%s exceeds the maximum nesting depth of %d", corpusKey, maxDepth))
+		}
+		transformed, err := m.applyCorpusRules(ctx, mappingID, rules, opts, corpusData)
+		if err != nil {
+			return nil, err
+		}
+		if shortForm && reflect.DeepEqual(transformed, corpusData) {
+			continue
+		}
+		if result == nil {
+			result = shallowCopyMap(jsonMap)
+		}
+		result[corpusKey] = transformed
 	}
 
-	if corpusKey == "" {
+	if result == nil {
 		return jsonData, nil
 	}
+	if opts.StripRewrites {
+		return withoutRawRewrites(result, m.editorName), nil
+	}
+	return result, nil
+}
 
-	corpusData, ok := jsonMap[corpusKey].(map[string]any)
-	if !ok {
-		return jsonData, nil
+// effectiveMaxDepth returns the maximum nesting depth of opts, or
+// parser.DefaultMaxDepth if none is given.
+func effectiveMaxDepth(opts MappingOptions) int {
+	if opts.MaxDepth <= 0 {
+		return parser.DefaultMaxDepth
 	}
+	return opts.MaxDepth
+}
 
-	result := shallowCopyMap(jsonMap)
+// exceedsDepth reports whether objects and arrays in value are nested
+// more than maxDepth levels deep. It stops descending at maxDepth, so
+// the corpus walkers never see deeper trees.
+func exceedsDepth(value any, maxDepth int) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		if maxDepth <= 0 {
+			return true
+		}
+		for _, child := range v {
+			if exceedsDepth(child, maxDepth-1) {
+				return true
+			}
+		}
+	case []any:
+		if maxDepth <= 0 {
+			return true
+		}
+		for _, child := range v {
+			if exceedsDepth(child, maxDepth-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyCorpusRules applies corpus rules to a corpus tree iteratively:
+// each rule is applied to the entire tree, and subsequent rules see the
+// transformed result. Passes over all rules are repeated until the tree
+// no longer changes; if that does not happen within the maximum number
+// of iterations, an error is returned. Rules whose replacement contains
+// their own pattern apply in the first pass only.
+func (m *Mapper) applyCorpusRules(ctx context.Context, mappingID string, rules []*parser.CorpusMappingResult, opts MappingOptions, corpusData map[string]any) (any, error) {
+	maxIterations := opts.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+
+	// firstPassOnly marks the rules not applied again in later passes,
+	// determined when the second pass starts
+	var firstPassOnly []bool
 
 	var current any = corpusData
-	for _, rule := range rules {
-		current = m.applyCorpusRule(current, rule, opts)
+	for iteration := 1; ; iteration++ {
+		if iteration == 2 {
+			firstPassOnly = make([]bool, len(rules))
+			for i, rule := range rules {
+				// Guard rules keep the node they match, so like appending
+				// rules they would match again in every pass
+				firstPassOnly[i] = rule != nil && (isGuardRule(rule, opts.Direction) || m.feedsItself(ctx, rule, opts))
+			}
+		}
+
+		next := current
+		for i, rule := range rules {
+			if rule == nil || !m.ruleSelected(mappingID, i, opts) {
+				continue
+			}
+			if iteration > 1 && firstPassOnly[i] {
+				continue
+			}
+			next = m.applyCorpusRule(ctx, next, rule, func() { m.recordRule(mappingID, i, opts) }, m.rewriteTemplate(mappingID, i), opts)
+			// A canceled context leaves the tree partially transformed
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		// The first pass is always kept, so rules that cancel each other
+		// out still record their rewrites as before. Later passes only
+		// count if they change more than rewrites.
+		if iteration == 1 {
+			current = next
+			// Appended nodes keep the original, which would match again
+			// in every further pass
+			if opts.Mode == ModeAppend {
+				break
+			}
+			continue
+		}
+		if corpusEqualIgnoringRewrites(current, next) {
+			break
+		}
+		if iteration >= maxIterations {
+			return nil, withKind(ErrInvalidInput, fmt.Errorf("corpus mapping list %s did not reach a stable state within %d iterations", mappingID, maxIterations))
+		}
+		current = next
 	}
-	result[corpusKey] = current
+	return current, nil
+}
 
-	return result, nil
+// feedsItself reports whether the replacement of rule in the direction of
+// opts contains its own pattern, as in "a <> (a & b)". Such a rule would
+// match its own result again in every further pass.
+func (m *Mapper) feedsItself(ctx context.Context, rule *parser.CorpusMappingResult, opts MappingOptions) bool {
+	replacement := rule.Lower
+	if opts.Direction == BtoA {
+		replacement = rule.Upper
+	}
+	replaced, ok := buildReplacementFromNode(replacement, map[string]any{}, nil).(map[string]any)
+	if !ok {
+		return false
+	}
+
+	matched := false
+	probe := opts
+	probe.AddRewrites = false
+	m.applyCorpusRule(ctx, replaced, rule, func() { matched = true }, ast.Rewrite{}, probe)
+	return matched
+}
+
+// isGuardRule reports whether the pattern of rule in direction dir
+// contains a negated guard field.
+func isGuardRule(rule *parser.CorpusMappingResult, dir Direction) bool {
+	if dir == AtoB {
+		return parser.HasGuard(rule.Upper)
+	}
+	return parser.HasGuard(rule.Lower)
 }
 
 // applyCorpusRule applies a single corpus mapping rule to a node tree.
 // It matches at the current level first, then recurses into operands
-// if no match is found.
-func (m *Mapper) applyCorpusRule(nodeAny any, rule *parser.CorpusMappingResult, opts MappingOptions) any {
+// if no match is found. Every match is reported to applied.
+func (m *Mapper) applyCorpusRule(ctx context.Context, nodeAny any, rule *parser.CorpusMappingResult, applied func(), template ast.Rewrite, opts MappingOptions) any {
 	node, ok := nodeAny.(map[string]any)
 	if !ok {
 		return nodeAny
@@ -68,31 +226,43 @@ func (m *Mapper) applyCorpusRule(nodeAny any, rule *parser.CorpusMappingResult,
 	}
 
 	if m.matchCorpusNode(pattern, node) {
+		applied()
+		// Guard patterns keep the matched node, as its value is not
+		// implied by the replacement
+		if opts.Mode == ModeAppend || isGuardRule(rule, opts.Direction) {
+			return m.buildAppendedNode(node, pattern, replacement, template, opts)
+		}
+
 		// AND subset match: node has more operands than pattern
 		if pg, ok := pattern.(*parser.CorpusGroup); ok && pg.Operation == "and" {
 			operandsRaw, _ := node["operands"].([]any)
 			if operandsRaw != nil && len(operandsRaw) > len(pg.Operands) {
-				return m.buildSubsetANDReplacement(node, pg.Operands, replacement, opts)
+				return m.buildSubsetANDReplacement(node, pg.Operands, replacement, template, opts)
 			}
 		}
 
-		replaced := buildReplacementFromNode(replacement, node)
+		replaced := buildReplacementFromNode(replacement, node, m.regexCaptures(pattern, node))
 		if opts.AddRewrites {
-			addCorpusRewrite(replaced, node)
+			addCorpusRewrite(template, replaced, node)
 		}
 		return replaced
 	}
 
 	// No match at this level; recurse into operands if it's a group
 	if atType == "koral:docGroup" || atType == "koral:fieldGroup" {
-		return m.applyCorpusRuleToOperands(node, rule, opts)
+		return m.applyCorpusRuleToOperands(ctx, node, rule, applied, template, opts)
 	}
 
 	return node
 }
 
 // applyCorpusRuleToOperands recursively applies a single rule to operands of a docGroup.
-func (m *Mapper) applyCorpusRuleToOperands(node map[string]any, rule *parser.CorpusMappingResult, opts MappingOptions) any {
+// It stops descending once ctx is done; the caller reports the error.
+func (m *Mapper) applyCorpusRuleToOperands(ctx context.Context, node map[string]any, rule *parser.CorpusMappingResult, applied func(), template ast.Rewrite, opts MappingOptions) any {
+	if ctx.Err() != nil {
+		return node
+	}
+
 	result := shallowCopyMap(node)
 
 	operandsRaw, ok := node["operands"].([]any)
@@ -102,7 +272,7 @@ func (m *Mapper) applyCorpusRuleToOperands(node map[string]any, rule *parser.Cor
 
 	newOperands := make([]any, len(operandsRaw))
 	for i, opRaw := range operandsRaw {
-		newOperands[i] = m.applyCorpusRule(opRaw, rule, opts)
+		newOperands[i] = m.applyCorpusRule(ctx, opRaw, rule, applied, template, opts)
 	}
 	result["operands"] = newOperands
 
@@ -112,7 +282,7 @@ func (m *Mapper) applyCorpusRuleToOperands(node map[string]any, rule *parser.Cor
 // buildSubsetANDReplacement handles AND patterns that match a subset of a
 // group's operands. The matched operands are replaced and unmatched ones
 // are preserved alongside the replacement.
-func (m *Mapper) buildSubsetANDReplacement(node map[string]any, patternOps []parser.CorpusNode, replacement parser.CorpusNode, opts MappingOptions) any {
+func (m *Mapper) buildSubsetANDReplacement(node map[string]any, patternOps []parser.CorpusNode, replacement parser.CorpusNode, template ast.Rewrite, opts MappingOptions) any {
 	operandsRaw, _ := node["operands"].([]any)
 
 	used := make([]bool, len(operandsRaw))
@@ -139,14 +309,14 @@ func (m *Mapper) buildSubsetANDReplacement(node map[string]any, patternOps []par
 		}
 	}
 
-	replacementNode := buildReplacementFromNode(replacement, node)
+	replacementNode := buildReplacementFromNode(replacement, node, nil)
 	newOperands := append([]any{replacementNode}, remaining...)
 
 	if len(newOperands) == 1 {
 		result := newOperands[0]
 		if opts.AddRewrites {
 			if resultMap, ok := result.(map[string]any); ok {
-				addCorpusRewrite(resultMap, node)
+				addCorpusRewrite(template, resultMap, node)
 			}
 		}
 		return result
@@ -156,12 +326,28 @@ func (m *Mapper) buildSubsetANDReplacement(node map[string]any, patternOps []par
 	result["operands"] = newOperands
 
 	if opts.AddRewrites {
-		addCorpusRewrite(result, node)
+		addCorpusRewrite(template, result, node)
 	}
 
 	return result
 }
 
+// buildAppendedNode keeps a matched node and combines it with its
+// replacement in an AND docGroup. Rewrites are attached to the
+// replacement.
+func (m *Mapper) buildAppendedNode(node map[string]any, pattern, replacement parser.CorpusNode, template ast.Rewrite, opts MappingOptions) any {
+	replaced := buildReplacementFromNode(replacement, node, m.regexCaptures(pattern, node))
+	if opts.AddRewrites {
+		addCorpusRewrite(template, replaced, node)
+	}
+
+	return map[string]any{
+		"@type":     "koral:docGroup",
+		"operation": "operation:and",
+		"operands":  []any{node, replaced},
+	}
+}
+
 // matchCorpusNode checks if a JSON node matches a CorpusNode pattern.
 // For CorpusField patterns, the node must be a koral:doc/koral:field.
 // For CorpusGroup patterns, the node must be a koral:docGroup/koral:fieldGroup
@@ -270,22 +456,36 @@ func (m *Mapper) matchGroupOperands(patternOps []parser.CorpusNode, node map[str
 // matchCorpusField checks if a koral:doc JSON node matches a CorpusField pattern.
 func (m *Mapper) matchCorpusField(pattern *parser.CorpusField, doc map[string]any) bool {
 	docKey, _ := doc["key"].(string)
-	if docKey != pattern.Key {
+	if pattern.Key != parser.WildcardKey && docKey != pattern.Key {
 		return false
 	}
 
 	docValue, _ := doc["value"].(string)
+	var valueMatches bool
 	if pattern.Type == "regex" {
 		re := m.compiledRegexes["^"+pattern.Value+"$"]
-		if re == nil || !re.MatchString(docValue) {
+		valueMatches = re != nil && re.MatchString(docValue)
+	} else {
+		valueMatches = docValue == pattern.Value
+	}
+
+	if pattern.Negated {
+		// A guard only applies to fields stating a value
+		if docMatch, _ := doc["match"].(string); docMatch != "" && docMatch != "match:eq" {
 			return false
 		}
-	} else if docValue != pattern.Value {
+		valueMatches = !valueMatches
+	}
+	if !valueMatches {
 		return false
 	}
 
 	if pattern.Match != "" {
+		// Fields without a match type compare for equality
 		docMatch, _ := doc["match"].(string)
+		if docMatch == "" {
+			docMatch = "match:eq"
+		}
 		expected := "match:" + pattern.Match
 		if docMatch != expected {
 			return false
@@ -303,9 +503,28 @@ func (m *Mapper) matchCorpusField(pattern *parser.CorpusField, doc map[string]an
 	return true
 }
 
+// matchResponseField checks if a response field value, given as a
+// koral:doc-like key/value pair, matches a CorpusField pattern. Response
+// fields carry no match type, so a pattern with match "contains" matches
+// values containing the pattern value as a substring instead of
+// requiring a match type. Other patterns match as in queries.
+func (m *Mapper) matchResponseField(pattern *parser.CorpusField, doc map[string]any) bool {
+	if pattern.Match != "contains" || pattern.Type == "regex" {
+		return m.matchCorpusField(pattern, doc)
+	}
+
+	docKey, _ := doc["key"].(string)
+	if pattern.Key != parser.WildcardKey && docKey != pattern.Key {
+		return false
+	}
+	docValue, _ := doc["value"].(string)
+	return strings.Contains(docValue, pattern.Value)
+}
+
 // buildReplacementFromNode builds a replacement JSON structure from a CorpusNode pattern.
 // Preserves match and type from the original doc when the rule doesn't specify them.
-func buildReplacementFromNode(replacement parser.CorpusNode, originalDoc map[string]any) any {
+// Group references in replacement values are expanded from captures, if any.
+func buildReplacementFromNode(replacement parser.CorpusNode, originalDoc map[string]any, captures *regexCaptures) any {
 	switch r := replacement.(type) {
 	case *parser.CorpusField:
 		// Determine @type: use the original's type for doc/field, default to koral:doc
@@ -314,14 +533,24 @@ func buildReplacementFromNode(replacement parser.CorpusNode, originalDoc map[str
 			atType = origType
 		}
 
+		// A wildcard key keeps the key of the matched field
+		key := r.Key
+		if key == parser.WildcardKey {
+			if origKey, ok := originalDoc["key"].(string); ok {
+				key = origKey
+			}
+		}
+
 		result := map[string]any{
 			"@type": atType,
-			"key":   r.Key,
-			"value": r.Value,
+			"key":   key,
+			"value": captures.expand(r.Value),
 		}
 
 		if r.Match != "" {
 			result["match"] = "match:" + r.Match
+		} else if r.Negated {
+			result["match"] = "match:ne"
 		} else if m, ok := originalDoc["match"]; ok {
 			result["match"] = m
 		}
@@ -337,7 +566,7 @@ func buildReplacementFromNode(replacement parser.CorpusNode, originalDoc map[str
 	case *parser.CorpusGroup:
 		operands := make([]any, len(r.Operands))
 		for i, op := range r.Operands {
-			operands[i] = buildReplacementFromNode(op, originalDoc)
+			operands[i] = buildReplacementFromNode(op, originalDoc, captures)
 		}
 		return map[string]any{
 			"@type":     "koral:docGroup",
@@ -350,31 +579,128 @@ func buildReplacementFromNode(replacement parser.CorpusNode, originalDoc map[str
 	}
 }
 
-// addCorpusRewrite adds a koral:rewrite annotation to the replaced node.
-func addCorpusRewrite(replaced any, original map[string]any) {
+// groupReference matches references to capture groups in replacement
+// values: $1, ${1} or ${name}.
+var groupReference = regexp.MustCompile(`\$(\d+|\{\w+\})`)
+
+// regexCaptures holds the submatches of a regex field pattern.
+type regexCaptures struct {
+	re      *regexp.Regexp
+	matches []string
+}
+
+// regexCaptures returns the submatches of a single regex field pattern
+// matched against doc, or nil if the pattern is no regex field or does
+// not match.
+func (m *Mapper) regexCaptures(pattern parser.CorpusNode, doc map[string]any) *regexCaptures {
+	field, ok := pattern.(*parser.CorpusField)
+	if !ok || field.Type != "regex" {
+		return nil
+	}
+	re := m.compiledRegexes["^"+field.Value+"$"]
+	if re == nil || re.NumSubexp() == 0 {
+		return nil
+	}
+	docValue, _ := doc["value"].(string)
+	matches := re.FindStringSubmatch(docValue)
+	if matches == nil {
+		return nil
+	}
+	return &regexCaptures{re: re, matches: matches}
+}
+
+// expand replaces group references in value with the captured text.
+// Without captures, or for unknown groups, references are kept literally;
+// NewMapper rejects rules referencing groups their pattern lacks.
+func (c *regexCaptures) expand(value string) string {
+	if c == nil {
+		return value
+	}
+	return groupReference.ReplaceAllStringFunc(value, func(ref string) string {
+		if index := captureIndex(c.re, ref); index >= 0 {
+			return c.matches[index]
+		}
+		return ref
+	})
+}
+
+// captureIndex returns the index of the group a reference like $1 or
+// ${name} refers to, or -1 if re has no such group.
+func captureIndex(re *regexp.Regexp, ref string) int {
+	name := strings.Trim(ref[1:], "{}")
+	if n, err := strconv.Atoi(name); err == nil {
+		if n > re.NumSubexp() {
+			return -1
+		}
+		return n
+	}
+	return re.SubexpIndex(name)
+}
+
+// validateGroupReferences checks that the group references in the
+// replacement values refer to groups of the pattern, if it is a single
+// regex field.
+func (m *Mapper) validateGroupReferences(pattern, replacement parser.CorpusNode) error {
+	field, ok := pattern.(*parser.CorpusField)
+	if !ok || field.Type != "regex" {
+		return nil
+	}
+	re := m.compiledRegexes["^"+field.Value+"$"]
+	if re == nil {
+		return nil
+	}
+
+	switch r := replacement.(type) {
+	case *parser.CorpusField:
+		for _, ref := range groupReference.FindAllString(r.Value, -1) {
+			if captureIndex(re, ref) < 0 {
+				return fmt.Errorf("replacement %q references group %s not defined in pattern %q", r.Value, ref, field.Value)
+			}
+		}
+	case *parser.CorpusGroup:
+		for _, op := range r.Operands {
+			if err := m.validateGroupReferences(pattern, op); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addCorpusRewrite adds a koral:rewrite annotation based on the template
+// to the replaced node. Without a template scope, the scope is derived from
+// what changed: the key, the value, or a whole group.
+func addCorpusRewrite(template ast.Rewrite, replaced any, original map[string]any) {
 	replacedMap, ok := replaced.(map[string]any)
 	if !ok {
 		return
 	}
 
 	origAtType, _ := original["@type"].(string)
+	origKey, _ := original["key"].(string)
+	origValue, _ := original["value"].(string)
 
-	var rw ast.Rewrite
+	isGroup := origAtType == "koral:docGroup" || origAtType == "koral:fieldGroup"
 
-	if origAtType == "koral:docGroup" || origAtType == "koral:fieldGroup" {
-		rw = ast.Rewrite{Editor: RewriteEditor, Original: original}
-	} else {
-		origKey, _ := original["key"].(string)
+	rw := template
+	if rw.Scope == "" && !isGroup {
 		newKey, _ := replacedMap["key"].(string)
-
 		if origKey != newKey && origKey != "" {
-			rw = ast.Rewrite{Editor: RewriteEditor, Scope: "key", Original: origKey}
+			rw.Scope = "key"
 		} else {
-			origValue, _ := original["value"].(string)
-			rw = ast.Rewrite{Editor: RewriteEditor, Scope: "value", Original: origValue}
+			rw.Scope = "value"
 		}
 	}
 
+	switch {
+	case !isGroup && rw.Scope == "key":
+		rw.Original = origKey
+	case !isGroup && rw.Scope == "value":
+		rw.Original = origValue
+	default:
+		rw.Original = original
+	}
+
 	replacedMap["rewrites"] = []any{rw.ToMap()}
 }
 
@@ -387,15 +713,19 @@ func (m *Mapper) applyCorpusResponseMappings(mappingID string, opts MappingOptio
 		return jsonData, nil
 	}
 
-	fieldsInDocument, fields, ok := extractResponseFieldsContainer(jsonMap)
+	fieldsPath, fields, ok := m.findResponseFields(jsonMap)
 	if !ok {
 		return jsonData, nil
 	}
 
-	var newFields []any
-	for _, fieldRaw := range fields {
-		newFields = append(newFields, fieldRaw)
+	var seen fieldSet
+	if opts.DeduplicateFields {
+		seen = newFieldSet(fields)
+	}
 
+	// Mapped fields by the index of the field they follow
+	mappedAfter := make([][]any, len(fields))
+	for i, fieldRaw := range fields {
 		fieldMap, ok := fieldRaw.(map[string]any)
 		if !ok {
 			continue
@@ -409,68 +739,139 @@ func (m *Mapper) applyCorpusResponseMappings(mappingID string, opts MappingOptio
 		fieldKey, _ := fieldMap["key"].(string)
 		fieldValue := fieldMap["value"]
 
-		mapped := m.matchFieldAndCollect(fieldKey, fieldValue, rules, opts)
-		newFields = append(newFields, mapped...)
+		mappedAfter[i] = m.matchFieldAndCollect(mappingID, fieldKey, fieldValue, rules, opts)
 	}
 
+	var trailing []any
 	fieldValues := collectResponseFieldValues(fields)
-	newFields = append(newFields, m.matchGroupPatternsAndCollect(fieldValues, rules, opts)...)
+	for _, match := range m.matchGroupPatternsAndCollect(mappingID, fieldValues, rules, opts) {
+		if opts.InsertAfterSource {
+			if i := m.lastSourceField(match.pattern, fields); i >= 0 {
+				mappedAfter[i] = append(mappedAfter[i], match.fields...)
+				continue
+			}
+		}
+		trailing = append(trailing, match.fields...)
+	}
 
-	result := shallowCopyMap(jsonMap)
-	if !fieldsInDocument {
-		result["fields"] = newFields
-		return result, nil
+	var newFields []any
+	appendMapped := func(mapped []any) {
+		for _, field := range mapped {
+			if seen != nil {
+				if seen.contains(field) {
+					continue
+				}
+				seen.add(field)
+			}
+			newFields = append(newFields, field)
+		}
 	}
+	for i, fieldRaw := range fields {
+		newFields = append(newFields, fieldRaw)
+		appendMapped(mappedAfter[i])
+	}
+	appendMapped(trailing)
+
+	return withFieldsAt(jsonMap, fieldsPath, newFields), nil
+}
 
-	if document, ok := jsonMap["document"].(map[string]any); ok {
-		documentCopy := shallowCopyMap(document)
-		documentCopy["fields"] = newFields
-		result["document"] = documentCopy
+// fieldSet records the key/value pairs of response fields. Each element
+// of a multi-valued field counts as a pair of its own.
+type fieldSet map[[2]string]bool
+
+func newFieldSet(fields []any) fieldSet {
+	s := make(fieldSet, len(fields))
+	for _, field := range fields {
+		s.add(field)
 	}
+	return s
+}
 
-	return result, nil
+func (s fieldSet) add(field any) {
+	for _, pair := range fieldPairs(field) {
+		s[pair] = true
+	}
 }
 
-// extractResponseFieldsContainer finds the response field array either at
-// top-level ("fields") or in document-level ("document.fields").
-func extractResponseFieldsContainer(jsonMap map[string]any) (bool, []any, bool) {
-	if fieldsRaw, exists := jsonMap["fields"]; exists {
-		if fields, ok := fieldsRaw.([]any); ok {
-			return false, fields, true
+// contains reports whether all key/value pairs of field are present.
+func (s fieldSet) contains(field any) bool {
+	pairs := fieldPairs(field)
+	for _, pair := range pairs {
+		if !s[pair] {
+			return false
 		}
 	}
+	return len(pairs) > 0
+}
 
-	documentRaw, exists := jsonMap["document"]
-	if !exists {
-		return false, nil, false
-	}
-	document, ok := documentRaw.(map[string]any)
+// fieldPairs returns the key/value pairs of a response field.
+func fieldPairs(field any) [][2]string {
+	fieldMap, ok := field.(map[string]any)
 	if !ok {
-		return false, nil, false
+		return nil
 	}
-	fieldsRaw, exists := document["fields"]
-	if !exists {
-		return false, nil, false
+	key, _ := fieldMap["key"].(string)
+	switch v := fieldMap["value"].(type) {
+	case string:
+		return [][2]string{{key, v}}
+	case []any:
+		var pairs [][2]string
+		for _, elem := range v {
+			if value, ok := elem.(string); ok {
+				pairs = append(pairs, [2]string{key, value})
+			}
+		}
+		return pairs
 	}
-	fields, ok := fieldsRaw.([]any)
-	if !ok {
-		return false, nil, false
+	return nil
+}
+
+// findResponseFields returns the path of the first fields array of the
+// response found at one of the field paths of the mapper.
+func (m *Mapper) findResponseFields(jsonMap map[string]any) ([]string, []any, bool) {
+	for _, path := range m.fieldPaths {
+		current := jsonMap
+		for _, key := range path[:len(path)-1] {
+			current, _ = current[key].(map[string]any)
+			if current == nil {
+				break
+			}
+		}
+		if current == nil {
+			continue
+		}
+		if fields, ok := current[path[len(path)-1]].([]any); ok {
+			return path, fields, true
+		}
+	}
+	return nil, nil, false
+}
+
+// withFieldsAt returns a copy of jsonMap with the value at path replaced
+// by fields, copying the objects along the path.
+func withFieldsAt(jsonMap map[string]any, path []string, fields []any) map[string]any {
+	result := shallowCopyMap(jsonMap)
+	if len(path) == 1 {
+		result[path[0]] = fields
+		return result
 	}
-	return true, fields, true
+	nested, _ := jsonMap[path[0]].(map[string]any)
+	result[path[0]] = withFieldsAt(nested, path[1:], fields)
+	return result
 }
 
 // matchFieldAndCollect matches a field's key/value against rules and returns mapped entries.
 // For array values, each element is matched individually.
-func (m *Mapper) matchFieldAndCollect(key string, value any, rules []*parser.CorpusMappingResult, opts MappingOptions) []any {
+func (m *Mapper) matchFieldAndCollect(mappingID, key string, value any, rules []*parser.CorpusMappingResult, opts MappingOptions) []any {
 	var results []any
 
 	switch v := value.(type) {
 	case string:
-		results = append(results, m.matchSingleValue(key, v, rules, opts)...)
+		results = append(results, m.matchSingleValue(mappingID, key, v, rules, opts)...)
 	case []any:
 		for _, elem := range v {
 			if s, ok := elem.(string); ok {
-				results = append(results, m.matchSingleValue(key, s, rules, opts)...)
+				results = append(results, m.matchSingleValue(mappingID, key, s, rules, opts)...)
 			}
 		}
 	}
@@ -481,7 +882,7 @@ func (m *Mapper) matchFieldAndCollect(key string, value any, rules []*parser.Cor
 // matchSingleValue checks a single key+value pair against all rules and returns mapped field entries.
 // Supports field patterns (direct match) and OR group patterns (any operand match).
 // AND group patterns cannot match a single field and are skipped.
-func (m *Mapper) matchSingleValue(key, value string, rules []*parser.CorpusMappingResult, opts MappingOptions) []any {
+func (m *Mapper) matchSingleValue(mappingID, key, value string, rules []*parser.CorpusMappingResult, opts MappingOptions) []any {
 	var results []any
 
 	pseudoDoc := map[string]any{
@@ -489,7 +890,10 @@ func (m *Mapper) matchSingleValue(key, value string, rules []*parser.CorpusMappi
 		"value": value,
 	}
 
-	for _, rule := range rules {
+	for i, rule := range rules {
+		if rule == nil || !m.ruleSelected(mappingID, i, opts) {
+			continue
+		}
 		var pattern, replacement parser.CorpusNode
 		if opts.Direction == AtoB {
 			pattern, replacement = rule.Upper, rule.Lower
@@ -500,20 +904,43 @@ func (m *Mapper) matchSingleValue(key, value string, rules []*parser.CorpusMappi
 		if !m.matchCorpusFieldPattern(pattern, pseudoDoc) {
 			continue
 		}
-
-		results = append(results, collectReplacementFields(replacement)...)
+		m.recordRule(mappingID, i, opts)
+
+		captures := m.regexCaptures(pattern, pseudoDoc)
+		for _, entry := range m.replacementFields(mappingID, i, replacement, opts) {
+			if entryMap, ok := entry.(map[string]any); ok {
+				// A wildcard key keeps the key of the matched field
+				if entryMap["key"] == parser.WildcardKey {
+					entryMap["key"] = key
+				}
+				if value, ok := entryMap["value"].(string); ok {
+					entryMap["value"] = captures.expand(value)
+				}
+			}
+			results = append(results, entry)
+		}
 	}
 
 	return results
 }
 
+// groupMatch holds the mapped fields of a group pattern that matched the
+// response fields as a whole.
+type groupMatch struct {
+	pattern parser.CorpusNode
+	fields  []any
+}
+
 // matchGroupPatternsAndCollect matches group-based rule patterns against the
 // complete set of response field values (e.g. AND combinations across
 // multi-valued textClass fields).
-func (m *Mapper) matchGroupPatternsAndCollect(values map[string][]string, rules []*parser.CorpusMappingResult, opts MappingOptions) []any {
-	var results []any
+func (m *Mapper) matchGroupPatternsAndCollect(mappingID string, values map[string][]string, rules []*parser.CorpusMappingResult, opts MappingOptions) []groupMatch {
+	var results []groupMatch
 
-	for _, rule := range rules {
+	for i, rule := range rules {
+		if rule == nil || !m.ruleSelected(mappingID, i, opts) {
+			continue
+		}
 		var pattern, replacement parser.CorpusNode
 		if opts.Direction == AtoB {
 			pattern, replacement = rule.Upper, rule.Lower
@@ -527,13 +954,54 @@ func (m *Mapper) matchGroupPatternsAndCollect(values map[string][]string, rules
 		if !m.matchCorpusPatternAgainstValues(pattern, values) {
 			continue
 		}
+		m.recordRule(mappingID, i, opts)
 
-		results = append(results, collectReplacementFields(replacement)...)
+		results = append(results, groupMatch{
+			pattern: pattern,
+			fields:  m.replacementFields(mappingID, i, replacement, opts),
+		})
 	}
 
 	return results
 }
 
+// lastSourceField returns the index of the last response field matching
+// one of the field patterns of pattern, or -1 if none does.
+func (m *Mapper) lastSourceField(pattern parser.CorpusNode, fields []any) int {
+	for i := len(fields) - 1; i >= 0; i-- {
+		fieldMap, ok := fields[i].(map[string]any)
+		if !ok {
+			continue
+		}
+		key, _ := fieldMap["key"].(string)
+		values := collectResponseFieldValues([]any{fieldMap})[key]
+		if m.patternMatchesAnyValue(pattern, key, values) {
+			return i
+		}
+	}
+	return -1
+}
+
+// patternMatchesAnyValue reports whether any field pattern within pattern
+// matches one of the values of the field key.
+func (m *Mapper) patternMatchesAnyValue(pattern parser.CorpusNode, key string, values []string) bool {
+	switch p := pattern.(type) {
+	case *parser.CorpusField:
+		for _, value := range values {
+			if m.matchResponseField(p, map[string]any{"key": key, "value": value}) {
+				return true
+			}
+		}
+	case *parser.CorpusGroup:
+		for _, op := range p.Operands {
+			if m.patternMatchesAnyValue(op, key, values) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func collectResponseFieldValues(fields []any) map[string][]string {
 	values := make(map[string][]string)
 
@@ -566,10 +1034,10 @@ func collectResponseFieldValues(fields []any) map[string][]string {
 func (m *Mapper) matchCorpusPatternAgainstValues(pattern parser.CorpusNode, values map[string][]string) bool {
 	switch p := pattern.(type) {
 	case *parser.CorpusField:
-		if p.Key == "" {
+		if p.Key == "" || p.Key == parser.WildcardKey {
 			for key, keyValues := range values {
 				for _, value := range keyValues {
-					if m.matchCorpusField(p, map[string]any{"key": key, "value": value}) {
+					if m.matchResponseField(p, map[string]any{"key": key, "value": value}) {
 						return true
 					}
 				}
@@ -577,7 +1045,7 @@ func (m *Mapper) matchCorpusPatternAgainstValues(pattern parser.CorpusNode, valu
 			return false
 		}
 		for _, value := range values[p.Key] {
-			if m.matchCorpusField(p, map[string]any{"key": p.Key, "value": value}) {
+			if m.matchResponseField(p, map[string]any{"key": p.Key, "value": value}) {
 				return true
 			}
 		}
@@ -625,7 +1093,7 @@ func patternNeedsAggregateMatching(pattern parser.CorpusNode) bool {
 func (m *Mapper) matchCorpusFieldPattern(pattern parser.CorpusNode, doc map[string]any) bool {
 	switch p := pattern.(type) {
 	case *parser.CorpusField:
-		return m.matchCorpusField(p, doc)
+		return m.matchResponseField(p, doc)
 	case *parser.CorpusGroup:
 		if p.Operation == "or" {
 			for _, op := range p.Operands {
@@ -638,15 +1106,43 @@ func (m *Mapper) matchCorpusFieldPattern(pattern parser.CorpusNode, doc map[stri
 	return false
 }
 
+// replacementFields returns the mapped fields of the replacement of the
+// rule at ruleIndex, recording the rule in each field if the options ask
+// for provenance.
+func (m *Mapper) replacementFields(mappingID string, ruleIndex int, replacement parser.CorpusNode, opts MappingOptions) []any {
+	fields := collectReplacementFields(replacement)
+	if !opts.IncludeProvenance {
+		return fields
+	}
+	for _, field := range fields {
+		provenance := map[string]any{
+			"list": mappingID,
+			"rule": ruleIndex,
+		}
+		if list, ok := m.mappingLists[mappingID]; ok {
+			if id := list.RuleMetaAt(ruleIndex).ID; id != "" {
+				provenance["id"] = id
+			}
+		}
+		field.(map[string]any)["mappedBy"] = provenance
+	}
+	return fields
+}
+
 // collectReplacementFields flattens a replacement CorpusNode into individual
-// mapped field entries. OR groups are skipped because response fields are flat
-// key/value entries and OR semantics (one-of) cannot be represented. AND groups
-// are flattened — all operands become individual fields.
+// mapped field entries. OR groups and negated fields are skipped because
+// response fields are flat key/value entries and OR semantics (one-of) cannot
+// be represented. AND groups are flattened — all operands become individual
+// fields.
 func collectReplacementFields(node parser.CorpusNode) []any {
 	var results []any
 
 	switch n := node.(type) {
 	case *parser.CorpusField:
+		// A field known not to have a value has no flat representation
+		if n.Negated {
+			return nil
+		}
 		entry := map[string]any{
 			"@type":   "koral:field",
 			"key":     n.Key,
@@ -673,6 +1169,92 @@ func collectReplacementFields(node parser.CorpusNode) []any {
 	return results
 }
 
+// corpusEqualIgnoringRewrites compares two corpus trees, ignoring any
+// "rewrites" entries.
+func corpusEqualIgnoringRewrites(a, b any) bool {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, aVal := range av {
+			if key == "rewrites" {
+				continue
+			}
+			bVal, exists := bv[key]
+			if !exists || !corpusEqualIgnoringRewrites(aVal, bVal) {
+				return false
+			}
+		}
+		for key := range bv {
+			if _, exists := av[key]; !exists && key != "rewrites" {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !corpusEqualIgnoringRewrites(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// withoutRawRewrites returns a copy of a generic JSON tree without the
+// rewrites by editor. Emptied "rewrites" lists are dropped.
+func withoutRawRewrites(data any, editor string) any {
+	switch v := data.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "rewrites" {
+				if rewrites, ok := value.([]any); ok {
+					kept := slices.DeleteFunc(slices.Clone(rewrites), func(rewrite any) bool {
+						return isRawRewriteBy(rewrite, editor)
+					})
+					if len(kept) > 0 {
+						result[key] = kept
+					}
+					continue
+				}
+			}
+			result[key] = withoutRawRewrites(value, editor)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = withoutRawRewrites(item, editor)
+		}
+		return result
+	default:
+		return data
+	}
+}
+
+// isRawRewriteBy reports whether a generic JSON rewrite was made by
+// editor, accepting the legacy "source" field.
+func isRawRewriteBy(rewrite any, editor string) bool {
+	rewriteMap, ok := rewrite.(map[string]any)
+	if !ok {
+		return false
+	}
+	if e, ok := rewriteMap["editor"].(string); ok {
+		return e == editor
+	}
+	source, _ := rewriteMap["source"].(string)
+	return source == editor
+}
+
 func shallowCopyMap(m map[string]any) map[string]any {
 	result := make(map[string]any, len(m))
 	maps.Copy(result, m)
@@ -686,6 +1268,9 @@ func (m *Mapper) rulesWithFieldOverrides(rules []*parser.CorpusMappingResult, op
 
 	result := make([]*parser.CorpusMappingResult, len(rules))
 	for i, rule := range rules {
+		if rule == nil {
+			continue
+		}
 		upper := rule.Upper.Clone()
 		lower := rule.Lower.Clone()
 
@@ -697,18 +1282,23 @@ func (m *Mapper) rulesWithFieldOverrides(rules []*parser.CorpusMappingResult, op
 		}
 
 		result[i] = &parser.CorpusMappingResult{
-			Upper: upper,
-			Lower: lower,
+			Upper:     upper,
+			Lower:     lower,
+			Direction: rule.Direction,
 		}
 	}
 
 	return result
 }
 
+// applyCorpusKeyOverride sets the key of all fields in the node. Wildcard
+// keys are kept, as they are not bound to a particular field.
 func applyCorpusKeyOverride(node parser.CorpusNode, key string) {
 	switch n := node.(type) {
 	case *parser.CorpusField:
-		n.Key = key
+		if n.Key != parser.WildcardKey {
+			n.Key = key
+		}
 	case *parser.CorpusGroup:
 		for _, op := range n.Operands {
 			applyCorpusKeyOverride(op, key)
@@ -68,6 +68,64 @@ func TestCorpusQueryNoMatch(t *testing.T) {
 	assert.Equal(t, "science", corpus["value"])
 }
 
+func TestCorpusQueryShortForm(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel <> genre=fiction", "pubDate=2020:geq#date <> year=2020:geq#date")
+
+	t.Run("field", func(t *testing.T) {
+		result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+			"corpus": "textClass=novel",
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]any{
+			"@type": "koral:doc",
+			"key":   "genre",
+			"value": "fiction",
+			"match": "match:eq",
+			"type":  "type:string",
+		}, result.(map[string]any)["corpus"])
+	})
+
+	t.Run("match and type suffix", func(t *testing.T) {
+		result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+			"collection": "pubDate=2020:geq#date",
+		})
+		require.NoError(t, err)
+
+		collection := result.(map[string]any)["collection"].(map[string]any)
+		assert.Equal(t, "year", collection["key"])
+		assert.Equal(t, "match:geq", collection["match"])
+		assert.Equal(t, "type:date", collection["type"])
+	})
+
+	t.Run("rewrites", func(t *testing.T) {
+		result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: BtoA, AddRewrites: true}, map[string]any{
+			"corpus": "genre=fiction",
+		})
+		require.NoError(t, err)
+
+		corpus := result.(map[string]any)["corpus"].(map[string]any)
+		assert.Equal(t, "textClass", corpus["key"])
+		assert.NotEmpty(t, corpus["rewrites"])
+	})
+
+	t.Run("no match keeps the short form", func(t *testing.T) {
+		input := map[string]any{"corpus": "textClass=science"}
+		result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"corpus": "textClass=science"}, result)
+	})
+
+	t.Run("invalid short form", func(t *testing.T) {
+		_, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+			"corpus": "textClass",
+		})
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+		assert.Contains(t, err.Error(), "invalid corpus short form")
+	})
+}
+
 func TestCorpusQueryBtoA(t *testing.T) {
 	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
 
@@ -129,6 +187,57 @@ func TestCorpusQueryDocGroupRecursive(t *testing.T) {
 	assert.Equal(t, "Fontane", second["value"])
 }
 
+func TestCorpusQueryAppendMode(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
+
+	novel := `{"@type": "koral:doc", "key": "textClass", "value": "novel", "match": "match:eq"}`
+	fiction := `{"@type": "koral:doc", "key": "genre", "value": "fiction", "match": "match:eq"}`
+	author := `{"@type": "koral:doc", "key": "author", "value": "Fontane", "match": "match:eq"}`
+
+	tests := []struct {
+		name     string
+		mode     Mode
+		input    string
+		expected string
+	}{
+		{
+			name:     "Replace single doc",
+			mode:     ModeReplace,
+			input:    novel,
+			expected: fiction,
+		},
+		{
+			name:     "Append single doc",
+			mode:     ModeAppend,
+			input:    novel,
+			expected: `{"@type": "koral:docGroup", "operation": "operation:and", "operands": [` + novel + `, ` + fiction + `]}`,
+		},
+		{
+			name:     "Replace within group",
+			input:    `{"@type": "koral:docGroup", "operation": "operation:or", "operands": [` + novel + `, ` + author + `]}`,
+			expected: `{"@type": "koral:docGroup", "operation": "operation:or", "operands": [` + fiction + `, ` + author + `]}`,
+		},
+		{
+			name:  "Append within group",
+			mode:  ModeAppend,
+			input: `{"@type": "koral:docGroup", "operation": "operation:or", "operands": [` + novel + `, ` + author + `]}`,
+			expected: `{"@type": "koral:docGroup", "operation": "operation:or", "operands": [
+				{"@type": "koral:docGroup", "operation": "operation:and", "operands": [` + novel + `, ` + fiction + `]},
+				` + author + `
+			]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := parseJSON(t, `{"corpus": `+tt.input+`}`)
+			result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB, Mode: tt.mode}, input)
+			require.NoError(t, err)
+			assert.Equal(t, parseJSON(t, tt.expected), result.(map[string]any)["corpus"])
+		})
+	}
+}
+
 func TestCorpusQueryDocGroupRefPassthrough(t *testing.T) {
 	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
 
@@ -269,6 +378,33 @@ func TestCorpusQueryCollectionAttribute(t *testing.T) {
 	assert.Equal(t, "fiction", corpus["value"])
 }
 
+func TestCorpusQueryCorpusAndCollection(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel <> genre=fiction", "textClass=poetry <> genre=lyric")
+
+	doc := func(key, value string) map[string]any {
+		return map[string]any{"@type": "koral:doc", "key": key, "value": value, "match": "match:eq"}
+	}
+	input := map[string]any{
+		"corpus":     doc("textClass", "novel"),
+		"collection": doc("textClass", "poetry"),
+		"query":      map[string]any{"@type": "koral:token"},
+		"meta":       map[string]any{"textClass": "novel"},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"corpus":     doc("genre", "fiction"),
+		"collection": doc("genre", "lyric"),
+		"query":      map[string]any{"@type": "koral:token"},
+		"meta":       map[string]any{"textClass": "novel"},
+	}, result)
+
+	// The input is not modified
+	assert.Equal(t, doc("textClass", "novel"), input["corpus"])
+	assert.Equal(t, doc("textClass", "poetry"), input["collection"])
+}
+
 func TestCorpusQuerySingleToGroupReplacement(t *testing.T) {
 	m := newCorpusMapper(t, "textClass=novel <> (genre=fiction & type=book)")
 
@@ -305,7 +441,7 @@ func TestCorpusQueryInvalidRegexFailsAtStartup(t *testing.T) {
 
 func TestCorpusQueryRegexCompiledOnce(t *testing.T) {
 	m := newCorpusMapper(t, "textClass=wissenschaft.*#regex <> genre=science")
-	assert.NotEmpty(t, m.compiledRegexes, "regex cache should be populated at startup")
+	assert.NotEmpty(t, m.snapshot().compiledRegexes, "regex cache should be populated at startup")
 }
 
 func TestCorpusQueryRegexMatch(t *testing.T) {
@@ -327,6 +463,80 @@ func TestCorpusQueryRegexMatch(t *testing.T) {
 	assert.Equal(t, "science", corpus["value"])
 }
 
+func TestCorpusQueryRegexCaptureSubstitution(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		value    string
+		expected string
+	}{
+		{"numbered group", "textClass=wissenschaft_(.*)#regex <> genre=$1", "wissenschaft_physik", "physik"},
+		{"braced group", "textClass=wissenschaft_(.*)#regex <> genre=${1}-science", "wissenschaft_physik", "physik-science"},
+		{"named group", "textClass=(?P<area>[a-z]+)_(?P<topic>[a-z]+)#regex <> genre=${topic}/${area}", "wissenschaft_physik", "physik/wissenschaft"},
+		{"no capture literal", "textClass=wissenschaft_.*#regex <> genre=science", "wissenschaft_physik", "science"},
+		{"no regex keeps reference", "textClass=novel <> genre=$1", "novel", "$1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newCorpusMapper(t, tt.rule)
+
+			input := map[string]any{
+				"corpus": map[string]any{
+					"@type": "koral:doc",
+					"key":   "textClass",
+					"value": tt.value,
+					"match": "match:eq",
+				},
+			}
+			result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+			require.NoError(t, err)
+
+			corpus := result.(map[string]any)["corpus"].(map[string]any)
+			assert.Equal(t, "genre", corpus["key"])
+			assert.Equal(t, tt.expected, corpus["value"])
+		})
+	}
+}
+
+func TestCorpusRegexCaptureOutOfRange(t *testing.T) {
+	for _, rule := range []string{
+		"textClass=wissenschaft_(.*)#regex <> genre=$2",
+		"textClass=wissenschaft_(.*)#regex <> (genre=$1 & topic=${name})",
+	} {
+		_, err := NewMapper([]config.MappingList{{
+			ID:       "corpus-test",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{config.MappingRule(rule)},
+		}})
+		require.Error(t, err, rule)
+		assert.Contains(t, err.Error(), "not defined in pattern")
+	}
+}
+
+func TestCorpusResponseRegexCaptureSubstitution(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=wissenschaft_(.*)#regex <> genre=$1")
+
+	input := map[string]any{
+		"fields": []any{
+			map[string]any{
+				"@type": "koral:field",
+				"key":   "textClass",
+				"value": "wissenschaft_physik",
+				"type":  "type:string",
+			},
+		},
+	}
+	result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	fields := result.(map[string]any)["fields"].([]any)
+	require.Len(t, fields, 2)
+	mapped := fields[1].(map[string]any)
+	assert.Equal(t, "genre", mapped["key"])
+	assert.Equal(t, "physik", mapped["value"])
+}
+
 func TestCorpusQueryRegexNoMatch(t *testing.T) {
 	m := newCorpusMapper(t, "textClass=wissenschaft.*#regex <> genre=science")
 
@@ -346,6 +556,51 @@ func TestCorpusQueryRegexNoMatch(t *testing.T) {
 	assert.Equal(t, "belletristik", corpus["value"])
 }
 
+func TestCorpusQueryColonInValue(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=Wissenschaft:Physik <> topic=science:physics")
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "Wissenschaft:Physik",
+			"match": "match:eq",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "topic", corpus["key"])
+	assert.Equal(t, "science:physics", corpus["value"])
+	assert.Equal(t, "match:eq", corpus["match"])
+
+	// The value is matched in full, not by its prefix
+	input["corpus"].(map[string]any)["value"] = "Wissenschaft"
+	result, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, "textClass", result.(map[string]any)["corpus"].(map[string]any)["key"])
+
+	// The short form keeps the colon in the value, too
+	result, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: BtoA}, map[string]any{
+		"corpus": "topic=science:physics",
+	})
+	require.NoError(t, err)
+	corpus = result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "textClass", corpus["key"])
+	assert.Equal(t, "Wissenschaft:Physik", corpus["value"])
+
+	response, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"fields": []any{
+			map[string]any{"@type": "koral:field", "key": "textClass", "value": "Wissenschaft:Physik", "type": "type:string"},
+		},
+	})
+	require.NoError(t, err)
+	fields := response.(map[string]any)["fields"].([]any)
+	require.Len(t, fields, 2)
+	assert.Equal(t, "topic", fields[1].(map[string]any)["key"])
+	assert.Equal(t, "science:physics", fields[1].(map[string]any)["value"])
+}
+
 func TestCorpusQueryMatchTypeFilter(t *testing.T) {
 	m := newCorpusMapper(t, "pubDate=2020:geq <> yearFrom=2020:geq")
 
@@ -402,6 +657,52 @@ func TestCorpusQueryMatchTypeFilterNoMatch(t *testing.T) {
 	assert.Equal(t, "pubDate", corpus["key"])
 }
 
+func TestCorpusQueryMatchTypeConversion(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel:eq <> genre=fiction:contains")
+
+	doc := func(key, value, match string) map[string]any {
+		d := map[string]any{"@type": "koral:doc", "key": key, "value": value}
+		if match != "" {
+			d["match"] = match
+		}
+		return d
+	}
+	apply := func(t *testing.T, dir Direction, input map[string]any) map[string]any {
+		t.Helper()
+		result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: dir}, map[string]any{"corpus": input})
+		require.NoError(t, err)
+		return result.(map[string]any)["corpus"].(map[string]any)
+	}
+
+	t.Run("AtoB emits the replacement match", func(t *testing.T) {
+		assert.Equal(t, doc("genre", "fiction", "match:contains"), apply(t, AtoB, doc("textClass", "novel", "match:eq")))
+	})
+
+	t.Run("Missing match counts as eq", func(t *testing.T) {
+		assert.Equal(t, doc("genre", "fiction", "match:contains"), apply(t, AtoB, doc("textClass", "novel", "")))
+	})
+
+	t.Run("BtoA converts back", func(t *testing.T) {
+		assert.Equal(t, doc("textClass", "novel", "match:eq"), apply(t, BtoA, doc("genre", "fiction", "match:contains")))
+	})
+
+	t.Run("Other match types are not converted", func(t *testing.T) {
+		assert.Equal(t, doc("textClass", "novel", "match:ne"), apply(t, AtoB, doc("textClass", "novel", "match:ne")))
+		assert.Equal(t, doc("genre", "fiction", "match:eq"), apply(t, BtoA, doc("genre", "fiction", "match:eq")))
+	})
+
+	t.Run("Converted inside a group", func(t *testing.T) {
+		result := apply(t, AtoB, map[string]any{
+			"@type":     "koral:docGroup",
+			"operation": "operation:and",
+			"operands":  []any{doc("textClass", "novel", "match:eq"), doc("author", "Fontane", "match:eq")},
+		})
+		operands := result["operands"].([]any)
+		assert.Equal(t, doc("genre", "fiction", "match:contains"), operands[0])
+		assert.Equal(t, doc("author", "Fontane", "match:eq"), operands[1])
+	})
+}
+
 func TestCorpusQueryRewriteAnnotation(t *testing.T) {
 	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
 
@@ -637,6 +938,152 @@ func TestCorpusQueryNestedDocGroups(t *testing.T) {
 	assert.Equal(t, "genre", innerOperands[0].(map[string]any)["key"])
 }
 
+func TestCorpusQueryIteratesToFixpoint(t *testing.T) {
+	// The second rule feeds the first, so a second pass is needed
+	m := newCorpusMapper(t,
+		"genre=fiction <> category=lit",
+		"textClass=novel <> genre=fiction",
+	)
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "novel",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "category", corpus["key"])
+	assert.Equal(t, "lit", corpus["value"])
+}
+
+func TestCorpusCyclicRulesRejected(t *testing.T) {
+	_, err := NewMapper([]config.MappingList{{
+		ID:   "corpus-test",
+		Type: "corpus",
+		Mappings: []config.MappingRule{
+			"author=Fontane <> author=Goethe",
+			"textClass=novel <> genre=fiction",
+			"genre=fiction <> textClass=novel",
+		},
+	}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic rules in corpus mapping list corpus-test")
+	assert.Contains(t, err.Error(), "rule 1 and rule 2")
+}
+
+func TestCorpusBidirectionalRuleNotCyclic(t *testing.T) {
+	// One rule used in both directions is not a cycle, and neither are
+	// rules sharing only one side
+	m := newCorpusMapper(t,
+		"textClass=novel <> genre=fiction",
+		"textClass=roman <> genre=fiction",
+	)
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "genre",
+			"value": "fiction",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: BtoA}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "textClass", corpus["key"])
+	assert.Equal(t, "novel", corpus["value"])
+}
+
+func TestCorpusQuerySelfContainingReplacement(t *testing.T) {
+	// The replacement contains its own pattern, so the rule applies once
+	m := newCorpusMapper(t, "textClass=novel <> (textClass=novel & genre=fiction)")
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "novel",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "koral:docGroup", corpus["@type"])
+	assert.Equal(t, "operation:and", corpus["operation"])
+	operands := corpus["operands"].([]any)
+	require.Len(t, operands, 2)
+	assert.Equal(t, "textClass", operands[0].(map[string]any)["key"])
+	assert.Equal(t, "novel", operands[0].(map[string]any)["value"])
+	assert.Equal(t, "genre", operands[1].(map[string]any)["key"])
+	assert.Equal(t, "fiction", operands[1].(map[string]any)["value"])
+
+	// The rule is counted once
+	assert.Equal(t, map[int]uint64{0: 1}, m.Stats()["corpus-test"])
+}
+
+func TestCorpusQueryMaxIterationsExceeded(t *testing.T) {
+	// The second rule brings back the pattern of the first, so the tree
+	// grows on every pass
+	m := newCorpusMapper(t,
+		"textClass=novel <> genre=fiction",
+		"genre=fiction <> (textClass=novel & author=Fontane)",
+	)
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "novel",
+		},
+	}
+	_, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Contains(t, err.Error(), "did not reach a stable state within 32 iterations")
+
+	_, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB, MaxIterations: 4}, input)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "within 4 iterations")
+}
+
+func TestCorpusQueryMaxDepth(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
+
+	// nested wraps the matching doc in depth docGroups
+	nested := func(depth int) map[string]any {
+		node := map[string]any{"@type": "koral:doc", "key": "textClass", "value": "novel"}
+		for range depth {
+			node = map[string]any{
+				"@type":     "koral:docGroup",
+				"operation": "operation:and",
+				"operands":  []any{node},
+			}
+		}
+		return map[string]any{"corpus": node}
+	}
+
+	// Each docGroup nests an object and an array
+	_, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB, MaxDepth: 21}, nested(10))
+	require.NoError(t, err)
+
+	_, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB, MaxDepth: 20}, nested(10))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Contains(t, err.Error(), "corpus exceeds the maximum nesting depth of 20")
+
+	_, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, nested(200))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "maximum nesting depth of 256")
+
+	_, err = m.MatchingRules("corpus-test", AtoB, nested(200))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
 // --- Corpus response mapping tests ---
 
 func TestCorpusResponseSimpleFieldEnrichment(t *testing.T) {
@@ -688,6 +1135,49 @@ func TestCorpusResponseNoMatch(t *testing.T) {
 	require.Len(t, fields, 1)
 }
 
+func TestCorpusResponseTagFilter(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:   "corpus-test",
+		Type: "corpus",
+		Mappings: []config.MappingRule{
+			"textClass=novel <> genre=fiction",
+			"textClass=poem <> genre=poetry",
+			"(textClass=novel & textClass=poem) <> genre=anthology",
+		},
+		RuleMeta: []config.RuleMeta{{Tags: []string{"a"}}, {Tags: []string{"b"}}, {Tags: []string{"b"}}},
+	}})
+	require.NoError(t, err)
+
+	apply := func(tags ...string) []string {
+		input := map[string]any{
+			"fields": []any{
+				map[string]any{
+					"@type": "koral:field",
+					"key":   "textClass",
+					"value": []any{"novel", "poem"},
+					"type":  "type:keywords",
+				},
+			},
+		}
+		result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB, Tags: tags}, input)
+		require.NoError(t, err)
+
+		var values []string
+		for _, field := range result.(map[string]any)["fields"].([]any)[1:] {
+			values = append(values, field.(map[string]any)["value"].(string))
+		}
+		return values
+	}
+
+	// Without tags all rules apply
+	assert.ElementsMatch(t, []string{"fiction", "poetry", "anthology"}, apply())
+
+	// Only rules with an intersecting tag apply, including group patterns
+	assert.Equal(t, []string{"fiction"}, apply("a"))
+	assert.ElementsMatch(t, []string{"poetry", "anthology"}, apply("b"))
+	assert.Empty(t, apply("other"))
+}
+
 func TestCorpusResponseMultiValuedField(t *testing.T) {
 	m := newCorpusMapper(t,
 		"textClass=wissenschaft <> genre=science",
@@ -723,6 +1213,126 @@ func TestCorpusResponseMultiValuedField(t *testing.T) {
 	assert.Equal(t, "notinindex", mapped2["comment"])
 }
 
+func TestCorpusResponseDeduplicateFields(t *testing.T) {
+	m := newCorpusMapper(t,
+		"textClass=novel <> genre=fiction",
+		"textClass=roman <> genre=fiction",
+	)
+
+	input := func() any {
+		return map[string]any{
+			"fields": []any{
+				map[string]any{"@type": "koral:field", "key": "textClass", "value": "novel", "type": "type:string"},
+				map[string]any{"@type": "koral:field", "key": "textClass", "value": "roman", "type": "type:string"},
+				map[string]any{"@type": "koral:field", "key": "title", "value": "Faust", "type": "type:string"},
+			},
+		}
+	}
+
+	result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	assert.Len(t, result.(map[string]any)["fields"].([]any), 5)
+
+	result, err = m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB, DeduplicateFields: true}, input())
+	require.NoError(t, err)
+
+	fields := result.(map[string]any)["fields"].([]any)
+	require.Len(t, fields, 4)
+	assert.Equal(t, "novel", fields[0].(map[string]any)["value"])
+	assert.Equal(t, "genre", fields[1].(map[string]any)["key"])
+	assert.Equal(t, "fiction", fields[1].(map[string]any)["value"])
+	assert.Equal(t, "roman", fields[2].(map[string]any)["value"])
+	assert.Equal(t, "title", fields[3].(map[string]any)["key"])
+}
+
+func TestCorpusResponseDeduplicateExistingField(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
+
+	input := map[string]any{
+		"fields": []any{
+			map[string]any{"@type": "koral:field", "key": "genre", "value": []any{"drama", "fiction"}, "type": "type:keywords"},
+			map[string]any{"@type": "koral:field", "key": "textClass", "value": "novel", "type": "type:string"},
+		},
+	}
+
+	result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB, DeduplicateFields: true}, input)
+	require.NoError(t, err)
+	assert.Len(t, result.(map[string]any)["fields"].([]any), 2)
+}
+
+func TestCorpusResponseIncludeProvenance(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:   "corpus-test",
+		Type: "corpus",
+		Mappings: []config.MappingRule{
+			"textClass=novel <> genre=fiction",
+			"textClass=roman <> lang=fr",
+			"(textClass=novel & title=Faust) <> work=faust",
+		},
+		RuleMeta: []config.RuleMeta{{}, {ID: "roman"}, {}},
+	}})
+	require.NoError(t, err)
+
+	input := func() any {
+		return map[string]any{
+			"fields": []any{
+				map[string]any{"@type": "koral:field", "key": "textClass", "value": "novel", "type": "type:string"},
+				map[string]any{"@type": "koral:field", "key": "textClass", "value": "roman", "type": "type:string"},
+				map[string]any{"@type": "koral:field", "key": "title", "value": "Faust", "type": "type:string"},
+			},
+		}
+	}
+
+	result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB, IncludeProvenance: true}, input())
+	require.NoError(t, err)
+
+	provenance := map[string]any{}
+	for _, field := range result.(map[string]any)["fields"].([]any) {
+		fieldMap := field.(map[string]any)
+		if fieldMap["mapped"] == true {
+			provenance[fieldMap["key"].(string)+"="+fieldMap["value"].(string)] = fieldMap["mappedBy"]
+		} else {
+			assert.NotContains(t, fieldMap, "mappedBy")
+		}
+	}
+	assert.Equal(t, map[string]any{
+		"genre=fiction": map[string]any{"list": "corpus-test", "rule": 0},
+		"lang=fr":       map[string]any{"list": "corpus-test", "rule": 1, "id": "roman"},
+		"work=faust":    map[string]any{"list": "corpus-test", "rule": 2},
+	}, provenance)
+
+	// Without the option, mapped fields carry no provenance
+	result, err = m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	for _, field := range result.(map[string]any)["fields"].([]any) {
+		assert.NotContains(t, field.(map[string]any), "mappedBy")
+	}
+}
+
+func TestCorpusResponseMatchesArray(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
+
+	input := parseJSON(t, `{
+		"matches": [
+			{"matchID": "match-1", "fields": [{"@type": "koral:field", "key": "textClass", "value": "novel", "type": "type:string"}]},
+			{"matchID": "match-2", "fields": [{"@type": "koral:field", "key": "textClass", "value": "drama", "type": "type:string"}]}
+		]
+	}`)
+
+	result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	matches := result.(map[string]any)["matches"].([]any)
+	require.Len(t, matches, 2)
+
+	fields := matches[0].(map[string]any)["fields"].([]any)
+	require.Len(t, fields, 2)
+	assert.Equal(t, "genre", fields[1].(map[string]any)["key"])
+	assert.Equal(t, "fiction", fields[1].(map[string]any)["value"])
+
+	assert.Len(t, matches[1].(map[string]any)["fields"].([]any), 1)
+}
+
 func TestCorpusResponseWikiDeReKoFixtureEnrichment(t *testing.T) {
 	cfg, err := config.LoadFromSources("", []string{"../mappings/wiki-dereko.yaml"})
 	require.NoError(t, err)
@@ -1676,7 +2286,7 @@ func TestAddCorpusRewriteKeyScope(t *testing.T) {
 		"value": "novel",
 	}
 
-	addCorpusRewrite(replaced, original)
+	addCorpusRewrite(ast.Rewrite{Editor: RewriteEditor}, replaced, original)
 
 	rewrites, ok := replaced["rewrites"].([]any)
 	require.True(t, ok)
@@ -1705,7 +2315,7 @@ func TestAddCorpusRewriteValueScope(t *testing.T) {
 		"value": "novel",
 	}
 
-	addCorpusRewrite(replaced, original)
+	addCorpusRewrite(ast.Rewrite{Editor: RewriteEditor}, replaced, original)
 
 	rewrites, ok := replaced["rewrites"].([]any)
 	require.True(t, ok)
@@ -1737,7 +2347,7 @@ func TestAddCorpusRewriteGroupOriginal(t *testing.T) {
 		},
 	}
 
-	addCorpusRewrite(replaced, original)
+	addCorpusRewrite(ast.Rewrite{Editor: RewriteEditor}, replaced, original)
 
 	rewrites, ok := replaced["rewrites"].([]any)
 	require.True(t, ok)
@@ -1794,3 +2404,441 @@ func TestCorpusRewriteGroupOriginalRoundTripsAsAstRewrite(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, "koral:docGroup", originalMap["@type"])
 }
+
+func TestCorpusWildcardKeyMatchesAnyKey(t *testing.T) {
+	m := newCorpusMapper(t, "*=novel <> genre=fiction")
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "novel",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "genre", corpus["key"])
+	assert.Equal(t, "fiction", corpus["value"])
+}
+
+func TestCorpusWildcardKeyNoMatch(t *testing.T) {
+	m := newCorpusMapper(t, "*=novel <> genre=fiction")
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "poem",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "textClass", corpus["key"])
+	assert.Equal(t, "poem", corpus["value"])
+}
+
+func TestCorpusWildcardKeyInReplacementKeepsKey(t *testing.T) {
+	m := newCorpusMapper(t, "*=novel <> *=fiction")
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "novel",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "textClass", corpus["key"])
+	assert.Equal(t, "fiction", corpus["value"])
+}
+
+func TestCorpusExplicitKeyRuleTakesPrecedenceOverWildcard(t *testing.T) {
+	// Rules apply in file order, so an explicit rule listed first wins
+	m := newCorpusMapper(t,
+		"textClass=novel <> category=lit",
+		"*=novel <> genre=fiction",
+	)
+
+	input := map[string]any{
+		"corpus": map[string]any{
+			"@type": "koral:doc",
+			"key":   "textClass",
+			"value": "novel",
+		},
+	}
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	corpus := result.(map[string]any)["corpus"].(map[string]any)
+	assert.Equal(t, "category", corpus["key"])
+	assert.Equal(t, "lit", corpus["value"])
+}
+
+func TestCorpusResponseContains(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []string
+		value  any
+		mapped []string // values of the mapped genre fields
+	}{
+		{
+			name:   "Array membership",
+			rules:  []string{"textClass=novel:contains <> genre=fiction"},
+			value:  []any{"poetry", "novel"},
+			mapped: []string{"fiction"},
+		},
+		{
+			name:   "Substring of an array value",
+			rules:  []string{"textClass=novel:contains <> genre=fiction"},
+			value:  []any{"poetry", "graphic-novel"},
+			mapped: []string{"fiction"},
+		},
+		{
+			name:   "Several matching values add the field per value",
+			rules:  []string{"textClass=novel:contains <> genre=fiction"},
+			value:  []any{"novel", "graphic-novel"},
+			mapped: []string{"fiction", "fiction"},
+		},
+		{
+			name:   "Substring of a single value",
+			rules:  []string{"textClass=novel:contains <> genre=fiction"},
+			value:  "short-novel",
+			mapped: []string{"fiction"},
+		},
+		{
+			name:  "No value contains the pattern",
+			rules: []string{"textClass=novel:contains <> genre=fiction"},
+			value: []any{"poetry", "drama"},
+		},
+		{
+			name:  "Without the modifier only equal values match",
+			rules: []string{"textClass=novel <> genre=fiction"},
+			value: []any{"graphic-novel"},
+		},
+		{
+			name:   "Inside an AND group",
+			rules:  []string{"(textClass=novel:contains & textClass=poetry) <> genre=mixed"},
+			value:  []any{"poetry", "graphic-novel"},
+			mapped: []string{"mixed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newCorpusMapper(t, tt.rules...)
+
+			input := map[string]any{
+				"fields": []any{
+					map[string]any{
+						"@type": "koral:field",
+						"key":   "textClass",
+						"value": tt.value,
+						"type":  "type:keywords",
+					},
+				},
+			}
+			result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input)
+			require.NoError(t, err)
+
+			var mapped []string
+			for _, field := range result.(map[string]any)["fields"].([]any)[1:] {
+				assert.Equal(t, "genre", field.(map[string]any)["key"])
+				mapped = append(mapped, field.(map[string]any)["value"].(string))
+			}
+			assert.Equal(t, tt.mapped, mapped)
+		})
+	}
+
+	t.Run("Several matching values with DeduplicateFields", func(t *testing.T) {
+		m := newCorpusMapper(t, "textClass=novel:contains <> genre=fiction")
+		input := map[string]any{
+			"fields": []any{
+				map[string]any{
+					"@type": "koral:field",
+					"key":   "textClass",
+					"value": []any{"novel", "graphic-novel"},
+					"type":  "type:keywords",
+				},
+			},
+		}
+		result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB, DeduplicateFields: true}, input)
+		require.NoError(t, err)
+
+		fields := result.(map[string]any)["fields"].([]any)
+		require.Len(t, fields, 2)
+		assert.Equal(t, "fiction", fields[1].(map[string]any)["value"])
+	})
+}
+
+func TestCorpusResponseInsertAfterSource(t *testing.T) {
+	m := newCorpusMapper(t,
+		"(genre=fiction & region=de) <> textClass=kultur",
+		"author=Fontane <> creator=fontane",
+	)
+
+	field := func(key, value string) map[string]any {
+		return map[string]any{
+			"@type": "koral:field",
+			"key":   key,
+			"value": value,
+			"type":  "type:string",
+		}
+	}
+	input := func() map[string]any {
+		return map[string]any{
+			"fields": []any{
+				field("genre", "fiction"),
+				field("region", "de"),
+				field("author", "Fontane"),
+				field("title", "Effi Briest"),
+			},
+		}
+	}
+	keys := func(result any) []string {
+		var keys []string
+		for _, f := range result.(map[string]any)["fields"].([]any) {
+			keys = append(keys, f.(map[string]any)["key"].(string))
+		}
+		return keys
+	}
+
+	result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"genre", "region", "author", "creator", "title", "textClass"}, keys(result))
+
+	result, err = m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB, InsertAfterSource: true}, input())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"genre", "region", "textClass", "author", "creator", "title"}, keys(result))
+}
+
+func TestCorpusQueryNotEqualGuard(t *testing.T) {
+	m := newCorpusMapper(t, "textClass!=public <> restricted=true")
+
+	doc := func(key, value, match string) map[string]any {
+		return map[string]any{"@type": "koral:doc", "key": key, "value": value, "match": match}
+	}
+	and := func(operands ...any) map[string]any {
+		return map[string]any{"@type": "koral:docGroup", "operation": "operation:and", "operands": operands}
+	}
+
+	tests := []struct {
+		name     string
+		dir      Direction
+		corpus   any
+		expected any
+	}{
+		{
+			name:     "different value adds the mapped field",
+			dir:      AtoB,
+			corpus:   doc("textClass", "science", "match:eq"),
+			expected: and(doc("textClass", "science", "match:eq"), doc("restricted", "true", "match:eq")),
+		},
+		{
+			name:     "guarded value is left untouched",
+			dir:      AtoB,
+			corpus:   doc("textClass", "public", "match:eq"),
+			expected: doc("textClass", "public", "match:eq"),
+		},
+		{
+			name:     "other keys are left untouched",
+			dir:      AtoB,
+			corpus:   doc("author", "Fontane", "match:eq"),
+			expected: doc("author", "Fontane", "match:eq"),
+		},
+		{
+			name:     "fields without a stated value are left untouched",
+			dir:      AtoB,
+			corpus:   doc("textClass", "news", "match:ne"),
+			expected: doc("textClass", "news", "match:ne"),
+		},
+		{
+			name:   "operands of groups are guarded individually",
+			dir:    AtoB,
+			corpus: and(doc("textClass", "science", "match:eq"), doc("textClass", "public", "match:eq")),
+			expected: and(
+				and(doc("textClass", "science", "match:eq"), doc("restricted", "true", "match:eq")),
+				doc("textClass", "public", "match:eq"),
+			),
+		},
+		{
+			name:     "reverse direction emits a not-equal field",
+			dir:      BtoA,
+			corpus:   doc("restricted", "true", "match:eq"),
+			expected: doc("textClass", "public", "match:ne"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: tt.dir}, map[string]any{
+				"corpus": tt.corpus,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.(map[string]any)["corpus"])
+		})
+	}
+}
+
+func TestCorpusQueryNotEqualGuardInGroup(t *testing.T) {
+	m := newCorpusMapper(t, "(textClass!=public & corpusSigle=GOE) <> restricted=true")
+
+	doc := func(key, value string) map[string]any {
+		return map[string]any{"@type": "koral:doc", "key": key, "value": value, "match": "match:eq"}
+	}
+	and := func(operands ...any) map[string]any {
+		return map[string]any{"@type": "koral:docGroup", "operation": "operation:and", "operands": operands}
+	}
+
+	// The whole matched group is kept and combined with the replacement
+	matching := and(doc("corpusSigle", "GOE"), doc("textClass", "science"))
+	result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"corpus": matching,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, and(matching, map[string]any{"@type": "koral:doc", "key": "restricted", "value": "true"}), result.(map[string]any)["corpus"])
+
+	guarded := and(doc("corpusSigle", "GOE"), doc("textClass", "public"))
+	result, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"corpus": guarded,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, guarded, result.(map[string]any)["corpus"])
+}
+
+func TestCorpusResponseFieldPaths(t *testing.T) {
+	field := func(key, value string) map[string]any {
+		return map[string]any{"@type": "koral:field", "key": key, "value": value, "type": "type:string"}
+	}
+	input := func() map[string]any {
+		return map[string]any{
+			"meta": map[string]any{"version": "1"},
+			"document": map[string]any{
+				"title":  "Faust",
+				"fields": []any{field("textClass", "novel")},
+			},
+			"result": map[string]any{
+				"metadata": map[string]any{
+					"fields": []any{field("textClass", "novel")},
+				},
+			},
+		}
+	}
+
+	t.Run("document fields by default", func(t *testing.T) {
+		m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
+		original := input()
+		result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, original)
+		require.NoError(t, err)
+
+		resultMap := result.(map[string]any)
+		document := resultMap["document"].(map[string]any)
+		assert.Equal(t, "Faust", document["title"])
+		fields := document["fields"].([]any)
+		require.Len(t, fields, 2)
+		assert.Equal(t, "genre", fields[1].(map[string]any)["key"])
+		assert.Equal(t, original["result"], resultMap["result"])
+
+		// The input is not modified
+		assert.Len(t, original["document"].(map[string]any)["fields"], 1)
+	})
+
+	t.Run("configured paths", func(t *testing.T) {
+		m, err := NewMapper([]config.MappingList{{
+			ID:       "corpus-test",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{"textClass=novel <> genre=fiction"},
+		}}, WithFieldPaths("fields", "result.metadata.fields"))
+		require.NoError(t, err)
+
+		result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, input())
+		require.NoError(t, err)
+
+		resultMap := result.(map[string]any)
+		assert.Len(t, resultMap["document"].(map[string]any)["fields"], 1)
+		fields := resultMap["result"].(map[string]any)["metadata"].(map[string]any)["fields"].([]any)
+		require.Len(t, fields, 2)
+		assert.Equal(t, "fiction", fields[1].(map[string]any)["value"])
+	})
+
+	t.Run("other shapes pass through", func(t *testing.T) {
+		m := newCorpusMapper(t, "textClass=novel <> genre=fiction")
+		for _, other := range []map[string]any{
+			{"document": "not an object"},
+			{"document": map[string]any{"fields": "not an array"}},
+			{"metadata": map[string]any{"fields": []any{field("textClass", "novel")}}},
+		} {
+			result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, other)
+			require.NoError(t, err)
+			assert.Equal(t, other, result)
+		}
+	})
+}
+
+func TestCorpusNegatedRegex(t *testing.T) {
+	m := newCorpusMapper(t, "textClass=.*wissenschaft.*#regex! <> domain=general")
+
+	doc := func(key, value string) map[string]any {
+		return map[string]any{"@type": "koral:doc", "key": key, "value": value, "match": "match:eq"}
+	}
+	and := func(operands ...any) map[string]any {
+		return map[string]any{"@type": "koral:docGroup", "operation": "operation:and", "operands": operands}
+	}
+
+	t.Run("query", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			corpus   any
+			expected any
+		}{
+			{
+				name:     "value not matching the regex",
+				corpus:   doc("textClass", "kultur"),
+				expected: and(doc("textClass", "kultur"), doc("domain", "general")),
+			},
+			{
+				name:     "value matching the regex",
+				corpus:   doc("textClass", "naturwissenschaften"),
+				expected: doc("textClass", "naturwissenschaften"),
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+					"corpus": tt.corpus,
+				})
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, result.(map[string]any)["corpus"])
+			})
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		field := func(value string) map[string]any {
+			return map[string]any{"@type": "koral:field", "key": "textClass", "value": value, "type": "type:string"}
+		}
+		result, err := m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+			"fields": []any{field("kultur")},
+		})
+		require.NoError(t, err)
+		fields := result.(map[string]any)["fields"].([]any)
+		require.Len(t, fields, 2)
+		assert.Equal(t, "domain", fields[1].(map[string]any)["key"])
+
+		result, err = m.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+			"fields": []any{field("naturwissenschaften")},
+		})
+		require.NoError(t, err)
+		assert.Len(t, result.(map[string]any)["fields"].([]any), 1)
+	})
+
+	// The regex is compiled once and shared with the plain regex rule
+	shared := newCorpusMapper(t, "textClass=.*wissenschaft.*#regex <> domain=science", "textClass=.*wissenschaft.*#regex! <> domain=general")
+	assert.Len(t, shared.snapshot().compiledRegexes, 1)
+}
@@ -0,0 +1,79 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMappingNotFound is matched by errors for unknown mapping list IDs.
+	ErrMappingNotFound = errors.New("mapping list not found")
+
+	// ErrInvalidInput is matched by errors for input that cannot be parsed
+	// and for options that fail validation.
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// kindError tags an error with one of the sentinel errors above, so
+// callers can classify it with errors.Is while the message stays unchanged.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind tags err with kind.
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// errMappingNotFound returns the error for an unknown mapping list ID.
+func errMappingNotFound(mappingID string) error {
+	return withKind(ErrMappingNotFound, fmt.Errorf("mapping list with ID %s not found", mappingID))
+}
+
+// StepError is the error of a failed step of a cascade.
+type StepError struct {
+	Step      int    // index of the step in the cascade
+	MappingID string // ID of the mapping list applied in the step
+	Err       error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("cascade step %d (mapping %q): %v", e.Step, e.MappingID, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// SkippedStepsError is returned along with the result of a cascade if
+// steps with MappingOptions.ContinueOnError failed. The result is the
+// one of the cascade without the failed steps.
+type SkippedStepsError struct {
+	Steps []*StepError
+}
+
+func (e *SkippedStepsError) Error() string {
+	messages := make([]string, len(e.Steps))
+	for i, step := range e.Steps {
+		messages[i] = step.Error()
+	}
+	return fmt.Sprintf("skipped %d failed cascade steps: %s", len(e.Steps), strings.Join(messages, "; "))
+}
+
+func (e *SkippedStepsError) Unwrap() []error {
+	errs := make([]error, len(e.Steps))
+	for i, step := range e.Steps {
+		errs[i] = step
+	}
+	return errs
+}
@@ -1,9 +1,15 @@
 package mapper
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 
+	"github.com/KorAP/Koral-Mapper/ast"
 	"github.com/KorAP/Koral-Mapper/config"
 	"github.com/KorAP/Koral-Mapper/parser"
 )
@@ -16,6 +22,22 @@ const (
 	BtoA Direction = false
 
 	RewriteEditor = "Koral-Mapper"
+
+	// DefaultMaxIterations bounds the number of passes over the rules
+	// of a corpus mapping list when no other limit is given
+	DefaultMaxIterations = 32
+
+	// DefaultNotInIndexClass is the class of spans injected into response
+	// snippets, marking annotations that are not part of the index
+	DefaultNotInIndexClass = "notinindex"
+
+	// DefaultPassthroughID is the mapping ID that returns the input
+	// unchanged when no other ID is set with WithPassthroughID
+	DefaultPassthroughID = "passthrough"
+
+	// DefaultSnippetAttr is the span attribute of response snippets
+	// annotations are read from and written to
+	DefaultSnippetAttr = "title"
 )
 
 // String converts the Direction to its string representation
@@ -34,59 +56,358 @@ func ParseDirection(dir string) (Direction, error) {
 	case "btoa":
 		return BtoA, nil
 	default:
-		return false, fmt.Errorf("invalid direction: %s", dir)
+		return false, withKind(ErrInvalidInput, fmt.Errorf("invalid direction: %s", dir))
 	}
 }
 
+// Mode selects how matched corpus query nodes are rewritten
+type Mode string
+
+const (
+	// ModeReplace replaces a matched node with the mapped node
+	ModeReplace Mode = "replace"
+
+	// ModeAppend keeps a matched node and adds the mapped node, combined
+	// in a docGroup with operation:and
+	ModeAppend Mode = "append"
+)
+
 // Mapper handles the application of mapping rules to JSON objects
 type Mapper struct {
 	mappingLists      map[string]*config.MappingList
+	aliases           map[string]string // list ID by alias
 	parsedQueryRules  map[string][]*parser.MappingResult
 	parsedCorpusRules map[string][]*parser.CorpusMappingResult
 	compiledRegexes   map[string]*regexp.Regexp
+	editorName        string
+	queryKeys         []string
+	fieldPaths        [][]string
+	referenceKeys     []string
+	passthroughID     string
+	snippetAttr       string
+
+	// ruleCounts holds the number of applications per rule of each list
+	ruleCounts map[string][]atomic.Uint64
+
+	// live holds the state with the current mapping lists, swapped as
+	// a whole by Reload. The state is itself a Mapper without live.
+	live atomic.Pointer[Mapper]
 }
 
-// NewMapper creates a new Mapper instance from a list of MappingLists
-func NewMapper(lists []config.MappingList) (*Mapper, error) {
+// Option configures a Mapper created by NewMapper.
+type Option func(*Mapper)
+
+// WithEditorName sets the editor emitted in koral:rewrite annotations.
+// An empty name keeps RewriteEditor.
+func WithEditorName(name string) Option {
+	return func(m *Mapper) {
+		if name != "" {
+			m.editorName = name
+		}
+	}
+}
+
+// WithQueryKeys sets the keys of wrapper objects the annotation query
+// is looked up under, in order of precedence. Without keys, "query" is
+// used. Inputs without any of the keys are treated as bare query nodes.
+func WithQueryKeys(keys ...string) Option {
+	return func(m *Mapper) {
+		if len(keys) > 0 {
+			m.queryKeys = keys
+		}
+	}
+}
+
+// WithFieldPaths sets the dot-separated paths of the fields arrays in
+// responses enriched by corpus lists, in order of precedence. The first
+// path leading to an array is used. Without paths, "fields" and
+// "document.fields" are used.
+func WithFieldPaths(paths ...string) Option {
+	return func(m *Mapper) {
+		if len(paths) == 0 {
+			return
+		}
+		m.fieldPaths = make([][]string, len(paths))
+		for i, path := range paths {
+			m.fieldPaths[i] = strings.Split(path, ".")
+		}
+	}
+}
+
+// WithReferenceKeys sets the keys of response objects, e.g. "matchInfo",
+// whose annotation references are mapped by annotation lists. Strings of
+// the form "foundry/layer:key" or "foundry/layer:key:value" anywhere below
+// the keys are replaced by the annotation of the first rule matching them.
+// Without keys, no references are mapped.
+func WithReferenceKeys(keys ...string) Option {
+	return func(m *Mapper) {
+		m.referenceKeys = keys
+	}
+}
+
+// WithPassthroughID sets the mapping ID that applies no rules and returns
+// the input unchanged, without a mapping list of that ID. A mapping list
+// with the ID takes precedence. An empty ID keeps DefaultPassthroughID.
+func WithPassthroughID(id string) Option {
+	return func(m *Mapper) {
+		if id != "" {
+			m.passthroughID = id
+		}
+	}
+}
+
+// WithSnippetAttr sets the span attribute annotations of response
+// snippets are read from and written to, e.g. "class" for renderers
+// encoding annotations as classes. An empty name keeps
+// DefaultSnippetAttr.
+func WithSnippetAttr(name string) Option {
+	return func(m *Mapper) {
+		if name != "" {
+			m.snippetAttr = name
+		}
+	}
+}
+
+// NewMapper creates a new Mapper instance from a list of MappingLists.
+// Lists disabled with "enabled: false" are skipped.
+func NewMapper(lists []config.MappingList, options ...Option) (*Mapper, error) {
 	m := &Mapper{
+		editorName:    RewriteEditor,
+		queryKeys:     []string{"query"},
+		fieldPaths:    [][]string{{"fields"}, {"document", "fields"}},
+		passthroughID: DefaultPassthroughID,
+		snippetAttr:   DefaultSnippetAttr,
+	}
+	for _, option := range options {
+		option(m)
+	}
+
+	if err := m.Reload(lists); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload replaces the mapping lists of the mapper, keeping its options.
+// The lists are parsed into a new state that is swapped in as a whole,
+// so transformations running concurrently finish with the lists they
+// started with. If a list is invalid, the previous lists stay in place.
+// Rule statistics start over with the new lists.
+func (m *Mapper) Reload(lists []config.MappingList) error {
+	next := &Mapper{
 		mappingLists:      make(map[string]*config.MappingList),
+		aliases:           make(map[string]string),
 		parsedQueryRules:  make(map[string][]*parser.MappingResult),
 		parsedCorpusRules: make(map[string][]*parser.CorpusMappingResult),
 		compiledRegexes:   make(map[string]*regexp.Regexp),
+		editorName:        m.editorName,
+		queryKeys:         m.queryKeys,
+		fieldPaths:        m.fieldPaths,
+		referenceKeys:     m.referenceKeys,
+		passthroughID:     m.passthroughID,
+		snippetAttr:       m.snippetAttr,
+		ruleCounts:        make(map[string][]atomic.Uint64),
 	}
 
 	for _, list := range lists {
-		if _, exists := m.mappingLists[list.ID]; exists {
-			return nil, fmt.Errorf("duplicate mapping list ID found: %s", list.ID)
+		if !list.IsEnabled() {
+			continue
+		}
+		if _, exists := next.mappingLists[list.ID]; exists {
+			return fmt.Errorf("duplicate mapping list ID found: %s", list.ID)
 		}
 
 		listCopy := list
-		m.mappingLists[list.ID] = &listCopy
+		next.mappingLists[list.ID] = &listCopy
 
-		if list.IsCorpus() {
+		// Mixed lists hold both kinds of rules, with nil entries for the
+		// rules of the other kind, so both are indexed like the rules
+		next.ruleCounts[list.ID] = make([]atomic.Uint64, len(list.Mappings))
+		if list.IsCorpus() || list.IsMixed() {
 			corpusRules, err := list.ParseCorpusMappings()
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse corpus mappings for list %s: %w", list.ID, err)
+				return fmt.Errorf("failed to parse corpus mappings for list %s: %w", list.ID, err)
 			}
 			for _, rule := range corpusRules {
-				if err := m.precompileCorpusRegexes(rule.Upper); err != nil {
-					return nil, fmt.Errorf("invalid regex in corpus mapping list %s: %w", list.ID, err)
+				if rule == nil {
+					continue
 				}
-				if err := m.precompileCorpusRegexes(rule.Lower); err != nil {
-					return nil, fmt.Errorf("invalid regex in corpus mapping list %s: %w", list.ID, err)
+				if err := next.precompileCorpusRegexes(rule.Upper); err != nil {
+					return fmt.Errorf("invalid regex in corpus mapping list %s: %w", list.ID, err)
+				}
+				if err := next.precompileCorpusRegexes(rule.Lower); err != nil {
+					return fmt.Errorf("invalid regex in corpus mapping list %s: %w", list.ID, err)
 				}
 			}
-			m.parsedCorpusRules[list.ID] = corpusRules
-		} else {
+			for i, rule := range corpusRules {
+				if rule == nil {
+					continue
+				}
+				if err := next.validateGroupReferences(rule.Upper, rule.Lower); err != nil {
+					return fmt.Errorf("invalid %s in corpus mapping list %s: %w", list.RuleLabel(i), list.ID, err)
+				}
+				if err := next.validateGroupReferences(rule.Lower, rule.Upper); err != nil {
+					return fmt.Errorf("invalid %s in corpus mapping list %s: %w", list.RuleLabel(i), list.ID, err)
+				}
+			}
+			if err := detectCorpusRuleCycle(&list, corpusRules); err != nil {
+				return fmt.Errorf("cyclic rules in corpus mapping list %s: %w", list.ID, err)
+			}
+			next.parsedCorpusRules[list.ID] = corpusRules
+		}
+		if !list.IsCorpus() {
 			queryRules, err := list.ParseMappings()
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse mappings for list %s: %w", list.ID, err)
+				return fmt.Errorf("failed to parse mappings for list %s: %w", list.ID, err)
 			}
-			m.parsedQueryRules[list.ID] = queryRules
+			if err := checkAllowedNames(&list, queryRules); err != nil {
+				return fmt.Errorf("invalid mappings for list %s: %w", list.ID, err)
+			}
+			next.parsedQueryRules[list.ID] = queryRules
 		}
 	}
 
-	return m, nil
+	// Aliases are resolved to the ID of their list, so they share its
+	// parsed rules and statistics
+	for _, list := range lists {
+		if !list.IsEnabled() {
+			continue
+		}
+		for _, alias := range list.Aliases {
+			if _, exists := next.mappingLists[alias]; exists {
+				return fmt.Errorf("alias %s of mapping list %s collides with a mapping list ID", alias, list.ID)
+			}
+			if other, exists := next.aliases[alias]; exists && other != list.ID {
+				return fmt.Errorf("alias %s of mapping list %s is already an alias of mapping list %s", alias, list.ID, other)
+			}
+			next.aliases[alias] = list.ID
+		}
+	}
+
+	m.live.Store(next)
+	return nil
+}
+
+// snapshot returns the state of the mapper holding the mapping lists
+// live at the time of the call. A snapshot is never modified, so every
+// exported method works on the snapshot taken when it is called.
+func (m *Mapper) snapshot() *Mapper {
+	if live := m.live.Load(); live != nil {
+		return live
+	}
+	return m
+}
+
+// checkAllowedNames fails if a term of the rules uses a foundry or
+// layer missing in the allowedFoundries or allowedLayers of the list,
+// if these are set. Terms without a foundry or layer are not checked.
+func checkAllowedNames(list *config.MappingList, rules []*parser.MappingResult) error {
+	if len(list.AllowedFoundries) == 0 && len(list.AllowedLayers) == 0 {
+		return nil
+	}
+	var check func(node ast.Node) error
+	check = func(node ast.Node) error {
+		switch n := node.(type) {
+		case *ast.Token:
+			if n != nil && n.Wrap != nil {
+				return check(n.Wrap)
+			}
+		case *ast.TermGroup:
+			for _, op := range n.Operands {
+				if err := check(op); err != nil {
+					return err
+				}
+			}
+		case *ast.Term:
+			if n.Foundry != "" && len(list.AllowedFoundries) > 0 && !slices.Contains(list.AllowedFoundries, n.Foundry) {
+				return fmt.Errorf("foundry '%s' is not in allowedFoundries %v", n.Foundry, list.AllowedFoundries)
+			}
+			if n.Layer != "" && len(list.AllowedLayers) > 0 && !slices.Contains(list.AllowedLayers, n.Layer) {
+				return fmt.Errorf("layer '%s' is not in allowedLayers %v", n.Layer, list.AllowedLayers)
+			}
+		}
+		return nil
+	}
+	for i, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		for _, side := range []*ast.Token{rule.Upper, rule.Lower} {
+			if err := check(side); err != nil {
+				return fmt.Errorf("%s: %w", list.RuleLabel(i), err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveAlias returns the ID of the mapping list with the alias
+// mappingID, or mappingID itself if it is no alias.
+func (m *Mapper) resolveAlias(mappingID string) string {
+	if id, ok := m.aliases[mappingID]; ok {
+		return id
+	}
+	return mappingID
+}
+
+// Stats returns the number of applications of each rule, by mapping list
+// ID and rule index. Rules that were never applied are left out.
+func (m *Mapper) Stats() map[string]map[int]uint64 {
+	m = m.snapshot()
+	stats := make(map[string]map[int]uint64)
+	for id, counts := range m.ruleCounts {
+		for i := range counts {
+			n := counts[i].Load()
+			if n == 0 {
+				continue
+			}
+			if stats[id] == nil {
+				stats[id] = make(map[int]uint64)
+			}
+			stats[id][i] = n
+		}
+	}
+	return stats
+}
+
+// ruleDirection returns the direction restriction of the rule at
+// ruleIndex of the mapping list.
+func (m *Mapper) ruleDirection(mappingID string, ruleIndex int) parser.RuleDirection {
+	if rules := m.parsedCorpusRules[mappingID]; ruleIndex < len(rules) && rules[ruleIndex] != nil {
+		return rules[ruleIndex].Direction
+	}
+	if rules := m.parsedQueryRules[mappingID]; ruleIndex < len(rules) && rules[ruleIndex] != nil {
+		return rules[ruleIndex].Direction
+	}
+	return parser.Bidirectional
+}
+
+// detectCorpusRuleCycle reports pairs of corpus rules that undo each other
+// when applied in the same direction, like "a <> b" followed by "b <> a".
+// Corpus rules are applied repeatedly, so such a pair only flips the
+// tree back and forth. A single rule is always usable in both directions,
+// as are two rules restricted to opposite directions. Rules are named
+// by their label in the list.
+func detectCorpusRuleCycle(list *config.MappingList, rules []*parser.CorpusMappingResult) error {
+	for i, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		for j := i + 1; j < len(rules); j++ {
+			other := rules[j]
+			if other == nil {
+				continue
+			}
+			if !rule.Direction.Allows(true) && !other.Direction.Allows(false) ||
+				!rule.Direction.Allows(false) && !other.Direction.Allows(true) {
+				continue
+			}
+			if reflect.DeepEqual(rule.Lower, other.Upper) && reflect.DeepEqual(other.Lower, rule.Upper) {
+				return fmt.Errorf("%s and %s map to each other in the same direction", list.RuleLabel(i), list.RuleLabel(j))
+			}
+		}
+	}
+	return nil
 }
 
 // precompileCorpusRegexes walks a CorpusNode tree and pre-compiles any
@@ -124,13 +445,114 @@ type MappingOptions struct {
 	FieldB      string
 	Direction   Direction
 	AddRewrites bool
+
+	// MaxIterations limits the passes over corpus rules until the
+	// result is stable. Zero means DefaultMaxIterations.
+	MaxIterations int
+
+	// MaxDepth limits the nesting of objects and arrays in the query
+	// and corpus sections, bounding the recursive descent into them.
+	// Zero means parser.DefaultMaxDepth.
+	MaxDepth int
+
+	// Tags restricts the applied rules to those carrying at least one
+	// of the tags. No tags means all rules apply.
+	Tags []string
+
+	// Mode selects whether corpus query rules replace matched nodes or
+	// append the mapped nodes to them. Empty means ModeReplace.
+	Mode Mode
+
+	// DeduplicateFields suppresses mapped response fields whose key and
+	// value are already present in the fields array, either as original
+	// or as previously mapped field.
+	DeduplicateFields bool
+
+	// InsertAfterSource inserts the fields mapped by group patterns in
+	// responses right after the last field that matched the pattern,
+	// instead of appending them to the fields. Fields mapped from a
+	// single field always follow that field.
+	InsertAfterSource bool
+
+	// IncludeProvenance adds a "mappedBy" object to every mapped response
+	// field, naming the mapping list and the index of the rule that
+	// produced it, and the ID of the rule if it has one.
+	IncludeProvenance bool
+
+	// ContinueOnError skips the step of a cascade if it fails, instead of
+	// aborting the cascade: the result of the previous step is passed on
+	// and the error is collected in the SkippedStepsError returned along
+	// with the result. Canceled contexts always abort the cascade.
+	ContinueOnError bool
+
+	// StripRewrites removes all koral:rewrite annotations by the mapper's
+	// editor after the transformation, e.g. in the last step of a cascade.
+	// Rewrites by other editors are kept.
+	StripRewrites bool
+
+	// OnlyFoundry and OnlyLayer restrict the snippet annotations rules
+	// are matched against in responses. Empty means no restriction
+	// beyond the foundry and layer of the rule patterns.
+	OnlyFoundry string
+	OnlyLayer   string
+
+	// NotInIndexClass overrides the class of spans injected into response
+	// snippets. Nil means the mapping list setting; an empty string omits
+	// the class attribute.
+	NotInIndexClass *string
+
+	// MaxMatches limits the tokens annotated in a response snippet, in
+	// the order the rules apply. Zero means no limit.
+	MaxMatches int
+
+	// FoundryRenames and LayerRenames rename the foundries and layers of
+	// all terms in the query after the rules are applied, e.g.
+	// {"opennlp": "opennlp2"}. Nil means the mapping list setting.
+	FoundryRenames map[string]string
+	LayerRenames   map[string]string
+
+	// MergeSpans collapses spans in response snippets that directly
+	// nest an identical span, e.g. when several rules inject the same
+	// annotation for a token.
+	MergeSpans bool
+
+	// Trace, if set, collects the rules applied by the transformation.
+	Trace *Trace
+}
+
+// isPassthrough reports whether mappingID is the passthrough ID and names
+// no mapping list.
+func (m *Mapper) isPassthrough(mappingID string) bool {
+	_, exists := m.mappingLists[mappingID]
+	return mappingID == m.passthroughID && !exists
+}
+
+// ruleSelected reports whether the rule at ruleIndex of the mapping list
+// applies in the direction of the options and passes their tag filter.
+func (m *Mapper) ruleSelected(mappingID string, ruleIndex int, opts MappingOptions) bool {
+	if !m.ruleDirection(mappingID, ruleIndex).Allows(bool(opts.Direction)) {
+		return false
+	}
+	if len(opts.Tags) == 0 {
+		return true
+	}
+	list, ok := m.mappingLists[mappingID]
+	if !ok {
+		return false
+	}
+	for _, tag := range list.RuleMetaAt(ruleIndex).Tags {
+		if slices.Contains(opts.Tags, tag) {
+			return true
+		}
+	}
+	return false
 }
 
 // validateEffectiveOptions checks that the resolved source and target
 // identifiers are not identical, which would cause an infinite mapping loop.
 // For annotation mappings it compares the effective foundry+layer pair;
-// for corpus mappings it compares the effective field names.
-// The effective value is: query-parameter override if non-empty, otherwise
+// for corpus mappings it compares the effective field names, and both
+// for mixed lists. The effective value is: query-parameter override if non-empty, otherwise
 // the YAML list default.
 func (m *Mapper) validateEffectiveOptions(mappingID string, opts MappingOptions) error {
 	list, exists := m.mappingLists[mappingID]
@@ -138,7 +560,7 @@ func (m *Mapper) validateEffectiveOptions(mappingID string, opts MappingOptions)
 		return nil // will be caught later
 	}
 
-	if list.IsCorpus() {
+	if list.IsCorpus() || list.IsMixed() {
 		effFieldA := opts.FieldA
 		if effFieldA == "" {
 			effFieldA = list.FieldA
@@ -148,9 +570,11 @@ func (m *Mapper) validateEffectiveOptions(mappingID string, opts MappingOptions)
 			effFieldB = list.FieldB
 		}
 		if effFieldA != "" && effFieldA == effFieldB {
-			return fmt.Errorf("identical source and target field (fieldA == fieldB == %q) in mapping list '%s': this would cause an infinite mapping loop", effFieldA, mappingID)
+			return withKind(ErrInvalidInput, fmt.Errorf("identical source and target field (fieldA == fieldB == %q) in mapping list '%s': this would cause an infinite mapping loop", effFieldA, mappingID))
+		}
+		if list.IsCorpus() {
+			return nil
 		}
-		return nil
 	}
 
 	effFoundryA := opts.FoundryA
@@ -171,7 +595,7 @@ func (m *Mapper) validateEffectiveOptions(mappingID string, opts MappingOptions)
 	}
 
 	if effFoundryA != "" && effFoundryA == effFoundryB && effLayerA == effLayerB {
-		return fmt.Errorf("identical source and target (foundryA/layerA == foundryB/layerB == %q/%q) in mapping list '%s': this would cause an infinite mapping loop", effFoundryA, effLayerA, mappingID)
+		return withKind(ErrInvalidInput, fmt.Errorf("identical source and target (foundryA/layerA == foundryB/layerB == %q/%q) in mapping list '%s': this would cause an infinite mapping loop", effFoundryA, effLayerA, mappingID))
 	}
 
 	return nil
@@ -180,39 +604,60 @@ func (m *Mapper) validateEffectiveOptions(mappingID string, opts MappingOptions)
 // CascadeQueryMappings applies multiple mapping lists sequentially,
 // feeding the output of each into the next. orderedIDs and
 // perMappingOpts must have the same length. An empty list returns
-// jsonData unchanged.
+// jsonData unchanged. A failing step aborts the cascade with a
+// *StepError, unless its options set ContinueOnError.
 func (m *Mapper) CascadeQueryMappings(orderedIDs []string, perMappingOpts []MappingOptions, jsonData any) (any, error) {
-	if len(orderedIDs) != len(perMappingOpts) {
-		return nil, fmt.Errorf("orderedIDs length (%d) must match perMappingOpts length (%d)", len(orderedIDs), len(perMappingOpts))
-	}
+	return m.CascadeQueryMappingsContext(context.Background(), orderedIDs, perMappingOpts, jsonData)
+}
 
-	result := jsonData
-	for i, id := range orderedIDs {
-		var err error
-		result, err = m.ApplyQueryMappings(id, perMappingOpts[i], result)
-		if err != nil {
-			return nil, fmt.Errorf("cascade step %d (mapping %q): %w", i, id, err)
-		}
-	}
-	return result, nil
+// CascadeQueryMappingsContext is like CascadeQueryMappings, but stops with
+// the context's error as soon as ctx is canceled or its deadline is exceeded.
+func (m *Mapper) CascadeQueryMappingsContext(ctx context.Context, orderedIDs []string, perMappingOpts []MappingOptions, jsonData any) (any, error) {
+	m = m.snapshot()
+	return cascade(ctx, orderedIDs, perMappingOpts, jsonData, m.ApplyQueryMappingsContext)
 }
 
 // CascadeResponseMappings applies multiple mapping lists sequentially
 // to a response object, feeding the output of each into the next.
 // orderedIDs and perMappingOpts must have the same length. An empty
-// list returns jsonData unchanged.
+// list returns jsonData unchanged. Failing steps are handled as in
+// CascadeQueryMappings.
 func (m *Mapper) CascadeResponseMappings(orderedIDs []string, perMappingOpts []MappingOptions, jsonData any) (any, error) {
+	return m.CascadeResponseMappingsContext(context.Background(), orderedIDs, perMappingOpts, jsonData)
+}
+
+// CascadeResponseMappingsContext is like CascadeResponseMappings, but stops
+// with the context's error as soon as ctx is canceled or its deadline is
+// exceeded.
+func (m *Mapper) CascadeResponseMappingsContext(ctx context.Context, orderedIDs []string, perMappingOpts []MappingOptions, jsonData any) (any, error) {
+	m = m.snapshot()
+	return cascade(ctx, orderedIDs, perMappingOpts, jsonData, m.ApplyResponseMappingsContext)
+}
+
+// cascade applies the steps of a cascade with apply. Failed steps with
+// ContinueOnError are skipped and reported in a *SkippedStepsError
+// returned along with the result.
+func cascade(ctx context.Context, orderedIDs []string, perMappingOpts []MappingOptions, jsonData any, apply func(context.Context, string, MappingOptions, any) (any, error)) (any, error) {
 	if len(orderedIDs) != len(perMappingOpts) {
 		return nil, fmt.Errorf("orderedIDs length (%d) must match perMappingOpts length (%d)", len(orderedIDs), len(perMappingOpts))
 	}
 
 	result := jsonData
+	var skipped []*StepError
 	for i, id := range orderedIDs {
-		var err error
-		result, err = m.ApplyResponseMappings(id, perMappingOpts[i], result)
+		next, err := apply(ctx, id, perMappingOpts[i], result)
 		if err != nil {
-			return nil, fmt.Errorf("cascade step %d (mapping %q): %w", i, id, err)
+			stepErr := &StepError{Step: i, MappingID: id, Err: err}
+			if !perMappingOpts[i].ContinueOnError || ctx.Err() != nil {
+				return nil, stepErr
+			}
+			skipped = append(skipped, stepErr)
+			continue
 		}
+		result = next
+	}
+	if len(skipped) > 0 {
+		return result, &SkippedStepsError{Steps: skipped}
 	}
 	return result, nil
 }
@@ -1,8 +1,12 @@
 package mapper
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/KorAP/Koral-Mapper/ast"
@@ -879,7 +883,7 @@ func TestBuildRewritesSingleObjectRewrite(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rewrites := buildRewrites(tt.original, tt.new_)
+			rewrites := buildRewrites(ast.Rewrite{Editor: RewriteEditor}, tt.original, tt.new_)
 			require.Len(t, rewrites, 1, "one rule application should produce exactly one rewrite")
 			rw := rewrites[0]
 			assert.Equal(t, RewriteEditor, rw.Editor)
@@ -1972,3 +1976,1729 @@ func TestSpecificityBasedRuleSelection(t *testing.T) {
 		assert.Equal(t, "relation:or", wrap["relation"])
 	})
 }
+
+func newTermGroupMapper(t *testing.T, rules ...string) *Mapper {
+	t.Helper()
+	mappingRules := make([]config.MappingRule, len(rules))
+	for i, r := range rules {
+		mappingRules[i] = config.MappingRule(r)
+	}
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "group-test",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: mappingRules,
+	}})
+	require.NoError(t, err)
+	return m
+}
+
+func TestTermGroupANDPatternCommutative(t *testing.T) {
+	m := newTermGroupMapper(t, "[ADJD & Variant:Short] <> [ADJ]")
+
+	// Operands in reverse order still match the AND pattern
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Variant", "layer": "p", "match": "match:eq", "value": "Short"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "ADJD", "layer": "p", "match": "match:eq"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "ADJ", "layer": "p", "match": "match:eq"}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestValueSensitiveMatching(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "value-test",
+		FoundryA: "opennlp",
+		LayerA:   "m",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{
+			"[opennlp/m=Number:Plur] <> [Number:Plur]",
+			"[opennlp/m=Number:Sing] <> [Number:Sing]",
+		},
+	}})
+	require.NoError(t, err)
+
+	// The value selects the rule
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "Number", "layer": "m", "match": "match:eq", "value": "Sing"}
+	}`)
+	result, err := m.ApplyQueryMappings("value-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "Number", "layer": "p", "match": "match:eq", "value": "Sing"}
+	}`), result)
+
+	// Values are compared in the reverse direction as well
+	input = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "Number", "layer": "p", "match": "match:eq", "value": "Plur"}
+	}`)
+	result, err = m.ApplyQueryMappings("value-test", MappingOptions{Direction: BtoA}, input)
+	require.NoError(t, err)
+	assert.Equal(t, parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "Number", "layer": "m", "match": "match:eq", "value": "Plur"}
+	}`), result)
+
+	// A different value or a missing value does not match
+	for _, term := range []string{
+		`{"@type": "koral:term", "foundry": "opennlp", "key": "Number", "layer": "m", "match": "match:eq", "value": "Dual"}`,
+		`{"@type": "koral:term", "foundry": "opennlp", "key": "Number", "layer": "m", "match": "match:eq"}`,
+	} {
+		input = parseJSON(t, `{"@type": "koral:token", "wrap": `+term+`}`)
+		expected := parseJSON(t, `{"@type": "koral:token", "wrap": `+term+`}`)
+		result, err = m.ApplyQueryMappings("value-test", MappingOptions{Direction: AtoB}, input)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestApplyMappingsCanceledContext(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID:       "anno",
+			FoundryA: "opennlp",
+			LayerA:   "p",
+			FoundryB: "upos",
+			LayerB:   "p",
+			Mappings: []config.MappingRule{"[PIDAT] <> [DET]"},
+		},
+		{
+			ID:       "corpus",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{"textClass=novel <> genre=fiction"},
+		},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	query := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+	}`)
+	_, err = m.ApplyQueryMappingsContext(ctx, "anno", MappingOptions{Direction: AtoB}, query)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	corpus := parseJSON(t, `{
+		"corpus": {"@type": "koral:doc", "key": "textClass", "value": "novel", "match": "match:eq"}
+	}`)
+	_, err = m.ApplyQueryMappingsContext(ctx, "corpus", MappingOptions{Direction: AtoB}, corpus)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	response := parseJSON(t, `{
+		"snippet": "<span title=\"opennlp/p:PIDAT\">Der</span>"
+	}`)
+	_, err = m.ApplyResponseMappingsContext(ctx, "anno", MappingOptions{Direction: AtoB}, response)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = m.CascadeQueryMappingsContext(ctx, []string{"anno"}, []MappingOptions{{Direction: AtoB}}, query)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// Without cancellation the same inputs are transformed
+	_, err = m.ApplyQueryMappings("anno", MappingOptions{Direction: AtoB}, query)
+	assert.NoError(t, err)
+}
+
+func TestDeletionRuleRemovesGroupOperand(t *testing.T) {
+	m := newTermGroupMapper(t, "[XY] <> []")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "XY", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Case", "layer": "p", "match": "match:eq", "value": "Nom"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Case", "layer": "p", "match": "match:eq", "value": "Nom"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	assert.Equal(t, expected, result)
+
+	// A group reduced to one operand collapses to that operand
+	input = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "XY", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestDeletionRuleRemovesSoleTerm(t *testing.T) {
+	m := newTermGroupMapper(t, "[XY] <> []")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "XY", "layer": "p", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB, AddRewrites: true}, input)
+	require.NoError(t, err)
+
+	// The token remains without a wrap, matching any token
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"rewrites": [{
+			"@type": "koral:rewrite",
+			"editor": "Koral-Mapper",
+			"original": {"@type": "koral:term", "foundry": "opennlp", "key": "XY", "layer": "p", "match": "match:eq"}
+		}]
+	}`)
+	assert.Equal(t, expected, result)
+
+	// Tokens inside a sequence are kept in place
+	input = parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "XY", "layer": "p", "match": "match:eq"}},
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}}
+		]
+	}`)
+	result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected = parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{"@type": "koral:token"},
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}}
+		]
+	}`)
+	assert.Equal(t, expected, result)
+
+	// The empty side never matches in the reverse direction
+	input = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`)
+	result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: BtoA}, input)
+	require.NoError(t, err)
+	assert.Equal(t, parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`), result)
+}
+
+func TestRegexKeyRules(t *testing.T) {
+	// The literal rule comes first, so it wins over the equally specific
+	// regex rule for NNP
+	m := newTermGroupMapper(t, "[NNP] <> [PROPN]", "[NN.*#regex] <> [NOUN]")
+
+	apply := func(direction Direction, term string) any {
+		t.Helper()
+		result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: direction}, parseJSON(t, `{"@type": "koral:token", "wrap": `+term+`}`))
+		require.NoError(t, err)
+		return result.(map[string]any)["wrap"]
+	}
+
+	noun := parseJSON(t, `{"@type": "koral:term", "foundry": "upos", "key": "NOUN", "layer": "p", "match": "match:eq"}`)
+	for _, key := range []string{"NN", "NNS"} {
+		assert.Equal(t, noun, apply(AtoB, `{"@type": "koral:term", "foundry": "opennlp", "key": "`+key+`", "layer": "p", "match": "match:eq"}`), key)
+	}
+	assert.Equal(t, "PROPN", apply(AtoB, `{"@type": "koral:term", "foundry": "opennlp", "key": "NNP", "layer": "p", "match": "match:eq"}`).(map[string]any)["key"])
+
+	// The key must match as a whole, in the foundry and layer of the rule
+	for _, term := range []string{
+		`{"@type": "koral:term", "foundry": "opennlp", "key": "ADJA", "layer": "p", "match": "match:eq"}`,
+		`{"@type": "koral:term", "foundry": "opennlp", "key": "ANN", "layer": "p", "match": "match:eq"}`,
+		`{"@type": "koral:term", "foundry": "tt", "key": "NN", "layer": "p", "match": "match:eq"}`,
+		// A regex in the query only matches the same regex
+		`{"@type": "koral:term", "foundry": "opennlp", "key": "N.*", "layer": "p", "match": "match:eq", "type": "type:regex"}`,
+	} {
+		assert.Equal(t, parseJSON(t, term), apply(AtoB, term), term)
+	}
+	assert.Equal(t, noun, apply(AtoB, `{"@type": "koral:term", "foundry": "opennlp", "key": "NN.*", "layer": "p", "match": "match:eq", "type": "type:regex"}`))
+
+	// In the other direction, the regex is the replacement
+	assert.Equal(t,
+		parseJSON(t, `{"@type": "koral:term", "foundry": "opennlp", "key": "NN.*", "layer": "p", "match": "match:eq", "type": "type:regex"}`),
+		apply(BtoA, `{"@type": "koral:term", "foundry": "upos", "key": "NOUN", "layer": "p", "match": "match:eq"}`))
+
+	// Invalid regular expressions are rejected at load
+	_, err := NewMapper([]config.MappingList{{ID: "invalid", Mappings: []config.MappingRule{"[+NN#regex] <> [NOUN]"}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid regular expression")
+}
+
+func TestTokenExtraFieldsPreserved(t *testing.T) {
+	m := newTermGroupMapper(t, "[PIDAT] <> [DET & PRON]", "[XY] <> []")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"},
+		"annotation": {"source": "user"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "upos", "key": "DET", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}
+			],
+			"relation": "relation:and"
+		},
+		"annotation": {"source": "user"}
+	}`), result)
+
+	// Tokens inside a sequence and tokens whose wrap was deleted keep
+	// their extra fields, too
+	input = parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "XY", "layer": "p", "match": "match:eq"}, "comment": "deleted"},
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}, "comment": "mapped"}
+		]
+	}`)
+	result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	operands := result.(map[string]any)["operands"].([]any)
+	require.Len(t, operands, 2)
+	assert.Equal(t, map[string]any{"@type": "koral:token", "comment": "deleted"}, operands[0])
+	assert.Equal(t, "mapped", operands[1].(map[string]any)["comment"])
+}
+
+func TestTermGroupANDPatternNoMatchWrongRelation(t *testing.T) {
+	m := newTermGroupMapper(t, "[ADJD & Variant:Short] <> [ADJ]")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "ADJD", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Variant", "layer": "p", "match": "match:eq", "value": "Short"}
+			],
+			"relation": "relation:or"
+		}
+	}`)
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "ADJD", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Variant", "layer": "p", "match": "match:eq", "value": "Short"}
+			],
+			"relation": "relation:or"
+		}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, expected, result)
+}
+
+func TestTermGroupANDPatternSubsetMatch(t *testing.T) {
+	m := newTermGroupMapper(t, "[ADJD & Variant:Short] <> [ADJ]")
+
+	// Three operands: the pattern matches two of them (subset),
+	// the unmatched operand is preserved alongside the replacement.
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "ADJD", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "marmot", "key": "degree", "layer": "m", "match": "match:eq", "value": "pos"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Variant", "layer": "p", "match": "match:eq", "value": "Short"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "upos", "key": "ADJ", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "marmot", "key": "degree", "layer": "m", "match": "match:eq", "value": "pos"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestTermGroupORPatternExactMatch(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET | ART] <> [PRON]")
+
+	// Exact OR structure is replaced as a whole
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "ART", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq"}
+			],
+			"relation": "relation:or"
+		}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestTermGroupORPatternSingleOperandMatch(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET | ART] <> [PRON]")
+
+	// A single term matches if any OR operand matches
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "ART", "layer": "p", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestTermGroupORPatternInsideANDGroup(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET | ART] <> [PRON]")
+
+	// The OR pattern matches the DET operand of an AND group; the other
+	// operand is preserved.
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "marmot", "key": "case", "layer": "m", "match": "match:eq", "value": "nom"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "marmot", "key": "case", "layer": "m", "match": "match:eq", "value": "nom"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestTermGroupORPatternNoMatchWrongValue(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET | ART] <> [PRON]")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`)
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, expected, result)
+}
+
+func TestTermGroupORReplacement(t *testing.T) {
+	m := newTermGroupMapper(t, "[X] <> [A | B]")
+
+	// An OR replacement is emitted as a termGroup with relation:or
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "X", "layer": "p", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	orGroup := `{
+		"@type": "koral:termGroup",
+		"operands": [
+			{"@type": "koral:term", "foundry": "upos", "key": "A", "layer": "p", "match": "match:eq"},
+			{"@type": "koral:term", "foundry": "upos", "key": "B", "layer": "p", "match": "match:eq"}
+		],
+		"relation": "relation:or"
+	}`
+	assert.Equal(t, parseJSON(t, `{"@type": "koral:token", "wrap": `+orGroup+`}`), result)
+
+	// Inside an AND group, the OR replacement becomes a nested operand
+	input = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "opennlp", "key": "X", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "marmot", "key": "case", "layer": "m", "match": "match:eq", "value": "nom"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				`+orGroup+`,
+				{"@type": "koral:term", "foundry": "marmot", "key": "case", "layer": "m", "match": "match:eq", "value": "nom"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestNestedGroupOperandsMapped(t *testing.T) {
+	m := newTermGroupMapper(t, "[PIDAT] <> [DET]", "[NN] <> [NOUN]")
+
+	// Each token inside a nested koral:group gets its own best rule.
+	input := parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{
+				"@type": "koral:group",
+				"operation": "operation:or",
+				"operands": [
+					{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}},
+					{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}}
+				]
+			},
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}}
+		]
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{
+				"@type": "koral:group",
+				"operation": "operation:or",
+				"operands": [
+					{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "key": "DET", "layer": "p", "match": "match:eq"}},
+					{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "key": "NOUN", "layer": "p", "match": "match:eq"}}
+				]
+			},
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "key": "NOUN", "layer": "p", "match": "match:eq"}}
+		]
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestCatchallWrapMappedWithRewrite(t *testing.T) {
+	m := newTermGroupMapper(t, "[NN] <> [NOUN]")
+
+	input := parseJSON(t, `{
+		"@type": "koral:span",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB, AddRewrites: true}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:span",
+		"wrap": {
+			"@type": "koral:term",
+			"foundry": "upos",
+			"key": "NOUN",
+			"layer": "p",
+			"match": "match:eq",
+			"rewrites": [
+				{
+					"@type": "koral:rewrite",
+					"editor": "Koral-Mapper",
+					"original": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+				}
+			]
+		}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestExistingRewritesAccumulate(t *testing.T) {
+	m := newTermGroupMapper(t, "[PIDAT] <> [DET]")
+	opts := MappingOptions{Direction: AtoB, AddRewrites: true}
+
+	t.Run("Token rewrite from foundry injection", func(t *testing.T) {
+		input := parseJSON(t, `{
+			"@type": "koral:group",
+			"operation": "operation:sequence",
+			"operands": [
+				{
+					"@type": "koral:token",
+					"rewrites": [
+						{"@type": "koral:rewrite", "editor": "Kustvakt", "operation": "operation:injection", "scope": "foundry"}
+					],
+					"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+				}
+			]
+		}`)
+		result, err := m.ApplyQueryMappings("group-test", opts, input)
+		require.NoError(t, err)
+
+		expected := parseJSON(t, `{
+			"@type": "koral:group",
+			"operation": "operation:sequence",
+			"operands": [
+				{
+					"@type": "koral:token",
+					"rewrites": [
+						{"@type": "koral:rewrite", "editor": "Kustvakt", "operation": "operation:injection", "scope": "foundry"},
+						{
+							"@type": "koral:rewrite",
+							"editor": "Koral-Mapper",
+							"original": {
+								"@type": "koral:token",
+								"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+							}
+						}
+					],
+					"wrap": {"@type": "koral:term", "foundry": "upos", "key": "DET", "layer": "p", "match": "match:eq"}
+				}
+			]
+		}`)
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("Top-level term rewrite", func(t *testing.T) {
+		input := parseJSON(t, `{
+			"@type": "koral:term",
+			"foundry": "opennlp",
+			"key": "PIDAT",
+			"layer": "p",
+			"match": "match:eq",
+			"rewrites": [
+				{"@type": "koral:rewrite", "editor": "Kustvakt", "operation": "operation:injection", "scope": "foundry"}
+			]
+		}`)
+		result, err := m.ApplyQueryMappings("group-test", opts, input)
+		require.NoError(t, err)
+
+		expected := parseJSON(t, `{
+			"@type": "koral:term",
+			"foundry": "upos",
+			"key": "DET",
+			"layer": "p",
+			"match": "match:eq",
+			"rewrites": [
+				{"@type": "koral:rewrite", "editor": "Kustvakt", "operation": "operation:injection", "scope": "foundry"},
+				{
+					"@type": "koral:rewrite",
+					"editor": "Koral-Mapper",
+					"original": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+				}
+			]
+		}`)
+		assert.Equal(t, expected, result)
+	})
+}
+
+func TestReplacementWithExplicitMatchType(t *testing.T) {
+	m := newTermGroupMapper(t, "[gender:masc] <> [case=nom:ne]")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "gender", "layer": "p", "match": "match:eq", "value": "masc"}
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	expected := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "upos", "key": "nom", "layer": "case", "match": "match:ne"}
+	}`)
+	assert.Equal(t, expected, result)
+}
+
+func TestNewMapperSkipsDisabledLists(t *testing.T) {
+	disabled := false
+	m, err := NewMapper([]config.MappingList{
+		{ID: "active", Mappings: []config.MappingRule{"[A] <> [B]"}},
+		{ID: "inactive", Enabled: &disabled, Mappings: []config.MappingRule{"[A] <> [B]"}},
+	})
+	require.NoError(t, err)
+
+	_, err = m.ApplyQueryMappings("inactive", MappingOptions{Direction: AtoB}, parseJSON(t, `{"@type": "koral:token"}`))
+	assert.EqualError(t, err, "mapping list with ID inactive not found")
+}
+
+func TestCustomEditorNameInRewrites(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID:       "query-test",
+			FoundryA: "opennlp",
+			LayerA:   "p",
+			FoundryB: "upos",
+			LayerB:   "p",
+			Mappings: []config.MappingRule{"[PIDAT] <> [DET]"},
+		},
+		{
+			ID:       "corpus-test",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{"textClass=novel <> genre=fiction"},
+		},
+	}, WithEditorName("Koral-Mapper-2"))
+	require.NoError(t, err)
+
+	opts := MappingOptions{Direction: AtoB, AddRewrites: true}
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PIDAT", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("query-test", opts, input)
+	require.NoError(t, err)
+	rewrites := result.(map[string]any)["wrap"].(map[string]any)["rewrites"].([]any)
+	require.Len(t, rewrites, 1)
+	assert.Equal(t, "Koral-Mapper-2", rewrites[0].(map[string]any)["editor"])
+
+	input = parseJSON(t, `{
+		"corpus": {"@type": "koral:doc", "key": "textClass", "value": "novel"}
+	}`)
+	result, err = m.ApplyQueryMappings("corpus-test", opts, input)
+	require.NoError(t, err)
+	rewrites = result.(map[string]any)["corpus"].(map[string]any)["rewrites"].([]any)
+	require.Len(t, rewrites, 1)
+	assert.Equal(t, "Koral-Mapper-2", rewrites[0].(map[string]any)["editor"])
+}
+
+func TestRuleRewriteOperationAndScope(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID:       "query-test",
+			FoundryA: "opennlp",
+			LayerA:   "p",
+			FoundryB: "upos",
+			LayerB:   "p",
+			Mappings: []config.MappingRule{"[PIDAT] <> [DET]", "[PPER] <> [PRON]", "[XY] <> []"},
+			RuleMeta: []config.RuleMeta{{}, {Operation: "operation:override", Scope: "key"}, {Operation: "operation:deletion", Scope: "wrap"}},
+		},
+		{
+			ID:       "corpus-test",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{"textClass=novel <> genre=fiction"},
+			RuleMeta: []config.RuleMeta{{Operation: "operation:injection", Scope: "value"}},
+		},
+	})
+	require.NoError(t, err)
+
+	opts := MappingOptions{Direction: AtoB, AddRewrites: true}
+
+	// Rules without settings keep the default rewrite
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PIDAT", "match": "match:eq"}
+	}`)
+	result, err := m.ApplyQueryMappings("query-test", opts, input)
+	require.NoError(t, err)
+	rw := result.(map[string]any)["wrap"].(map[string]any)["rewrites"].([]any)[0].(map[string]any)
+	assert.Nil(t, rw["operation"])
+	assert.Nil(t, rw["scope"])
+
+	input = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "PPER", "match": "match:eq"}
+	}`)
+	result, err = m.ApplyQueryMappings("query-test", opts, input)
+	require.NoError(t, err)
+	rw = result.(map[string]any)["wrap"].(map[string]any)["rewrites"].([]any)[0].(map[string]any)
+	assert.Equal(t, "operation:override", rw["operation"])
+	assert.Equal(t, "key", rw["scope"])
+	assert.Equal(t, RewriteEditor, rw["editor"])
+
+	// A deletion rule removing the sole wrap sets the rewrite of the token
+	input = parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "XY", "match": "match:eq"}
+	}`)
+	result, err = m.ApplyQueryMappings("query-test", opts, input)
+	require.NoError(t, err)
+	rw = result.(map[string]any)["rewrites"].([]any)[0].(map[string]any)
+	assert.Equal(t, "operation:deletion", rw["operation"])
+	assert.Equal(t, "wrap", rw["scope"])
+	assert.NotNil(t, rw["original"])
+
+	// The corpus rule would derive scope "key", but the rule sets "value"
+	input = parseJSON(t, `{
+		"corpus": {"@type": "koral:doc", "key": "textClass", "value": "novel"}
+	}`)
+	result, err = m.ApplyQueryMappings("corpus-test", opts, input)
+	require.NoError(t, err)
+	rw = result.(map[string]any)["corpus"].(map[string]any)["rewrites"].([]any)[0].(map[string]any)
+	assert.Equal(t, "operation:injection", rw["operation"])
+	assert.Equal(t, "value", rw["scope"])
+	assert.Equal(t, "novel", rw["original"])
+}
+
+func TestTypedErrors(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET] <> [PRON]")
+
+	_, err := m.ApplyQueryMappings("nonexistent", MappingOptions{Direction: AtoB}, map[string]any{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrMappingNotFound)
+	assert.Equal(t, "mapping list with ID nonexistent not found", err.Error())
+
+	_, err = m.ApplyResponseMappings("nonexistent", MappingOptions{Direction: AtoB}, map[string]any{})
+	assert.ErrorIs(t, err, ErrMappingNotFound)
+
+	_, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"@type": "koral:token",
+		"wrap":  "not a node",
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.NotErrorIs(t, err, ErrMappingNotFound)
+
+	_, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB, FoundryB: "opennlp"}, map[string]any{})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestTagFilter(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "tag-test",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{"[NN] <> [NOUN]", "[VVFIN] <> [VERB]"},
+		RuleMeta: []config.RuleMeta{{Tags: []string{"pos", "noun"}}, {Tags: []string{"pos"}}},
+	}})
+	require.NoError(t, err)
+
+	apply := func(key string, tags ...string) string {
+		input := parseJSON(t, `{
+			"@type": "koral:token",
+			"wrap": {"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "`+key+`", "match": "match:eq"}
+		}`)
+		result, err := m.ApplyQueryMappings("tag-test", MappingOptions{Direction: AtoB, Tags: tags}, input)
+		require.NoError(t, err)
+		return result.(map[string]any)["wrap"].(map[string]any)["key"].(string)
+	}
+
+	// Without tags all rules apply
+	assert.Equal(t, "NOUN", apply("NN"))
+	assert.Equal(t, "VERB", apply("VVFIN"))
+
+	// Only rules with an intersecting tag apply
+	assert.Equal(t, "NOUN", apply("NN", "noun"))
+	assert.Equal(t, "VVFIN", apply("VVFIN", "noun"))
+	assert.Equal(t, "VERB", apply("VVFIN", "noun", "pos"))
+	assert.Equal(t, "NN", apply("NN", "other"))
+}
+
+func TestTokenShorthandMapping(t *testing.T) {
+	m := newTermGroupMapper(t, "[PIDAT] <> [DET]", "[PAV] <> [ADV & PronType:Dem]")
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"foundry": "opennlp",
+		"layer": "p",
+		"key": "PIDAT",
+		"match": "match:eq"
+	}`)
+	result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, parseJSON(t, `{
+		"@type": "koral:token",
+		"foundry": "upos",
+		"layer": "p",
+		"key": "DET",
+		"match": "match:eq"
+	}`), result)
+
+	// Shorthand operands of a sequence keep their form
+	input = parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{"@type": "koral:token", "foundry": "opennlp", "layer": "p", "key": "PIDAT", "match": "match:eq"},
+			{"@type": "koral:token", "foundry": "opennlp", "layer": "p", "key": "PAV", "match": "match:eq"}
+		]
+	}`)
+	result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	operands := result.(map[string]any)["operands"].([]any)
+	first := operands[0].(map[string]any)
+	assert.Equal(t, "DET", first["key"])
+	assert.Nil(t, first["wrap"])
+
+	// A replacement that is not a single term needs a wrap
+	second := operands[1].(map[string]any)
+	assert.Nil(t, second["key"])
+	assert.Equal(t, "koral:termGroup", second["wrap"].(map[string]any)["@type"])
+}
+
+func TestLayerAwareMatching(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET] <> [PRON]", "[opennlp/x=ART] <> [DET]")
+
+	token := func(key, layer string) any {
+		return parseJSON(t, `{
+			"@type": "koral:token",
+			"wrap": {
+				"@type": "koral:term",
+				"foundry": "opennlp",
+				"key": "`+key+`",
+				"layer": "`+layer+`",
+				"match": "match:eq"
+			}
+		}`)
+	}
+
+	tests := []struct {
+		name        string
+		key         string
+		layer       string
+		opts        MappingOptions
+		expectedKey string
+	}{
+		{"list default layer matches", "DET", "p", MappingOptions{Direction: AtoB}, "PRON"},
+		{"other layer does not match", "DET", "m", MappingOptions{Direction: AtoB}, "DET"},
+		{"override layer matches", "DET", "m", MappingOptions{Direction: AtoB, LayerA: "m"}, "PRON"},
+		{"override excludes default layer", "DET", "p", MappingOptions{Direction: AtoB, LayerA: "m"}, "DET"},
+		{"rule layer matches", "ART", "x", MappingOptions{Direction: AtoB}, "DET"},
+		{"rule layer excludes default layer", "ART", "p", MappingOptions{Direction: AtoB}, "ART"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.ApplyQueryMappings("group-test", tt.opts, token(tt.key, tt.layer))
+			require.NoError(t, err)
+			wrap := result.(map[string]any)["wrap"].(map[string]any)
+			assert.Equal(t, tt.expectedKey, wrap["key"])
+		})
+	}
+
+	t.Run("response snippet", func(t *testing.T) {
+		input := parseJSON(t, `{"snippet": "<span title=\"opennlp/p:DET\">a</span><span title=\"opennlp/m:DET\">b</span>"}`)
+		result, err := m.ApplyResponseMappings("group-test", MappingOptions{Direction: AtoB}, input)
+		require.NoError(t, err)
+		assert.Equal(t,
+			`<span title="opennlp/p:DET"><span title="upos/p:PRON" class="notinindex">a</span></span><span title="opennlp/m:DET">b</span>`,
+			result.(map[string]any)["snippet"])
+	})
+}
+
+func TestDeterministicOperandOrder(t *testing.T) {
+	annotations := newTermGroupMapper(t,
+		"[ADJD & Variant:Short] <> [ADJ & Variant=Short & Degree=Pos]",
+		"[NN] <> [NOUN | PROPN]",
+	)
+	corpus := newCorpusMapper(t,
+		"(textClass=novel & pubPlace=Berlin) <> (genre=fiction & place=Berlin & country=DE)",
+	)
+
+	query := `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "marmot", "key": "case", "layer": "m", "match": "match:eq", "value": "nom"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "Variant", "layer": "p", "match": "match:eq", "value": "Short"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "opennlp", "key": "ADJD", "layer": "p", "match": "match:eq"}
+			],
+			"relation": "relation:and"
+		}
+	}`
+	corpusQuery := `{
+		"collection": {
+			"@type": "koral:docGroup",
+			"operation": "operation:and",
+			"operands": [
+				{"@type": "koral:doc", "key": "author", "value": "Goethe", "match": "match:eq"},
+				{"@type": "koral:doc", "key": "pubPlace", "value": "Berlin", "match": "match:eq"},
+				{"@type": "koral:doc", "key": "textClass", "value": "novel", "match": "match:eq"}
+			]
+		}
+	}`
+
+	serialize := func(m *Mapper, mappingID, input string) []byte {
+		result, err := m.ApplyQueryMappings(mappingID, MappingOptions{Direction: AtoB, AddRewrites: true}, parseJSON(t, input))
+		require.NoError(t, err)
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		return data
+	}
+
+	// Replacement operands come first in rule order, followed by the
+	// preserved operands in input order
+	first := serialize(annotations, "group-test", query)
+	firstCorpus := serialize(corpus, "corpus-test", corpusQuery)
+	for range 20 {
+		assert.Equal(t, string(first), string(serialize(annotations, "group-test", query)))
+		assert.Equal(t, string(firstCorpus), string(serialize(corpus, "corpus-test", corpusQuery)))
+	}
+
+	result := parseJSON(t, string(firstCorpus)).(map[string]any)["collection"].(map[string]any)
+	operands := result["operands"].([]any)
+	require.Len(t, operands, 2)
+	replacement := operands[0].(map[string]any)["operands"].([]any)
+	var keys []string
+	for _, op := range replacement {
+		keys = append(keys, op.(map[string]any)["key"].(string))
+	}
+	assert.Equal(t, []string{"genre", "place", "country"}, keys)
+	assert.Equal(t, "author", operands[1].(map[string]any)["key"])
+}
+
+func TestRuleDirectionRestriction(t *testing.T) {
+	term := func(foundry, key string) string {
+		return `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "` + foundry + `", "key": "` + key + `", "layer": "p", "match": "match:eq"}}`
+	}
+
+	tests := []struct {
+		rule     string
+		atob     string // result of mapping opennlp/p=A
+		btoa     string // result of mapping upos/p=B
+		response bool   // whether a snippet annotated with opennlp/p:A is enriched
+	}{
+		{"[A] <> [B]", term("upos", "B"), term("opennlp", "A"), true},
+		{"[A] >> [B]", term("upos", "B"), term("upos", "B"), true},
+		{"[A] << [B]", term("opennlp", "A"), term("opennlp", "A"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			m := newTermGroupMapper(t, tt.rule)
+
+			result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, parseJSON(t, term("opennlp", "A")))
+			require.NoError(t, err)
+			assert.Equal(t, parseJSON(t, tt.atob), result)
+
+			result, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: BtoA}, parseJSON(t, term("upos", "B")))
+			require.NoError(t, err)
+			assert.Equal(t, parseJSON(t, tt.btoa), result)
+
+			result, err = m.ApplyResponseMappings("group-test", MappingOptions{Direction: AtoB}, parseJSON(t, `{
+				"snippet": "<span title=\"opennlp/p:A\">a</span>"
+			}`))
+			require.NoError(t, err)
+			assert.Equal(t, tt.response, strings.Contains(result.(map[string]any)["snippet"].(string), "upos/p:B"))
+		})
+	}
+}
+
+func TestCorpusRuleDirectionRestriction(t *testing.T) {
+	doc := func(key, value string) map[string]any {
+		return map[string]any{"@type": "koral:doc", "key": key, "value": value, "match": "match:eq"}
+	}
+
+	tests := []struct {
+		rule string
+		atob map[string]any // result of mapping textClass=novel
+		btoa map[string]any // result of mapping genre=fiction
+	}{
+		{"textClass=novel <> genre=fiction", doc("genre", "fiction"), doc("textClass", "novel")},
+		{"textClass=novel >> genre=fiction", doc("genre", "fiction"), doc("genre", "fiction")},
+		{"textClass=novel << genre=fiction", doc("textClass", "novel"), doc("textClass", "novel")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			m := newCorpusMapper(t, tt.rule)
+
+			result, err := m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{"corpus": doc("textClass", "novel")})
+			require.NoError(t, err)
+			assert.Equal(t, tt.atob, result.(map[string]any)["corpus"])
+
+			result, err = m.ApplyQueryMappings("corpus-test", MappingOptions{Direction: BtoA}, map[string]any{"corpus": doc("genre", "fiction")})
+			require.NoError(t, err)
+			assert.Equal(t, tt.btoa, result.(map[string]any)["corpus"])
+		})
+	}
+
+	// Rules restricted to opposite directions do not form a cycle
+	_, err := NewMapper([]config.MappingList{{
+		ID:       "one-way",
+		Type:     "corpus",
+		Mappings: []config.MappingRule{"a=1 >> b=2", "b=2 << a=1"},
+	}})
+	assert.NoError(t, err)
+	_, err = NewMapper([]config.MappingList{{
+		ID:       "cycle",
+		Type:     "corpus",
+		Mappings: []config.MappingRule{"a=1 >> b=2", "b=2 >> a=1"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestStats(t *testing.T) {
+	m := newTermGroupMapper(t, "[A] <> [B]", "[C] <> [D]")
+	query := `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "A", "layer": "p", "match": "match:eq"}}`
+
+	assert.Empty(t, m.Stats())
+
+	const n = 20
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, parseJSON(t, query))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	_, err := m.ApplyResponseMappings("group-test", MappingOptions{Direction: AtoB}, parseJSON(t, `{
+		"snippet": "<span title=\"opennlp/p:A\">a</span>"
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[int]uint64{"group-test": {0: n + 1}}, m.Stats())
+
+	corpus := newCorpusMapper(t, "textClass=a <> genre=a", "textClass=b <> genre=b")
+	for range 3 {
+		_, err := corpus.ApplyQueryMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+			"corpus": map[string]any{"@type": "koral:doc", "key": "textClass", "value": "b", "match": "match:eq"},
+		})
+		require.NoError(t, err)
+	}
+	_, err = corpus.ApplyResponseMappings("corpus-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"fields": []any{map[string]any{"@type": "koral:field", "key": "textClass", "value": "a", "type": "type:string"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]map[int]uint64{"corpus-test": {0: 1, 1: 3}}, corpus.Stats())
+}
+
+func TestQueryKeys(t *testing.T) {
+	lists := []config.MappingList{{
+		ID:       "test",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{"[A] <> [B]"},
+	}}
+	token := func(foundry, key string) string {
+		return `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "` + foundry + `", "key": "` + key + `", "layer": "p", "match": "match:eq"}}`
+	}
+
+	tests := []struct {
+		name     string
+		keys     []string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Default query envelope",
+			input:    `{"query": ` + token("opennlp", "A") + `, "meta": {}}`,
+			expected: `{"query": ` + token("upos", "B") + `, "meta": {}}`,
+		},
+		{
+			name:     "Bare token",
+			input:    token("opennlp", "A"),
+			expected: token("upos", "B"),
+		},
+		{
+			name:     "Custom envelope key",
+			keys:     []string{"koralQuery", "query"},
+			input:    `{"koralQuery": ` + token("opennlp", "A") + `}`,
+			expected: `{"koralQuery": ` + token("upos", "B") + `}`,
+		},
+		{
+			name:     "First configured key takes precedence",
+			keys:     []string{"koralQuery", "query"},
+			input:    `{"koralQuery": ` + token("opennlp", "A") + `, "query": ` + token("opennlp", "A") + `}`,
+			expected: `{"koralQuery": ` + token("upos", "B") + `, "query": ` + token("opennlp", "A") + `}`,
+		},
+		{
+			name:     "Default key not used when replaced",
+			keys:     []string{"koralQuery"},
+			input:    `{"query": ` + token("opennlp", "A") + `}`,
+			expected: `{"query": ` + token("opennlp", "A") + `}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMapper(lists, WithQueryKeys(tt.keys...))
+			require.NoError(t, err)
+
+			result, err := m.ApplyQueryMappings("test", MappingOptions{Direction: AtoB}, parseJSON(t, tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, parseJSON(t, tt.expected), result)
+		})
+	}
+}
+
+func TestTrace(t *testing.T) {
+	m := newTermGroupMapper(t, "[A] <> [B]", "[C] <> [D]")
+	query := `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "C", "layer": "p", "match": "match:eq"}},
+			{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "A", "layer": "p", "match": "match:eq"}}
+		]
+	}`
+
+	trace := &Trace{}
+	_, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB, Trace: trace}, parseJSON(t, query))
+	require.NoError(t, err)
+	assert.Equal(t, []AppliedRule{
+		{List: "group-test", Index: 1},
+		{List: "group-test", Index: 0},
+	}, trace.Applied())
+
+	// Without a trace, only the counters are updated
+	_, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, parseJSON(t, query))
+	require.NoError(t, err)
+	assert.Len(t, trace.Applied(), 2)
+	assert.Equal(t, map[string]map[int]uint64{"group-test": {0: 2, 1: 2}}, m.Stats())
+}
+
+func TestApplyMappingsBytes(t *testing.T) {
+	m := newTermGroupMapper(t, "[ADJA] <> [ADJ]")
+
+	query := `{
+		"query": {
+			"@type": "koral:token",
+			"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "ADJA", "layer": "p", "match": "match:eq"}
+		}
+	}`
+	response := `{"snippet": "<span title=\"opennlp/p:ADJA\">schöne</span> & mehr"}`
+	opts := MappingOptions{Direction: AtoB, AddRewrites: true}
+
+	for _, tt := range []struct {
+		name  string
+		input string
+		bytes func(string, MappingOptions, []byte) ([]byte, error)
+		any   func(string, MappingOptions, any) (any, error)
+	}{
+		{name: "query", input: query, bytes: m.ApplyQueryMappingsBytes, any: m.ApplyQueryMappings},
+		{name: "response", input: response, bytes: m.ApplyResponseMappingsBytes, any: m.ApplyResponseMappings},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := tt.bytes("group-test", opts, []byte(tt.input))
+			require.NoError(t, err)
+
+			result, err := tt.any("group-test", opts, parseJSON(t, tt.input))
+			require.NoError(t, err)
+			expected, err := json.Marshal(result)
+			require.NoError(t, err)
+
+			assert.Equal(t, string(expected), string(output))
+			assert.Contains(t, string(output), "upos")
+		})
+	}
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		_, err := m.ApplyQueryMappingsBytes("group-test", opts, []byte(`{"query": `))
+		assert.ErrorIs(t, err, ErrInvalidInput)
+	})
+
+	t.Run("unknown mapping list", func(t *testing.T) {
+		_, err := m.ApplyResponseMappingsBytes("missing", opts, []byte(response))
+		assert.ErrorIs(t, err, ErrMappingNotFound)
+	})
+}
+
+func TestPassthrough(t *testing.T) {
+	m := newTermGroupMapper(t, "[ADJA] <> [ADJ]")
+
+	query := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "ADJA", "layer": "p", "match": "match:eq"}
+	}`)
+	response := parseJSON(t, `{"snippet": "<span title=\"opennlp/p:ADJA\">schöne</span>"}`)
+	opts := MappingOptions{Direction: AtoB, AddRewrites: true}
+
+	result, err := m.ApplyQueryMappings(DefaultPassthroughID, opts, query)
+	require.NoError(t, err)
+	assert.Equal(t, query, result)
+
+	result, err = m.ApplyResponseMappings(DefaultPassthroughID, opts, response)
+	require.NoError(t, err)
+	assert.Equal(t, response, result)
+
+	// A custom ID replaces the default
+	custom, err := NewMapper(nil, WithPassthroughID("noop"))
+	require.NoError(t, err)
+	result, err = custom.ApplyQueryMappings("noop", opts, query)
+	require.NoError(t, err)
+	assert.Equal(t, query, result)
+	_, err = custom.ApplyQueryMappings(DefaultPassthroughID, opts, query)
+	assert.ErrorIs(t, err, ErrMappingNotFound)
+
+	// A mapping list with the ID takes precedence
+	shadowed, err := NewMapper([]config.MappingList{{
+		ID:       DefaultPassthroughID,
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{"[ADJA] <> [ADJ]"},
+	}})
+	require.NoError(t, err)
+	result, err = shadowed.ApplyQueryMappings(DefaultPassthroughID, opts, query)
+	require.NoError(t, err)
+	assert.NotEqual(t, query, result)
+}
+
+func TestAliases(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "stts-upos",
+		Aliases:  []string{"opennlp-upos", "pos"},
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{"[ADJA] <> [ADJ]"},
+	}})
+	require.NoError(t, err)
+
+	query := `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "ADJA", "layer": "p", "match": "match:eq"}
+	}`
+	expected, err := m.ApplyQueryMappings("stts-upos", MappingOptions{Direction: AtoB}, parseJSON(t, query))
+	require.NoError(t, err)
+
+	trace := &Trace{}
+	result, err := m.ApplyQueryMappings("opennlp-upos", MappingOptions{Direction: AtoB, Trace: trace}, parseJSON(t, query))
+	require.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	// Applications through an alias are reported for the list ID
+	require.Len(t, trace.Applied(), 1)
+	assert.Equal(t, "stts-upos", trace.Applied()[0].List)
+	assert.Equal(t, map[string]map[int]uint64{"stts-upos": {0: 2}}, m.Stats())
+
+	response, err := m.ApplyResponseMappings("pos", MappingOptions{Direction: AtoB},
+		parseJSON(t, `{"snippet": "<span title=\"opennlp/p:ADJA\">schöne</span>"}`))
+	require.NoError(t, err)
+	assert.Contains(t, response.(map[string]any)["snippet"], "upos/p:ADJ")
+
+	// Aliases must not collide with list IDs or other aliases
+	_, err = NewMapper([]config.MappingList{
+		{ID: "a", Aliases: []string{"b"}, Mappings: []config.MappingRule{"[A] <> [B]"}},
+		{ID: "b", Mappings: []config.MappingRule{"[A] <> [B]"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "alias b of mapping list a collides with a mapping list ID")
+
+	_, err = NewMapper([]config.MappingList{
+		{ID: "a", Aliases: []string{"old"}, Mappings: []config.MappingRule{"[A] <> [B]"}},
+		{ID: "b", Aliases: []string{"old"}, Mappings: []config.MappingRule{"[A] <> [B]"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "alias old of mapping list b is already an alias of mapping list a")
+}
+
+func TestSingleOperandGroupQuery(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET] <> [PRON]")
+
+	tests := []struct {
+		name     string
+		dir      Direction
+		input    string
+		expected string
+		matches  int
+	}{
+		{
+			name:     "AND group",
+			dir:      AtoB,
+			input:    `{"@type": "koral:token", "wrap": {"@type": "koral:termGroup", "relation": "relation:and", "operands": [{"@type": "koral:term", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq"}]}}`,
+			expected: `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}}`,
+			matches:  1,
+		},
+		{
+			name:     "OR group",
+			dir:      AtoB,
+			input:    `{"@type": "koral:token", "wrap": {"@type": "koral:termGroup", "relation": "relation:or", "operands": [{"@type": "koral:term", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq"}]}}`,
+			expected: `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}}`,
+			matches:  1,
+		},
+		{
+			name:     "reverse direction",
+			dir:      BtoA,
+			input:    `{"@type": "koral:token", "wrap": {"@type": "koral:termGroup", "relation": "relation:and", "operands": [{"@type": "koral:term", "foundry": "upos", "key": "PRON", "layer": "p", "match": "match:eq"}]}}`,
+			expected: `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq"}}`,
+			matches:  1,
+		},
+		{
+			name:     "non-matching operand",
+			dir:      AtoB,
+			input:    `{"@type": "koral:token", "wrap": {"@type": "koral:termGroup", "relation": "relation:and", "operands": [{"@type": "koral:term", "foundry": "opennlp", "key": "ART", "layer": "p", "match": "match:eq"}]}}`,
+			expected: `{"@type": "koral:token", "wrap": {"@type": "koral:termGroup", "relation": "relation:and", "operands": [{"@type": "koral:term", "foundry": "opennlp", "key": "ART", "layer": "p", "match": "match:eq"}]}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: tt.dir}, parseJSON(t, tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, parseJSON(t, tt.expected), result)
+
+			matches, err := m.MatchingRules("group-test", tt.dir, parseJSON(t, tt.input))
+			require.NoError(t, err)
+			assert.Len(t, matches, tt.matches)
+		})
+	}
+}
+
+func TestFoundryAndLayerRenames(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:             "rename-test",
+		FoundryA:       "opennlp",
+		LayerA:         "p",
+		FoundryB:       "upos",
+		LayerB:         "p",
+		FoundryRenames: map[string]string{"opennlp": "opennlp2", "upos": "opennlp"},
+		Mappings:       []config.MappingRule{"[PIDAT] <> [DET]"},
+	}})
+	require.NoError(t, err)
+
+	input := func() any {
+		return parseJSON(t, `{
+			"@type": "koral:token",
+			"wrap": {
+				"@type": "koral:termGroup",
+				"relation": "relation:and",
+				"operands": [
+					{"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"},
+					{"@type": "koral:term", "foundry": "opennlp", "key": "Sg", "layer": "m", "match": "match:eq"},
+					{"@type": "koral:term", "foundry": "marmot", "key": "NN", "layer": "p", "match": "match:eq"}
+				]
+			}
+		}`)
+	}
+	terms := func(result any) map[string]string {
+		operands := result.(map[string]any)["wrap"].(map[string]any)["operands"].([]any)
+		found := map[string]string{}
+		for _, op := range operands {
+			term := op.(map[string]any)
+			found[term["key"].(string)] = term["foundry"].(string) + "/" + term["layer"].(string)
+		}
+		return found
+	}
+
+	// Renames apply after the rules, including to the mapped term, and
+	// renamed names are not renamed again
+	result, err := m.ApplyQueryMappings("rename-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"DET": "opennlp/p", "Sg": "opennlp2/m", "NN": "marmot/p"}, terms(result))
+
+	// Options override the list settings
+	result, err = m.ApplyQueryMappings("rename-test", MappingOptions{
+		Direction:      AtoB,
+		FoundryRenames: map[string]string{},
+		LayerRenames:   map[string]string{"m": "morph"},
+	}, input())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"DET": "upos/p", "Sg": "opennlp/morph", "NN": "marmot/p"}, terms(result))
+}
+
+func TestReload(t *testing.T) {
+	lists := func(key string) []config.MappingList {
+		return []config.MappingList{{
+			ID:       "reload-test",
+			FoundryA: "opennlp",
+			LayerA:   "p",
+			FoundryB: "upos",
+			LayerB:   "p",
+			Mappings: []config.MappingRule{config.MappingRule("[PIDAT] <> [" + key + "]")},
+		}}
+	}
+	input := func() any {
+		return parseJSON(t, `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}}`)
+	}
+	mappedKey := func(result any) string {
+		return result.(map[string]any)["wrap"].(map[string]any)["key"].(string)
+	}
+
+	m, err := NewMapper(lists("DET"), WithEditorName("test-editor"))
+	require.NoError(t, err)
+
+	result, err := m.ApplyQueryMappings("reload-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	assert.Equal(t, "DET", mappedKey(result))
+
+	require.NoError(t, m.Reload(lists("PRON")))
+	result, err = m.ApplyQueryMappings("reload-test", MappingOptions{Direction: AtoB, AddRewrites: true}, input())
+	require.NoError(t, err)
+	assert.Equal(t, "PRON", mappedKey(result))
+
+	// Options are kept
+	rewrites := result.(map[string]any)["wrap"].(map[string]any)["rewrites"].([]any)
+	assert.Equal(t, "test-editor", rewrites[0].(map[string]any)["editor"])
+
+	// Invalid lists keep the previous ones
+	require.Error(t, m.Reload([]config.MappingList{{ID: "broken", Mappings: []config.MappingRule{"[PIDAT <> [DET]"}}}))
+	result, err = m.ApplyQueryMappings("reload-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	assert.Equal(t, "PRON", mappedKey(result))
+
+	// Transformations running during reloads see either state as a whole
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				result, err := m.CascadeQueryMappings(
+					[]string{"reload-test", "reload-test"},
+					[]MappingOptions{{Direction: AtoB}, {Direction: AtoB}},
+					input())
+				if err != nil {
+					errs <- err
+					return
+				}
+				if key := mappedKey(result); key != "DET" && key != "PRON" {
+					errs <- fmt.Errorf("unexpected key %s", key)
+					return
+				}
+				m.Stats()
+			}
+		}()
+	}
+	for i := range 100 {
+		key := "DET"
+		if i%2 == 1 {
+			key = "PRON"
+		}
+		require.NoError(t, m.Reload(lists(key)))
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestQueryMaxDepth(t *testing.T) {
+	m := newTermGroupMapper(t, "[opennlp/p=NN] <> [upos/p=NOUN]")
+
+	// nested wraps the token in depth sequence groups
+	nested := func(depth int) any {
+		var node any = map[string]any{
+			"@type": "koral:token",
+			"wrap":  map[string]any{"@type": "koral:term", "foundry": "opennlp", "layer": "p", "key": "NN"},
+		}
+		for range depth {
+			node = map[string]any{
+				"@type":     "koral:group",
+				"operation": "operation:sequence",
+				"operands":  []any{node},
+			}
+		}
+		return map[string]any{"query": node}
+	}
+
+	_, err := m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB, MaxDepth: 22}, nested(10))
+	require.NoError(t, err)
+
+	_, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB, MaxDepth: 21}, nested(10))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	assert.Contains(t, err.Error(), "maximum nesting depth of 21")
+
+	_, err = m.ApplyQueryMappings("group-test", MappingOptions{Direction: AtoB}, nested(1000))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "maximum nesting depth of 256")
+}
+
+func TestAllowedFoundriesAndLayers(t *testing.T) {
+	newList := func(rules ...config.MappingRule) config.MappingList {
+		return config.MappingList{
+			ID:               "allowed-test",
+			FoundryA:         "opennlp",
+			LayerA:           "p",
+			FoundryB:         "upos",
+			LayerB:           "p",
+			AllowedFoundries: []string{"opennlp", "upos"},
+			AllowedLayers:    []string{"p"},
+			Mappings:         rules,
+		}
+	}
+
+	_, err := NewMapper([]config.MappingList{newList("[PIDAT] <> [DET]", "[opennlp/p=PPER] <> [upos/p=PRON]")})
+	require.NoError(t, err)
+
+	_, err = NewMapper([]config.MappingList{newList("[PIDAT] <> [DET]", "[opennpl/p=PPER] <> [upos/p=PRON]")})
+	require.Error(t, err)
+	assert.Equal(t, "invalid mappings for list allowed-test: rule 1: foundry 'opennpl' is not in allowedFoundries [opennlp upos]", err.Error())
+
+	_, err = NewMapper([]config.MappingList{newList("[PIDAT] <> [DET & upos/m=Definite:Def]")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rule 0: layer 'm' is not in allowedLayers [p]")
+
+	// Defaults of the list are checked, too
+	list := newList("[PIDAT] <> [DET]")
+	list.FoundryB = "ud"
+	_, err = NewMapper([]config.MappingList{list})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "foundry 'ud' is not in allowedFoundries")
+
+	// Without an allow-list, any foundry is accepted
+	list = newList("[opennpl/p=PPER] <> [upos/m=PRON]")
+	list.AllowedFoundries, list.AllowedLayers = nil, nil
+	_, err = NewMapper([]config.MappingList{list})
+	require.NoError(t, err)
+}
+
+func TestMixedMappingList(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "mixed",
+		Type:     "mixed",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{
+			"[DET] <> [PRON]",
+			"textClass=novel <> genre=fiction",
+		},
+	}})
+	require.NoError(t, err)
+
+	token := func(foundry, key string) string {
+		return `{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "` + foundry + `", "key": "` + key + `", "layer": "p", "match": "match:eq"}}`
+	}
+	doc := func(key, value string) string {
+		return `{"@type": "koral:doc", "key": "` + key + `", "value": "` + value + `", "match": "match:eq"}`
+	}
+
+	t.Run("Query and corpus", func(t *testing.T) {
+		input := parseJSON(t, `{"query": `+token("opennlp", "DET")+`, "corpus": `+doc("textClass", "novel")+`}`)
+		result, err := m.ApplyQueryMappings("mixed", MappingOptions{Direction: AtoB}, input)
+		require.NoError(t, err)
+		assert.Equal(t, parseJSON(t, `{"query": `+token("upos", "PRON")+`, "corpus": `+doc("genre", "fiction")+`}`), result)
+
+		result, err = m.ApplyQueryMappings("mixed", MappingOptions{Direction: BtoA}, result)
+		require.NoError(t, err)
+		assert.Equal(t, parseJSON(t, `{"query": `+token("opennlp", "DET")+`, "corpus": `+doc("textClass", "novel")+`}`), result)
+	})
+
+	t.Run("Bare token", func(t *testing.T) {
+		result, err := m.ApplyQueryMappings("mixed", MappingOptions{Direction: AtoB}, parseJSON(t, token("opennlp", "DET")))
+		require.NoError(t, err)
+		assert.Equal(t, parseJSON(t, token("upos", "PRON")), result)
+	})
+
+	t.Run("Corpus only", func(t *testing.T) {
+		result, err := m.ApplyQueryMappings("mixed", MappingOptions{Direction: AtoB}, parseJSON(t, `{"collection": `+doc("textClass", "novel")+`}`))
+		require.NoError(t, err)
+		assert.Equal(t, parseJSON(t, `{"collection": `+doc("genre", "fiction")+`}`), result)
+	})
+
+	t.Run("Response snippet and fields", func(t *testing.T) {
+		input := parseJSON(t, `{
+			"snippet": "<span title=\"opennlp/p:DET\">Der</span>",
+			"fields": [{"@type": "koral:field", "key": "textClass", "value": "novel", "type": "type:string"}]
+		}`)
+		result, err := m.ApplyResponseMappings("mixed", MappingOptions{Direction: AtoB}, input)
+		require.NoError(t, err)
+
+		resultMap := result.(map[string]any)
+		assert.Contains(t, resultMap["snippet"], `upos/p:PRON`)
+		fields := resultMap["fields"].([]any)
+		require.Len(t, fields, 2)
+		assert.Equal(t, "genre", fields[1].(map[string]any)["key"])
+		assert.Equal(t, "fiction", fields[1].(map[string]any)["value"])
+	})
+
+	t.Run("Stats and matching rules use the rule index", func(t *testing.T) {
+		stats := m.Stats()["mixed"]
+		assert.Positive(t, stats[0])
+		assert.Positive(t, stats[1])
+
+		matches, err := m.MatchingRules("mixed", AtoB, parseJSON(t, `{"query": `+token("opennlp", "DET")+`, "corpus": `+doc("textClass", "novel")+`}`))
+		require.NoError(t, err)
+		require.Len(t, matches, 2)
+		assert.Equal(t, 0, matches[0].RuleIndex)
+		assert.Equal(t, 1, matches[1].RuleIndex)
+		assert.Equal(t, "textClass=novel <> genre=fiction", matches[1].Rule)
+	})
+
+	t.Run("Invalid rule", func(t *testing.T) {
+		_, err := NewMapper([]config.MappingList{{
+			ID:       "mixed",
+			Type:     "mixed",
+			Mappings: []config.MappingRule{"[DET] <> [PRON]", "textClass=novel"},
+		}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse corpus mappings")
+	})
+}
@@ -0,0 +1,218 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/KorAP/Koral-Mapper/ast"
+	"github.com/KorAP/Koral-Mapper/matcher"
+	"github.com/KorAP/Koral-Mapper/parser"
+)
+
+// RuleMatch describes a rule that would apply to a part of the input.
+type RuleMatch struct {
+	RuleIndex int    // Index of the rule in the mapping list
+	Rule      string // The rule as written in the mapping list
+	Matched   any    // JSON representation of the matched subtree
+}
+
+// MatchingRules reports which rules of the mapping list identified by
+// mappingID would match the given input in the given direction, without
+// transforming it. For annotation lists the input may be a bare query node
+// or a wrapper object containing a "query" field; for corpus lists it must
+// contain a "corpus" or "collection" field. Matches are reported in rule
+// order, one per matched subtree.
+func (m *Mapper) MatchingRules(mappingID string, dir Direction, jsonData any) ([]RuleMatch, error) {
+	m = m.snapshot()
+	mappingID = m.resolveAlias(mappingID)
+	list, exists := m.mappingLists[mappingID]
+	if !exists {
+		return nil, errMappingNotFound(mappingID)
+	}
+
+	if list.IsCorpus() {
+		return m.matchingCorpusRules(mappingID, dir, jsonData)
+	}
+	if list.IsMixed() {
+		matches, err := m.matchingQueryRules(mappingID, dir, jsonData)
+		if err != nil {
+			return nil, err
+		}
+		corpusMatches, err := m.matchingCorpusRules(mappingID, dir, jsonData)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, corpusMatches...)
+		slices.SortStableFunc(matches, func(a, b RuleMatch) int { return a.RuleIndex - b.RuleIndex })
+		return matches, nil
+	}
+	return m.matchingQueryRules(mappingID, dir, jsonData)
+}
+
+// matchingQueryRules reports the matches of the annotation rules of a
+// list in the query, like MatchingRules.
+func (m *Mapper) matchingQueryRules(mappingID string, dir Direction, jsonData any) ([]RuleMatch, error) {
+	list := m.mappingLists[mappingID]
+
+	queryData := jsonData
+	if jsonMap, ok := jsonData.(map[string]any); ok {
+		if query, exists := jsonMap["query"]; exists {
+			queryData = query
+		}
+	}
+	if !isValidQueryObject(queryData) {
+		return nil, nil
+	}
+
+	jsonBytes, err := json.Marshal(queryData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input JSON: %w", err)
+	}
+
+	node, err := parser.ParseJSON(jsonBytes)
+	if err != nil {
+		return nil, withKind(ErrInvalidInput, fmt.Errorf("failed to parse JSON into AST: %w", err))
+	}
+
+	// Collect the same targets the query transformation applies rules to
+	if token, ok := node.(*ast.Token); ok {
+		node = token.Wrap
+	}
+	targets := collectQueryTargets(node)
+
+	var matches []RuleMatch
+	for i, rule := range m.parsedQueryRules[mappingID] {
+		if rule == nil || !rule.Direction.Allows(bool(dir)) {
+			continue
+		}
+		pattern := rule.Lower.Wrap
+		if dir == AtoB {
+			pattern = rule.Upper.Wrap
+		}
+		if pattern == nil {
+			// An empty side never matches anything
+			continue
+		}
+
+		ruleMatcher, err := matcher.NewMatcher(ast.Pattern{Root: pattern}, ast.Replacement{Root: &ast.Term{}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create matcher for rule %d: %w", i, err)
+		}
+
+		for _, target := range targets {
+			if !ruleMatcher.Match(target) {
+				continue
+			}
+			matched, err := nodeToJSON(target)
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, RuleMatch{
+				RuleIndex: i,
+				Rule:      string(list.Mappings[i]),
+				Matched:   matched,
+			})
+		}
+	}
+
+	return matches, nil
+}
+
+// matchingCorpusRules walks the corpus section of a query like
+// applyCorpusRule does and reports the nodes each rule matches.
+func (m *Mapper) matchingCorpusRules(mappingID string, dir Direction, jsonData any) ([]RuleMatch, error) {
+	jsonMap, ok := jsonData.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	corpusData, ok := jsonMap["corpus"].(map[string]any)
+	if !ok {
+		corpusData, ok = jsonMap["collection"].(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+	}
+	if exceedsDepth(corpusData, parser.DefaultMaxDepth) {
+		return nil, withKind(ErrInvalidInput, fmt.Errorf("corpus exceeds the maximum nesting depth of %d", parser.DefaultMaxDepth))
+	}
+
+	list := m.mappingLists[mappingID]
+
+	var matches []RuleMatch
+	for i, rule := range m.parsedCorpusRules[mappingID] {
+		if rule == nil || !rule.Direction.Allows(bool(dir)) {
+			continue
+		}
+		pattern := rule.Lower
+		if dir == AtoB {
+			pattern = rule.Upper
+		}
+		for _, matched := range m.collectCorpusMatches(pattern, corpusData) {
+			matches = append(matches, RuleMatch{
+				RuleIndex: i,
+				Rule:      string(list.Mappings[i]),
+				Matched:   matched,
+			})
+		}
+	}
+	return matches, nil
+}
+
+// collectCorpusMatches returns the topmost nodes matching the pattern,
+// recursing into group operands where the group itself does not match.
+func (m *Mapper) collectCorpusMatches(pattern parser.CorpusNode, node map[string]any) []map[string]any {
+	atType, _ := node["@type"].(string)
+	if atType == "koral:docGroupRef" {
+		return nil
+	}
+
+	if m.matchCorpusNode(pattern, node) {
+		return []map[string]any{node}
+	}
+
+	if atType != "koral:docGroup" && atType != "koral:fieldGroup" {
+		return nil
+	}
+
+	var matches []map[string]any
+	operands, _ := node["operands"].([]any)
+	for _, opRaw := range operands {
+		if op, ok := opRaw.(map[string]any); ok {
+			matches = append(matches, m.collectCorpusMatches(pattern, op)...)
+		}
+	}
+	return matches
+}
+
+// collectQueryTargets returns the nodes best-rule selection is applied to,
+// descending into the wrapped node and operands of CatchallNodes.
+func collectQueryTargets(node ast.Node) []ast.Node {
+	catchall, ok := node.(*ast.CatchallNode)
+	if !ok || (catchall.Wrap == nil && len(catchall.Operands) == 0) {
+		return []ast.Node{node}
+	}
+
+	var targets []ast.Node
+	if catchall.Wrap != nil {
+		targets = append(targets, collectQueryTargets(catchall.Wrap)...)
+	}
+	for _, op := range catchall.Operands {
+		targets = append(targets, collectQueryTargets(op)...)
+	}
+	return targets
+}
+
+// nodeToJSON serializes an AST node into its generic JSON representation.
+func nodeToJSON(node ast.Node) (any, error) {
+	nodeBytes, err := parser.SerializeToJSON(node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize AST to JSON: %w", err)
+	}
+	var result any
+	if err := json.Unmarshal(nodeBytes, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse result JSON: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/KorAP/Koral-Mapper/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMatchingRulesMapper(t *testing.T) *Mapper {
+	t.Helper()
+	m, err := NewMapper([]config.MappingList{
+		{
+			ID:       "match-test",
+			FoundryA: "opennlp",
+			LayerA:   "p",
+			FoundryB: "upos",
+			LayerB:   "p",
+			Mappings: []config.MappingRule{
+				"[PIDAT] <> [DET & AdjType:Pdt]",
+				"[ART] <> [DET & PronType:Art]",
+				"[PIDAT | ART] <> [DET]",
+			},
+		},
+		{
+			ID:       "corpus-match-test",
+			Type:     "corpus",
+			Mappings: []config.MappingRule{"textClass=novel <> genre=fiction"},
+		},
+	})
+	require.NoError(t, err)
+	return m
+}
+
+func TestMatchingRulesSimpleTerm(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+	}`)
+
+	matches, err := m.MatchingRules("match-test", AtoB, input)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+
+	assert.Equal(t, 0, matches[0].RuleIndex)
+	assert.Equal(t, "[PIDAT] <> [DET & AdjType:Pdt]", matches[0].Rule)
+	assert.Equal(t, 2, matches[1].RuleIndex)
+
+	expected := parseJSON(t, `{"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}`)
+	assert.Equal(t, expected, matches[0].Matched)
+
+	// The input is not modified
+	assert.Equal(t, parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "PIDAT", "layer": "p", "match": "match:eq"}
+	}`), input)
+}
+
+func TestMatchingRulesGroupInput(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{"@type": "koral:term", "foundry": "upos", "key": "DET", "layer": "p", "match": "match:eq"},
+				{"@type": "koral:term", "foundry": "upos", "key": "PronType", "layer": "p", "match": "match:eq", "value": "Art"}
+			],
+			"relation": "relation:and"
+		}
+	}`)
+
+	matches, err := m.MatchingRules("match-test", BtoA, input)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, 1, matches[0].RuleIndex)
+	assert.Equal(t, 2, matches[1].RuleIndex)
+
+	matched := matches[0].Matched.(map[string]any)
+	assert.Equal(t, "koral:termGroup", matched["@type"])
+	assert.Len(t, matched["operands"], 2)
+}
+
+func TestMatchingRulesSequenceOperands(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	input := parseJSON(t, `{
+		"query": {
+			"@type": "koral:group",
+			"operation": "operation:sequence",
+			"operands": [
+				{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "ART", "layer": "p", "match": "match:eq"}},
+				{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}}
+			]
+		}
+	}`)
+
+	matches, err := m.MatchingRules("match-test", AtoB, input)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, 1, matches[0].RuleIndex)
+	assert.Equal(t, 2, matches[1].RuleIndex)
+
+	matched := matches[0].Matched.(map[string]any)
+	assert.Equal(t, "koral:token", matched["@type"])
+}
+
+func TestMatchingRulesNoMatch(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	input := parseJSON(t, `{
+		"@type": "koral:token",
+		"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}
+	}`)
+
+	matches, err := m.MatchingRules("match-test", AtoB, input)
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestMatchingRulesCorpus(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	input := parseJSON(t, `{
+		"corpus": {
+			"@type": "koral:docGroup",
+			"operation": "operation:and",
+			"operands": [
+				{"@type": "koral:doc", "key": "textClass", "value": "novel"},
+				{"@type": "koral:doc", "key": "pubDate", "value": "2020"}
+			]
+		}
+	}`)
+
+	matches, err := m.MatchingRules("corpus-match-test", AtoB, input)
+	require.NoError(t, err)
+	require.Len(t, matches, 1)
+	assert.Equal(t, 0, matches[0].RuleIndex)
+	assert.Equal(t, "novel", matches[0].Matched.(map[string]any)["value"])
+}
+
+func TestMatchingRulesMappingListNotFound(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	_, err := m.MatchingRules("nonexistent", AtoB, map[string]any{})
+	assert.EqualError(t, err, "mapping list with ID nonexistent not found")
+}
+
+func TestMatchingRulesNestedGroupOperands(t *testing.T) {
+	m := newMatchingRulesMapper(t)
+
+	input := parseJSON(t, `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{
+				"@type": "koral:group",
+				"operation": "operation:or",
+				"operands": [
+					{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN", "layer": "p", "match": "match:eq"}},
+					{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "ART", "layer": "p", "match": "match:eq"}}
+				]
+			}
+		]
+	}`)
+
+	matches, err := m.MatchingRules("match-test", AtoB, input)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, 1, matches[0].RuleIndex)
+	assert.Equal(t, 2, matches[1].RuleIndex)
+}
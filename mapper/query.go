@@ -1,8 +1,10 @@
 package mapper
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/KorAP/Koral-Mapper/ast"
 	"github.com/KorAP/Koral-Mapper/matcher"
@@ -11,10 +13,22 @@ import (
 
 // ApplyQueryMappings transforms a JSON query object using the mapping rules
 // identified by mappingID. The input may be a bare query node or a wrapper
-// object containing a "query" field; both forms are accepted.
+// object containing the query under one of the keys set with
+// WithQueryKeys ("query" by default); both forms are accepted.
 func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonData any) (any, error) {
+	return m.ApplyQueryMappingsContext(context.Background(), mappingID, opts, jsonData)
+}
+
+// ApplyQueryMappingsContext is like ApplyQueryMappings, but stops with the
+// context's error as soon as ctx is canceled or its deadline is exceeded.
+func (m *Mapper) ApplyQueryMappingsContext(ctx context.Context, mappingID string, opts MappingOptions, jsonData any) (any, error) {
+	m = m.snapshot()
+	mappingID = m.resolveAlias(mappingID)
+	if m.isPassthrough(mappingID) {
+		return jsonData, nil
+	}
 	if _, exists := m.mappingLists[mappingID]; !exists {
-		return nil, fmt.Errorf("mapping list with ID %s not found", mappingID)
+		return nil, errMappingNotFound(mappingID)
 	}
 
 	if err := m.validateEffectiveOptions(mappingID, opts); err != nil {
@@ -22,19 +36,37 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 	}
 
 	if m.mappingLists[mappingID].IsCorpus() {
-		return m.applyCorpusQueryMappings(mappingID, opts, jsonData)
+		return m.applyCorpusQueryMappings(ctx, mappingID, opts, jsonData)
+	}
+	if m.mappingLists[mappingID].IsMixed() {
+		// Annotation rules apply to the query, corpus rules to the corpus
+		result, err := m.applyAnnotationQueryMappings(ctx, mappingID, opts, jsonData)
+		if err != nil {
+			return nil, err
+		}
+		return m.applyCorpusQueryMappings(ctx, mappingID, opts, result)
 	}
+	return m.applyAnnotationQueryMappings(ctx, mappingID, opts, jsonData)
+}
 
+// applyAnnotationQueryMappings processes the query of a wrapper object,
+// or a bare query node, with annotation rules.
+func (m *Mapper) applyAnnotationQueryMappings(ctx context.Context, mappingID string, opts MappingOptions, jsonData any) (any, error) {
 	rules := m.parsedQueryRules[mappingID]
 
 	// Detect wrapper: input may be {"query": ...} or a bare koral:token
 	var queryData any
+	var queryKey string
 	var hasQueryWrapper bool
 
 	if jsonMap, ok := jsonData.(map[string]any); ok {
-		if query, exists := jsonMap["query"]; exists {
-			queryData = query
-			hasQueryWrapper = true
+		for _, key := range m.queryKeys {
+			if query, exists := jsonMap[key]; exists {
+				queryData = query
+				queryKey = key
+				hasQueryWrapper = true
+				break
+			}
 		}
 	}
 
@@ -47,6 +79,12 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 		return jsonData, nil
 	}
 
+	// References to stored queries have no annotations to map and are
+	// passed through untouched, like koral:docGroupRef on the corpus side
+	if isQueryReference(queryData) {
+		return jsonData, nil
+	}
+
 	// Strip pre-existing rewrites before AST conversion so they do not
 	// interfere with matching. They are restored after transformation.
 	var oldRewrites any
@@ -62,16 +100,20 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 		return nil, fmt.Errorf("failed to marshal input JSON: %w", err)
 	}
 
-	node, err := parser.ParseJSON(jsonBytes)
+	node, err := parser.ParseJSONWithMaxDepth(jsonBytes, opts.MaxDepth)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse JSON into AST: %w", err)
+		return nil, withKind(ErrInvalidInput, fmt.Errorf("failed to parse JSON into AST: %w", err))
 	}
 
 	// Unwrap Token so matching operates on the inner node; re-wrapped later.
 	isToken := false
+	shorthand := false
 	var tokenWrap ast.Node
+	var tokenExtra map[string]any
 	if token, ok := node.(*ast.Token); ok {
 		isToken = true
+		shorthand = token.Shorthand
+		tokenExtra = token.Extra
 		tokenWrap = token.Wrap
 		node = tokenWrap
 	}
@@ -115,7 +157,7 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 
 		patternKey := patternCacheKey{ruleIndex: i, foundry: patternFoundry, layer: patternLayer, isReplacement: false}
 		processedPattern, exists := patternCache[patternKey]
-		if !exists {
+		if !exists && pattern != nil {
 			processedPattern = pattern.Clone()
 			if patternFoundry != "" || patternLayer != "" {
 				ast.ApplyFoundryAndLayerOverrides(processedPattern, patternFoundry, patternLayer)
@@ -125,14 +167,24 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 		return processedPattern, replacement, pattern, nil
 	}
 
+	// deletedBy is the index of the rule that deleted a node last
+	deletedBy := -1
+
 	// applyBestRule applies the best-matching rule (by specificity) to a single node.
 	applyBestRule := func(target ast.Node) (ast.Node, error) {
 		var candidates []matchCandidate
 		for i, rule := range rules {
+			if rule == nil || !m.ruleSelected(mappingID, i, opts) {
+				continue
+			}
 			processedPattern, replacement, _, err := getProcessedPattern(i, rule)
 			if err != nil {
 				return nil, err
 			}
+			if processedPattern == nil {
+				// An empty side never matches anything
+				continue
+			}
 			tempMatcher, err := matcher.NewMatcher(ast.Pattern{Root: processedPattern}, ast.Replacement{Root: &ast.Term{}})
 			if err != nil {
 				return nil, fmt.Errorf("failed to create temporary matcher: %w", err)
@@ -157,7 +209,7 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 
 		replacementKey := patternCacheKey{ruleIndex: best.ruleIndex, foundry: replacementFoundry, layer: replacementLayer, isReplacement: true}
 		processedReplacement, exists := patternCache[replacementKey]
-		if !exists {
+		if !exists && replacement != nil {
 			processedReplacement = replacement.Clone()
 			if replacementFoundry != "" || replacementLayer != "" {
 				ast.ApplyFoundryAndLayerOverrides(processedReplacement, replacementFoundry, replacementLayer)
@@ -172,57 +224,109 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 
 		// Collect pre-existing rewrites before replacement so they
 		// survive when the matcher creates a fresh replacement node.
-		existingRewrites := collectRewrites(node)
+		existingRewrites := collectRewrites(target)
 
 		actualMatcher, err := matcher.NewMatcher(ast.Pattern{Root: processedPattern}, ast.Replacement{Root: processedReplacement})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create matcher: %w", err)
 		}
 		result := actualMatcher.Replace(target)
+		m.recordRule(mappingID, best.ruleIndex, opts)
+		if result == nil {
+			// A deletion rule removed the node entirely; the caller
+			// decides what remains in its place
+			deletedBy = best.ruleIndex
+			return nil, nil
+		}
 
 		if len(existingRewrites) > 0 {
 			prependRewrites(result, existingRewrites)
 		}
 
 		if opts.AddRewrites {
-			recordRewrites(result, beforeNode)
+			recordRewrites(m.rewriteTemplate(mappingID, best.ruleIndex), result, beforeNode)
 		}
 		return result, nil
 	}
 
-	// For CatchallNodes (any complex KoralQuery operation like sequence,
-	// disjunction, or position), apply best-rule selection per operand
-	// so each token gets its own best-matching rule.
-	if catchall, ok := node.(*ast.CatchallNode); ok && len(catchall.Operands) > 0 {
-		newOperands := make([]ast.Node, len(catchall.Operands))
-		for i, op := range catchall.Operands {
-			replaced, err := applyBestRule(op)
-			if err != nil {
-				return nil, err
-			}
-			newOperands[i] = replaced
+	// applyRecursive descends into CatchallNodes (any complex KoralQuery
+	// operation like sequence, disjunction, or position, including nested
+	// groups) and applies best-rule selection to every wrapped node and
+	// operand, so each token gets its own best-matching rule.
+	var applyRecursive func(target ast.Node) (ast.Node, error)
+	applyRecursive = func(target ast.Node) (ast.Node, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		node = &ast.CatchallNode{
+		catchall, ok := target.(*ast.CatchallNode)
+		if !ok || (catchall.Wrap == nil && len(catchall.Operands) == 0) {
+			return applyBestRule(target)
+		}
+
+		newCatchall := &ast.CatchallNode{
 			NodeType:   catchall.NodeType,
 			RawContent: catchall.RawContent,
-			Wrap:       catchall.Wrap,
-			Operands:   newOperands,
 		}
-	} else {
-		var err error
-		node, err = applyBestRule(node)
-		if err != nil {
-			return nil, err
+		if catchall.Wrap != nil {
+			wrapped, err := applyRecursive(catchall.Wrap)
+			if err != nil {
+				return nil, err
+			}
+			if wrapped == nil {
+				wrapped = catchall.Wrap
+			}
+			newCatchall.Wrap = wrapped
+		}
+		if len(catchall.Operands) > 0 {
+			newCatchall.Operands = make([]ast.Node, len(catchall.Operands))
+			for i, op := range catchall.Operands {
+				replaced, err := applyRecursive(op)
+				if err != nil {
+					return nil, err
+				}
+				if replaced == nil {
+					replaced = op
+				}
+				newCatchall.Operands[i] = replaced
+			}
 		}
+		return newCatchall, nil
+	}
+
+	mapped, err := applyRecursive(node)
+	if err != nil {
+		return nil, err
 	}
 
 	var result ast.Node
-	if isToken {
-		result = &ast.Token{Wrap: node}
-	} else {
+	switch {
+	case mapped != nil && isToken:
+		result = &ast.Token{Wrap: mapped, Shorthand: shorthand, Extra: tokenExtra}
+	case mapped != nil:
+		result = mapped
+	case isToken:
+		// A deletion rule removed the sole wrap of the token, leaving a
+		// token without constraints. Rewrites move to the token.
+		emptyToken := &ast.Token{Extra: tokenExtra}
+		prependRewrites(emptyToken, collectRewrites(node))
+		if opts.AddRewrites {
+			addRewriteToNode(m.rewriteTemplate(mappingID, deletedBy), emptyToken, node)
+		}
+		result = emptyToken
+	default:
+		// A bare term cannot be deleted without a token to remain
 		result = node
 	}
 
+	foundryRenames, layerRenames := m.renames(mappingID, opts)
+	if len(foundryRenames) > 0 || len(layerRenames) > 0 {
+		ast.RenameFoundriesAndLayers(result, foundryRenames, layerRenames)
+	}
+
+	if opts.StripRewrites {
+		stripRewrites(result, m.editorName)
+	}
+
 	resultBytes, err := parser.SerializeToJSON(result)
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize AST to JSON: %w", err)
@@ -258,8 +362,20 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 				}
 				processedRewrites[i] = transformedRewrite
 			}
+			if opts.StripRewrites {
+				processedRewrites = slices.DeleteFunc(processedRewrites, func(rewrite any) bool {
+					return isRawRewriteBy(rewrite, m.editorName)
+				})
+			}
 			if resultMap, ok := resultData.(map[string]any); ok {
-				resultMap["rewrites"] = processedRewrites
+				// Rewrites added during this transformation follow the
+				// pre-existing ones
+				if added, ok := resultMap["rewrites"].([]any); ok {
+					processedRewrites = append(processedRewrites, added...)
+				}
+				if len(processedRewrites) > 0 || !opts.StripRewrites {
+					resultMap["rewrites"] = processedRewrites
+				}
 			}
 		} else {
 			if resultMap, ok := resultData.(map[string]any); ok {
@@ -270,7 +386,15 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 
 	if hasQueryWrapper {
 		if wrapper, ok := jsonData.(map[string]any); ok {
-			wrapper["query"] = resultData
+			wrapper[queryKey] = resultData
+			if opts.StripRewrites {
+				// Clean up rewrites of previous corpus steps as well
+				for _, key := range corpusKeys {
+					if corpus, exists := wrapper[key]; exists {
+						wrapper[key] = withoutRawRewrites(corpus, m.editorName)
+					}
+				}
+			}
 			return wrapper, nil
 		}
 	}
@@ -278,6 +402,20 @@ func (m *Mapper) ApplyQueryMappings(mappingID string, opts MappingOptions, jsonD
 	return resultData, nil
 }
 
+// renames resolves the foundry and layer renames of a transformation:
+// the option overrides if set, otherwise the mapping list settings.
+func (m *Mapper) renames(mappingID string, opts MappingOptions) (map[string]string, map[string]string) {
+	list := m.mappingLists[mappingID]
+	foundries, layers := list.FoundryRenames, list.LayerRenames
+	if opts.FoundryRenames != nil {
+		foundries = opts.FoundryRenames
+	}
+	if opts.LayerRenames != nil {
+		layers = opts.LayerRenames
+	}
+	return foundries, layers
+}
+
 // selectBestCandidate picks the best match from candidates using:
 //  1. Highest pattern specificity (most features matched)
 //  2. Lowest replacement specificity (broadest/fallback output)
@@ -306,7 +444,7 @@ type matchCandidate struct {
 // recordRewrites compares the new node against the before-snapshot and
 // attaches rewrite entries to any changed nodes. It handles both simple
 // nodes (Term, TermGroup) and container nodes (CatchallNode with operands).
-func recordRewrites(newNode, beforeNode ast.Node) {
+func recordRewrites(template ast.Rewrite, newNode, beforeNode ast.Node) {
 	if ast.NodesEqual(newNode, beforeNode) {
 		return
 	}
@@ -321,19 +459,19 @@ func recordRewrites(newNode, beforeNode ast.Node) {
 					break
 				}
 				oldOp := oldCatchall.Operands[i]
-				recordRewritesForOperand(newOp, oldOp)
+				recordRewritesForOperand(template, newOp, oldOp)
 			}
 			return
 		}
 	}
 
-	addRewriteToNode(newNode, beforeNode)
+	addRewriteToNode(template, newNode, beforeNode)
 }
 
 // recordRewritesForOperand handles rewrite recording for a single operand,
 // unwrapping Token nodes so the rewrite attaches to the inner term/termGroup
 // rather than the token wrapper.
-func recordRewritesForOperand(newOp, oldOp ast.Node) {
+func recordRewritesForOperand(template ast.Rewrite, newOp, oldOp ast.Node) {
 	if ast.NodesEqual(newOp, oldOp) {
 		return
 	}
@@ -351,13 +489,13 @@ func recordRewritesForOperand(newOp, oldOp ast.Node) {
 		return
 	}
 
-	addRewriteToNode(newInner, oldInner)
+	addRewriteToNode(template, newInner, oldInner)
 }
 
 // addRewriteToNode creates and attaches rewrite entries to a node,
 // recording what the node looked like before the change.
-func addRewriteToNode(newNode, originalNode ast.Node) {
-	for _, rw := range buildRewrites(originalNode, newNode) {
+func addRewriteToNode(template ast.Rewrite, newNode, originalNode ast.Node) {
+	for _, rw := range buildRewrites(template, originalNode, newNode) {
 		ast.AppendRewrite(newNode, rw)
 	}
 }
@@ -366,19 +504,35 @@ func addRewriteToNode(newNode, originalNode ast.Node) {
 // originalNode and newNode. One rule application on one object always produces
 // exactly one koral:rewrite with the full original serialized in `original`.
 // Rewrites from previous cascade steps are stripped from the original so the
-// serialized value only contains the node's own content.
-func buildRewrites(originalNode, newNode ast.Node) []ast.Rewrite {
+// serialized value only contains the node's own content. Editor, operation
+// and scope are taken from the template.
+func buildRewrites(template ast.Rewrite, originalNode, newNode ast.Node) []ast.Rewrite {
 	clean := originalNode.Clone()
 	ast.StripRewrites(clean)
 	originalBytes, err := parser.SerializeToJSON(clean)
 	if err != nil {
-		return []ast.Rewrite{{Editor: RewriteEditor}}
+		return []ast.Rewrite{template}
 	}
 	var originalJSON any
 	if err := json.Unmarshal(originalBytes, &originalJSON); err != nil {
-		return []ast.Rewrite{{Editor: RewriteEditor}}
+		return []ast.Rewrite{template}
 	}
-	return []ast.Rewrite{{Editor: RewriteEditor, Original: originalJSON}}
+	rw := template
+	rw.Original = originalJSON
+	return []ast.Rewrite{rw}
+}
+
+// rewriteTemplate returns the rewrite emitted for the rule at ruleIndex of
+// the mapping list, carrying the editor and the operation and scope the
+// rule asks for. A negative index yields the defaults.
+func (m *Mapper) rewriteTemplate(mappingID string, ruleIndex int) ast.Rewrite {
+	rw := ast.Rewrite{Editor: m.editorName}
+	if list, ok := m.mappingLists[mappingID]; ok && ruleIndex >= 0 {
+		meta := list.RuleMetaAt(ruleIndex)
+		rw.Operation = meta.Operation
+		rw.Scope = meta.Scope
+	}
+	return rw
 }
 
 // collectRewrites returns the rewrites from the deepest rewritable node.
@@ -419,6 +573,53 @@ func prependRewrites(node ast.Node, rewrites []ast.Rewrite) {
 	}
 }
 
+// stripRewrites removes the rewrites by editor from node and all nodes
+// below it. Rewrites kept in the raw content of CatchallNodes are removed
+// as well.
+func stripRewrites(node ast.Node, editor string) {
+	switch n := node.(type) {
+	case *ast.Token:
+		n.Rewrites = withoutEditor(n.Rewrites, editor)
+		if n.Wrap != nil {
+			stripRewrites(n.Wrap, editor)
+		}
+	case *ast.TermGroup:
+		n.Rewrites = withoutEditor(n.Rewrites, editor)
+		for _, op := range n.Operands {
+			stripRewrites(op, editor)
+		}
+	case *ast.Term:
+		n.Rewrites = withoutEditor(n.Rewrites, editor)
+	case *ast.CatchallNode:
+		if n.RawContent != nil {
+			var raw map[string]any
+			if err := json.Unmarshal(n.RawContent, &raw); err == nil {
+				if content, err := json.Marshal(withoutRawRewrites(raw, editor)); err == nil {
+					n.RawContent = content
+				}
+			}
+		}
+		if n.Wrap != nil {
+			stripRewrites(n.Wrap, editor)
+		}
+		for _, op := range n.Operands {
+			stripRewrites(op, editor)
+		}
+	}
+}
+
+// withoutEditor returns the rewrites not made by editor, or nil if none
+// remain.
+func withoutEditor(rewrites []ast.Rewrite, editor string) []ast.Rewrite {
+	var kept []ast.Rewrite
+	for _, rewrite := range rewrites {
+		if rewrite.Editor != editor {
+			kept = append(kept, rewrite)
+		}
+	}
+	return kept
+}
+
 // isValidQueryObject returns true if data is a JSON object with an @type field.
 func isValidQueryObject(data any) bool {
 	queryMap, ok := data.(map[string]any)
@@ -428,3 +629,13 @@ func isValidQueryObject(data any) bool {
 	_, ok = queryMap["@type"]
 	return ok
 }
+
+// isQueryReference returns true for a koral:queryRef node.
+func isQueryReference(data any) bool {
+	queryMap, ok := data.(map[string]any)
+	if !ok {
+		return false
+	}
+	atType, _ := queryMap["@type"].(string)
+	return atType == "koral:queryRef"
+}
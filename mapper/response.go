@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"maps"
@@ -15,19 +16,89 @@ import (
 
 // ApplyResponseMappings applies the specified mapping rules to a JSON object
 func (m *Mapper) ApplyResponseMappings(mappingID string, opts MappingOptions, jsonData any) (any, error) {
+	return m.ApplyResponseMappingsContext(context.Background(), mappingID, opts, jsonData)
+}
+
+// ApplyResponseMappingsContext is like ApplyResponseMappings, but stops with
+// the context's error as soon as ctx is canceled or its deadline is exceeded.
+func (m *Mapper) ApplyResponseMappingsContext(ctx context.Context, mappingID string, opts MappingOptions, jsonData any) (any, error) {
+	m = m.snapshot()
+	mappingID = m.resolveAlias(mappingID)
+	if m.isPassthrough(mappingID) {
+		return jsonData, nil
+	}
+
 	// Validate mapping ID
 	if _, exists := m.mappingLists[mappingID]; !exists {
-		return nil, fmt.Errorf("mapping list with ID %s not found", mappingID)
+		return nil, errMappingNotFound(mappingID)
 	}
 
 	if err := m.validateEffectiveOptions(mappingID, opts); err != nil {
 		return nil, err
 	}
 
-	if m.mappingLists[mappingID].IsCorpus() {
-		return m.applyCorpusResponseMappings(mappingID, opts, jsonData)
+	apply := func(data any) (any, error) {
+		list := m.mappingLists[mappingID]
+		if list.IsCorpus() {
+			return m.applyCorpusResponseMappings(mappingID, opts, data)
+		}
+		mapped, err := m.applySnippetMappings(ctx, mappingID, opts, data)
+		if err != nil {
+			return nil, err
+		}
+		mapped, err = m.applyReferenceMappings(ctx, mappingID, opts, mapped)
+		if err != nil {
+			return nil, err
+		}
+		if list.IsMixed() {
+			// Annotation rules apply to the snippet, corpus rules to the fields
+			return m.applyCorpusResponseMappings(mappingID, opts, mapped)
+		}
+		return mapped, nil
+	}
+
+	result, err := apply(jsonData)
+	if err != nil {
+		return nil, err
+	}
+	return applyToMatches(result, apply)
+}
+
+// applyToMatches applies apply to every object in the "matches" array of
+// a response, as returned by Krill for search results. Other items of the
+// array are kept untouched.
+func applyToMatches(jsonData any, apply func(any) (any, error)) (any, error) {
+	jsonMap, ok := jsonData.(map[string]any)
+	if !ok {
+		return jsonData, nil
+	}
+	matches, ok := jsonMap["matches"].([]any)
+	if !ok {
+		return jsonData, nil
+	}
+
+	newMatches := make([]any, len(matches))
+	for i, match := range matches {
+		if _, ok := match.(map[string]any); !ok {
+			newMatches[i] = match
+			continue
+		}
+		mapped, err := apply(match)
+		if err != nil {
+			return nil, err
+		}
+		newMatches[i] = mapped
 	}
 
+	result := make(map[string]any, len(jsonMap))
+	maps.Copy(result, jsonMap)
+	result["matches"] = newMatches
+	return result, nil
+}
+
+// applySnippetMappings adds the annotations of the annotation mapping list
+// to the "snippet" of a response object.
+func (m *Mapper) applySnippetMappings(ctx context.Context, mappingID string, opts MappingOptions, jsonData any) (any, error) {
 	// Get the parsed rules
 	rules := m.parsedQueryRules[mappingID]
 
@@ -47,58 +118,28 @@ func (m *Mapper) ApplyResponseMappings(mappingID string, opts MappingOptions, js
 		return jsonData, nil
 	}
 
+	spanClass := m.notInIndexClass(mappingID, opts)
+
+	// Tokens that may still be annotated, if limited
+	remaining := opts.MaxMatches
+
 	// Process the snippet with each rule
 	processedSnippet := snippet
 	for ruleIndex, rule := range rules {
-		// Create pattern and replacement based on direction
-		var pattern, replacement ast.Node
-		if opts.Direction { // true means AtoB
-			pattern = rule.Upper
-			replacement = rule.Lower
-		} else {
-			pattern = rule.Lower
-			replacement = rule.Upper
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-
-		// Extract the inner nodes from the pattern and replacement tokens
-		if token, ok := pattern.(*ast.Token); ok {
-			pattern = token.Wrap
+		if opts.MaxMatches > 0 && remaining == 0 {
+			break
 		}
-		if token, ok := replacement.(*ast.Token); ok {
-			replacement = token.Wrap
+		if rule == nil || !m.ruleSelected(mappingID, ruleIndex, opts) {
+			continue
 		}
 
-		// Apply foundry and layer overrides with proper precedence
-		mappingList := m.mappingLists[mappingID]
-
-		// Determine foundry and layer values based on direction
-		var patternFoundry, patternLayer, replacementFoundry, replacementLayer string
-		if opts.Direction { // AtoB
-			patternFoundry, patternLayer = opts.FoundryA, opts.LayerA
-			replacementFoundry, replacementLayer = opts.FoundryB, opts.LayerB
-			// Apply mapping list defaults if not specified
-			if replacementFoundry == "" {
-				replacementFoundry = mappingList.FoundryB
-			}
-			if replacementLayer == "" {
-				replacementLayer = mappingList.LayerB
-			}
-		} else { // BtoA
-			patternFoundry, patternLayer = opts.FoundryB, opts.LayerB
-			replacementFoundry, replacementLayer = opts.FoundryA, opts.LayerA
-			// Apply mapping list defaults if not specified
-			if replacementFoundry == "" {
-				replacementFoundry = mappingList.FoundryA
-			}
-			if replacementLayer == "" {
-				replacementLayer = mappingList.LayerA
-			}
-		}
-
-		// Clone pattern and apply foundry and layer overrides
-		processedPattern := pattern.Clone()
-		if patternFoundry != "" || patternLayer != "" {
-			ast.ApplyFoundryAndLayerOverrides(processedPattern, patternFoundry, patternLayer)
+		processedPattern, replacement, replacementFoundry, replacementLayer := m.responseRule(mappingID, rule, opts)
+		// Deletion rules have no annotations to add to a snippet
+		if processedPattern == nil {
+			continue
 		}
 
 		// Create snippet matcher for this rule
@@ -109,6 +150,8 @@ func (m *Mapper) ApplyResponseMappings(mappingID string, opts MappingOptions, js
 		if err != nil {
 			continue // Skip this rule if we can't create a matcher
 		}
+		snippetMatcher.RestrictAnnotations(opts.OnlyFoundry, opts.OnlyLayer)
+		snippetMatcher.ReadAnnotationsFrom(m.snippetAttr)
 
 		// Find matching tokens in the snippet
 		matchingTokens, err := snippetMatcher.FindMatchingTokens(processedSnippet)
@@ -138,11 +181,23 @@ func (m *Mapper) ApplyResponseMappings(mappingID string, opts MappingOptions, js
 			continue // Nothing to add
 		}
 
+		if opts.MaxMatches > 0 && len(matchingTokens) > remaining {
+			matchingTokens = matchingTokens[:remaining]
+		}
+
 		// Apply annotations to matching tokens in the snippet
-		processedSnippet, err = m.addAnnotationsToSnippet(processedSnippet, matchingTokens, annotationStrings)
+		processedSnippet, err = m.addAnnotationsToSnippet(processedSnippet, matchingTokens, annotationStrings, spanClass)
 		if err != nil {
 			continue // Skip if we can't apply annotations
 		}
+		m.recordRule(mappingID, ruleIndex, opts)
+		remaining -= len(matchingTokens)
+	}
+
+	if opts.MergeSpans {
+		if merged, err := mergeNestedSpans(processedSnippet, m.snippetAttr); err == nil {
+			processedSnippet = merged
+		}
 	}
 
 	log.Debug().Str("snippet", processedSnippet).Msg("Processed snippet")
@@ -155,6 +210,209 @@ func (m *Mapper) ApplyResponseMappings(mappingID string, opts MappingOptions, js
 	return result, nil
 }
 
+// referenceParser parses annotation references in responses.
+var referenceParser = parser.NewTitleAttributeParser()
+
+// referenceRule is an annotation rule mapping single annotation
+// references, with the annotation a matched reference is replaced by.
+type referenceRule struct {
+	index      int
+	matcher    *matcher.Matcher
+	annotation string
+}
+
+// applyReferenceMappings maps the annotation references below the
+// reference keys of a response object, e.g. the annotations named in a
+// "matchInfo" block, consistently with the annotations added to the
+// snippet. A reference is replaced by the annotation of the first rule
+// matching it; rules adding several annotations are not used, as a
+// reference can only name one.
+func (m *Mapper) applyReferenceMappings(ctx context.Context, mappingID string, opts MappingOptions, jsonData any) (any, error) {
+	jsonMap, ok := jsonData.(map[string]any)
+	if !ok {
+		return jsonData, nil
+	}
+
+	var result map[string]any
+	var rules []referenceRule
+	for _, key := range m.referenceKeys {
+		value, exists := jsonMap[key]
+		if !exists {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]any, len(jsonMap))
+			maps.Copy(result, jsonMap)
+			rules = m.referenceRules(mappingID, opts)
+		}
+		mapped, err := m.mapReferences(ctx, mappingID, opts, rules, value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = mapped
+	}
+
+	if result == nil {
+		return jsonData, nil
+	}
+	return result, nil
+}
+
+// referenceRules returns the selected rules of an annotation mapping
+// list that replace a single annotation by a single annotation.
+func (m *Mapper) referenceRules(mappingID string, opts MappingOptions) []referenceRule {
+	var rules []referenceRule
+	for ruleIndex, rule := range m.parsedQueryRules[mappingID] {
+		if rule == nil || !m.ruleSelected(mappingID, ruleIndex, opts) {
+			continue
+		}
+		pattern, replacement, foundry, layer := m.responseRule(mappingID, rule, opts)
+		if pattern == nil {
+			continue
+		}
+		ruleMatcher, err := matcher.NewMatcher(ast.Pattern{Root: pattern}, ast.Replacement{Root: replacement})
+		if err != nil {
+			continue
+		}
+		restricted := m.applyReplacementWithLayerPrecedence(
+			replacement, foundry, layer, mappingID, ruleIndex, bool(opts.Direction))
+		annotations, err := m.generateAnnotationStrings(restricted)
+		if err != nil || len(annotations) != 1 {
+			continue
+		}
+		rules = append(rules, referenceRule{index: ruleIndex, matcher: ruleMatcher, annotation: annotations[0]})
+	}
+	return rules
+}
+
+// mapReferences returns a copy of value with every string that is an
+// annotation reference, in objects and arrays at any depth, mapped by
+// the first matching rule.
+func (m *Mapper) mapReferences(ctx context.Context, mappingID string, opts MappingOptions, rules []referenceRule, value any) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return m.mapReference(mappingID, opts, rules, v), nil
+
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			mapped, err := m.mapReferences(ctx, mappingID, opts, rules, item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = mapped
+		}
+		return result, nil
+
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			mapped, err := m.mapReferences(ctx, mappingID, opts, rules, item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = mapped
+		}
+		return result, nil
+
+	default:
+		return value, nil
+	}
+}
+
+// mapReference maps a single annotation reference of the form
+// "foundry/layer:key" or "foundry/layer:key:value". Other strings and
+// references no rule matches are returned unchanged.
+func (m *Mapper) mapReference(mappingID string, opts MappingOptions, rules []referenceRule, reference string) string {
+	if !referenceParser.IsAnnotation(reference) {
+		return reference
+	}
+	terms, err := referenceParser.ParseTitleAttributesToTerms([]string{reference})
+	if err != nil || len(terms) != 1 {
+		return reference
+	}
+
+	term := terms[0].(*ast.Term)
+	if (opts.OnlyFoundry != "" && term.Foundry != opts.OnlyFoundry) ||
+		(opts.OnlyLayer != "" && term.Layer != opts.OnlyLayer) {
+		return reference
+	}
+
+	for _, rule := range rules {
+		if rule.matcher.Match(term) {
+			m.recordRule(mappingID, rule.index, opts)
+			return rule.annotation
+		}
+	}
+	return reference
+}
+
+// responseRule returns the pattern and replacement of an annotation rule
+// for matching annotations of a response in the direction of opts. The
+// pattern is a copy with the foundry and layer overrides applied, the
+// foundry and layer are the ones to restrict the replacement with.
+// Deletion rules, which have no annotations to add, return a nil pattern.
+func (m *Mapper) responseRule(mappingID string, rule *parser.MappingResult, opts MappingOptions) (pattern, replacement ast.Node, foundry, layer string) {
+	// Create pattern and replacement based on direction
+	if opts.Direction { // true means AtoB
+		pattern = rule.Upper
+		replacement = rule.Lower
+	} else {
+		pattern = rule.Lower
+		replacement = rule.Upper
+	}
+
+	// Extract the inner nodes from the pattern and replacement tokens
+	if token, ok := pattern.(*ast.Token); ok {
+		pattern = token.Wrap
+	}
+	if token, ok := replacement.(*ast.Token); ok {
+		replacement = token.Wrap
+	}
+
+	if pattern == nil || replacement == nil {
+		return nil, nil, "", ""
+	}
+
+	// Apply foundry and layer overrides with proper precedence
+	mappingList := m.mappingLists[mappingID]
+
+	// Determine foundry and layer values based on direction
+	var patternFoundry, patternLayer string
+	if opts.Direction { // AtoB
+		patternFoundry, patternLayer = opts.FoundryA, opts.LayerA
+		foundry, layer = opts.FoundryB, opts.LayerB
+		// Apply mapping list defaults if not specified
+		if foundry == "" {
+			foundry = mappingList.FoundryB
+		}
+		if layer == "" {
+			layer = mappingList.LayerB
+		}
+	} else { // BtoA
+		patternFoundry, patternLayer = opts.FoundryB, opts.LayerB
+		foundry, layer = opts.FoundryA, opts.LayerA
+		// Apply mapping list defaults if not specified
+		if foundry == "" {
+			foundry = mappingList.FoundryA
+		}
+		if layer == "" {
+			layer = mappingList.LayerA
+		}
+	}
+
+	// Clone pattern and apply foundry and layer overrides
+	pattern = pattern.Clone()
+	if patternFoundry != "" || patternLayer != "" {
+		ast.ApplyFoundryAndLayerOverrides(pattern, patternFoundry, patternLayer)
+	}
+	return pattern, replacement, foundry, layer
+}
+
 // generateAnnotationStrings converts a replacement AST node into annotation strings
 func (m *Mapper) generateAnnotationStrings(node ast.Node) ([]string, error) {
 	if node == nil {
@@ -199,9 +457,25 @@ func (m *Mapper) generateAnnotationStrings(node ast.Node) ([]string, error) {
 	}
 }
 
+// notInIndexClass resolves the class of injected spans: the option
+// override if set, otherwise the mapping list setting, otherwise
+// DefaultNotInIndexClass.
+func (m *Mapper) notInIndexClass(mappingID string, opts MappingOptions) string {
+	if opts.NotInIndexClass != nil {
+		return *opts.NotInIndexClass
+	}
+	if list := m.mappingLists[mappingID]; list.NotInIndexClass != nil {
+		return *list.NotInIndexClass
+	}
+	return DefaultNotInIndexClass
+}
+
 // addAnnotationsToSnippet adds new annotations to matching tokens in the snippet
 // using SAX-based parsing for structural identification of text nodes.
-func (m *Mapper) addAnnotationsToSnippet(snippet string, matchingTokens []matcher.TokenSpan, annotationStrings []string) (string, error) {
+// Injected spans get the given class; an empty class omits the attribute.
+// If annotations are written to the class attribute, the class follows
+// the annotation in it.
+func (m *Mapper) addAnnotationsToSnippet(snippet string, matchingTokens []matcher.TokenSpan, annotationStrings []string, spanClass string) (string, error) {
 	if len(matchingTokens) == 0 || len(annotationStrings) == 0 {
 		return snippet, nil
 	}
@@ -217,6 +491,17 @@ func (m *Mapper) addAnnotationsToSnippet(snippet string, matchingTokens []matche
 	var result strings.Builder
 	result.Grow(len(snippet) + len(matchingTokens)*100)
 
+	spanAttrs := func(annotation string) string {
+		if m.snippetAttr == "class" {
+			return fmt.Sprintf(`class="%s"`, html.EscapeString(strings.TrimSpace(annotation+" "+spanClass)))
+		}
+		attrs := fmt.Sprintf(`%s="%s"`, m.snippetAttr, html.EscapeString(annotation))
+		if spanClass != "" {
+			attrs += fmt.Sprintf(` class="%s"`, html.EscapeString(spanClass))
+		}
+		return attrs
+	}
+
 	var textPos int
 
 	for {
@@ -254,7 +539,7 @@ func (m *Mapper) addAnnotationsToSnippet(snippet string, matchingTokens []matche
 
 				annotated := escapeXMLText(trimmed)
 				for i := len(annotationStrings) - 1; i >= 0; i-- {
-					annotated = fmt.Sprintf(`<span title="%s" class="notinindex">%s</span>`, html.EscapeString(annotationStrings[i]), annotated)
+					annotated = fmt.Sprintf(`<span %s>%s</span>`, spanAttrs(annotationStrings[i]), annotated)
 				}
 				result.WriteString(annotated)
 				result.WriteString(trailingWS)
@@ -272,6 +557,83 @@ func (m *Mapper) addAnnotationsToSnippet(snippet string, matchingTokens []matche
 	return result.String(), nil
 }
 
+// mergeNestedSpans drops span elements opened right inside a span with
+// the same annotation attribute and class, together with their end tags.
+// The content of a dropped span is kept in the outer span.
+func mergeNestedSpans(snippet, annotationAttr string) (string, error) {
+	r := gosax.NewReader(strings.NewReader(snippet))
+
+	var result strings.Builder
+	result.Grow(len(snippet))
+
+	// Open elements, marking the ones whose end tag is dropped
+	var dropped []bool
+
+	// Annotation and class of the span started by the previous event, if any
+	lastSpan, afterSpan := "", false
+
+	for {
+		e, err := r.Event()
+		if err != nil {
+			return "", fmt.Errorf("failed to parse snippet for merging spans: %w", err)
+		}
+		if e.Type() == gosax.EventEOF {
+			break
+		}
+
+		switch e.Type() {
+		case gosax.EventStart:
+			selfClosing := strings.HasSuffix(string(e.Bytes), "/>")
+			key, isSpan := spanKey(e.Bytes, annotationAttr)
+			if isSpan && !selfClosing && afterSpan && key == lastSpan {
+				dropped = append(dropped, true)
+				continue
+			}
+			result.Write(e.Bytes)
+			if !selfClosing {
+				dropped = append(dropped, false)
+			}
+			lastSpan, afterSpan = key, isSpan && !selfClosing
+			continue
+
+		case gosax.EventEnd:
+			if n := len(dropped); n > 0 {
+				drop := dropped[n-1]
+				dropped = dropped[:n-1]
+				if drop {
+					continue
+				}
+			}
+			result.Write(e.Bytes)
+
+		default:
+			result.Write(e.Bytes)
+		}
+		afterSpan = false
+	}
+
+	return result.String(), nil
+}
+
+// spanKey returns the annotation attribute and class of a span start
+// tag, and whether the tag starts a span.
+func spanKey(tag []byte, annotationAttr string) (string, bool) {
+	elem, err := gosax.StartElement(tag)
+	if err != nil || elem.Name.Local != "span" {
+		return "", false
+	}
+	var annotation, class string
+	for _, attr := range elem.Attr {
+		switch attr.Name.Local {
+		case annotationAttr:
+			annotation = attr.Value
+		case "class":
+			class = attr.Value
+		}
+	}
+	return annotation + "\x00" + class, true
+}
+
 func escapeXMLText(s string) string {
 	s = strings.ReplaceAll(s, "&", "&amp;")
 	s = strings.ReplaceAll(s, "<", "&lt;")
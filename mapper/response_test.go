@@ -2,6 +2,7 @@ package mapper
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/KorAP/Koral-Mapper/config"
@@ -74,7 +75,7 @@ func TestResponseMappingDebug(t *testing.T) {
 	require.NoError(t, err)
 
 	// Debug: Print what the parsed rules look like
-	rules := m.parsedQueryRules["test-mapper"]
+	rules := m.snapshot().parsedQueryRules["test-mapper"]
 	t.Logf("Number of parsed rules: %d", len(rules))
 	for i, rule := range rules {
 		t.Logf("Rule %d - Upper: %+v", i, rule.Upper)
@@ -1165,3 +1166,354 @@ func TestResponseMappingWithFallbackRules(t *testing.T) {
 		assert.Contains(t, snippet, `title="opennlp/p:ART" class="notinindex"`)
 	})
 }
+
+// TestResponseMappingNotInIndexClass tests configuring the class of injected spans
+func TestResponseMappingNotInIndexClass(t *testing.T) {
+	responseSnippet := `{
+		"snippet": "<span title=\"marmot/m:gender:masc\">Der</span>"
+	}`
+
+	emptyClass := ""
+	customClass := "injected"
+	mappingList := config.MappingList{
+		ID:              "test-mapper",
+		FoundryA:        "marmot",
+		LayerA:          "m",
+		FoundryB:        "opennlp",
+		LayerB:          "p",
+		NotInIndexClass: &emptyClass,
+		Mappings: []config.MappingRule{
+			"[gender:masc] <> [p=M]",
+		},
+	}
+
+	m, err := NewMapper([]config.MappingList{mappingList})
+	require.NoError(t, err)
+
+	var inputData any
+	require.NoError(t, json.Unmarshal([]byte(responseSnippet), &inputData))
+
+	// The list setting omits the class
+	result, err := m.ApplyResponseMappings("test-mapper", MappingOptions{Direction: AtoB}, inputData)
+	require.NoError(t, err)
+	assert.Equal(t, "<span title=\"marmot/m:gender:masc\"><span title=\"opennlp/p:M\">Der</span></span>", result.(map[string]any)["snippet"])
+
+	// The option overrides the list setting
+	result, err = m.ApplyResponseMappings("test-mapper", MappingOptions{Direction: AtoB, NotInIndexClass: &customClass}, inputData)
+	require.NoError(t, err)
+	assert.Equal(t, "<span title=\"marmot/m:gender:masc\"><span title=\"opennlp/p:M\" class=\"injected\">Der</span></span>", result.(map[string]any)["snippet"])
+}
+
+// TestResponseMappingMatchesArray tests snippets in the matches of a search result
+func TestResponseMappingMatchesArray(t *testing.T) {
+	m := newTermGroupMapper(t, "[DET] <> [PRON]")
+
+	input := parseJSON(t, `{
+		"meta": {"totalResults": 2},
+		"matches": [
+			{"matchID": "match-1", "snippet": "<span title=\"opennlp/p:DET\">Der</span>"},
+			{"matchID": "match-2", "snippet": "<span title=\"opennlp/p:NN\">Baum</span> <span title=\"opennlp/p:DET\">die</span>"},
+			"not a match object"
+		]
+	}`)
+
+	result, err := m.ApplyResponseMappings("group-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+
+	resultMap := result.(map[string]any)
+	assert.Equal(t, map[string]any{"totalResults": 2.0}, resultMap["meta"])
+
+	matches := resultMap["matches"].([]any)
+	require.Len(t, matches, 3)
+	assert.Equal(t, map[string]any{
+		"matchID": "match-1",
+		"snippet": `<span title="opennlp/p:DET"><span title="upos/p:PRON" class="notinindex">Der</span></span>`,
+	}, matches[0])
+	assert.Equal(t, map[string]any{
+		"matchID": "match-2",
+		"snippet": `<span title="opennlp/p:NN">Baum</span> <span title="opennlp/p:DET"><span title="upos/p:PRON" class="notinindex">die</span></span>`,
+	}, matches[1])
+	assert.Equal(t, "not a match object", matches[2])
+}
+
+func TestResponseMappingOnlyFoundryAndLayer(t *testing.T) {
+	input := parseJSON(t, `{
+		"snippet": "<span title=\"marmot/p:DET\">Der</span> <span title=\"opennlp/p:DET\">Baum</span>"
+	}`)
+
+	// Patterns are restricted to the effective foundry and layer
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "marmot-only",
+		FoundryA: "marmot",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{"[DET] <> [PRON]"},
+	}})
+	require.NoError(t, err)
+
+	result, err := m.ApplyResponseMappings("marmot-only", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<span title="marmot/p:DET"><span title="upos/p:PRON" class="notinindex">Der</span></span> <span title="opennlp/p:DET">Baum</span>`,
+		result.(map[string]any)["snippet"])
+
+	// OnlyFoundry and OnlyLayer further restrict rules matching any foundry
+	m, err = NewMapper([]config.MappingList{{
+		ID:       "any-foundry",
+		Mappings: []config.MappingRule{"[marmot/p=DET | opennlp/p=DET] <> [upos/p=PRON]"},
+	}})
+	require.NoError(t, err)
+
+	result, err = m.ApplyResponseMappings("any-foundry", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(result.(map[string]any)["snippet"].(string), "upos/p:PRON"))
+
+	result, err = m.ApplyResponseMappings("any-foundry", MappingOptions{Direction: AtoB, OnlyFoundry: "marmot"}, input)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<span title="marmot/p:DET"><span title="upos/p:PRON" class="notinindex">Der</span></span> <span title="opennlp/p:DET">Baum</span>`,
+		result.(map[string]any)["snippet"])
+
+	result, err = m.ApplyResponseMappings("any-foundry", MappingOptions{Direction: AtoB, OnlyLayer: "m"}, input)
+	require.NoError(t, err)
+	assert.NotContains(t, result.(map[string]any)["snippet"], "upos/p:PRON")
+}
+
+func TestResponseMappingMaxMatches(t *testing.T) {
+	m := newTermGroupMapper(t, "[ADJA] <> [ADJ]", "[NN] <> [NOUN]")
+
+	input := map[string]any{
+		"snippet": `<span title="opennlp/p:ADJA">schöne</span> <span title="opennlp/p:ADJA">große</span> <span title="opennlp/p:NN">Häuser</span>`,
+	}
+
+	tests := []struct {
+		name       string
+		maxMatches int
+		expected   string
+	}{
+		{
+			name:       "unlimited",
+			maxMatches: 0,
+			expected:   `<span title="opennlp/p:ADJA"><span title="upos/p:ADJ" class="notinindex">schöne</span></span> <span title="opennlp/p:ADJA"><span title="upos/p:ADJ" class="notinindex">große</span></span> <span title="opennlp/p:NN"><span title="upos/p:NOUN" class="notinindex">Häuser</span></span>`,
+		},
+		{
+			name:       "first match only",
+			maxMatches: 1,
+			expected:   `<span title="opennlp/p:ADJA"><span title="upos/p:ADJ" class="notinindex">schöne</span></span> <span title="opennlp/p:ADJA">große</span> <span title="opennlp/p:NN">Häuser</span>`,
+		},
+		{
+			name:       "limit spans rules",
+			maxMatches: 3,
+			expected:   `<span title="opennlp/p:ADJA"><span title="upos/p:ADJ" class="notinindex">schöne</span></span> <span title="opennlp/p:ADJA"><span title="upos/p:ADJ" class="notinindex">große</span></span> <span title="opennlp/p:NN"><span title="upos/p:NOUN" class="notinindex">Häuser</span></span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := m.ApplyResponseMappings("group-test", MappingOptions{Direction: AtoB, MaxMatches: tt.maxMatches}, input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.(map[string]any)["snippet"])
+		})
+	}
+
+	// Rules are not applied once the limit is reached
+	trace := &Trace{}
+	_, err := m.ApplyResponseMappings("group-test", MappingOptions{Direction: AtoB, MaxMatches: 2, Trace: trace}, input)
+	require.NoError(t, err)
+	assert.Equal(t, []AppliedRule{{List: "group-test", Index: 0}}, trace.Applied())
+}
+
+func TestResponseMappingMergeSpans(t *testing.T) {
+	m, err := NewMapper([]config.MappingList{{
+		ID:       "merge-test",
+		FoundryA: "marmot",
+		LayerA:   "m",
+		FoundryB: "opennlp",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{
+			"[gender:masc] <> [p=M]",
+			"[case:nom] <> [p=M]",
+		},
+	}})
+	require.NoError(t, err)
+
+	input := map[string]any{
+		"snippet": `<span title="marmot/m:gender:masc"><span title="marmot/m:case:nom">Der</span></span> <span title="marmot/m:case:nom">Mann</span>`,
+	}
+
+	// Without merging, both rules inject a span
+	result, err := m.ApplyResponseMappings("merge-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<span title="marmot/m:gender:masc"><span title="marmot/m:case:nom"><span title="opennlp/p:M" class="notinindex"><span title="opennlp/p:M" class="notinindex">Der</span></span></span></span> <span title="marmot/m:case:nom"><span title="opennlp/p:M" class="notinindex">Mann</span></span>`,
+		result.(map[string]any)["snippet"])
+
+	result, err = m.ApplyResponseMappings("merge-test", MappingOptions{Direction: AtoB, MergeSpans: true}, input)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<span title="marmot/m:gender:masc"><span title="marmot/m:case:nom"><span title="opennlp/p:M" class="notinindex">Der</span></span></span> <span title="marmot/m:case:nom"><span title="opennlp/p:M" class="notinindex">Mann</span></span>`,
+		result.(map[string]any)["snippet"])
+}
+
+func TestResponseMappingSnippetAttr(t *testing.T) {
+	lists := []config.MappingList{{
+		ID:       "attr-test",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{"[M] <> [NOUN]"},
+	}}
+
+	m, err := NewMapper(lists, WithSnippetAttr("class"))
+	require.NoError(t, err)
+
+	// Classes that are no annotations are ignored; the class of injected
+	// spans follows the annotation
+	input := map[string]any{
+		"snippet": `<span class="opennlp/p:M token"><span class="tt/l:Haus">Haus</span></span> <span title="opennlp/p:M">Baum</span>`,
+	}
+	result, err := m.ApplyResponseMappings("attr-test", MappingOptions{Direction: AtoB}, input)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<span class="opennlp/p:M token"><span class="tt/l:Haus"><span class="upos/p:NOUN notinindex">Haus</span></span></span> <span title="opennlp/p:M">Baum</span>`,
+		result.(map[string]any)["snippet"])
+
+	// Injected annotations are read back from the class attribute, e.g.
+	// by a later cascade step, and merged
+	empty := ""
+	result, err = m.ApplyResponseMappings("attr-test", MappingOptions{Direction: BtoA, NotInIndexClass: &empty, MergeSpans: true}, map[string]any{
+		"snippet": `<span class="upos/p:NOUN"><span class="opennlp/p:M">Haus</span></span>`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `<span class="upos/p:NOUN"><span class="opennlp/p:M">Haus</span></span>`, result.(map[string]any)["snippet"])
+
+	m, err = NewMapper(lists, WithSnippetAttr("data-annotation"))
+	require.NoError(t, err)
+	result, err = m.ApplyResponseMappings("attr-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"snippet": `<span data-annotation="opennlp/p:M">Haus</span>`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t,
+		`<span data-annotation="opennlp/p:M"><span data-annotation="upos/p:NOUN" class="notinindex">Haus</span></span>`,
+		result.(map[string]any)["snippet"])
+}
+
+func TestResponseMappingReferenceKeys(t *testing.T) {
+	lists := []config.MappingList{{
+		ID:       "ref-test",
+		FoundryA: "opennlp",
+		LayerA:   "p",
+		FoundryB: "upos",
+		LayerB:   "p",
+		Mappings: []config.MappingRule{
+			"[PIDAT] <> [DET]",
+			"[ADJA] <> [ADJ & Degree=Pos]",
+		},
+	}}
+
+	input := func() map[string]any {
+		return map[string]any{
+			"snippet": `<span title="opennlp/p:PIDAT">alle</span>`,
+			"matchInfo": map[string]any{
+				"highlights": []any{
+					map[string]any{"start": float64(0), "end": float64(1), "annotation": "opennlp/p:PIDAT"},
+					map[string]any{"start": float64(1), "end": float64(2), "annotation": "opennlp/p:ADJA"},
+					map[string]any{"start": float64(2), "end": float64(3), "annotation": "tt/p:PIDAT"},
+				},
+				"layers": []any{"opennlp/p", "opennlp/p:PIDAT"},
+			},
+		}
+	}
+
+	m, err := NewMapper(lists, WithReferenceKeys("matchInfo"))
+	require.NoError(t, err)
+
+	data := input()
+	result, err := m.ApplyResponseMappings("ref-test", MappingOptions{Direction: AtoB}, data)
+	require.NoError(t, err)
+
+	resultMap := result.(map[string]any)
+	assert.Contains(t, resultMap["snippet"], `upos/p:DET`)
+	matchInfo := resultMap["matchInfo"].(map[string]any)
+	highlights := matchInfo["highlights"].([]any)
+
+	// References replaced by a single annotation are mapped, others and
+	// plain layer names are kept
+	assert.Equal(t, "upos/p:DET", highlights[0].(map[string]any)["annotation"])
+	assert.Equal(t, float64(0), highlights[0].(map[string]any)["start"])
+	assert.Equal(t, "opennlp/p:ADJA", highlights[1].(map[string]any)["annotation"])
+	assert.Equal(t, "tt/p:PIDAT", highlights[2].(map[string]any)["annotation"])
+	assert.Equal(t, []any{"opennlp/p", "upos/p:DET"}, matchInfo["layers"])
+
+	// The input is not modified
+	assert.Equal(t, input(), data)
+
+	// References are mapped back in the other direction
+	result, err = m.ApplyResponseMappings("ref-test", MappingOptions{Direction: BtoA}, map[string]any{
+		"matchInfo": []any{"upos/p:DET"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"matchInfo": []any{"opennlp/p:PIDAT"}}, result)
+
+	// Foundry overrides apply to the references as to the snippet
+	result, err = m.ApplyResponseMappings("ref-test", MappingOptions{Direction: AtoB, FoundryB: "ud"}, map[string]any{
+		"matchInfo": []any{"opennlp/p:PIDAT"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"matchInfo": []any{"ud/p:DET"}}, result)
+
+	// Matches of a search result are mapped as well
+	result, err = m.ApplyResponseMappings("ref-test", MappingOptions{Direction: AtoB}, map[string]any{
+		"matches": []any{map[string]any{"matchInfo": []any{"opennlp/p:PIDAT"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"matches": []any{map[string]any{"matchInfo": []any{"upos/p:DET"}}},
+	}, result)
+
+	// Without reference keys, references are kept
+	m, err = NewMapper(lists)
+	require.NoError(t, err)
+	result, err = m.ApplyResponseMappings("ref-test", MappingOptions{Direction: AtoB}, input())
+	require.NoError(t, err)
+	assert.Equal(t, input()["matchInfo"], result.(map[string]any)["matchInfo"])
+}
+
+func TestMergeNestedSpans(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "identical spans",
+			input:    `<span title="a" class="x"><span title="a" class="x"><span title="a" class="x">Der</span></span></span>`,
+			expected: `<span title="a" class="x">Der</span>`,
+		},
+		{
+			name:     "different class",
+			input:    `<span title="a" class="x"><span title="a">Der</span></span>`,
+			expected: `<span title="a" class="x"><span title="a">Der</span></span>`,
+		},
+		{
+			name:     "not directly nested",
+			input:    `<span title="a"> <span title="a">Der</span></span>`,
+			expected: `<span title="a"> <span title="a">Der</span></span>`,
+		},
+		{
+			name:     "siblings",
+			input:    `<span title="a">Der</span><span title="a">Mann</span>`,
+			expected: `<span title="a">Der</span><span title="a">Mann</span>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := mergeNestedSpans(tt.input, DefaultSnippetAttr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
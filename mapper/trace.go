@@ -0,0 +1,46 @@
+package mapper
+
+import "sync"
+
+// AppliedRule identifies a rule applied during a transformation.
+type AppliedRule struct {
+	List  string // ID of the mapping list
+	Index int    // index of the rule in the list
+	ID    string // ID of the rule in object form, if any
+}
+
+// Trace collects the rules applied during transformations, in the order
+// they were applied. Set it in MappingOptions.Trace; a Trace may be
+// shared by the steps of a cascade and is safe for concurrent use.
+type Trace struct {
+	mu      sync.Mutex
+	applied []AppliedRule
+}
+
+// Applied returns the rules applied so far.
+func (t *Trace) Applied() []AppliedRule {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]AppliedRule(nil), t.applied...)
+}
+
+func (t *Trace) add(rule AppliedRule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.applied = append(t.applied, rule)
+}
+
+// recordRule records an application of the rule at ruleIndex of the
+// mapping list in the rule counters and in the trace of the options.
+func (m *Mapper) recordRule(mappingID string, ruleIndex int, opts MappingOptions) {
+	if counts := m.ruleCounts[mappingID]; ruleIndex >= 0 && ruleIndex < len(counts) {
+		counts[ruleIndex].Add(1)
+	}
+	if opts.Trace != nil {
+		rule := AppliedRule{List: mappingID, Index: ruleIndex}
+		if list, ok := m.mappingLists[mappingID]; ok {
+			rule.ID = list.RuleMetaAt(ruleIndex).ID
+		}
+		opts.Trace.add(rule)
+	}
+}
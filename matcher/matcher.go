@@ -2,6 +2,7 @@ package matcher
 
 import (
 	"fmt"
+	"maps"
 
 	"github.com/KorAP/Koral-Mapper/ast"
 )
@@ -48,8 +49,11 @@ func NewMatcher(pattern ast.Pattern, replacement ast.Replacement) (*Matcher, err
 	if err := validateNode(pattern.Root); err != nil {
 		return nil, fmt.Errorf("invalid pattern: %v", err)
 	}
-	if err := validateNode(replacement.Root); err != nil {
-		return nil, fmt.Errorf("invalid replacement: %v", err)
+	// A nil replacement deletes the matched node
+	if replacement.Root != nil {
+		if err := validateNode(replacement.Root); err != nil {
+			return nil, fmt.Errorf("invalid replacement: %v", err)
+		}
 	}
 	return &Matcher{
 		pattern:     pattern,
@@ -68,10 +72,14 @@ func (m *Matcher) Replace(node ast.Node) ast.Node {
 	replaced := m.replaceNode(node)
 	// Second step: Simplify the structure
 	simplified := m.simplifyNode(replaced)
-	// If the input was a Token, ensure the output is also a Token
-	if _, isToken := node.(*ast.Token); isToken {
+	// If the input was a Token, ensure the output is also a Token.
+	// A token whose wrap was deleted remains as an empty token
+	if token, isToken := node.(*ast.Token); isToken {
+		if simplified == nil {
+			return &ast.Token{Rewrites: token.Rewrites, Extra: token.Extra}
+		}
 		if _, isToken := simplified.(*ast.Token); !isToken {
-			return &ast.Token{Wrap: simplified}
+			return &ast.Token{Wrap: simplified, Shorthand: token.Shorthand, Extra: token.Extra}
 		}
 	}
 	return simplified
@@ -88,13 +96,24 @@ func (m *Matcher) replaceNode(node ast.Node) ast.Node {
 		if token.Wrap == nil {
 			return token
 		}
-		// Process the wrapped node
+		// Process the wrapped node, keeping rewrites already recorded
+		// on the token (e.g. by an upstream foundry injection)
 		wrap := m.replaceNode(token.Wrap)
-		return &ast.Token{Wrap: wrap}
+		var rewrites []ast.Rewrite
+		if len(token.Rewrites) > 0 {
+			rewrites = append(rewrites, token.Rewrites...)
+		}
+		return &ast.Token{Wrap: wrap, Rewrites: rewrites, Shorthand: token.Shorthand, Extra: token.Extra}
 	}
 
 	// Handle TermGroup nodes
 	if tg, ok := node.(*ast.TermGroup); ok {
+		// Group patterns are matched structurally against groups of the
+		// same relation before descending into operands
+		if replaced, ok := m.replaceGroupStructurally(tg); ok {
+			return replaced
+		}
+
 		// Check if any operand matches the pattern
 		hasMatch := false
 		newOperands := make([]ast.Node, 0, len(tg.Operands))
@@ -150,6 +169,53 @@ func (m *Matcher) replaceNode(node ast.Node) ast.Node {
 	return node
 }
 
+// replaceGroupStructurally replaces a TermGroup that matches a group
+// pattern of the same relation as a whole.
+//
+// AND patterns use subset matching: all pattern operands must be found
+// among the group's operands. Unmatched operands are preserved alongside
+// the replacement.
+//
+// OR patterns require exactly matching operands (commutative, exact
+// count). Partial OR groups fall through to per-operand replacement,
+// where any-operand matching applies.
+func (m *Matcher) replaceGroupStructurally(tg *ast.TermGroup) (ast.Node, bool) {
+	p, ok := m.pattern.Root.(*ast.TermGroup)
+	if !ok || p.Relation != tg.Relation {
+		return nil, false
+	}
+
+	if p.Relation == ast.OrRelation {
+		if len(tg.Operands) != len(p.Operands) {
+			return nil, false
+		}
+		if _, ok := m.matchGroupOperands(tg, p); !ok {
+			return nil, false
+		}
+		return m.cloneNode(m.replacement.Root), true
+	}
+
+	used, ok := m.matchGroupOperands(tg, p)
+	if !ok {
+		return nil, false
+	}
+
+	var remaining []ast.Node
+	for j, op := range tg.Operands {
+		if !used[j] {
+			remaining = append(remaining, op)
+		}
+	}
+	if len(remaining) == 0 {
+		return m.cloneNode(m.replacement.Root), true
+	}
+
+	return &ast.TermGroup{
+		Operands: append([]ast.Node{m.cloneNode(m.replacement.Root)}, remaining...),
+		Relation: tg.Relation,
+	}, true
+}
+
 // simplifyNode removes unnecessary wrappers and empty nodes
 func (m *Matcher) simplifyNode(node ast.Node) ast.Node {
 	if node == nil {
@@ -165,7 +231,7 @@ func (m *Matcher) simplifyNode(node ast.Node) ast.Node {
 		if simplified == nil {
 			return nil
 		}
-		return &ast.Token{Wrap: simplified}
+		return &ast.Token{Wrap: simplified, Rewrites: n.Rewrites, Shorthand: n.Shorthand, Extra: n.Extra}
 
 	case *ast.TermGroup:
 		// First simplify all operands
@@ -255,7 +321,9 @@ func (m *Matcher) matchNode(node, pattern ast.Node) bool {
 	return false
 }
 
-// tryMatchWrapped attempts to match a node that might wrap other nodes
+// tryMatchWrapped attempts to match a node that might wrap other nodes.
+// A term group matches if any of its operands does, so a degenerate group
+// with a single operand is equivalent to that operand.
 func (m *Matcher) tryMatchWrapped(node, pattern ast.Node) bool {
 	switch n := node.(type) {
 	case *ast.Token:
@@ -282,8 +350,13 @@ func (m *Matcher) tryMatchWrapped(node, pattern ast.Node) bool {
 // matchTerm checks if a node matches a term pattern
 func (m *Matcher) matchTerm(node ast.Node, pattern *ast.Term) bool {
 	if t, ok := node.(*ast.Term); ok {
+		// A regex term in the query only matches the same regex
+		keyMatches := pattern.MatchesKey(t.Key)
+		if t.Regex {
+			keyMatches = pattern.Regex && t.Key == pattern.Key
+		}
 		return t.Foundry == pattern.Foundry &&
-			t.Key == pattern.Key &&
+			keyMatches &&
 			t.Layer == pattern.Layer &&
 			t.Match == pattern.Match &&
 			(pattern.Value == "" || t.Value == pattern.Value)
@@ -293,8 +366,16 @@ func (m *Matcher) matchTerm(node ast.Node, pattern *ast.Term) bool {
 
 // matchAndTermGroup checks if a TermGroup matches an AND pattern
 func (m *Matcher) matchAndTermGroup(node *ast.TermGroup, pattern *ast.TermGroup) bool {
+	_, ok := m.matchGroupOperands(node, pattern)
+	return ok
+}
+
+// matchGroupOperands checks if all pattern operands are found among the
+// node's operands using commutative set matching. It returns which node
+// operands were consumed by the pattern.
+func (m *Matcher) matchGroupOperands(node *ast.TermGroup, pattern *ast.TermGroup) ([]bool, bool) {
 	if len(node.Operands) < len(pattern.Operands) {
-		return false
+		return nil, false
 	}
 	matched := make([]bool, len(node.Operands))
 	for _, pOp := range pattern.Operands {
@@ -307,10 +388,10 @@ func (m *Matcher) matchAndTermGroup(node *ast.TermGroup, pattern *ast.TermGroup)
 			}
 		}
 		if !found {
-			return false
+			return nil, false
 		}
 	}
-	return true
+	return matched, true
 }
 
 // cloneNode creates a deep copy of a node
@@ -322,7 +403,9 @@ func (m *Matcher) cloneNode(node ast.Node) ast.Node {
 	switch n := node.(type) {
 	case *ast.Token:
 		return &ast.Token{
-			Wrap: m.cloneNode(n.Wrap),
+			Wrap:      m.cloneNode(n.Wrap),
+			Shorthand: n.Shorthand,
+			Extra:     maps.Clone(n.Extra),
 		}
 
 	case *ast.TermGroup:
@@ -337,11 +420,13 @@ func (m *Matcher) cloneNode(node ast.Node) ast.Node {
 
 	case *ast.Term:
 		return &ast.Term{
-			Foundry: n.Foundry,
-			Key:     n.Key,
-			Layer:   n.Layer,
-			Match:   n.Match,
-			Value:   n.Value,
+			Foundry:   n.Foundry,
+			Key:       n.Key,
+			Layer:     n.Layer,
+			Match:     n.Match,
+			Value:     n.Value,
+			Regex:     n.Regex,
+			KeyRegexp: n.KeyRegexp,
 		}
 
 	case *ast.CatchallNode:
@@ -810,3 +810,42 @@ func TestMatchWithUnknownNodes(t *testing.T) {
 		})
 	}
 }
+
+func TestSingleOperandGroup(t *testing.T) {
+	det := &ast.Term{Foundry: "opennlp", Key: "DET", Layer: "p", Match: ast.MatchEqual}
+	pron := &ast.Term{Foundry: "upos", Key: "PRON", Layer: "p", Match: ast.MatchEqual}
+
+	m, err := NewMatcher(ast.Pattern{Root: det}, ast.Replacement{Root: pron})
+	assert.NoError(t, err)
+
+	for _, relation := range []ast.RelationType{ast.AndRelation, ast.OrRelation} {
+		t.Run(string(relation), func(t *testing.T) {
+			group := &ast.TermGroup{
+				Operands: []ast.Node{&ast.Term{Foundry: "opennlp", Key: "DET", Layer: "p", Match: ast.MatchEqual}},
+				Relation: relation,
+			}
+			input := &ast.Token{Wrap: group}
+
+			// A group with a single operand is equivalent to the operand
+			assert.True(t, m.Match(group))
+			assert.True(t, m.Match(input))
+			assert.Equal(t, &ast.Token{Wrap: pron}, m.Replace(input))
+			assert.Equal(t, pron, m.Replace(group))
+
+			// Nested single-operand groups are unwrapped as well
+			nested := &ast.Token{Wrap: &ast.TermGroup{
+				Operands: []ast.Node{group},
+				Relation: ast.AndRelation,
+			}}
+			assert.True(t, m.Match(nested))
+			assert.Equal(t, &ast.Token{Wrap: pron}, m.Replace(nested))
+
+			// The sole operand must still match
+			other := &ast.TermGroup{
+				Operands: []ast.Node{&ast.Term{Foundry: "opennlp", Key: "ART", Layer: "p", Match: ast.MatchEqual}},
+				Relation: relation,
+			}
+			assert.False(t, m.Match(other))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package matcher
 
 import (
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
@@ -15,13 +16,21 @@ type TokenSpan struct {
 	Text        string   // The actual token text
 	StartPos    int      // Character position where the token starts
 	EndPos      int      // Character position where the token ends
-	Annotations []string // All title attributes that annotate this token
+	Annotations []string // All annotations of the spans around this token
 }
 
 // SnippetMatcher extends the basic matcher to work with HTML/XML snippets
 type SnippetMatcher struct {
 	matcher     *Matcher
 	titleParser *parser.TitleAttributeParser
+
+	// annotationAttr is the span attribute holding the annotations
+	annotationAttr string
+
+	// onlyFoundry and onlyLayer restrict the annotations considered
+	// for matching; empty means any
+	onlyFoundry string
+	onlyLayer   string
 }
 
 // NewSnippetMatcher creates a new snippet matcher
@@ -32,19 +41,53 @@ func NewSnippetMatcher(pattern ast.Pattern, replacement ast.Replacement) (*Snipp
 	}
 
 	return &SnippetMatcher{
-		matcher:     matcher,
-		titleParser: parser.NewTitleAttributeParser(),
+		matcher:        matcher,
+		titleParser:    parser.NewTitleAttributeParser(),
+		annotationAttr: "title",
 	}, nil
 }
 
+// ReadAnnotationsFrom sets the span attribute annotations are read from,
+// "title" by default. The class attribute may hold several annotations
+// separated by whitespace; classes that are no annotations, e.g. the
+// class of injected spans, are ignored.
+func (sm *SnippetMatcher) ReadAnnotationsFrom(attr string) {
+	sm.annotationAttr = attr
+}
+
+// annotationsOf returns the annotations in the value of the annotation
+// attribute of a span.
+func (sm *SnippetMatcher) annotationsOf(value string) []string {
+	if sm.annotationAttr != "class" {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	var annotations []string
+	for _, class := range strings.Fields(value) {
+		if sm.titleParser.IsAnnotation(class) {
+			annotations = append(annotations, class)
+		}
+	}
+	return annotations
+}
+
+// RestrictAnnotations limits matching to annotations of the given
+// foundry and layer. An empty foundry or layer does not restrict.
+func (sm *SnippetMatcher) RestrictAnnotations(foundry, layer string) {
+	sm.onlyFoundry = foundry
+	sm.onlyLayer = layer
+}
+
 // ParseSnippet parses an HTML/XML snippet and extracts tokens with their annotations
 func (sm *SnippetMatcher) ParseSnippet(snippet string) ([]TokenSpan, error) {
 	tokens := make([]TokenSpan, 0)
 
 	// Stack to track nested spans and their annotations
 	type spanInfo struct {
-		title string
-		level int
+		annotations []string
+		level       int
 	}
 	spanStack := make([]spanInfo, 0)
 
@@ -73,15 +116,15 @@ func (sm *SnippetMatcher) ParseSnippet(snippet string) ([]TokenSpan, error) {
 			}
 
 			if startElem.Name.Local == "span" {
-				// Look for title attribute
-				var title string
+				// Look for the annotation attribute
+				var annotations []string
 				for _, attr := range startElem.Attr {
-					if attr.Name.Local == "title" {
-						title = attr.Value
+					if attr.Name.Local == sm.annotationAttr {
+						annotations = sm.annotationsOf(attr.Value)
 						break
 					}
 				}
-				spanStack = append(spanStack, spanInfo{title: title, level: len(spanStack)})
+				spanStack = append(spanStack, spanInfo{annotations: annotations, level: len(spanStack)})
 			}
 
 		case 2: // gosax.EventEnd
@@ -105,9 +148,7 @@ func (sm *SnippetMatcher) ParseSnippet(snippet string) ([]TokenSpan, error) {
 				// Collect all annotations from the current span stack
 				annotations := make([]string, 0)
 				for _, span := range spanStack {
-					if span.title != "" {
-						annotations = append(annotations, span.title)
-					}
+					annotations = append(annotations, span.annotations...)
 				}
 
 				// Create token span
@@ -143,6 +184,14 @@ func (sm *SnippetMatcher) CheckToken(token TokenSpan) (bool, error) {
 		return false, fmt.Errorf("failed to parse token annotations: %w", err)
 	}
 
+	if sm.onlyFoundry != "" || sm.onlyLayer != "" {
+		terms = slices.DeleteFunc(terms, func(node ast.Node) bool {
+			term := node.(*ast.Term)
+			return (sm.onlyFoundry != "" && term.Foundry != sm.onlyFoundry) ||
+				(sm.onlyLayer != "" && term.Layer != sm.onlyLayer)
+		})
+	}
+
 	if len(terms) == 0 {
 		return false, nil
 	}
@@ -347,3 +347,35 @@ func TestSnippetMatcher_RealWorldExample(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, matches)
 }
+
+func TestSnippetMatcher_ReadAnnotationsFrom(t *testing.T) {
+	pattern := ast.Pattern{
+		Root: &ast.Term{Foundry: "opennlp", Layer: "p", Key: "M", Match: ast.MatchEqual},
+	}
+	replacement := ast.Replacement{
+		Root: &ast.Term{Foundry: "upos", Layer: "p", Key: "NOUN", Match: ast.MatchEqual},
+	}
+
+	sm, err := NewSnippetMatcher(pattern, replacement)
+	require.NoError(t, err)
+	sm.ReadAnnotationsFrom("class")
+
+	snippet := `<span class="opennlp/p:M token"><span class="tt/l:Haus notinindex">Haus</span></span> <span title="opennlp/p:M">Baum</span>`
+
+	tokens, err := sm.ParseSnippet(snippet)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, []string{"opennlp/p:M", "tt/l:Haus"}, tokens[0].Annotations)
+	assert.Empty(t, tokens[1].Annotations)
+
+	matching, err := sm.FindMatchingTokens(snippet)
+	require.NoError(t, err)
+	require.Len(t, matching, 1)
+	assert.Equal(t, "Haus", matching[0].Text)
+
+	sm.ReadAnnotationsFrom("data-annotation")
+	tokens, err = sm.ParseSnippet(`<span data-annotation="opennlp/p:M">Haus</span>`)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, []string{"opennlp/p:M"}, tokens[0].Annotations)
+}
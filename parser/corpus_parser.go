@@ -5,6 +5,10 @@ import (
 	"strings"
 )
 
+// WildcardKey is the field key that matches any key in a corpus pattern.
+// In a replacement it stands for the key of the matched field.
+const WildcardKey = "*"
+
 // CorpusNode represents a node in a corpus mapping rule.
 type CorpusNode interface {
 	isCorpusNode()
@@ -18,12 +22,17 @@ type CorpusField struct {
 	Value string
 	Match string // "eq","ne","geq","leq","contains","excludes" (empty = unspecified)
 	Type  string // "string","regex","date" (empty = unspecified, defaults to "string")
+
+	// Negated marks a guard field written as key!=value. As a pattern it
+	// matches fields with the key and a different value; as a
+	// replacement it stands for a field with match "ne".
+	Negated bool
 }
 
 func (f *CorpusField) isCorpusNode() {}
 
 func (f *CorpusField) Clone() CorpusNode {
-	return &CorpusField{Key: f.Key, Value: f.Value, Match: f.Match, Type: f.Type}
+	return &CorpusField{Key: f.Key, Value: f.Value, Match: f.Match, Type: f.Type, Negated: f.Negated}
 }
 
 // ToJSON converts the field to a koral:doc JSON map.
@@ -35,6 +44,8 @@ func (f *CorpusField) ToJSON() map[string]any {
 	}
 	if f.Match != "" {
 		m["match"] = "match:" + f.Match
+	} else if f.Negated {
+		m["match"] = "match:ne"
 	} else {
 		m["match"] = "match:eq"
 	}
@@ -77,8 +88,9 @@ func (g *CorpusGroup) ToJSON() map[string]any {
 
 // CorpusMappingResult represents a parsed corpus mapping rule.
 type CorpusMappingResult struct {
-	Upper CorpusNode // Side A
-	Lower CorpusNode // Side B
+	Upper     CorpusNode // Side A
+	Lower     CorpusNode // Side B
+	Direction RuleDirection
 }
 
 // CorpusParser parses corpus mapping rules.
@@ -93,9 +105,25 @@ func NewCorpusParser() *CorpusParser {
 	return &CorpusParser{}
 }
 
+// cutRuleOperator splits a corpus rule at its first rule operator.
+func cutRuleOperator(input string) (before, after string, direction RuleDirection, found bool) {
+	pos := -1
+	var operator string
+	for op := range ruleDirections {
+		if i := strings.Index(input, op); i >= 0 && (pos < 0 || i < pos) {
+			pos, operator = i, op
+		}
+	}
+	if pos < 0 {
+		return input, "", Bidirectional, false
+	}
+	return input[:pos], input[pos+len(operator):], ruleDirections[operator], true
+}
+
 // ParseMapping parses a corpus mapping rule of the form "pattern <> replacement".
+// The separators ">>" and "<<" restrict the rule to one direction.
 func (p *CorpusParser) ParseMapping(input string) (*CorpusMappingResult, error) {
-	before, after, ok := strings.Cut(input, "<>")
+	before, after, direction, ok := cutRuleOperator(input)
 	if !ok {
 		return nil, fmt.Errorf("invalid corpus mapping rule: missing <> separator in %q", input)
 	}
@@ -120,7 +148,35 @@ func (p *CorpusParser) ParseMapping(input string) (*CorpusMappingResult, error)
 		return nil, fmt.Errorf("error parsing right side: %w", err)
 	}
 
-	return &CorpusMappingResult{Upper: upper, Lower: lower}, nil
+	// A wildcard key in a replacement takes the key of the matched
+	// field, so the opposite side must be a single field
+	if hasWildcardKey(upper) {
+		if _, ok := lower.(*CorpusField); !ok {
+			return nil, fmt.Errorf("invalid corpus mapping rule: wildcard key on the left side requires a single field on the right side")
+		}
+	}
+	if hasWildcardKey(lower) {
+		if _, ok := upper.(*CorpusField); !ok {
+			return nil, fmt.Errorf("invalid corpus mapping rule: wildcard key on the right side requires a single field on the left side")
+		}
+	}
+
+	return &CorpusMappingResult{Upper: upper, Lower: lower, Direction: direction}, nil
+}
+
+// hasWildcardKey reports whether any field of the node uses WildcardKey.
+func hasWildcardKey(node CorpusNode) bool {
+	switch n := node.(type) {
+	case *CorpusField:
+		return n.Key == WildcardKey
+	case *CorpusGroup:
+		for _, op := range n.Operands {
+			if hasWildcardKey(op) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // parseExpression parses a corpus expression (field or group).
@@ -178,7 +234,30 @@ var validMatchTypes = map[string]bool{
 	"contains": true, "excludes": true,
 }
 
-// parseField parses a single field expression: key=value[:match][#type].
+// HasGuard reports whether any field of the node is a negated guard field.
+func HasGuard(node CorpusNode) bool {
+	switch n := node.(type) {
+	case *CorpusField:
+		return n.Negated
+	case *CorpusGroup:
+		for _, op := range n.Operands {
+			if HasGuard(op) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseCorpusField parses a single field expression in the Koral short
+// form of a virtual corpus, e.g. "textClass=novel" or
+// "pubDate=2020:geq#date", as written on either side of a corpus rule.
+func ParseCorpusField(input string) (*CorpusField, error) {
+	return (&CorpusParser{}).parseField(input)
+}
+
+// parseField parses a single field expression: key=value[:match][#type],
+// or key!=value[#type] and key=value#regex! for a negated guard field.
 // When AllowBareValues is true, also accepts bare values without key=.
 func (p *CorpusParser) parseField(input string) (*CorpusField, error) {
 	input = strings.TrimSpace(input)
@@ -191,6 +270,7 @@ func (p *CorpusParser) parseField(input string) (*CorpusField, error) {
 		return p.parseBareValue(input)
 	}
 
+	before, negated := strings.CutSuffix(before, "!")
 	key := strings.TrimSpace(before)
 	rest := strings.TrimSpace(after)
 
@@ -201,12 +281,15 @@ func (p *CorpusParser) parseField(input string) (*CorpusField, error) {
 		return nil, fmt.Errorf("invalid field expression: empty value for key %q", key)
 	}
 
-	field := &CorpusField{Key: key}
+	field := &CorpusField{Key: key, Negated: negated}
 
 	// Split off #type first
-	if hashIdx := strings.LastIndex(rest, "#"); hashIdx != -1 {
-		field.Type = strings.TrimSpace(rest[hashIdx+1:])
-		rest = rest[:hashIdx]
+	rest, negatedRegex := field.cutType(rest)
+	if negatedRegex {
+		if negated {
+			return nil, fmt.Errorf("invalid field expression: '!=' cannot be combined with '#%s!'", negatedRegexType)
+		}
+		field.Negated = true
 	}
 
 	// Split off :match — only if the part after the last colon is a valid match type
@@ -222,10 +305,36 @@ func (p *CorpusParser) parseField(input string) (*CorpusField, error) {
 	if field.Value == "" {
 		return nil, fmt.Errorf("invalid field expression: empty value for key %q", key)
 	}
+	if field.Negated && field.Match != "" {
+		if negatedRegex {
+			return nil, fmt.Errorf("invalid field expression: '#%s!' cannot be combined with match type %q", negatedRegexType, field.Match)
+		}
+		return nil, fmt.Errorf("invalid field expression: '!=' cannot be combined with match type %q", field.Match)
+	}
 
 	return field, nil
 }
 
+// negatedRegexType is the value type written with a trailing "!" for a
+// regex that matches values the expression does not match.
+const negatedRegexType = "regex"
+
+// cutType splits off a "#type" suffix of a field expression into the
+// Type of the field and returns the rest. It reports whether the type
+// is a negated regex ("#regex!"), which is stored as type "regex".
+func (f *CorpusField) cutType(input string) (string, bool) {
+	hashIdx := strings.LastIndex(input, "#")
+	if hashIdx == -1 {
+		return input, false
+	}
+	f.Type = strings.TrimSpace(input[hashIdx+1:])
+	if f.Type == negatedRegexType+"!" {
+		f.Type = negatedRegexType
+		return input[:hashIdx], true
+	}
+	return input[:hashIdx], false
+}
+
 // parseBareValue parses a value without a key= prefix.
 // The Key is left empty and should be filled from the mapping list header.
 func (p *CorpusParser) parseBareValue(input string) (*CorpusField, error) {
@@ -235,10 +344,7 @@ func (p *CorpusParser) parseBareValue(input string) (*CorpusField, error) {
 
 	field := &CorpusField{}
 
-	if hashIdx := strings.LastIndex(input, "#"); hashIdx != -1 {
-		field.Type = strings.TrimSpace(input[hashIdx+1:])
-		input = input[:hashIdx]
-	}
+	input, field.Negated = field.cutType(input)
 
 	if colonIdx := strings.LastIndex(input, ":"); colonIdx != -1 {
 		candidate := strings.TrimSpace(input[colonIdx+1:])
@@ -252,6 +358,9 @@ func (p *CorpusParser) parseBareValue(input string) (*CorpusField, error) {
 	if field.Value == "" {
 		return nil, fmt.Errorf("invalid field expression: empty bare value")
 	}
+	if field.Negated && field.Match != "" {
+		return nil, fmt.Errorf("invalid field expression: '#%s!' cannot be combined with match type %q", negatedRegexType, field.Match)
+	}
 
 	return field, nil
 }
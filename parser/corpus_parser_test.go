@@ -41,6 +41,36 @@ func TestCorpusParserMatchType(t *testing.T) {
 	assert.Equal(t, "geq", lower.Match)
 }
 
+func TestCorpusParserColonInValue(t *testing.T) {
+	p := NewCorpusParser()
+	result, err := p.ParseMapping("textClass=Wissenschaft:Physik <> topic=science:physics:eq")
+	require.NoError(t, err)
+
+	upper := result.Upper.(*CorpusField)
+	assert.Equal(t, "textClass", upper.Key)
+	assert.Equal(t, "Wissenschaft:Physik", upper.Value)
+	assert.Empty(t, upper.Match)
+
+	lower := result.Lower.(*CorpusField)
+	assert.Equal(t, "topic", lower.Key)
+	assert.Equal(t, "science:physics", lower.Value)
+	assert.Equal(t, "eq", lower.Match)
+
+	// Only the part after the last colon can be a match type
+	field, err := ParseCorpusField("textClass=a:contains:b#string")
+	require.NoError(t, err)
+	assert.Equal(t, "a:contains:b", field.Value)
+	assert.Empty(t, field.Match)
+	assert.Equal(t, "string", field.Type)
+
+	p.AllowBareValues = true
+	result, err = p.ParseMapping("Wissenschaft:Physik:ne <> science:physics")
+	require.NoError(t, err)
+	assert.Equal(t, "Wissenschaft:Physik", result.Upper.(*CorpusField).Value)
+	assert.Equal(t, "ne", result.Upper.(*CorpusField).Match)
+	assert.Equal(t, "science:physics", result.Lower.(*CorpusField).Value)
+}
+
 func TestCorpusParserValueType(t *testing.T) {
 	p := NewCorpusParser()
 	result, err := p.ParseMapping("pubDate=2020-01#date <> year=2020#string")
@@ -201,6 +231,30 @@ func TestCorpusParserErrors(t *testing.T) {
 	assert.Error(t, err, "missing = in field")
 }
 
+func TestCorpusParserRuleDirections(t *testing.T) {
+	p := NewCorpusParser()
+
+	tests := []struct {
+		input     string
+		direction RuleDirection
+	}{
+		{"textClass=novel <> genre=fiction", Bidirectional},
+		{"textClass=novel >> genre=fiction", AtoBOnly},
+		{"textClass=novel << genre=fiction", BtoAOnly},
+		{"(a=1 & b=2)>>c=3", AtoBOnly},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := p.ParseMapping(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.direction, result.Direction)
+			assert.NotNil(t, result.Upper)
+			assert.NotNil(t, result.Lower)
+		})
+	}
+}
+
 func TestCorpusParserThreeOperandGroup(t *testing.T) {
 	p := NewCorpusParser()
 	result, err := p.ParseMapping("(a=1 & b=2 & c=3) <> d=4")
@@ -354,3 +408,85 @@ func TestCorpusParserBareValueMixedWithKeyed(t *testing.T) {
 	assert.Equal(t, "genre", lower.Key)
 	assert.Equal(t, "fiction", lower.Value)
 }
+
+func TestCorpusParserWildcardKey(t *testing.T) {
+	p := NewCorpusParser()
+	result, err := p.ParseMapping("*=novel <> genre=fiction")
+	require.NoError(t, err)
+
+	upper, ok := result.Upper.(*CorpusField)
+	require.True(t, ok)
+	assert.Equal(t, WildcardKey, upper.Key)
+	assert.Equal(t, "novel", upper.Value)
+
+	// A wildcard key needs a single field on the other side
+	_, err = p.ParseMapping("*=novel <> (genre=fiction & type=book)")
+	assert.Error(t, err)
+
+	_, err = p.ParseMapping("(textClass=novel | textClass=poem) <> *=fiction")
+	assert.Error(t, err)
+}
+
+func TestCorpusParserNotEqualGuard(t *testing.T) {
+	p := NewCorpusParser()
+	result, err := p.ParseMapping("textClass!=public <> restricted=true")
+	require.NoError(t, err)
+
+	upper := result.Upper.(*CorpusField)
+	assert.Equal(t, "textClass", upper.Key)
+	assert.Equal(t, "public", upper.Value)
+	assert.True(t, upper.Negated)
+	assert.True(t, HasGuard(result.Upper))
+	assert.Equal(t, "match:ne", upper.ToJSON()["match"])
+
+	lower := result.Lower.(*CorpusField)
+	assert.False(t, lower.Negated)
+	assert.False(t, HasGuard(result.Lower))
+
+	result, err = p.ParseMapping("(textClass != public & corpusSigle=GOE) <> restricted=true")
+	require.NoError(t, err)
+	assert.True(t, HasGuard(result.Upper))
+	group := result.Upper.(*CorpusGroup)
+	assert.Equal(t, "textClass", group.Operands[0].(*CorpusField).Key)
+	assert.True(t, group.Operands[0].Clone().(*CorpusField).Negated)
+
+	_, err = p.ParseMapping("textClass!=public:eq <> restricted=true")
+	assert.ErrorContains(t, err, "cannot be combined")
+}
+
+func TestParseCorpusField(t *testing.T) {
+	field, err := ParseCorpusField("pubDate=2020:geq#date")
+	require.NoError(t, err)
+	assert.Equal(t, "pubDate", field.Key)
+	assert.Equal(t, "2020", field.Value)
+	assert.Equal(t, "geq", field.Match)
+	assert.Equal(t, "date", field.Type)
+
+	_, err = ParseCorpusField("pubDate")
+	assert.Error(t, err)
+}
+
+func TestCorpusParserNegatedRegex(t *testing.T) {
+	field, err := ParseCorpusField("textClass=.*wissenschaft.*#regex!")
+	require.NoError(t, err)
+	assert.Equal(t, &CorpusField{Key: "textClass", Value: ".*wissenschaft.*", Type: "regex", Negated: true}, field)
+
+	// Same as a guard with a regex value
+	guard, err := ParseCorpusField("textClass!=.*wissenschaft.*#regex")
+	require.NoError(t, err)
+	assert.Equal(t, guard, field)
+
+	_, err = ParseCorpusField("textClass!=.*wissenschaft.*#regex!")
+	assert.ErrorContains(t, err, "'!=' cannot be combined with '#regex!'")
+
+	_, err = ParseCorpusField("textClass=.*wissenschaft.*:ne#regex!")
+	assert.ErrorContains(t, err, "'#regex!' cannot be combined with match type \"ne\"")
+
+	p := NewCorpusParser()
+	p.AllowBareValues = true
+	result, err := p.ParseMapping(".*wissenschaft.*#regex! <> general")
+	require.NoError(t, err)
+	upper := result.Upper.(*CorpusField)
+	assert.Equal(t, "regex", upper.Type)
+	assert.True(t, upper.Negated)
+}
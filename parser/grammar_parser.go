@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/KorAP/Koral-Mapper/ast"
@@ -29,13 +30,16 @@ type MappingGrammar struct {
 
 // MappingRule represents a mapping between two token expressions
 type MappingRule struct {
-	Upper *TokenExpr `parser:"@@"`
-	Lower *TokenExpr `parser:"'<>' @@"`
+	Upper    *TokenExpr `parser:"@@"`
+	Operator string     `parser:"@('<>' | '>>' | '<<')"`
+	Lower    *TokenExpr `parser:"@@"`
 }
 
-// TokenExpr represents a token expression in square brackets
+// TokenExpr represents a token expression in square brackets.
+// An empty token expression "[]" is only meaningful as a replacement
+// and marks a deletion rule
 type TokenExpr struct {
-	Expr *Expr `parser:"'[' @@ ']'"`
+	Expr *Expr `parser:"'[' @@? ']'"`
 }
 
 // Expr represents a sequence of terms and operators
@@ -68,37 +72,44 @@ type SimpleTerm struct {
 	SimpleKey           *KeyTerm             `parser:"| @@"`
 }
 
-// FoundryLayerTerm represents foundry/layer=key:value
+// FoundryLayerTerm represents foundry/layer=key:value:match
 type FoundryLayerTerm struct {
 	Foundry string `parser:"@Ident '/'"`
 	Layer   string `parser:"@Ident '='"`
-	Key     string `parser:"@Ident"`
+	Key     string `parser:"@(Regex | Ident)"`
 	Value   string `parser:"(':' @Ident)?"`
+	Match   string `parser:"(':' @Ident)?"`
 }
 
-// FoundryWildcardTerm represents foundry/*=key (wildcard layer)
+// FoundryWildcardTerm represents foundry/*=key:value:match (wildcard layer)
 type FoundryWildcardTerm struct {
 	Foundry string `parser:"@Ident '/' '*' '='"`
-	Key     string `parser:"@Ident"`
+	Key     string `parser:"@(Regex | Ident)"`
+	Value   string `parser:"(':' @Ident)?"`
+	Match   string `parser:"(':' @Ident)?"`
 }
 
-// FoundryKeyTerm represents foundry/key
+// FoundryKeyTerm represents foundry/key:value:match
 type FoundryKeyTerm struct {
 	Foundry string `parser:"@Ident '/'"`
-	Key     string `parser:"@Ident"`
+	Key     string `parser:"@(Regex | Ident)"`
+	Value   string `parser:"(':' @Ident)?"`
+	Match   string `parser:"(':' @Ident)?"`
 }
 
-// LayerTerm represents layer=key:value (only when no foundry is present)
+// LayerTerm represents layer=key:value:match (only when no foundry is present)
 type LayerTerm struct {
 	Layer string `parser:"@Ident '='"`
-	Key   string `parser:"@Ident"`
+	Key   string `parser:"@(Regex | Ident)"`
 	Value string `parser:"(':' @Ident)?"`
+	Match string `parser:"(':' @Ident)?"`
 }
 
-// KeyTerm represents key:value or key=value
+// KeyTerm represents key:value:match or key=value:match
 type KeyTerm struct {
-	Key   string `parser:"@Ident"`
+	Key   string `parser:"@(Regex | Ident)"`
 	Value string `parser:"((':' | '=') @Ident)?"`
+	Match string `parser:"(':' @Ident)?"`
 }
 
 // EscapedPunct represents an escaped punctuation character like \(
@@ -110,14 +121,15 @@ type EscapedPunct struct {
 // NewGrammarParser creates a new grammar parser with optional default foundry and layer
 func NewGrammarParser(defaultFoundry, defaultLayer string) (*GrammarParser, error) {
 	lex := lexer.MustSimple([]lexer.SimpleRule{
+		{Name: "Regex", Pattern: `(?:[a-zA-Z0-9_$,.*+?{}]|\\.)+` + regexSuffix},
 		{Name: "Ident", Pattern: `(?:[a-zA-Z$,.]|\\.)(?:[a-zA-Z0-9_$,.]|\\.)*`},
-		{Name: "Punct", Pattern: `[\[\]()&\|=:/\*]|<>`},
+		{Name: "Punct", Pattern: `[\[\]()&\|=:/\*]|<>|>>|<<`},
 		{Name: "Whitespace", Pattern: `\s+`},
 	})
 
 	tokenParser, err := participle.Build[TokenGrammar](
 		participle.Lexer(lex),
-		participle.UseLookahead(2),
+		participle.UseLookahead(4),
 		participle.Elide("Whitespace"),
 	)
 	if err != nil {
@@ -126,7 +138,7 @@ func NewGrammarParser(defaultFoundry, defaultLayer string) (*GrammarParser, erro
 
 	mappingParser, err := participle.Build[MappingGrammar](
 		participle.Lexer(lex),
-		participle.UseLookahead(2),
+		participle.UseLookahead(4),
 		participle.Elide("Whitespace"),
 	)
 	if err != nil {
@@ -147,6 +159,8 @@ func (p *GrammarParser) preprocessInput(input string) string {
 	input = strings.ReplaceAll(input, " & ", "&")
 	input = strings.ReplaceAll(input, " | ", "|")
 	input = strings.ReplaceAll(input, " <> ", "<>")
+	input = strings.ReplaceAll(input, " >> ", ">>")
+	input = strings.ReplaceAll(input, " << ", "<<")
 
 	// Add spaces around parentheses that are not escaped
 	result := make([]rune, 0, len(input)*2)
@@ -190,26 +204,72 @@ func (p *GrammarParser) ParseMapping(input string) (*MappingResult, error) {
 		return nil, fmt.Errorf("expected mapping rule, got token expression")
 	}
 
-	upper, err := p.parseExpr(grammar.Mapping.Upper.Expr)
+	if grammar.Mapping.Upper.Expr == nil && grammar.Mapping.Lower.Expr == nil {
+		return nil, fmt.Errorf("invalid mapping rule: both sides are empty")
+	}
+
+	upper, err := p.parseOptionalExpr(grammar.Mapping.Upper.Expr)
 	if err != nil {
 		return nil, err
 	}
 
-	lower, err := p.parseExpr(grammar.Mapping.Lower.Expr)
+	lower, err := p.parseOptionalExpr(grammar.Mapping.Lower.Expr)
 	if err != nil {
 		return nil, err
 	}
 
 	return &MappingResult{
-		Upper: &ast.Token{Wrap: upper},
-		Lower: &ast.Token{Wrap: lower},
+		Upper:     &ast.Token{Wrap: upper},
+		Lower:     &ast.Token{Wrap: lower},
+		Direction: ruleDirections[grammar.Mapping.Operator],
 	}, nil
 }
 
 // MappingResult represents the parsed mapping rule
 type MappingResult struct {
-	Upper *ast.Token
-	Lower *ast.Token
+	Upper     *ast.Token
+	Lower     *ast.Token
+	Direction RuleDirection
+}
+
+// RuleDirection restricts the directions a mapping rule applies in
+type RuleDirection int
+
+const (
+	// Bidirectional rules ("<>") apply in both directions
+	Bidirectional RuleDirection = iota
+	// AtoBOnly rules (">>") only apply from side A to side B
+	AtoBOnly
+	// BtoAOnly rules ("<<") only apply from side B to side A
+	BtoAOnly
+)
+
+// ruleDirections maps the rule operators to their direction
+var ruleDirections = map[string]RuleDirection{
+	"<>": Bidirectional,
+	">>": AtoBOnly,
+	"<<": BtoAOnly,
+}
+
+// Allows reports whether a rule with this direction applies in the given
+// direction, which is A to B if atob is true.
+func (d RuleDirection) Allows(atob bool) bool {
+	switch d {
+	case AtoBOnly:
+		return atob
+	case BtoAOnly:
+		return !atob
+	}
+	return true
+}
+
+// parseOptionalExpr builds the AST from the parsed Expr of a token
+// expression, which is nil for an empty token expression "[]"
+func (p *GrammarParser) parseOptionalExpr(expr *Expr) (ast.Node, error) {
+	if expr == nil {
+		return nil, nil
+	}
+	return p.parseExpr(expr)
 }
 
 // parseExpr builds the AST from the parsed Expr
@@ -323,49 +383,70 @@ func unescapeString(s string) string {
 
 // parseSimpleTerm converts a SimpleTerm into an AST Term node
 func (p *GrammarParser) parseSimpleTerm(term *SimpleTerm) (ast.Node, error) {
-	var foundry, layer, key, value string
+	var foundry, layer, key, value, match string
+	var regex bool
 
 	switch {
 	case term.WithFoundryLayer != nil:
 		foundry = unescapeString(term.WithFoundryLayer.Foundry)
 		layer = unescapeString(term.WithFoundryLayer.Layer)
-		key = unescapeString(term.WithFoundryLayer.Key)
+		key, regex = parseKey(term.WithFoundryLayer.Key)
 		value = unescapeString(term.WithFoundryLayer.Value)
+		match = term.WithFoundryLayer.Match
 	case term.WithFoundryWildcard != nil:
 		foundry = unescapeString(term.WithFoundryWildcard.Foundry)
-		key = unescapeString(term.WithFoundryWildcard.Key)
+		key, regex = parseKey(term.WithFoundryWildcard.Key)
+		value = unescapeString(term.WithFoundryWildcard.Value)
+		match = term.WithFoundryWildcard.Match
 	case term.WithFoundryKey != nil:
 		foundry = unescapeString(term.WithFoundryKey.Foundry)
-		key = unescapeString(term.WithFoundryKey.Key)
+		key, regex = parseKey(term.WithFoundryKey.Key)
+		value = unescapeString(term.WithFoundryKey.Value)
+		match = term.WithFoundryKey.Match
 	case term.WithLayer != nil:
 		// Special case: if LayerTerm was parsed but the layer doesn't match the default layer,
 		// treat it as a key=value pattern instead
 		parsedLayer := unescapeString(term.WithLayer.Layer)
-		parsedKey := unescapeString(term.WithLayer.Key)
+		parsedKey, parsedRegex := parseKey(term.WithLayer.Key)
 		parsedValue := unescapeString(term.WithLayer.Value)
 
 		if p.defaultLayer != "" && parsedLayer == p.defaultLayer {
 			// This is a genuine layer=key pattern when the layer matches the default
 			layer = parsedLayer
-			key = parsedKey
+			key, regex = parsedKey, parsedRegex
 			value = parsedValue
+			match = term.WithLayer.Match
 		} else if p.defaultLayer != "" && parsedLayer != p.defaultLayer {
 			// This should be treated as key=value pattern when there's a default layer but it doesn't match
+			if parsedRegex {
+				return nil, fmt.Errorf("invalid term: regular expressions are only supported for keys, got value %q", parsedKey)
+			}
 			key = parsedLayer
 			value = parsedKey
+			if term.WithLayer.Match != "" {
+				return nil, fmt.Errorf("invalid term: unexpected %q after match type", term.WithLayer.Match)
+			}
+			match = term.WithLayer.Value
 		} else {
 			// No default layer context, treat as genuine layer=key pattern
 			layer = parsedLayer
-			key = parsedKey
+			key, regex = parsedKey, parsedRegex
 			value = parsedValue
+			match = term.WithLayer.Match
 		}
 	case term.SimpleKey != nil:
-		key = unescapeString(term.SimpleKey.Key)
+		key, regex = parseKey(term.SimpleKey.Key)
 		value = unescapeString(term.SimpleKey.Value)
+		match = term.SimpleKey.Match
 	default:
 		return nil, fmt.Errorf("invalid term: no valid form found")
 	}
 
+	value, matchType, err := splitMatchType(value, match)
+	if err != nil {
+		return nil, err
+	}
+
 	if foundry == "" {
 		foundry = p.defaultFoundry
 	}
@@ -373,11 +454,54 @@ func (p *GrammarParser) parseSimpleTerm(term *SimpleTerm) (ast.Node, error) {
 		layer = p.defaultLayer
 	}
 
-	return &ast.Term{
+	result := &ast.Term{
 		Foundry: foundry,
 		Key:     key,
 		Layer:   layer,
-		Match:   ast.MatchEqual,
+		Match:   matchType,
 		Value:   value,
-	}, nil
+		Regex:   regex,
+	}
+	if regex {
+		// Compile the key once with the rule, anchored like corpus regexes
+		re, err := regexp.Compile("^(?:" + key + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid term: invalid regular expression %q: %w", key, err)
+		}
+		result.KeyRegexp = re
+	}
+	return result, nil
+}
+
+// regexSuffix marks a key of a rule as regular expression, as in
+// [opennlp/p=NN.*#regex].
+const regexSuffix = "#regex"
+
+// parseKey returns the key of a term and whether it is a regular
+// expression. Escapes are kept in regular expressions, so \. still
+// matches a literal dot.
+func parseKey(raw string) (string, bool) {
+	if pattern, ok := strings.CutSuffix(raw, regexSuffix); ok {
+		return pattern, true
+	}
+	return unescapeString(raw), false
+}
+
+// splitMatchType resolves the match type of a term. An explicit trailing
+// match token must be eq or ne. Without one, a value that is itself a
+// known match token is taken as the match type instead, so both
+// layer=key:ne and layer=key:value:ne are supported.
+func splitMatchType(value, match string) (string, ast.MatchType, error) {
+	if match != "" {
+		switch ast.MatchType(match) {
+		case ast.MatchEqual, ast.MatchNotEqual:
+			return value, ast.MatchType(match), nil
+		}
+		return "", "", fmt.Errorf("invalid term: unknown match type %q", match)
+	}
+	switch ast.MatchType(value) {
+	case ast.MatchEqual, ast.MatchNotEqual:
+		return "", ast.MatchType(value), nil
+	}
+	return value, ast.MatchEqual, nil
 }
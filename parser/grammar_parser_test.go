@@ -374,6 +374,96 @@ func TestMappingRules(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "Replacement with explicit match type",
+			input: "[gender:masc] <> [case=nom:ne]",
+			expected: &MappingResult{
+				Upper: &ast.Token{
+					Wrap: &ast.Term{
+						Key:   "gender",
+						Value: "masc",
+						Match: ast.MatchEqual,
+					},
+				},
+				Lower: &ast.Token{
+					Wrap: &ast.Term{
+						Layer: "case",
+						Key:   "nom",
+						Match: ast.MatchNotEqual,
+					},
+				},
+			},
+		},
+		{
+			name:  "Match type after layer:value",
+			input: "[opennlp/p=DET:Def:eq] <> [case=nom:x:ne]",
+			expected: &MappingResult{
+				Upper: &ast.Token{
+					Wrap: &ast.Term{
+						Foundry: "opennlp",
+						Layer:   "p",
+						Key:     "DET",
+						Value:   "Def",
+						Match:   ast.MatchEqual,
+					},
+				},
+				Lower: &ast.Token{
+					Wrap: &ast.Term{
+						Layer: "case",
+						Key:   "nom",
+						Value: "x",
+						Match: ast.MatchNotEqual,
+					},
+				},
+			},
+		},
+		{
+			name:    "Unknown match type",
+			input:   "[DET] <> [case=nom:x:geq]",
+			wantErr: true,
+		},
+		{
+			name:  "Values with foundry/key and foundry wildcard",
+			input: "[opennlp/Number:Plur] <> [upos/*=Number:Plur:ne]",
+			expected: &MappingResult{
+				Upper: &ast.Token{
+					Wrap: &ast.Term{
+						Foundry: "opennlp",
+						Key:     "Number",
+						Value:   "Plur",
+						Match:   ast.MatchEqual,
+					},
+				},
+				Lower: &ast.Token{
+					Wrap: &ast.Term{
+						Foundry: "upos",
+						Key:     "Number",
+						Value:   "Plur",
+						Match:   ast.MatchNotEqual,
+					},
+				},
+			},
+		},
+		{
+			name:  "Deletion rule with empty replacement",
+			input: "[opennlp/p=XY] <> []",
+			expected: &MappingResult{
+				Upper: &ast.Token{
+					Wrap: &ast.Term{
+						Foundry: "opennlp",
+						Layer:   "p",
+						Key:     "XY",
+						Match:   ast.MatchEqual,
+					},
+				},
+				Lower: &ast.Token{},
+			},
+		},
+		{
+			name:    "Both sides empty",
+			input:   "[] <> []",
+			wantErr: true,
+		},
 		{
 			name:    "Invalid mapping syntax",
 			input:   "[PAV] -> [ADV]",
@@ -401,3 +491,94 @@ func TestMappingRules(t *testing.T) {
 		})
 	}
 }
+
+func TestMappingRuleDirections(t *testing.T) {
+	parser, err := NewGrammarParser("", "")
+	require.NoError(t, err)
+
+	tests := []struct {
+		input     string
+		direction RuleDirection
+		atob      bool
+		btoa      bool
+	}{
+		{"[A] <> [B]", Bidirectional, true, true},
+		{"[A] >> [B]", AtoBOnly, true, false},
+		{"[A] << [B]", BtoAOnly, false, true},
+		{"[A]>>[B & C]", AtoBOnly, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := parser.ParseMapping(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.direction, result.Direction)
+			assert.Equal(t, tt.atob, result.Direction.Allows(true))
+			assert.Equal(t, tt.btoa, result.Direction.Allows(false))
+			assert.Equal(t, "A", result.Upper.Wrap.(*ast.Term).Key)
+		})
+	}
+
+	_, err = parser.ParseMapping("[A] <>> [B]")
+	assert.Error(t, err)
+}
+
+func TestMappingRulesMatchTypeWithDefaultLayer(t *testing.T) {
+	parser, err := NewGrammarParser("upos", "p")
+	require.NoError(t, err)
+
+	// case=nom is read as key=value because "case" is not the default
+	// layer; the trailing token is still taken as the match type
+	result, err := parser.ParseMapping("[DET] <> [case=nom:ne]")
+	require.NoError(t, err)
+	assert.Equal(t, &ast.Term{
+		Foundry: "upos",
+		Layer:   "p",
+		Key:     "case",
+		Value:   "nom",
+		Match:   ast.MatchNotEqual,
+	}, result.Lower.Wrap)
+
+	_, err = parser.ParseMapping("[DET] <> [case=nom:ne:eq]")
+	assert.Error(t, err)
+}
+
+func TestMappingRulesRegexKeys(t *testing.T) {
+	parser, err := NewGrammarParser("opennlp", "p")
+	require.NoError(t, err)
+
+	for input, key := range map[string]string{
+		"[opennlp/p=NN.*#regex] <> [NOUN]": "NN.*",
+		"[NN.*#regex] <> [NOUN]":           "NN.*",
+		"[p=NN.*#regex] <> [NOUN]":         "NN.*",
+		"[opennlp/NN.*#regex] <> [NOUN]":   "NN.*",
+		"[opennlp/*=V.+#regex] <> [VERB]":  "V.+",
+		`[N\.E?#regex] <> [NOUN]`:          `N\.E?`,
+	} {
+		result, err := parser.ParseMapping(input)
+		require.NoError(t, err, input)
+		term := result.Upper.Wrap.(*ast.Term)
+		assert.Equal(t, key, term.Key, input)
+		assert.True(t, term.Regex, input)
+		require.NotNil(t, term.KeyRegexp, input)
+		assert.False(t, result.Lower.Wrap.(*ast.Term).Regex, input)
+	}
+
+	// The compiled key is anchored at both ends
+	result, err := parser.ParseMapping("[NN.*#regex & AdjType:Pdt] <> [NOUN]")
+	require.NoError(t, err)
+	term := result.Upper.Wrap.(*ast.TermGroup).Operands[0].(*ast.Term)
+	assert.True(t, term.MatchesKey("NN"))
+	assert.True(t, term.MatchesKey("NNS"))
+	assert.False(t, term.MatchesKey("ANN"))
+	assert.False(t, term.MatchesKey("NE"))
+	assert.False(t, result.Upper.Wrap.(*ast.TermGroup).Operands[1].(*ast.Term).Regex)
+
+	_, err = parser.ParseMapping("[+NN#regex] <> [NOUN]")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid regular expression "+NN"`)
+
+	_, err = parser.ParseMapping("[pos=NN.*#regex] <> [NOUN]")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "regular expressions are only supported for keys")
+}
@@ -6,6 +6,7 @@ package parser
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
 
 	"maps"
@@ -139,8 +140,26 @@ func (r rawNode) MarshalJSON() ([]byte, error) {
 	return json.Marshal(raw)
 }
 
-// ParseJSON parses a JSON string into our AST representation
+// DefaultMaxDepth bounds the nesting of objects and arrays in the JSON
+// given to ParseJSON.
+const DefaultMaxDepth = 256
+
+// ParseJSON parses a JSON string into our AST representation, nested at
+// most DefaultMaxDepth levels deep
 func ParseJSON(data []byte) (ast.Node, error) {
+	return ParseJSONWithMaxDepth(data, DefaultMaxDepth)
+}
+
+// ParseJSONWithMaxDepth is like ParseJSON, but fails if objects and
+// arrays are nested more than maxDepth levels deep. Zero or less means
+// DefaultMaxDepth.
+func ParseJSONWithMaxDepth(data []byte, maxDepth int) (ast.Node, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if err := CheckJSONDepth(data, maxDepth); err != nil {
+		return nil, err
+	}
 	var raw rawNode
 	if err := json.Unmarshal(data, &raw); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
@@ -151,10 +170,72 @@ func ParseJSON(data []byte) (ast.Node, error) {
 	return parseNode(raw)
 }
 
+// CheckJSONDepth fails if objects and arrays in data are nested more
+// than maxDepth levels deep. It only counts brackets outside of strings
+// and leaves the validation of the JSON to the decoder, so it can run
+// before the recursive decoding.
+func CheckJSONDepth(data []byte, maxDepth int) error {
+	depth := 0
+	inString, escaped := false, false
+	for _, b := range data {
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if b == '\\' {
+				escaped = true
+			} else if b == '"' {
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("JSON exceeds the maximum nesting depth of %d", maxDepth)
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return nil
+}
+
+// regexTermType is the "type" of a koral:term whose key is a regular
+// expression.
+const regexTermType = "type:regex"
+
+// tokenExtra returns the unknown fields of a raw token, or nil if there
+// are none. The "type" of a shorthand token belongs to its term.
+func tokenExtra(raw rawNode) map[string]any {
+	extra := raw.Extra
+	if raw.Wrap == nil {
+		if _, ok := extra["type"]; ok {
+			extra = maps.Clone(extra)
+			delete(extra, "type")
+		}
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
 // parseNode converts a raw node into an AST node
 func parseNode(raw rawNode) (ast.Node, error) {
 	switch raw.Type {
 	case "koral:token":
+		if raw.Wrap == nil && raw.Key != "" {
+			// Shorthand: the term attributes are given on the token
+			termRaw := raw
+			termRaw.Type = "koral:term"
+			termRaw.Rewrites = nil
+			term, err := parseNode(termRaw)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing shorthand token: %w", err)
+			}
+			return &ast.Token{Wrap: term, Rewrites: raw.Rewrites, Shorthand: true, Extra: tokenExtra(raw)}, nil
+		}
 		if raw.Wrap == nil {
 			return nil, fmt.Errorf("token node of type '%s' missing required 'wrap' field", raw.Type)
 		}
@@ -166,7 +247,7 @@ func parseNode(raw rawNode) (ast.Node, error) {
 		if err != nil {
 			return nil, fmt.Errorf("error parsing wrapped node: %w", err)
 		}
-		return &ast.Token{Wrap: wrap, Rewrites: raw.Rewrites}, nil
+		return &ast.Token{Wrap: wrap, Rewrites: raw.Rewrites, Extra: tokenExtra(raw)}, nil
 
 	case "koral:termGroup":
 		if len(raw.Operands) == 0 {
@@ -186,12 +267,9 @@ func parseNode(raw rawNode) (ast.Node, error) {
 			return nil, fmt.Errorf("term group must have a 'relation' field")
 		}
 
-		relation := ast.AndRelation
-		if strings.HasSuffix(raw.Relation, "or") {
-			relation = ast.OrRelation
-		} else if !strings.HasSuffix(raw.Relation, "and") {
-			return nil, fmt.Errorf("invalid relation type '%s', must be one of: 'relation:and', 'relation:or'", raw.Relation)
-		}
+		// Relations other than and/or are preserved, so upcoming
+		// relations pass through the mapper unchanged
+		relation := ast.RelationType(strings.TrimPrefix(raw.Relation, "relation:"))
 
 		return &ast.TermGroup{
 			Operands: operands,
@@ -220,6 +298,7 @@ func parseNode(raw rawNode) (ast.Node, error) {
 			Match:    match,
 			Value:    raw.Value,
 			Rewrites: raw.Rewrites,
+			Regex:    raw.Extra["type"] == regexTermType,
 		}, nil
 
 	default:
@@ -271,6 +350,14 @@ func SerializeToJSON(node ast.Node) ([]byte, error) {
 	return json.MarshalIndent(nodeToRaw(node), "", "  ")
 }
 
+// SerializeToJSONCompact converts an AST node to canonical JSON without
+// whitespace. All objects are marshaled from maps, so keys are sorted at
+// every level and equal ASTs serialize to identical bytes, which makes
+// the output suitable for hashing and diffing.
+func SerializeToJSONCompact(node ast.Node) ([]byte, error) {
+	return json.Marshal(nodeToRaw(node))
+}
+
 // nodeToRaw converts an AST node to a raw node for JSON serialization
 func nodeToRaw(node ast.Node) rawNode {
 	switch n := node.(type) {
@@ -279,12 +366,27 @@ func nodeToRaw(node ast.Node) rawNode {
 			return rawNode{
 				Type:     "koral:token",
 				Rewrites: n.Rewrites,
+				Extra:    n.Extra,
 			}
 		}
+		if term, ok := n.Wrap.(*ast.Term); ok && n.Shorthand {
+			// Serialize back to the shorthand with the term attributes
+			// on the token
+			raw := nodeToRaw(term)
+			raw.Type = "koral:token"
+			raw.Rewrites = append(slices.Clone(n.Rewrites), term.Rewrites...)
+			if len(n.Extra) > 0 {
+				extra := maps.Clone(n.Extra)
+				maps.Copy(extra, raw.Extra)
+				raw.Extra = extra
+			}
+			return raw
+		}
 		return rawNode{
 			Type:     "koral:token",
 			Wrap:     json.RawMessage(nodeToRaw(n.Wrap).toJSON()),
 			Rewrites: n.Rewrites,
+			Extra:    n.Extra,
 		}
 
 	case *ast.TermGroup:
@@ -315,6 +417,9 @@ func nodeToRaw(node ast.Node) rawNode {
 		if n.Value != "" {
 			raw.Value = n.Value
 		}
+		if n.Regex {
+			raw.Extra = map[string]any{"type": regexTermType}
+		}
 		return raw
 
 	case *ast.CatchallNode:
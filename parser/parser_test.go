@@ -2,6 +2,7 @@ package parser
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/KorAP/Koral-Mapper/ast"
@@ -537,23 +538,6 @@ func TestParseJSONErrors(t *testing.T) {
 			}`,
 			wantErr: true,
 		},
-		{
-			name: "Invalid relation type",
-			input: `{
-				"@type": "koral:termGroup",
-				"operands": [
-					{
-						"@type": "koral:term",
-						"key": "DET",
-						"foundry": "opennlp",
-						"layer": "p",
-						"match": "match:eq"
-					}
-				],
-				"relation": "relation:invalid"
-			}`,
-			wantErr: true,
-		},
 	}
 
 	for _, tt := range tests {
@@ -568,6 +552,31 @@ func TestParseJSONErrors(t *testing.T) {
 	}
 }
 
+func TestParseJSONMaxDepth(t *testing.T) {
+	// nested builds a koral:group with depth nested operands around a term
+	nested := func(depth int) []byte {
+		open := strings.Repeat(`{"@type":"koral:group","operation":"operation:sequence","operands":[`, depth)
+		term := `{"@type":"koral:token","wrap":{"@type":"koral:term","key":"NN"}}`
+		return []byte(open + term + strings.Repeat("]}", depth))
+	}
+
+	// Each group nests an object and an array, the token two objects
+	_, err := ParseJSONWithMaxDepth(nested(10), 22)
+	require.NoError(t, err)
+
+	_, err = ParseJSONWithMaxDepth(nested(10), 21)
+	require.Error(t, err)
+	assert.Equal(t, "JSON exceeds the maximum nesting depth of 21", err.Error())
+
+	_, err = ParseJSON(nested(DefaultMaxDepth))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "maximum nesting depth of 256")
+
+	// Brackets in strings do not count
+	_, err = ParseJSONWithMaxDepth([]byte(`{"@type":"koral:term","key":"[[[{{\\\"[["}`), 1)
+	require.NoError(t, err)
+}
+
 func TestSerializeToJSON(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -672,6 +681,63 @@ func TestSerializeToJSON(t *testing.T) {
 	}
 }
 
+func TestSerializeToJSONCompact(t *testing.T) {
+	// Built from JSON with unsorted keys, whitespace and extra fields
+	parsed, err := ParseJSON([]byte(`{
+		"wrap": {
+			"relation": "relation:and",
+			"operands": [
+				{"match": "match:eq", "layer": "p", "key": "DET", "foundry": "opennlp", "@type": "koral:term"},
+				{"value": "Pdt", "@type": "koral:term", "key": "AdjType", "layer": "m", "foundry": "opennlp"}
+			],
+			"@type": "koral:termGroup"
+		},
+		"@type": "koral:token"
+	}`))
+	require.NoError(t, err)
+
+	// Built directly as AST
+	built := &ast.Token{
+		Wrap: &ast.TermGroup{
+			Operands: []ast.Node{
+				&ast.Term{Foundry: "opennlp", Key: "DET", Layer: "p", Match: ast.MatchEqual},
+				&ast.Term{Foundry: "opennlp", Key: "AdjType", Layer: "m", Match: ast.MatchEqual, Value: "Pdt"},
+			},
+			Relation: ast.AndRelation,
+		},
+	}
+
+	parsedBytes, err := SerializeToJSONCompact(parsed)
+	require.NoError(t, err)
+	builtBytes, err := SerializeToJSONCompact(built)
+	require.NoError(t, err)
+
+	expected := `{"@type":"koral:token","wrap":{"@type":"koral:termGroup","operands":[` +
+		`{"@type":"koral:term","foundry":"opennlp","key":"DET","layer":"p","match":"match:eq"},` +
+		`{"@type":"koral:term","foundry":"opennlp","key":"AdjType","layer":"m","match":"match:eq","value":"Pdt"}],` +
+		`"relation":"relation:and"}}`
+	assert.Equal(t, expected, string(parsedBytes))
+	assert.Equal(t, parsedBytes, builtBytes)
+
+	// Unknown nodes keep their extra fields in sorted order
+	first, err := ParseJSON([]byte(`{"@type": "koral:span", "zeta": 1, "alpha": {"b": true, "a": false}}`))
+	require.NoError(t, err)
+	second, err := ParseJSON([]byte(`{"alpha": {"a": false, "b": true}, "zeta": 1, "@type": "koral:span"}`))
+	require.NoError(t, err)
+
+	firstBytes, err := SerializeToJSONCompact(first)
+	require.NoError(t, err)
+	secondBytes, err := SerializeToJSONCompact(second)
+	require.NoError(t, err)
+	assert.Equal(t, `{"@type":"koral:span","alpha":{"a":false,"b":true},"zeta":1}`, string(firstBytes))
+	assert.Equal(t, firstBytes, secondBytes)
+
+	// Compact output round-trips to the same AST
+	reparsed, err := ParseJSON(parsedBytes)
+	require.NoError(t, err)
+	compareNodes(t, built, reparsed)
+}
+
 func TestRoundTrip(t *testing.T) {
 	// Test that parsing and then serializing produces equivalent JSON
 	input := `{
@@ -716,6 +782,102 @@ func TestRoundTrip(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestRoundTripTokenExtraFields(t *testing.T) {
+	for _, input := range []string{
+		`{
+			"@type": "koral:token",
+			"wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq"},
+			"annotation": {"source": "user", "weight": 2}
+		}`,
+		// Shorthand tokens keep their extra fields, too
+		`{"@type": "koral:token", "foundry": "opennlp", "key": "DET", "layer": "p", "match": "match:eq", "comment": "det"}`,
+	} {
+		node, err := ParseJSON([]byte(input))
+		require.NoError(t, err)
+
+		output, err := SerializeToJSON(node)
+		require.NoError(t, err)
+
+		var expected, actual any
+		require.NoError(t, json.Unmarshal([]byte(input), &expected))
+		require.NoError(t, json.Unmarshal(output, &actual))
+		assert.Equal(t, expected, actual)
+
+		// Clones serialize the same
+		output, err = SerializeToJSON(node.Clone())
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(output, &actual))
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestRoundTripRegexTerm(t *testing.T) {
+	for _, input := range []string{
+		`{"@type": "koral:token", "wrap": {"@type": "koral:term", "foundry": "opennlp", "key": "NN.*", "layer": "p", "match": "match:eq", "type": "type:regex"}}`,
+		`{"@type": "koral:token", "foundry": "opennlp", "key": "NN.*", "layer": "p", "match": "match:eq", "type": "type:regex", "comment": "noun"}`,
+	} {
+		node, err := ParseJSON([]byte(input))
+		require.NoError(t, err)
+		term := node.(*ast.Token).Wrap.(*ast.Term)
+		assert.True(t, term.Regex)
+		assert.Nil(t, term.KeyRegexp)
+
+		output, err := SerializeToJSON(node)
+		require.NoError(t, err)
+
+		var expected, actual any
+		require.NoError(t, json.Unmarshal([]byte(input), &expected))
+		require.NoError(t, json.Unmarshal(output, &actual))
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestRoundTripUnknownRelation(t *testing.T) {
+	input := `{
+		"@type": "koral:token",
+		"wrap": {
+			"@type": "koral:termGroup",
+			"operands": [
+				{
+					"@type": "koral:term",
+					"foundry": "opennlp",
+					"key": "DET",
+					"layer": "p",
+					"match": "match:eq"
+				},
+				{
+					"@type": "koral:term",
+					"foundry": "opennlp",
+					"key": "PIDAT",
+					"layer": "p",
+					"match": "match:eq"
+				}
+			],
+			"relation": "relation:xor"
+		}
+	}`
+
+	node, err := ParseJSON([]byte(input))
+	require.NoError(t, err)
+
+	token, ok := node.(*ast.Token)
+	require.True(t, ok)
+	group, ok := token.Wrap.(*ast.TermGroup)
+	require.True(t, ok)
+	assert.Equal(t, ast.RelationType("xor"), group.Relation)
+	require.Len(t, group.Operands, 2)
+
+	output, err := SerializeToJSON(node)
+	require.NoError(t, err)
+
+	var expected, actual any
+	err = json.Unmarshal([]byte(input), &expected)
+	require.NoError(t, err)
+	err = json.Unmarshal(output, &actual)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
 func TestRoundTripUnknownType(t *testing.T) {
 	// Test that parsing and then serializing an unknown node type preserves the structure
 	input := `{
@@ -766,6 +928,60 @@ func TestRoundTripUnknownType(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestRoundTripGroupWithTokens(t *testing.T) {
+	input := `{
+		"@type": "koral:group",
+		"operation": "operation:sequence",
+		"operands": [
+			{
+				"@type": "koral:token",
+				"wrap": {
+					"@type": "koral:term",
+					"foundry": "opennlp",
+					"key": "PIDAT",
+					"layer": "p",
+					"match": "match:eq"
+				}
+			},
+			{
+				"@type": "koral:token",
+				"wrap": {
+					"@type": "koral:term",
+					"foundry": "opennlp",
+					"key": "NN",
+					"layer": "p",
+					"match": "match:eq"
+				}
+			}
+		]
+	}`
+
+	node, err := ParseJSON([]byte(input))
+	require.NoError(t, err)
+
+	// The group is kept as a CatchallNode whose operands are parsed tokens
+	catchall, ok := node.(*ast.CatchallNode)
+	require.True(t, ok)
+	assert.Equal(t, "koral:group", catchall.NodeType)
+	require.Len(t, catchall.Operands, 2)
+	for _, op := range catchall.Operands {
+		token, ok := op.(*ast.Token)
+		require.True(t, ok)
+		_, ok = token.Wrap.(*ast.Term)
+		assert.True(t, ok)
+	}
+
+	output, err := SerializeToJSON(node)
+	require.NoError(t, err)
+
+	var expected, actual any
+	err = json.Unmarshal([]byte(input), &expected)
+	require.NoError(t, err)
+	err = json.Unmarshal(output, &actual)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
 func TestParseJSONEdgeCases(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -997,3 +1213,45 @@ func TestParseJSONEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenShorthand(t *testing.T) {
+	input := `{
+		"@type": "koral:token",
+		"foundry": "opennlp",
+		"key": "DET",
+		"layer": "p",
+		"match": "match:eq"
+	}`
+
+	node, err := ParseJSON([]byte(input))
+	require.NoError(t, err)
+
+	token, ok := node.(*ast.Token)
+	require.True(t, ok)
+	assert.True(t, token.Shorthand)
+	assert.Equal(t, &ast.Term{Foundry: "opennlp", Key: "DET", Layer: "p", Match: ast.MatchEqual}, token.Wrap)
+
+	// Serializes back to the shorthand
+	output, err := SerializeToJSON(node)
+	require.NoError(t, err)
+	assert.JSONEq(t, input, string(output))
+
+	// Falls back to a wrap once the token no longer holds a single term
+	token.Wrap = &ast.TermGroup{
+		Operands: []ast.Node{
+			&ast.Term{Foundry: "upos", Key: "DET", Layer: "p", Match: ast.MatchEqual},
+			&ast.Term{Foundry: "upos", Key: "PronType", Layer: "p", Match: ast.MatchEqual, Value: "Dem"},
+		},
+		Relation: ast.AndRelation,
+	}
+	output, err = SerializeToJSON(node)
+	require.NoError(t, err)
+	var result map[string]any
+	require.NoError(t, json.Unmarshal(output, &result))
+	assert.Nil(t, result["key"])
+	assert.Equal(t, "koral:termGroup", result["wrap"].(map[string]any)["@type"])
+
+	// A token with neither wrap nor key is still invalid
+	_, err = ParseJSON([]byte(`{"@type": "koral:token", "foundry": "opennlp"}`))
+	assert.Error(t, err)
+}
@@ -58,6 +58,12 @@ func (p *TitleAttributeParser) parseTitleAttribute(title string) (*TitleAttribut
 	}, nil
 }
 
+// IsAnnotation reports whether s has the format of an annotation,
+// "foundry/layer:key" or "foundry/layer:key:value"
+func (p *TitleAttributeParser) IsAnnotation(s string) bool {
+	return p.regex.MatchString(s)
+}
+
 // ParseTitleAttributesToTerms converts title attributes to AST Term nodes
 func (p *TitleAttributeParser) ParseTitleAttributesToTerms(titles []string) ([]ast.Node, error) {
 	terms := make([]ast.Node, 0) // Initialize as empty slice instead of nil